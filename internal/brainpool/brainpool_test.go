@@ -0,0 +1,71 @@
+package brainpool
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurves(t *testing.T) {
+	for _, c := range []elliptic.Curve{P256r1(), P384r1(), P512r1()} {
+		c := c
+		t.Run(c.Params().Name, func(t *testing.T) {
+			params := c.Params()
+			if !assert.True(t, c.IsOnCurve(params.Gx, params.Gy), `base point should be on the curve`) {
+				return
+			}
+
+			x, y := c.ScalarBaseMult(params.N.Bytes())
+			if !assert.True(t, x.Sign() == 0 && y.Sign() == 0, `N*G should be the point at infinity`) {
+				return
+			}
+
+			// 2G + G == 3G
+			x2, y2 := c.Double(params.Gx, params.Gy)
+			x3, y3 := c.Add(x2, y2, params.Gx, params.Gy)
+			ex3, ey3 := c.ScalarBaseMult([]byte{3})
+			if !assert.Equal(t, ex3, x3, `x coordinates should match`) {
+				return
+			}
+			if !assert.Equal(t, ey3, y3, `y coordinates should match`) {
+				return
+			}
+			if !assert.True(t, c.IsOnCurve(x3, y3), `3G should be on the curve`) {
+				return
+			}
+
+			if !assert.False(t, c.IsOnCurve(params.Gx, new(big.Int).Add(params.Gy, big.NewInt(1))), `modified point should not be on the curve`) {
+				return
+			}
+		})
+	}
+}
+
+func TestECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(P256r1(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	if !assert.True(t, key.Curve.IsOnCurve(key.X, key.Y), `public key should be on the curve`) {
+		return
+	}
+
+	digest := sha256.Sum256([]byte("Hello, World!"))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if !assert.NoError(t, err, `ecdsa.Sign should succeed`) {
+		return
+	}
+	if !assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:], r, s), `ecdsa.Verify should succeed`) {
+		return
+	}
+
+	digest[0] ^= 0xff
+	if !assert.False(t, ecdsa.Verify(&key.PublicKey, digest[:], r, s), `ecdsa.Verify with modified digest should fail`) {
+		return
+	}
+}
@@ -0,0 +1,268 @@
+// Package jcs implements the JSON Canonicalization Scheme (JCS) as
+// described in https://tools.ietf.org/html/rfc8785
+package jcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Transform takes a JSON document and returns its canonical form.
+//
+// As RFC8785 requires the input to conform to I-JSON (RFC7493), documents
+// that are not valid UTF-8, that contain escaped unpaired surrogates, or
+// that contain objects with duplicate member names are rejected.
+func Transform(src []byte) ([]byte, error) {
+	if !utf8.Valid(src) {
+		return nil, errors.New(`invalid UTF-8 in JSON`)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to decode JSON`)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New(`extra data after JSON value`)
+	}
+
+	// encoding/json silently replaces unpaired surrogates with U+FFFD,
+	// so they need to be looked for in the source
+	if err := checkSurrogates(src); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeValue decodes the next JSON value from dec in the same form as
+// json.Unmarshal into an interface{} does, except that objects with
+// duplicate member names are rejected
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+	case json.Delim('{'):
+		m := map[string]interface{}{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := tok.(string)
+			if !ok {
+				return nil, errors.Errorf(`invalid member name %v`, tok)
+			}
+			if _, ok := m[name]; ok {
+				return nil, errors.Errorf(`duplicate member name %q`, name)
+			}
+
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			m[name] = v
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return tok, nil
+	}
+}
+
+// checkSurrogates reports an error if src, which must be valid JSON,
+// contains an escaped surrogate that is not part of a surrogate pair
+func checkSurrogates(src []byte) error {
+	// In valid JSON, backslashes only appear in escape sequences
+	// within strings
+	pending := false // previous character was an escaped high surrogate
+	for i := 0; i < len(src); i++ {
+		var r uint64 // the escaped code unit, if this is a \u escape
+		if src[i] == '\\' {
+			i++
+			if src[i] == 'u' {
+				v, err := strconv.ParseUint(string(src[i+1:i+5]), 16, 16)
+				if err != nil {
+					return errors.Wrap(err, `invalid unicode escape`)
+				}
+				r = v
+				i += 4
+			}
+		}
+
+		if low := r >= 0xDC00 && r < 0xE000; low != pending {
+			return errors.New(`unpaired surrogate in JSON string`)
+		}
+		pending = r >= 0xD800 && r < 0xDC00
+	}
+	return nil
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteString(`null`)
+	case bool:
+		if x {
+			buf.WriteString(`true`)
+		} else {
+			buf.WriteString(`false`)
+		}
+	case json.Number:
+		f, err := x.Float64()
+		if err != nil {
+			return errors.Wrapf(err, `failed to parse number %s`, x)
+		}
+		s, err := formatNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case string:
+		encodeString(buf, x)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range x {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		// Members are sorted by their names, compared as arrays
+		// of UTF-16 code units
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encodeString(buf, k)
+			buf.WriteByte(':')
+			if err := encode(buf, x[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return errors.Errorf(`unsupported type %T`, v)
+	}
+	return nil
+}
+
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// formatNumber formats the number in the same way as ECMAScript's
+// Number.prototype.toString() (RFC8785 Section 3.2.2.3)
+func formatNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", errors.Errorf(`invalid number %v`, f)
+	}
+
+	if f == 0 {
+		return `0`, nil
+	}
+
+	var sign string
+	if f < 0 {
+		f = -f
+		sign = `-`
+	}
+
+	format := byte('e')
+	if f < 1e21 && f >= 1e-6 {
+		format = 'f'
+	}
+
+	s := strconv.FormatFloat(f, format, -1, 64)
+	// Go emits exponents with at least two digits (e.g. "1e+09")
+	if i := strings.IndexByte(s, 'e'); i > 0 && s[i+2] == '0' {
+		s = s[:i+2] + s[i+3:]
+	}
+	return sign + s, nil
+}
+
+const hexdigits = "0123456789abcdef"
+
+func encodeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hexdigits[r>>4])
+				buf.WriteByte(hexdigits[r&0xF])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
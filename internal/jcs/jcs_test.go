@@ -0,0 +1,77 @@
+package jcs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransform(t *testing.T) {
+	testcases := []struct {
+		Name     string
+		Input    string
+		Expected string
+	}{
+		{
+			Name:     "whitespace and ordering",
+			Input:    "{ \"b\" : [ 1, true, null ],\n \"a\": \"x\" }",
+			Expected: `{"a":"x","b":[1,true,null]}`,
+		},
+		// https://tools.ietf.org/html/rfc8785#section-3.2.3
+		{
+			Name:     "UTF-16 ordering",
+			Input:    "{\"\\u20ac\":\"Euro Sign\",\"\\r\":\"Carriage Return\",\"\\ufb33\":\"Hebrew Letter Dalet With Dagesh\",\"1\":\"One\",\"\\ud83d\\ude00\":\"Emoji: Grinning Face\",\"\\u0080\":\"Control\",\"\\u00f6\":\"Latin Small Letter O With Diaeresis\"}",
+			Expected: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		// https://tools.ietf.org/html/rfc8785#section-3.2.2
+		{
+			Name:     "numbers",
+			Input:    `{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001,-0,1e21,1e-7]}`,
+			Expected: `{"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27,0,1e+21,1e-7]}`,
+		},
+		{
+			Name:     "string escapes",
+			Input:    `{"string":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/"}`,
+			Expected: `{"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			out, err := Transform([]byte(tc.Input))
+			if !assert.NoError(t, err, `Transform should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Expected, string(out), `output should match`) {
+				return
+			}
+		})
+	}
+
+	t.Run("invalid input", func(t *testing.T) {
+		testcases := []struct {
+			Name  string
+			Input string
+		}{
+			{Name: "invalid JSON", Input: `{"a":`},
+			{Name: "extra data", Input: `{"a":1}]\`},
+			{Name: "invalid UTF-8", Input: "{\"a\":\"\xff\"}"},
+			{Name: "unpaired high surrogate", Input: `{"a":"\ud83dx"}`},
+			{Name: "unpaired high surrogate at end of string", Input: `{"a":"\ud83d"}`},
+			{Name: "unpaired low surrogate", Input: `{"a":"\ude00"}`},
+			{Name: "duplicate member names", Input: `{"a":1,"b":2,"a":3}`},
+			{Name: "duplicate escaped member names", Input: `{"a":1,"\u0061":2}`},
+			{Name: "duplicate nested member names", Input: `{"a":[{"b":1,"b":1}]}`},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				_, err := Transform([]byte(tc.Input))
+				if !assert.Error(t, err, `Transform should fail`) {
+					return
+				}
+			})
+		}
+	})
+}
@@ -4,13 +4,30 @@ import (
 	"bytes"
 	"math/big"
 	"sync"
+	"sync/atomic"
 )
 
 var bytesBufferPool = sync.Pool{
 	New: allocBytesBuffer,
 }
 
+var bytesBufferInitialCapacity int64
+
+// SetBytesBufferInitialCapacity sets the initial capacity of
+// the buffers that are newly allocated by the bytes.Buffer pool.
+// Buffers that have already been allocated are not affected.
+// A value of 0 or less restores the default behavior.
+func SetBytesBufferInitialCapacity(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&bytesBufferInitialCapacity, int64(n))
+}
+
 func allocBytesBuffer() interface{} {
+	if n := atomic.LoadInt64(&bytesBufferInitialCapacity); n > 0 {
+		return bytes.NewBuffer(make([]byte, 0, n))
+	}
 	return &bytes.Buffer{}
 }
 
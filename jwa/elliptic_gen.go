@@ -8,11 +8,14 @@ import (
 	"github.com/pkg/errors"
 )
 
-//  EllipticCurveAlgorithm represents the algorithms used for EC keys
+// EllipticCurveAlgorithm represents the algorithms used for EC keys
 type EllipticCurveAlgorithm string
 
 // Supported values for EllipticCurveAlgorithm
 const (
+	BrainpoolP256r1      EllipticCurveAlgorithm = "brainpoolP256r1" // brainpoolP256r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry
+	BrainpoolP384r1      EllipticCurveAlgorithm = "brainpoolP384r1" // brainpoolP384r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry
+	BrainpoolP512r1      EllipticCurveAlgorithm = "brainpoolP512r1" // brainpoolP512r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry
 	InvalidEllipticCurve EllipticCurveAlgorithm = "P-invalid"
 	P256                 EllipticCurveAlgorithm = "P-256"
 	P384                 EllipticCurveAlgorithm = "P-384"
@@ -38,7 +41,7 @@ func (v *EllipticCurveAlgorithm) Accept(value interface{}) error {
 		tmp = EllipticCurveAlgorithm(s)
 	}
 	switch tmp {
-	case P256, P384, P521:
+	case BrainpoolP256r1, BrainpoolP384r1, BrainpoolP512r1, P256, P384, P521:
 	default:
 		return errors.Errorf(`invalid jwa.EllipticCurveAlgorithm value`)
 	}
@@ -0,0 +1,48 @@
+package jwa
+
+// AlgorithmFamily describes what an algorithm is used for
+type AlgorithmFamily int
+
+const (
+	// UnknownFamily is used for algorithms that are not known
+	UnknownFamily AlgorithmFamily = iota
+	// SignatureFamily is used for SignatureAlgorithm values
+	SignatureFamily
+	// KeyEncryptionFamily is used for KeyEncryptionAlgorithm values
+	KeyEncryptionFamily
+	// ContentEncryptionFamily is used for ContentEncryptionAlgorithm values
+	ContentEncryptionFamily
+)
+
+// String returns the string representation of an AlgorithmFamily
+func (f AlgorithmFamily) String() string {
+	switch f {
+	case SignatureFamily:
+		return "Signature"
+	case KeyEncryptionFamily:
+		return "KeyEncryption"
+	case ContentEncryptionFamily:
+		return "ContentEncryption"
+	default:
+		return "Unknown"
+	}
+}
+
+// FamilyOf returns the family of the algorithm with the given name, as
+// found in the "alg" or "enc" members of JOSE objects. Signature
+// algorithms registered via RegisterSignatureAlgorithm are recognized.
+func FamilyOf(name string) AlgorithmFamily {
+	var sig SignatureAlgorithm
+	if err := sig.Accept(name); err == nil {
+		return SignatureFamily
+	}
+	var keyenc KeyEncryptionAlgorithm
+	if err := keyenc.Accept(name); err == nil {
+		return KeyEncryptionFamily
+	}
+	var contentenc ContentEncryptionAlgorithm
+	if err := contentenc.Accept(name); err == nil {
+		return ContentEncryptionFamily
+	}
+	return UnknownFamily
+}
@@ -126,12 +126,28 @@ func _main() error {
 					name:  `P521`,
 					value: `P-521`,
 				},
+				{
+					name:    `BrainpoolP256r1`,
+					value:   `brainpoolP256r1`,
+					comment: `brainpoolP256r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry`,
+				},
+				{
+					name:    `BrainpoolP384r1`,
+					value:   `brainpoolP384r1`,
+					comment: `brainpoolP384r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry`,
+				},
+				{
+					name:    `BrainpoolP512r1`,
+					value:   `brainpoolP512r1`,
+					comment: `brainpoolP512r1 (RFC 5639). This is not a curve registered in the JOSE IANA registry`,
+				},
 			},
 		},
 		{
-			name:     `SignatureAlgorithm`,
-			comment:  `SignatureAlgorithm represents the various signature algorithms as described in https://tools.ietf.org/html/rfc7518#section-3.1`,
-			filename: `signature_gen.go`,
+			name:       `SignatureAlgorithm`,
+			comment:    `SignatureAlgorithm represents the various signature algorithms as described in https://tools.ietf.org/html/rfc7518#section-3.1`,
+			filename:   `signature_gen.go`,
+			registered: true,
 			elements: []element{
 				{
 					name:  `NoSignature`,
@@ -317,6 +333,9 @@ type typ struct {
 	comment  string
 	filename string
 	elements []element
+	// registered is true if values other than those listed in
+	// elements may be registered at runtime (see jwa.Register<name>)
+	registered bool
 }
 
 type element struct {
@@ -392,7 +411,13 @@ func (t typ) Generate() error {
 	}
 	fmt.Fprintf(&buf, ":")
 	fmt.Fprintf(&buf, "\ndefault:")
-	fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid jwa.%s value`)", t.name)
+	if t.registered {
+		fmt.Fprintf(&buf, "\nif !isRegistered%s(tmp) {", t.name)
+		fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid jwa.%s value`)", t.name)
+		fmt.Fprintf(&buf, "\n}")
+	} else {
+		fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid jwa.%s value`)", t.name)
+	}
 	fmt.Fprintf(&buf, "\n}")
 
 	fmt.Fprintf(&buf, "\n\n*v = tmp")
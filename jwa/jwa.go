@@ -12,6 +12,12 @@ func (crv EllipticCurveAlgorithm) Size() int {
 		return 48
 	case P521:
 		return 66
+	case BrainpoolP256r1:
+		return 32
+	case BrainpoolP384r1:
+		return 48
+	case BrainpoolP512r1:
+		return 64
 	}
 	return 0
 }
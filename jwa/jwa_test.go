@@ -1,5 +1,13 @@
 package jwa_test
 
+import (
+	"crypto"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+)
+
 type stringer struct {
 	src string
 }
@@ -7,3 +15,78 @@ type stringer struct {
 func (s stringer) String() string {
 	return s.src
 }
+
+func TestRegisterSignatureAlgorithm(t *testing.T) {
+	var dst jwa.SignatureAlgorithm
+	if !assert.Error(t, dst.Accept(`X-CUSTOM`), `accept should fail before registration`) {
+		return
+	}
+
+	alg := jwa.RegisterSignatureAlgorithm(`X-CUSTOM`)
+	if !assert.NoError(t, dst.Accept(`X-CUSTOM`), `accept should succeed after registration`) {
+		return
+	}
+	if !assert.Equal(t, alg, dst, `accepted value should be equal to the registered value`) {
+		return
+	}
+}
+
+func TestHashForSignatureAlgorithm(t *testing.T) {
+	testcases := []struct {
+		alg  jwa.SignatureAlgorithm
+		hash crypto.Hash
+		ok   bool
+	}{
+		{alg: jwa.ES256, hash: crypto.SHA256, ok: true},
+		{alg: jwa.ES384, hash: crypto.SHA384, ok: true},
+		{alg: jwa.ES512, hash: crypto.SHA512, ok: true},
+		{alg: jwa.HS256, hash: crypto.SHA256, ok: true},
+		{alg: jwa.HS384, hash: crypto.SHA384, ok: true},
+		{alg: jwa.HS512, hash: crypto.SHA512, ok: true},
+		{alg: jwa.PS256, hash: crypto.SHA256, ok: true},
+		{alg: jwa.PS384, hash: crypto.SHA384, ok: true},
+		{alg: jwa.PS512, hash: crypto.SHA512, ok: true},
+		{alg: jwa.RS256, hash: crypto.SHA256, ok: true},
+		{alg: jwa.RS384, hash: crypto.SHA384, ok: true},
+		{alg: jwa.RS512, hash: crypto.SHA512, ok: true},
+		{alg: jwa.NoSignature, ok: false},
+		{alg: jwa.SignatureAlgorithm(`X-UNKNOWN`), ok: false},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.alg.String(), func(t *testing.T) {
+			h, ok := jwa.HashForSignatureAlgorithm(tc.alg)
+			if !assert.Equal(t, tc.ok, ok, `ok should match`) {
+				return
+			}
+			if !assert.Equal(t, tc.hash, h, `hash should match`) {
+				return
+			}
+		})
+	}
+}
+
+func TestFamilyOf(t *testing.T) {
+	testcases := []struct {
+		name   string
+		family jwa.AlgorithmFamily
+	}{
+		{name: jwa.ES256.String(), family: jwa.SignatureFamily},
+		{name: jwa.HS512.String(), family: jwa.SignatureFamily},
+		{name: jwa.RSA_OAEP_256.String(), family: jwa.KeyEncryptionFamily},
+		{name: jwa.DIRECT.String(), family: jwa.KeyEncryptionFamily},
+		{name: jwa.A128GCM.String(), family: jwa.ContentEncryptionFamily},
+		{name: jwa.A256CBC_HS512.String(), family: jwa.ContentEncryptionFamily},
+		{name: "X-UNKNOWN", family: jwa.UnknownFamily},
+		{name: "", family: jwa.UnknownFamily},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if !assert.Equal(t, tc.family, jwa.FamilyOf(tc.name), `family should match`) {
+				return
+			}
+		})
+	}
+}
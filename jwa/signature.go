@@ -0,0 +1,56 @@
+package jwa
+
+import (
+	"crypto"
+	"sync"
+)
+
+var muRegisteredSignatureAlgorithms sync.RWMutex
+var registeredSignatureAlgorithms = map[SignatureAlgorithm]struct{}{}
+
+// RegisterSignatureAlgorithm registers a new SignatureAlgorithm value,
+// so that it is accepted when parsing values from outside sources, such
+// as the "alg" header of a JWS message. This is meant to be used with
+// signature algorithms that are not defined in RFC7518, and you will
+// also need to register the signer and verifier for the algorithm
+// (see jws.RegisterSigner and jws.RegisterVerifier).
+//
+// Registering a name that is already known is a no-op.
+func RegisterSignatureAlgorithm(name string) SignatureAlgorithm {
+	alg := SignatureAlgorithm(name)
+	muRegisteredSignatureAlgorithms.Lock()
+	registeredSignatureAlgorithms[alg] = struct{}{}
+	muRegisteredSignatureAlgorithms.Unlock()
+	return alg
+}
+
+func isRegisteredSignatureAlgorithm(alg SignatureAlgorithm) bool {
+	muRegisteredSignatureAlgorithms.RLock()
+	_, ok := registeredSignatureAlgorithms[alg]
+	muRegisteredSignatureAlgorithms.RUnlock()
+	return ok
+}
+
+var signatureHashes = map[SignatureAlgorithm]crypto.Hash{
+	ES256: crypto.SHA256,
+	ES384: crypto.SHA384,
+	ES512: crypto.SHA512,
+	HS256: crypto.SHA256,
+	HS384: crypto.SHA384,
+	HS512: crypto.SHA512,
+	PS256: crypto.SHA256,
+	PS384: crypto.SHA384,
+	PS512: crypto.SHA512,
+	RS256: crypto.SHA256,
+	RS384: crypto.SHA384,
+	RS512: crypto.SHA512,
+}
+
+// HashForSignatureAlgorithm returns the hash function that is used to
+// compute signatures with the given algorithm. The second return value
+// is false for algorithms that do not use a hash function of their own,
+// such as "none", and for algorithms that are not known.
+func HashForSignatureAlgorithm(alg SignatureAlgorithm) (crypto.Hash, bool) {
+	h, ok := signatureHashes[alg]
+	return h, ok
+}
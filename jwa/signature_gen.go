@@ -49,7 +49,9 @@ func (v *SignatureAlgorithm) Accept(value interface{}) error {
 	switch tmp {
 	case ES256, ES384, ES512, HS256, HS384, HS512, NoSignature, PS256, PS384, PS512, RS256, RS384, RS512:
 	default:
-		return errors.Errorf(`invalid jwa.SignatureAlgorithm value`)
+		if !isRegisteredSignatureAlgorithm(tmp) {
+			return errors.Errorf(`invalid jwa.SignatureAlgorithm value`)
+		}
 	}
 
 	*v = tmp
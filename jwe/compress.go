@@ -3,19 +3,42 @@ package jwe
 import (
 	"bytes"
 	"compress/flate"
+	"io"
 	"io/ioutil"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
 
-func uncompress(plaintext []byte) ([]byte, error) {
-	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(plaintext)))
+// uncompress decompresses the payload. If maxSize is greater than zero,
+// decompression is aborted as soon as the output exceeds maxSize bytes
+func uncompress(plaintext []byte, alg jwa.CompressionAlgorithm, maxSize int64) ([]byte, error) {
+	if alg != jwa.Deflate {
+		return nil, errors.Errorf(`unsupported compression algorithm %s`, alg)
+	}
+
+	var r io.Reader = flate.NewReader(bytes.NewReader(plaintext))
+	if maxSize <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > maxSize {
+		return nil, errors.Errorf(`decompressed payload exceeds %d bytes`, maxSize)
+	}
+	return buf, nil
 }
 
 func compress(plaintext []byte, alg jwa.CompressionAlgorithm) ([]byte, error) {
-	if alg == jwa.NoCompress {
+	switch alg {
+	case jwa.NoCompress:
 		return plaintext, nil
+	case jwa.Deflate:
+	default:
+		return nil, errors.Errorf(`unsupported compression algorithm %s`, alg)
 	}
 
 	var output bytes.Buffer
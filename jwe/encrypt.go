@@ -6,6 +6,9 @@ import (
 
 	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe/internal/content_crypt"
+	"github.com/lestrrat-go/jwx/jwe/internal/keyenc"
+	"github.com/lestrrat-go/jwx/jwe/internal/keygen"
 	"github.com/lestrrat-go/pdebug"
 	"github.com/pkg/errors"
 )
@@ -25,6 +28,7 @@ func releaseEncryptCtx(ctx *encryptCtx) {
 	ctx.generator = nil
 	ctx.keyEncrypters = nil
 	ctx.compress = jwa.NoCompress
+	ctx.protected = nil
 	encryptCtxPool.Put(ctx)
 }
 
@@ -43,7 +47,10 @@ func (e encryptCtx) Encrypt(plaintext []byte) (*Message, error) {
 		pdebug.Printf("Encrypt: generated cek len = %d", len(cek))
 	}
 
-	protected := NewHeaders()
+	protected, err := mergeHeaders(context.TODO(), nil, e.protected)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to copy protected headers")
+	}
 	if err := protected.Set(ContentEncryptionKey, e.contentEncrypter.Algorithm()); err != nil {
 		return nil, errors.Wrap(err, `failed to set "enc" in protected header`)
 	}
@@ -91,13 +98,17 @@ func (e encryptCtx) Encrypt(plaintext []byte) (*Message, error) {
 	}
 
 	// If there's only one recipient, you want to include that in the
-	// protected header
+	// protected header. The members are moved, not copied, as the
+	// protected header and the recipient header must be disjoint
 	if len(recipients) == 1 {
 		h, err := mergeHeaders(context.TODO(), protected, recipients[0].Headers())
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to merge protected headers")
 		}
 		protected = h
+		if err := recipients[0].SetHeaders(NewHeaders()); err != nil {
+			return nil, errors.Wrap(err, "failed to reset recipient headers")
+		}
 	}
 
 	aad, err := protected.Encode()
@@ -128,6 +139,7 @@ func (e encryptCtx) Encrypt(plaintext []byte) (*Message, error) {
 	}
 
 	msg := NewMessage()
+	msg.cek = cek
 
 	decodedAad, err := buffer.FromBase64(aad)
 	if err != nil {
@@ -154,3 +166,95 @@ func (e encryptCtx) Encrypt(plaintext []byte) (*Message, error) {
 
 	return msg, nil
 }
+
+// RecipientKey specifies a key encryption algorithm and the key that
+// is used to encrypt the content encryption key for a recipient
+type RecipientKey struct {
+	Algorithm jwa.KeyEncryptionAlgorithm
+	Key       interface{}
+}
+
+// RecipientContext holds the validated configuration (key encrypters,
+// content cipher, and compression) for encrypting messages to a fixed
+// set of recipients. Use it instead of `jwe.Encrypt` when encrypting
+// many messages to the same recipients, so that the keys are not parsed
+// and validated on every call.
+//
+// A RecipientContext is safe for concurrent use.
+type RecipientContext struct {
+	contentEncrypter contentEncrypter
+	generator        keygen.Generator
+	keyEncrypters    []keyenc.Encrypter
+	compress         jwa.CompressionAlgorithm
+}
+
+// NewRecipientContext creates a new RecipientContext that encrypts the
+// content using `contentalg` and `compressalg`, and encrypts the
+// content encryption key for each of the given recipients.
+//
+// All recipients must require the same content encryption key size.
+func NewRecipientContext(contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm, recipients ...RecipientKey) (*RecipientContext, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+
+	contentcrypt, err := content_crypt.NewAES(contentalg)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create AES encrypter`)
+	}
+
+	var keysize int
+	encrypters := make([]keyenc.Encrypter, len(recipients))
+	for i, recipient := range recipients {
+		enc, size, err := buildKeyEncrypter(recipient.Algorithm, recipient.Key, contentcrypt, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to build key encrypter for recipient %d`, i)
+		}
+		if i > 0 && size != keysize {
+			return nil, errors.Errorf(`recipient %d requires a different content encryption key size (%d != %d)`, i, size, keysize)
+		}
+		keysize = size
+		encrypters[i] = enc
+	}
+
+	return &RecipientContext{
+		contentEncrypter: contentcrypt,
+		generator:        keygen.NewRandom(keysize),
+		keyEncrypters:    encrypters,
+		compress:         compressalg,
+	}, nil
+}
+
+// Encrypt encrypts the payload for the recipients in this context, and
+// returns the resulting JWE message. Use `jwe.Compact` or `jwe.JSON` to
+// serialize it. Messages for more than one recipient can only be
+// serialized using `jwe.JSON`.
+//
+// The WithSenderKeyID option is accepted, as in `jwe.Encrypt`
+func (rc *RecipientContext) Encrypt(payload []byte, options ...Option) (*Message, error) {
+	var protected Headers
+	for _, o := range options {
+		switch o.Name() {
+		case optkeySenderKeyID:
+			if protected == nil {
+				protected = NewHeaders()
+			}
+			if err := protected.Set(SenderKeyIDKey, o.Value().(string)); err != nil {
+				return nil, errors.Wrapf(err, `failed to set %s`, SenderKeyIDKey)
+			}
+		}
+	}
+
+	encctx := encryptCtx{
+		contentEncrypter: rc.contentEncrypter,
+		generator:        rc.generator,
+		keyEncrypters:    rc.keyEncrypters,
+		compress:         rc.compress,
+		protected:        protected,
+	}
+	msg, err := encctx.Encrypt(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt payload")
+	}
+	return msg, nil
+}
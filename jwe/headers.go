@@ -10,6 +10,98 @@ import (
 	"github.com/pkg/errors"
 )
 
+// SenderKeyIDKey is the name of the "skid" (sender key ID) header
+// parameter. It is not one of the registered header parameters, and is
+// therefore stored as a private parameter
+const SenderKeyIDKey = "skid"
+
+// headers defined in RFC7516 and RFC7518, which may not be listed in "crit"
+var standardHeaderNames = map[string]struct{}{
+	AgreementPartyUInfoKey:    {},
+	AgreementPartyVInfoKey:    {},
+	AlgorithmKey:              {},
+	CompressionKey:            {},
+	ContentEncryptionKey:      {},
+	ContentTypeKey:            {},
+	CriticalKey:               {},
+	EphemeralPublicKeyKey:     {},
+	JWKKey:                    {},
+	JWKSetURLKey:              {},
+	KeyIDKey:                  {},
+	TypeKey:                   {},
+	X509CertChainKey:          {},
+	X509CertThumbprintKey:     {},
+	X509CertThumbprintS256Key: {},
+	X509URLKey:                {},
+	"iv":                      {},
+	"tag":                     {},
+	"p2s":                     {},
+	"p2c":                     {},
+}
+
+// validateCritical checks the contents of the "crit" header as
+// described in https://tools.ietf.org/html/rfc7516#section-4.1.13:
+// the entries must be non-empty and unique, and must not name
+// standard headers.
+func validateCritical(crit []string) error {
+	seen := make(map[string]struct{}, len(crit))
+	for _, name := range crit {
+		if name == "" {
+			return errors.New(`empty header name in crit`)
+		}
+		if _, ok := standardHeaderNames[name]; ok {
+			return errors.Errorf(`standard header %s may not be listed in crit`, name)
+		}
+		if _, ok := seen[name]; ok {
+			return errors.Errorf(`duplicate header %s in crit`, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+// checkCritical makes sure that the "crit" header only appears in the
+// protected header, and that each header it lists is present in the
+// protected header and is one of the understood headers
+func (m *Message) checkCritical(understood []string) error {
+	if m.unprotectedHeaders != nil && m.unprotectedHeaders.Critical() != nil {
+		return errors.New(`"crit" must be in the protected header`)
+	}
+	for i, recipient := range m.recipients {
+		if h := recipient.Headers(); h != nil && h.Critical() != nil {
+			return errors.Errorf(`"crit" must be in the protected header (found in recipient #%d)`, i+1)
+		}
+	}
+
+	crit := m.protectedHeaders.Critical()
+	if crit == nil {
+		return nil
+	}
+	if len(crit) == 0 {
+		return errors.New(`"crit" must not be empty`)
+	}
+	if err := validateCritical(crit); err != nil {
+		return err
+	}
+
+	for _, name := range crit {
+		var ok bool
+		for _, v := range understood {
+			if v == name {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.Errorf(`critical header %s is not understood`, name)
+		}
+		if _, ok := m.protectedHeaders.Get(name); !ok {
+			return errors.Errorf(`critical header %s is missing from the protected header`, name)
+		}
+	}
+	return nil
+}
+
 type isZeroer interface {
 	isZero() bool
 }
@@ -1,6 +1,8 @@
 package jwe
 
 import (
+	"sync"
+
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/internal/iter"
@@ -12,6 +14,23 @@ import (
 
 const (
 	optkeyPrettyJSONFormat = "optkeyPrettyJSONFormat"
+	optkeyPBES2Count       = "optkeyPBES2Count"
+	optkeyPBES2SaltSize    = "optkeyPBES2SaltSize"
+	optkeySenderKeyID      = "optkeySenderKeyID"
+
+	optkeyAllowedCompression  = "optkeyAllowedCompression"
+	optkeyParallelKeyAttempts = "optkeyParallelKeyAttempts"
+	optkeyMaxDecompressedSize = "optkeyMaxDecompressedSize"
+
+	optkeyExpectedKeyEncryptionAlgorithm = "optkeyExpectedKeyEncryptionAlgorithm"
+	optkeyPBES2MinCount                  = "optkeyPBES2MinCount"
+	optkeyPBES2MaxCount                  = "optkeyPBES2MaxCount"
+	optkeyMaxRecipients                  = "optkeyMaxRecipients"
+	optkeyKeepContentEncryptionKey       = "optkeyKeepContentEncryptionKey"
+	optkeyCriticalHeaders                = "optkeyCriticalHeaders"
+	optkeyCriticalHeader                 = "optkeyCriticalHeader"
+	optkeyContentType                    = "optkeyContentType"
+	optkeyEphemeralKey                   = "optkeyEphemeralKey"
 )
 
 // Recipient holds the encrypted key and hints to decrypt the key
@@ -36,6 +55,11 @@ type Message struct {
 	recipients           []Recipient
 	tag                  *buffer.Buffer
 	unprotectedHeaders   Headers
+
+	// cek is the content encryption key, which is only known after the
+	// message has been encrypted or decrypted. See AddRecipient
+	mu  sync.Mutex
+	cek []byte
 }
 
 // contentEncrypter encrypts the content using the content using the
@@ -50,6 +74,7 @@ type encryptCtx struct {
 	generator        keygen.Generator
 	keyEncrypters    []keyenc.Encrypter
 	compress         jwa.CompressionAlgorithm
+	protected        Headers
 }
 
 // populater is an interface for things that may modify the
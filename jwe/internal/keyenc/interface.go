@@ -48,6 +48,24 @@ type ECDHESDecrypt struct {
 	pubkey    *ecdsa.PublicKey
 }
 
+// PBES2Encrypt encrypts content encryption keys using PBES2 (password
+// based key derivation followed by AES key wrap)
+type PBES2Encrypt struct {
+	alg      jwa.KeyEncryptionAlgorithm
+	password []byte
+	count    int
+	saltSize int
+	keyID    string
+}
+
+// PBES2Decrypt decrypts keys using PBES2.
+type PBES2Decrypt struct {
+	alg      jwa.KeyEncryptionAlgorithm
+	password []byte
+	salt     []byte
+	count    int
+}
+
 // RSAOAEPEncrypt encrypts keys using RSA OAEP algorithm
 type RSAOAEPEncrypt struct {
 	alg    jwa.KeyEncryptionAlgorithm
@@ -9,16 +9,19 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
 	"hash"
+	"io"
 
 	"github.com/lestrrat-go/jwx/internal/concatkdf"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwe/internal/keygen"
 	"github.com/lestrrat-go/pdebug"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
 )
 
 // NewAESCGM creates a key-wrap encrypter using AES-CGM.
@@ -67,9 +70,10 @@ func (kw *AESCGM) Encrypt(cek []byte) (keygen.ByteSource, error) {
 	return keygen.ByteKey(encrypted), nil
 }
 
-// NewECDHESEncrypt creates a new key encrypter based on ECDH-ES
-func NewECDHESEncrypt(alg jwa.KeyEncryptionAlgorithm, key *ecdsa.PublicKey) (*ECDHESEncrypt, error) {
-	generator, err := keygen.NewEcdhes(alg, key)
+// NewECDHESEncrypt creates a new key encrypter based on ECDH-ES. If
+// ephemeral is not nil, it is used instead of a freshly generated key
+func NewECDHESEncrypt(alg jwa.KeyEncryptionAlgorithm, key *ecdsa.PublicKey, ephemeral *ecdsa.PrivateKey) (*ECDHESEncrypt, error) {
+	generator, err := keygen.NewEcdhes(alg, key, ephemeral)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create key generator")
 	}
@@ -167,6 +171,143 @@ func (kw ECDHESDecrypt) Decrypt(enckey []byte) ([]byte, error) {
 	return Unwrap(block, enckey)
 }
 
+// pbes2Params returns the hash function and the size of the derived
+// key encryption key for the given PBES2 algorithm
+func pbes2Params(alg jwa.KeyEncryptionAlgorithm) (func() hash.Hash, int, error) {
+	switch alg {
+	case jwa.PBES2_HS256_A128KW:
+		return sha256.New, 16, nil
+	case jwa.PBES2_HS384_A192KW:
+		return sha512.New384, 24, nil
+	case jwa.PBES2_HS512_A256KW:
+		return sha512.New, 32, nil
+	default:
+		return nil, 0, errors.Errorf("invalid PBES2 key encryption algorithm (%s)", alg)
+	}
+}
+
+// pbes2DeriveKey derives the key encryption key from the password.
+// As described in RFC7518 Section 4.8.1.1, the salt value used in the
+// derivation is the concatenation of the algorithm name, a 0x00 octet,
+// and the salt input value
+func pbes2DeriveKey(alg jwa.KeyEncryptionAlgorithm, password, salt []byte, count int) ([]byte, error) {
+	hashFunc, keysize, err := pbes2Params(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	fullsalt := make([]byte, 0, len(alg.String())+1+len(salt))
+	fullsalt = append(fullsalt, []byte(alg.String())...)
+	fullsalt = append(fullsalt, 0x00)
+	fullsalt = append(fullsalt, salt...)
+
+	return pbkdf2.Key(password, fullsalt, count, keysize, hashFunc), nil
+}
+
+// NewPBES2Encrypt creates a new key encrypter using PBES2. `count` is
+// the PBKDF2 iteration count, and `saltSize` is the number of random
+// bytes generated for the salt input value
+func NewPBES2Encrypt(alg jwa.KeyEncryptionAlgorithm, password []byte, count, saltSize int) (*PBES2Encrypt, error) {
+	if _, _, err := pbes2Params(alg); err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		return nil, errors.Errorf("invalid PBES2 iteration count (%d)", count)
+	}
+
+	// RFC7518 Section 4.8.1.1: A Salt Input value containing 8 or more
+	// octets MUST be used.
+	if saltSize < 8 {
+		return nil, errors.Errorf("invalid PBES2 salt size (%d): must be 8 or more", saltSize)
+	}
+
+	return &PBES2Encrypt{
+		alg:      alg,
+		password: password,
+		count:    count,
+		saltSize: saltSize,
+	}, nil
+}
+
+// Algorithm returns the key encryption algorithm being used
+func (kw PBES2Encrypt) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return kw.alg
+}
+
+// KeyID returns the key ID associated with this encrypter
+func (kw PBES2Encrypt) KeyID() string {
+	return kw.keyID
+}
+
+// Encrypt encrypts the content encryption key using PBES2
+func (kw PBES2Encrypt) Encrypt(cek []byte) (keygen.ByteSource, error) {
+	salt := make([]byte, kw.saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt")
+	}
+
+	kek, err := pbes2DeriveKey(kw.alg, kw.password, salt, kw.count)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive key encryption key")
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher from derived key")
+	}
+
+	jek, err := Wrap(block, cek)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap data")
+	}
+
+	return keygen.ByteWithSaltAndCount{
+		ByteKey: keygen.ByteKey(jek),
+		Salt:    salt,
+		Count:   kw.count,
+	}, nil
+}
+
+// NewPBES2Decrypt creates a new key decrypter using PBES2. `salt` and
+// `count` are the values taken from the 'p2s' and 'p2c' headers
+func NewPBES2Decrypt(alg jwa.KeyEncryptionAlgorithm, password, salt []byte, count int) (*PBES2Decrypt, error) {
+	if _, _, err := pbes2Params(alg); err != nil {
+		return nil, err
+	}
+
+	if count <= 0 {
+		return nil, errors.Errorf("invalid PBES2 iteration count (%d)", count)
+	}
+
+	return &PBES2Decrypt{
+		alg:      alg,
+		password: password,
+		salt:     salt,
+		count:    count,
+	}, nil
+}
+
+// Algorithm returns the key encryption algorithm being used
+func (kw PBES2Decrypt) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return kw.alg
+}
+
+// Decrypt decrypts the encrypted key using PBES2
+func (kw PBES2Decrypt) Decrypt(enckey []byte) ([]byte, error) {
+	kek, err := pbes2DeriveKey(kw.alg, kw.password, kw.salt, kw.count)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to derive key encryption key")
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher from derived key")
+	}
+
+	return Unwrap(block, enckey)
+}
+
 // NewRSAOAEPEncrypt creates a new key encrypter using RSA OAEP
 func NewRSAOAEPEncrypt(alg jwa.KeyEncryptionAlgorithm, pubkey *rsa.PublicKey) (*RSAOAEPEncrypt, error) {
 	switch alg {
@@ -24,6 +24,7 @@ type Ecdhes struct {
 	algorithm jwa.KeyEncryptionAlgorithm
 	keysize   int
 	pubkey    *ecdsa.PublicKey
+	ephemeral *ecdsa.PrivateKey
 }
 
 // ByteKey is a generated key that only has the key's byte buffer
@@ -39,6 +40,16 @@ type ByteWithECPrivateKey struct {
 	PrivateKey *ecdsa.PrivateKey
 }
 
+// ByteWithSaltAndCount holds the encrypted key along with the salt
+// input and the iteration count that was used to derive the key
+// encryption key. This is required to set the proper values in the
+// JWE headers ('p2s' and 'p2c')
+type ByteWithSaltAndCount struct {
+	ByteKey
+	Salt  []byte
+	Count int
+}
+
 // ByteSource is an interface for things that return a byte sequence.
 // This is used for KeyGenerator so that the result of computations can
 // carry more than just the generate byte sequence.
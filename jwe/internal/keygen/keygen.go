@@ -7,6 +7,7 @@ import (
 	"encoding/binary"
 	"io"
 
+	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/concatkdf"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
@@ -50,8 +51,10 @@ func (g Random) Generate() (ByteSource, error) {
 	return ByteKey(buf), nil
 }
 
-// NewEcdhes creates a new key generator using ECDH-ES
-func NewEcdhes(alg jwa.KeyEncryptionAlgorithm, pubkey *ecdsa.PublicKey) (*Ecdhes, error) {
+// NewEcdhes creates a new key generator using ECDH-ES. If ephemeral is
+// not nil, it is used as the ephemeral key instead of generating a new
+// one for each key. It must be on the same curve as pubkey
+func NewEcdhes(alg jwa.KeyEncryptionAlgorithm, pubkey *ecdsa.PublicKey, ephemeral *ecdsa.PrivateKey) (*Ecdhes, error) {
 	var keysize int
 	switch alg {
 	case jwa.ECDH_ES:
@@ -66,10 +69,15 @@ func NewEcdhes(alg jwa.KeyEncryptionAlgorithm, pubkey *ecdsa.PublicKey) (*Ecdhes
 		return nil, errors.Errorf("invalid ECDH-ES key generation algorithm (%s)", alg)
 	}
 
+	if ephemeral != nil && ephemeral.Curve.Params().Name != pubkey.Curve.Params().Name {
+		return nil, errors.Errorf("ephemeral key curve (%s) does not match the recipient key curve (%s)", ephemeral.Curve.Params().Name, pubkey.Curve.Params().Name)
+	}
+
 	return &Ecdhes{
 		algorithm: alg,
 		keysize:   keysize,
 		pubkey:    pubkey,
+		ephemeral: ephemeral,
 	}, nil
 }
 
@@ -80,9 +88,13 @@ func (g Ecdhes) Size() int {
 
 // Generate generates new keys using ECDH-ES
 func (g Ecdhes) Generate() (ByteSource, error) {
-	priv, err := ecdsa.GenerateKey(g.pubkey.Curve, rand.Reader)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to generate key for ECDH-ES")
+	priv := g.ephemeral
+	if priv == nil {
+		var err error
+		priv, err = ecdsa.GenerateKey(g.pubkey.Curve, rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate key for ECDH-ES")
+		}
 	}
 
 	pubinfo := make([]byte, 4)
@@ -114,3 +126,16 @@ func (k ByteWithECPrivateKey) Populate(h Setter) error {
 	}
 	return nil
 }
+
+// Populate populates the header with the PBES2 salt input and
+// iteration count ('p2s' and 'p2c' keys)
+func (k ByteWithSaltAndCount) Populate(h Setter) error {
+	if err := h.Set("p2s", base64.EncodeToString(k.Salt)); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+
+	if err := h.Set("p2c", k.Count); err != nil {
+		return errors.Wrap(err, "failed to write header")
+	}
+	return nil
+}
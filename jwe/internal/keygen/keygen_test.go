@@ -0,0 +1,80 @@
+package keygen_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/internal/concatkdf"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe/internal/keygen"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+)
+
+// https://tools.ietf.org/html/rfc7518#appendix-C
+func TestEcdhesEphemeralKey(t *testing.T) {
+	parseKey := func(t *testing.T, src string) *ecdsa.PrivateKey {
+		key, err := jwk.ParseKey([]byte(src))
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+			return nil
+		}
+		var raw ecdsa.PrivateKey
+		if !assert.NoError(t, key.Raw(&raw), `key.Raw should succeed`) {
+			return nil
+		}
+		return &raw
+	}
+	bob := parseKey(t, `{"kty":"EC","crv":"P-256",
+ "x":"weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ",
+ "y":"e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck",
+ "d":"VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw"}`)
+	alice := parseKey(t, `{"kty":"EC","crv":"P-256",
+ "x":"gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0",
+ "y":"SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps",
+ "d":"0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo"}`)
+	if bob == nil || alice == nil {
+		return
+	}
+
+	// The shared secret Z that Alice and Bob agree upon
+	z := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132,
+		38, 156, 251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121,
+		140, 254, 144, 196}
+
+	g, err := keygen.NewEcdhes(jwa.ECDH_ES_A128KW, &bob.PublicKey, alice)
+	if !assert.NoError(t, err, `keygen.NewEcdhes should succeed`) {
+		return
+	}
+	generated, err := g.Generate()
+	if !assert.NoError(t, err, `Generate should succeed`) {
+		return
+	}
+	key, ok := generated.(keygen.ByteWithECPrivateKey)
+	if !assert.True(t, ok, `generated key should be a ByteWithECPrivateKey`) {
+		return
+	}
+	if !assert.Equal(t, alice, key.PrivateKey, `the ephemeral key should be used`) {
+		return
+	}
+
+	// The appendix uses direct key agreement, whose derivation from Z is
+	// checked in internal/concatkdf. For "ECDH-ES+A128KW" the algorithm ID
+	// is the key encryption algorithm, and "apu" and "apv" are empty
+	expected := make([]byte, 16)
+	kdf := concatkdf.New(crypto.SHA256, []byte(jwa.ECDH_ES_A128KW.String()), z, []byte{}, []byte{}, []byte{0, 0, 0, 128}, []byte{})
+	if _, err := kdf.Read(expected); !assert.NoError(t, err, `kdf.Read should succeed`) {
+		return
+	}
+	if !assert.Equal(t, expected, key.Bytes(), `the key encryption key should be derived from Z`) {
+		return
+	}
+
+	t.Run("Curve mismatch", func(t *testing.T) {
+		_, err := keygen.NewEcdhes(jwa.ECDH_ES_A128KW, &bob.PublicKey, &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P384()}})
+		if !assert.Error(t, err, `keygen.NewEcdhes should fail`) {
+			return
+		}
+	})
+}
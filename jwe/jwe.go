@@ -5,11 +5,16 @@ package jwe
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/json"
+	"math"
+	"sync"
 
 	"github.com/lestrrat-go/jwx/buffer"
+	"github.com/lestrrat-go/jwx/internal/base64"
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwe/internal/content_crypt"
 	"github.com/lestrrat-go/jwx/jwe/internal/keyenc"
@@ -19,15 +24,108 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// DefaultPBES2Count is the PBKDF2 iteration count used when
+	// encrypting using the PBES2 family of key encryption algorithms
+	DefaultPBES2Count = 100000
+	// DefaultPBES2SaltSize is the size of the salt input value used when
+	// encrypting using the PBES2 family of key encryption algorithms
+	DefaultPBES2SaltSize = 16
+	// DefaultPBES2MinCount is the minimum PBKDF2 iteration count accepted
+	// when decrypting using the PBES2 family of key encryption algorithms,
+	// as recommended by RFC7518
+	DefaultPBES2MinCount = 1000
+	// DefaultPBES2MaxCount is the maximum PBKDF2 iteration count accepted
+	// when decrypting using the PBES2 family of key encryption algorithms.
+	// As "p2c" is controlled by the sender, this bounds the work that a
+	// single message can cause
+	DefaultPBES2MaxCount = 1000000
+	// DefaultMaxRecipients is the maximum number of recipients that a
+	// message may have when decrypting
+	DefaultMaxRecipients = 100
+	// DefaultMaxDecompressedSize is the maximum size, in bytes, of the
+	// payload after it has been decompressed when decrypting
+	DefaultMaxDecompressedSize = 10 * 1024 * 1024
+)
+
 // Encrypt takes the plaintext payload and encrypts it in JWE compact format.
-func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm) ([]byte, error) {
+//
+// If you would like to include the sender key ID or the content type in
+// the protected header, use the WithSenderKeyID or WithContentType
+// option. To include extension headers that recipients must understand,
+// use the WithCriticalHeader option.
+func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm, options ...Option) ([]byte, error) {
+	var protected Headers
+	var critical []string
+	var ephemeral *ecdsa.PrivateKey
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyEphemeralKey:
+			ephemeral = o.Value().(*ecdsa.PrivateKey)
+		case optkeySenderKeyID:
+			if protected == nil {
+				protected = NewHeaders()
+			}
+			if err := protected.Set(SenderKeyIDKey, o.Value().(string)); err != nil {
+				return nil, errors.Wrapf(err, `failed to set %s`, SenderKeyIDKey)
+			}
+		case optkeyContentType:
+			if protected == nil {
+				protected = NewHeaders()
+			}
+			if err := protected.Set(ContentTypeKey, o.Value().(string)); err != nil {
+				return nil, errors.Wrapf(err, `failed to set %s`, ContentTypeKey)
+			}
+		case optkeyCriticalHeader:
+			ch := o.Value().(*criticalHeader)
+			if protected == nil {
+				protected = NewHeaders()
+			}
+			if err := protected.Set(ch.name, ch.value); err != nil {
+				return nil, errors.Wrapf(err, `failed to set %s`, ch.name)
+			}
+			critical = append(critical, ch.name)
+		}
+	}
+
+	if len(critical) > 0 {
+		if err := validateCritical(critical); err != nil {
+			return nil, errors.Wrap(err, `invalid critical headers`)
+		}
+		if err := protected.Set(CriticalKey, critical); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, CriticalKey)
+		}
+	}
+
 	contentcrypt, err := content_crypt.NewAES(contentalg)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to create AES encrypter`)
 	}
 
+	enc, keysize, err := buildKeyEncrypter(keyalg, key, contentcrypt, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	return encrypt(payload, contentcrypt, enc, keysize, compressalg, protected)
+}
+
+// buildKeyEncrypter creates a new key Encrypter instance from the given
+// parameters, along with the size of the content encryption key that
+// should be generated for it. The ephemeral key, if given, is only
+// valid for the ECDH-ES family.
+func buildKeyEncrypter(keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentcrypt *content_crypt.Generic, ephemeral *ecdsa.PrivateKey) (keyenc.Encrypter, int, error) {
+	if ephemeral != nil {
+		switch keyalg {
+		case jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+		default:
+			return nil, 0, errors.Errorf(`an ephemeral key cannot be used with key encryption algorithm %s`, keyalg)
+		}
+	}
+
 	var enc keyenc.Encrypter
 	var keysize int
+	var err error
 	switch keyalg {
 	case jwa.RSA1_5:
 		var pubkey *rsa.PublicKey
@@ -37,12 +135,12 @@ func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{},
 		case *rsa.PublicKey:
 			pubkey = v
 		default:
-			return nil, errors.Errorf("*rsa.PublicKey is required as the key to build %s key encrypter", keyalg)
+			return nil, 0, errors.Errorf("*rsa.PublicKey is required as the key to build %s key encrypter", keyalg)
 		}
 
 		enc, err = keyenc.NewRSAPKCSEncrypt(keyalg, pubkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create RSA PKCS encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create RSA PKCS encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
@@ -53,52 +151,103 @@ func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{},
 		case *rsa.PublicKey:
 			pubkey = v
 		default:
-			return nil, errors.Errorf("*rsa.PublicKey is required as the key to build %s key encrypter", keyalg)
+			return nil, 0, errors.Errorf("*rsa.PublicKey is required as the key to build %s key encrypter", keyalg)
 		}
 
 		enc, err = keyenc.NewRSAOAEPEncrypt(keyalg, pubkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create RSA OAEP encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create RSA OAEP encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.A128KW, jwa.A192KW, jwa.A256KW:
 		sharedkey, ok := key.([]byte)
 		if !ok {
-			return nil, errors.New("invalid key: []byte required")
+			return nil, 0, errors.New("invalid key: []byte required")
 		}
 		enc, err = keyenc.NewAESCGM(keyalg, sharedkey)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create key wrap encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create key wrap encrypter")
 		}
 		keysize = contentcrypt.KeySize()
 		switch aesKeySize := keysize / 2; aesKeySize {
 		case 16, 24, 32:
 		default:
-			return nil, errors.Errorf("unsupported keysize %d (from content encryption algorithm %s). consider using content encryption that uses 32, 48, or 64 byte keys", keysize, contentalg)
+			return nil, 0, errors.Errorf("unsupported keysize %d (from content encryption algorithm %s). consider using content encryption that uses 32, 48, or 64 byte keys", keysize, contentcrypt.Algorithm())
 		}
 	case jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
 		pubkey, ok := key.(*ecdsa.PublicKey)
 		if !ok {
-			return nil, errors.New("invalid key: *ecdsa.PublicKey required")
+			return nil, 0, errors.New("invalid key: *ecdsa.PublicKey required")
 		}
-		enc, err = keyenc.NewECDHESEncrypt(keyalg, pubkey)
+		enc, err = keyenc.NewECDHESEncrypt(keyalg, pubkey, ephemeral)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to create ECDHS key wrap encrypter")
+			return nil, 0, errors.Wrap(err, "failed to create ECDHS key wrap encrypter")
+		}
+		keysize = contentcrypt.KeySize() / 2
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		password, ok := key.([]byte)
+		if !ok {
+			return nil, 0, errors.New("invalid key: []byte required")
+		}
+		enc, err = keyenc.NewPBES2Encrypt(keyalg, password, DefaultPBES2Count, DefaultPBES2SaltSize)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to create PBES2 key wrap encrypter")
 		}
 		keysize = contentcrypt.KeySize() / 2
 	case jwa.ECDH_ES:
 		fallthrough
 	case jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW:
 		fallthrough
-	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
-		fallthrough
 	default:
 		if pdebug.Enabled {
 			pdebug.Printf("Encrypt: unknown key encryption algorithm: %s", keyalg)
 		}
-		return nil, errors.Errorf(`invalid key encryption algorithm (%s)`, keyalg)
+		return nil, 0, errors.Errorf(`invalid key encryption algorithm (%s)`, keyalg)
 	}
 
+	return enc, keysize, nil
+}
+
+// EncryptWithPassword encrypts the payload in JWE compact format using
+// a key encryption key derived from the given password. The key is
+// encrypted using PBES2-HS256+A128KW, and the content is encrypted
+// using A256GCM.
+//
+// The iteration count and the salt size may be changed by passing
+// `jwe.WithPBES2Count` and `jwe.WithPBES2SaltSize`, respectively.
+func EncryptWithPassword(payload, password []byte, options ...Option) ([]byte, error) {
+	count := DefaultPBES2Count
+	saltSize := DefaultPBES2SaltSize
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyPBES2Count:
+			count = o.Value().(int)
+		case optkeyPBES2SaltSize:
+			saltSize = o.Value().(int)
+		}
+	}
+
+	contentcrypt, err := content_crypt.NewAES(jwa.A256GCM)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create AES encrypter`)
+	}
+
+	enc, err := keyenc.NewPBES2Encrypt(jwa.PBES2_HS256_A128KW, password, count, saltSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create PBES2 key wrap encrypter")
+	}
+
+	return encrypt(payload, contentcrypt, enc, contentcrypt.KeySize()/2, jwa.NoCompress, nil)
+}
+
+// DecryptWithPassword decrypts a JWE message that was encrypted
+// using `jwe.EncryptWithPassword`. The options are the same as those
+// accepted by `jwe.Decrypt`
+func DecryptWithPassword(buf, password []byte, options ...Option) ([]byte, error) {
+	return Decrypt(buf, jwa.PBES2_HS256_A128KW, password, options...)
+}
+
+func encrypt(payload []byte, contentcrypt contentEncrypter, enc keyenc.Encrypter, keysize int, compressalg jwa.CompressionAlgorithm, protected Headers) ([]byte, error) {
 	if pdebug.Enabled {
 		pdebug.Printf("Encrypt: keysize = %d", keysize)
 	}
@@ -109,6 +258,7 @@ func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{},
 	encctx.generator = keygen.NewRandom(keysize)
 	encctx.keyEncrypters = []keyenc.Encrypter{enc}
 	encctx.compress = compressalg
+	encctx.protected = protected
 	msg, err := encctx.Encrypt(payload)
 	if err != nil {
 		if pdebug.Enabled {
@@ -123,13 +273,162 @@ func Encrypt(payload []byte, keyalg jwa.KeyEncryptionAlgorithm, key interface{},
 // Decrypt takes the key encryption algorithm and the corresponding
 // key to decrypt the JWE message, and returns the decrypted payload.
 // The JWE message can be either compact or full JSON format.
-func Decrypt(buf []byte, alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]byte, error) {
+//
+// If you would like to restrict the compression algorithms that are
+// accepted, use the WithAllowedCompression option. To change the maximum
+// size of the decompressed payload, use the WithMaxDecompressedSize
+// option. To reject messages that use any other key encryption algorithm
+// than `alg`, use the WithExpectedKeyEncryptionAlgorithm option. To change
+// the minimum PBKDF2 iteration count accepted for PBES2 algorithms, use
+// the WithPBES2MinCount option, and to change the maximum, use the
+// WithPBES2MaxCount option. To change the maximum number of recipients
+// that a message may have, use the WithMaxRecipients option.
+//
+// Messages whose "crit" header lists extension headers are rejected,
+// unless all of them are given in the WithCriticalHeaders option.
+func Decrypt(buf []byte, alg jwa.KeyEncryptionAlgorithm, key interface{}, options ...Option) ([]byte, error) {
 	msg, err := Parse(buf)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to parse buffer for Decrypt")
 	}
 
-	return msg.Decrypt(alg, key)
+	return msg.Decrypt(alg, key, options...)
+}
+
+// DecryptWithKeys decrypts the JWE message using each of the given
+// candidate keys until one of them succeeds, and returns the decrypted
+// payload. This is useful when the recipient holds several private keys
+// and does not know which one was used to encrypt the message.
+//
+// By default the keys are tried sequentially. Use the
+// WithParallelKeyAttempts option to try up to `n` keys concurrently.
+// Once a key succeeds, no further attempts are started.
+//
+// When none of the keys can decrypt the message, the reason why each
+// individual key failed is not reported, so that the error cannot be
+// used as an oracle against the keys. The rest of the options are the
+// same as those accepted by `jwe.Decrypt`
+func DecryptWithKeys(buf []byte, alg jwa.KeyEncryptionAlgorithm, keys []interface{}, options ...Option) ([]byte, error) {
+	parallelism := 1
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyParallelKeyAttempts:
+			parallelism = o.Value().(int)
+		}
+	}
+
+	msg, err := Parse(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse buffer for DecryptWithKeys")
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no keys given, can not proceed with decrypt")
+	}
+
+	if parallelism > len(keys) {
+		parallelism = len(keys)
+	}
+
+	if parallelism <= 1 {
+		for _, key := range keys {
+			if plaintext, err := msg.Decrypt(alg, key, options...); err == nil {
+				return plaintext, nil
+			}
+		}
+		return nil, errors.New("failed to decrypt message using any of the given keys")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keych := make(chan interface{})
+	go func() {
+		defer close(keych)
+		for _, key := range keys {
+			select {
+			case <-ctx.Done():
+				return
+			case keych <- key:
+			}
+		}
+	}()
+
+	// each worker sends at most one result, so this never blocks
+	resultch := make(chan []byte, parallelism)
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			for key := range keych {
+				plaintext, err := msg.Decrypt(alg, key, options...)
+				if err != nil {
+					continue
+				}
+				resultch <- plaintext
+				cancel()
+				return
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultch)
+	}()
+
+	if plaintext, ok := <-resultch; ok {
+		return plaintext, nil
+	}
+	return nil, errors.New("failed to decrypt message using any of the given keys")
+}
+
+// DecryptWithRecipient takes a JWE message whose encrypted key has been
+// transmitted separately (e.g. a compact serialization with an empty
+// encrypted key part), and decrypts it using the given encrypted key
+// and recipient header.
+//
+// The recipient header is merged on top of the per-recipient header
+// found in the message, if any, and the key encryption algorithm is
+// taken from the "alg" header of the result. `recipientHeader` may be nil
+// if the message already carries all the necessary headers.
+//
+// The options are the same as those accepted by `jwe.Decrypt`
+func DecryptWithRecipient(buf []byte, encryptedKey []byte, recipientHeader Headers, key interface{}, options ...Option) ([]byte, error) {
+	msg, err := Parse(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse buffer for DecryptWithRecipient")
+	}
+
+	var h Headers
+	if recipients := msg.Recipients(); len(recipients) == 1 {
+		h = recipients[0].Headers()
+	}
+	h, err = mergeHeaders(context.TODO(), h, recipientHeader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to merge recipient headers")
+	}
+
+	// the "alg" header may also be in the protected header
+	if h.Algorithm() == "" {
+		if err := h.Set(AlgorithmKey, msg.ProtectedHeaders().Algorithm()); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, AlgorithmKey)
+		}
+	}
+
+	recipient := NewRecipient()
+	if err := recipient.SetHeaders(h); err != nil {
+		return nil, errors.Wrap(err, "failed to set recipient headers")
+	}
+	if err := recipient.SetEncryptedKey(encryptedKey); err != nil {
+		return nil, errors.Wrap(err, "failed to set encrypted key")
+	}
+
+	if err := msg.Set(RecipientsKey, []Recipient{recipient}); err != nil {
+		return nil, errors.Wrapf(err, `failed to set %s`, RecipientsKey)
+	}
+
+	return msg.Decrypt(h.Algorithm(), key, options...)
 }
 
 // Parse parses the JWE message into a Message object. The JWE message
@@ -181,8 +480,10 @@ func parseCompact(buf []byte) (*Message, error) {
 		return nil, errors.Wrap(err, "failed to parse header JSON")
 	}
 
-	// We need the protected header to contain the content encryption
-	// algorithm. XXX probably other headers need to go there too
+	// The content encryption algorithm and the compression algorithm
+	// apply to the message as a whole, so they belong in the protected
+	// header. The rest stays in the recipient header. XXX probably other
+	// headers need to go there too
 	protected := NewHeaders()
 	if err := protected.Set(ContentEncryptionKey, hdr.ContentEncryption()); err != nil {
 		return nil, errors.Wrapf(err, "failed to set %#v in protected header", ContentEncryptionKey)
@@ -192,6 +493,32 @@ func parseCompact(buf []byte) (*Message, error) {
 		return nil, errors.Wrapf(err, "failed to remove %#v from public header", ContentEncryptionKey)
 	}
 
+	if zip := hdr.Compression(); zip != jwa.NoCompress {
+		if err := protected.Set(CompressionKey, zip); err != nil {
+			return nil, errors.Wrapf(err, "failed to set %#v in protected header", CompressionKey)
+		}
+		if err := hdr.Remove(CompressionKey); err != nil {
+			return nil, errors.Wrapf(err, "failed to remove %#v from public header", CompressionKey)
+		}
+	}
+
+	// "crit" and the headers it lists must be understood before the
+	// message is processed, so they are treated as protected too
+	if crit := hdr.Critical(); crit != nil {
+		for _, name := range append([]string{CriticalKey}, crit...) {
+			v, ok := hdr.Get(name)
+			if !ok {
+				continue
+			}
+			if err := protected.Set(name, v); err != nil {
+				return nil, errors.Wrapf(err, "failed to set %#v in protected header", name)
+			}
+			if err := hdr.Remove(name); err != nil {
+				return nil, errors.Wrapf(err, "failed to remove %#v from public header", name)
+			}
+		}
+	}
+
 	var enckeybuf buffer.Buffer
 	if err := enckeybuf.Base64Decode(parts[1]); err != nil {
 		return nil, errors.Wrap(err, "failed to base64 decode encryption key")
@@ -311,7 +638,69 @@ func buildKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, h Headers, key interface{
 		}
 
 		return keyenc.NewECDHESDecrypt(alg, pubkey.(*ecdsa.PublicKey), apuData, apvData, privkey), nil
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		password, ok := key.([]byte)
+		if !ok {
+			return nil, errors.Errorf("[]byte is required as the key to build %s key decrypter", alg)
+		}
+
+		p2sif, ok := h.Get("p2s")
+		if !ok {
+			return nil, errors.New("failed to get 'p2s' field")
+		}
+		p2s, ok := p2sif.(string)
+		if !ok {
+			return nil, errors.Errorf("invalid type for 'p2s' field: %T", p2sif)
+		}
+		salt, err := base64.DecodeString(p2s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode 'p2s' field")
+		}
+
+		count, err := pbes2Count(h)
+		if err != nil {
+			return nil, err
+		}
+
+		return keyenc.NewPBES2Decrypt(alg, password, salt, count)
 	}
 
 	return nil, errors.Errorf(`unsupported algorithm for key decryption (%s)`, alg)
 }
+
+func isPBES2(alg jwa.KeyEncryptionAlgorithm) bool {
+	switch alg {
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+		return true
+	default:
+		return false
+	}
+}
+
+// pbes2Count returns the PBKDF2 iteration count from the "p2c" header
+func pbes2Count(h Headers) (int, error) {
+	p2cif, ok := h.Get("p2c")
+	if !ok {
+		return 0, errors.New("failed to get 'p2c' field")
+	}
+	switch v := p2cif.(type) {
+	case int:
+		if v <= 0 {
+			return 0, errors.Errorf("invalid 'p2c' field: %d", v)
+		}
+		return v, nil
+	case float64:
+		if v <= 0 || v > math.MaxInt32 {
+			return 0, errors.Errorf("invalid 'p2c' field: %v", v)
+		}
+		return int(v), nil
+	default:
+		return 0, errors.Errorf("invalid type for 'p2c' field: %T", p2cif)
+	}
+}
+
+// SetBufferPoolConfig is equivalent to jwk.SetBufferPoolConfig, as the
+// buffer pool is shared among the jwk, jws, jwe, and jwt packages.
+func SetBufferPoolConfig(initialCap int) {
+	pool.SetBytesBufferInitialCapacity(initialCap)
+}
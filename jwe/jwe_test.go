@@ -1,12 +1,16 @@
 package jwe_test
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/lestrrat-go/jwx/jwa"
@@ -198,7 +202,7 @@ func TestParse_RSAES_OAEP_AES_GCM(t *testing.T) {
 		{
 			Name:     "JSON",
 			Func:     func(m *jwe.Message) ([]byte, error) { return jwe.JSON(m) },
-			Expected: `{"aad":"eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ","ciphertext":"5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A","iv":"48V1_ALb6US04U3b","protected":"eyJlbmMiOiJBMjU2R0NNIn0","recipients":[{"header":{"alg":"RSA-OAEP"},"encrypted_key":"OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg"}],"tag":"XFBoMYUZodetZdvTiFvSkQ"}`,
+			Expected: `{"aad":"eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ","ciphertext":"5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A","iv":"48V1_ALb6US04U3b","protected":"eyJlbmMiOiJBMjU2R0NNIn0","header":{"alg":"RSA-OAEP"},"encrypted_key":"OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg","tag":"XFBoMYUZodetZdvTiFvSkQ"}`,
 		},
 		{
 			Name: "JSON (Pretty)",
@@ -208,14 +212,10 @@ func TestParse_RSAES_OAEP_AES_GCM(t *testing.T) {
   "ciphertext": "5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A",
   "iv": "48V1_ALb6US04U3b",
   "protected": "eyJlbmMiOiJBMjU2R0NNIn0",
-  "recipients": [
-    {
-      "header": {
-        "alg": "RSA-OAEP"
-      },
-      "encrypted_key": "OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg"
-    }
-  ],
+  "header": {
+    "alg": "RSA-OAEP"
+  },
+  "encrypted_key": "OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg",
   "tag": "XFBoMYUZodetZdvTiFvSkQ"
 }`,
 		},
@@ -454,3 +454,1180 @@ func Test_A256KW_A256CBC_HS512(t *testing.T) {
 		return
 	}
 }
+
+func TestEncode_PBES2(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	password := []byte("correct horse battery staple")
+
+	algorithms := []jwa.KeyEncryptionAlgorithm{
+		jwa.PBES2_HS256_A128KW,
+		jwa.PBES2_HS384_A192KW,
+		jwa.PBES2_HS512_A256KW,
+	}
+
+	for _, alg := range algorithms {
+		alg := alg
+		t.Run(alg.String(), func(t *testing.T) {
+			t.Parallel()
+
+			encrypted, err := jwe.Encrypt(plaintext, alg, password, jwa.A256GCM, jwa.NoCompress)
+			if !assert.NoError(t, err, "Encrypt succeeds") {
+				return
+			}
+
+			msg, err := jwe.Parse(encrypted)
+			if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+				return
+			}
+
+			for _, key := range []string{"p2s", "p2c"} {
+				_, ok := msg.Recipients()[0].Headers().Get(key)
+				if !assert.True(t, ok, `%s header should be present`, key) {
+					return
+				}
+			}
+
+			decrypted, err := jwe.Decrypt(encrypted, alg, password)
+			if !assert.NoError(t, err, "Decrypt succeeds") {
+				return
+			}
+			if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+				return
+			}
+		})
+	}
+}
+
+func TestEncryptWithPassword(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	password := []byte("correct horse battery staple")
+
+	t.Run("Roundtrip", func(t *testing.T) {
+		encrypted, err := jwe.EncryptWithPassword(plaintext, password)
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		decrypted, err := jwe.DecryptWithPassword(encrypted, password)
+		if !assert.NoError(t, err, "jwe.DecryptWithPassword should succeed") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Roundtrip with options", func(t *testing.T) {
+		encrypted, err := jwe.EncryptWithPassword(plaintext, password, jwe.WithPBES2Count(1000), jwe.WithPBES2SaltSize(32))
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		msg, err := jwe.Parse(encrypted)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+
+		h := msg.Recipients()[0].Headers()
+		if !assert.Equal(t, jwa.PBES2_HS256_A128KW, h.Algorithm(), `alg should match`) {
+			return
+		}
+		if !assert.Equal(t, jwa.A256GCM, msg.ProtectedHeaders().ContentEncryption(), `enc should match`) {
+			return
+		}
+		p2c, _ := h.Get("p2c")
+		if !assert.Equal(t, float64(1000), p2c, `p2c should match`) {
+			return
+		}
+
+		decrypted, err := jwe.DecryptWithPassword(encrypted, password)
+		if !assert.NoError(t, err, "jwe.DecryptWithPassword should succeed") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Wrong password", func(t *testing.T) {
+		encrypted, err := jwe.EncryptWithPassword(plaintext, password)
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		_, err = jwe.DecryptWithPassword(encrypted, []byte("Tr0ub4dor&3"))
+		if !assert.Error(t, err, "jwe.DecryptWithPassword should fail") {
+			return
+		}
+	})
+	t.Run("Short salt", func(t *testing.T) {
+		_, err := jwe.EncryptWithPassword(plaintext, password, jwe.WithPBES2SaltSize(4))
+		if !assert.Error(t, err, "jwe.EncryptWithPassword should fail") {
+			return
+		}
+	})
+	t.Run("Minimum count", func(t *testing.T) {
+		encrypted, err := jwe.EncryptWithPassword(plaintext, password, jwe.WithPBES2Count(999))
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		_, err = jwe.DecryptWithPassword(encrypted, password)
+		if !assert.Error(t, err, "jwe.DecryptWithPassword should fail with the default minimum") {
+			return
+		}
+
+		_, err = jwe.DecryptWithPassword(encrypted, password, jwe.WithPBES2MinCount(1000000))
+		if !assert.Error(t, err, "jwe.DecryptWithPassword should fail") {
+			return
+		}
+
+		decrypted, err := jwe.DecryptWithPassword(encrypted, password, jwe.WithPBES2MinCount(999))
+		if !assert.NoError(t, err, "jwe.DecryptWithPassword should succeed") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Maximum count", func(t *testing.T) {
+		encrypted, err := jwe.EncryptWithPassword(plaintext, password, jwe.WithPBES2Count(jwe.DefaultPBES2MaxCount+1))
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		_, err = jwe.DecryptWithPassword(encrypted, password)
+		if !assert.Error(t, err, "jwe.DecryptWithPassword should fail with the default maximum") {
+			return
+		}
+
+		encrypted, err = jwe.EncryptWithPassword(plaintext, password, jwe.WithPBES2Count(2000))
+		if !assert.NoError(t, err, "jwe.EncryptWithPassword should succeed") {
+			return
+		}
+
+		_, err = jwe.DecryptWithPassword(encrypted, password, jwe.WithPBES2MaxCount(1999))
+		if !assert.Error(t, err, "jwe.DecryptWithPassword should fail") {
+			return
+		}
+
+		decrypted, err := jwe.DecryptWithPassword(encrypted, password, jwe.WithPBES2MaxCount(2000))
+		if !assert.NoError(t, err, "jwe.DecryptWithPassword should succeed") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+}
+
+func TestEncrypt_SenderKeyID(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	privkey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, "ecdsa key generated") {
+		return
+	}
+
+	encrypted, err := jwe.Encrypt(plaintext, jwa.ECDH_ES_A128KW, &privkey.PublicKey, jwa.A128GCM, jwa.NoCompress, jwe.WithSenderKeyID("sender-1"))
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	msg, err := jwe.Parse(encrypted)
+	if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+		return
+	}
+
+	var protected map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(msg.AuthenticatedData(), &protected), `json.Unmarshal should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "sender-1", protected[jwe.SenderKeyIDKey], `skid should be in the protected header`) {
+		return
+	}
+
+	decrypted, err := jwe.Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey)
+	if !assert.NoError(t, err, "Decrypt succeeds") {
+		return
+	}
+	if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+		return
+	}
+}
+
+func TestEncrypt_EphemeralKey(t *testing.T) {
+	// The key pairs of Bob (the recipient) and Alice (the sender, using
+	// a fixed ephemeral key) from RFC7518 Appendix C
+	parseKey := func(t *testing.T, src string) *ecdsa.PrivateKey {
+		key, err := jwk.ParseKey([]byte(src))
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+			return nil
+		}
+		var raw ecdsa.PrivateKey
+		if !assert.NoError(t, key.Raw(&raw), `key.Raw should succeed`) {
+			return nil
+		}
+		return &raw
+	}
+	privkey := parseKey(t, `{"kty":"EC","crv":"P-256",
+ "x":"weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ",
+ "y":"e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck",
+ "d":"VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw"}`)
+	ephemeral := parseKey(t, `{"kty":"EC","crv":"P-256",
+ "x":"gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0",
+ "y":"SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps",
+ "d":"0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo"}`)
+	if privkey == nil || ephemeral == nil {
+		return
+	}
+
+	plaintext := []byte("Lorem ipsum")
+	for i := 0; i < 2; i++ {
+		encrypted, err := jwe.Encrypt(plaintext, jwa.ECDH_ES_A128KW, &privkey.PublicKey, jwa.A128GCM, jwa.NoCompress, jwe.WithEphemeralKey(ephemeral))
+		if !assert.NoError(t, err, "Encrypt succeeds") {
+			return
+		}
+
+		msg, err := jwe.Parse(encrypted)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+
+		var protected map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(msg.AuthenticatedData(), &protected), `json.Unmarshal should succeed`) {
+			return
+		}
+		expected := map[string]interface{}{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   "gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0",
+			"y":   "SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps",
+		}
+		if !assert.Equal(t, expected, protected[jwe.EphemeralPublicKeyKey], `epk should be the given key`) {
+			return
+		}
+
+		decrypted, err := jwe.Decrypt(encrypted, jwa.ECDH_ES_A128KW, privkey)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	}
+
+	t.Run("Curve mismatch", func(t *testing.T) {
+		p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if !assert.NoError(t, err, "ecdsa key generated") {
+			return
+		}
+		_, err = jwe.Encrypt(plaintext, jwa.ECDH_ES_A128KW, &privkey.PublicKey, jwa.A128GCM, jwa.NoCompress, jwe.WithEphemeralKey(p384))
+		if !assert.Error(t, err, "Encrypt should fail") {
+			return
+		}
+	})
+	t.Run("Non ECDH-ES algorithm", func(t *testing.T) {
+		_, err := jwe.Encrypt(plaintext, jwa.RSA_OAEP, &rsaPrivKey.PublicKey, jwa.A128GCM, jwa.NoCompress, jwe.WithEphemeralKey(ephemeral))
+		if !assert.Error(t, err, "Encrypt should fail") {
+			return
+		}
+	})
+}
+
+func TestDecryptWithRecipient(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	privkey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, "rsa key generated") {
+		return
+	}
+
+	encrypted, err := jwe.Encrypt(plaintext, jwa.RSA_OAEP, &privkey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	// Split the encrypted key from the rest of the message
+	parts := bytes.Split(encrypted, []byte{'.'})
+	if !assert.Len(t, parts, 5, `compact JWE should have five parts`) {
+		return
+	}
+	encryptedKey, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if !assert.NoError(t, err, `base64 decode should succeed`) {
+		return
+	}
+	parts[1] = []byte{}
+	ciphertext := bytes.Join(parts, []byte{'.'})
+
+	t.Run("Without recipient header", func(t *testing.T) {
+		decrypted, err := jwe.DecryptWithRecipient(ciphertext, encryptedKey, nil, privkey)
+		if !assert.NoError(t, err, "DecryptWithRecipient succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("With recipient header", func(t *testing.T) {
+		h := jwe.NewHeaders()
+		if !assert.NoError(t, h.Set(jwe.AlgorithmKey, jwa.RSA_OAEP), `h.Set should succeed`) {
+			return
+		}
+		decrypted, err := jwe.DecryptWithRecipient(ciphertext, encryptedKey, h, privkey)
+		if !assert.NoError(t, err, "DecryptWithRecipient succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Wrong encrypted key", func(t *testing.T) {
+		_, err := jwe.DecryptWithRecipient(ciphertext, []byte("garbage"), nil, privkey)
+		if !assert.Error(t, err, "DecryptWithRecipient should fail") {
+			return
+		}
+	})
+}
+
+func TestDecrypt_AllowedCompression(t *testing.T) {
+	plaintext := []byte("Lorem ipsum")
+	key := []byte("0123456789abcdef")
+
+	compressed, err := jwe.Encrypt(plaintext, jwa.A128KW, key, jwa.A128GCM, jwa.Deflate)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+	uncompressed, err := jwe.Encrypt(plaintext, jwa.A128KW, key, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		decrypted, err := jwe.Decrypt(compressed, jwa.A128KW, key)
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Compression disallowed", func(t *testing.T) {
+		_, err := jwe.Decrypt(compressed, jwa.A128KW, key, jwe.WithAllowedCompression())
+		if !assert.Error(t, err, "Decrypt should fail") {
+			return
+		}
+
+		decrypted, err := jwe.Decrypt(uncompressed, jwa.A128KW, key, jwe.WithAllowedCompression())
+		if !assert.NoError(t, err, "Decrypt of uncompressed message succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Compression explicitly allowed", func(t *testing.T) {
+		decrypted, err := jwe.Decrypt(compressed, jwa.A128KW, key, jwe.WithAllowedCompression(jwa.Deflate))
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+}
+
+func TestDecrypt_MaxDecompressedSize(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); !assert.NoError(t, err, "rand.Read succeeds") {
+		return
+	}
+
+	// Highly compressible, so the compressed message is much smaller
+	// than the decompressed payload
+	plaintext := bytes.Repeat([]byte{'a'}, 1<<20)
+	compressed, err := jwe.Encrypt(plaintext, jwa.A128KW, key, jwa.A128GCM, jwa.Deflate)
+	if !assert.NoError(t, err, "Encrypt succeeds") {
+		return
+	}
+
+	t.Run("Within limit", func(t *testing.T) {
+		decrypted, err := jwe.Decrypt(compressed, jwa.A128KW, key, jwe.WithMaxDecompressedSize(int64(len(plaintext))))
+		if !assert.NoError(t, err, "Decrypt succeeds") {
+			return
+		}
+		if !assert.Equal(t, plaintext, decrypted, "payloads should match") {
+			return
+		}
+	})
+	t.Run("Exceeds limit", func(t *testing.T) {
+		_, err := jwe.Decrypt(compressed, jwa.A128KW, key, jwe.WithMaxDecompressedSize(int64(len(plaintext)-1)))
+		if !assert.Error(t, err, "Decrypt should fail") {
+			return
+		}
+	})
+	t.Run("Default limit", func(t *testing.T) {
+		large := bytes.Repeat([]byte{'a'}, jwe.DefaultMaxDecompressedSize+1)
+		compressed, err := jwe.Encrypt(large, jwa.A128KW, key, jwa.A128GCM, jwa.Deflate)
+		if !assert.NoError(t, err, "Encrypt succeeds") {
+			return
+		}
+		if _, err := jwe.Decrypt(compressed, jwa.A128KW, key); !assert.Error(t, err, "Decrypt should fail") {
+			return
+		}
+
+		decrypted, err := jwe.Decrypt(compressed, jwa.A128KW, key, jwe.WithMaxDecompressedSize(0))
+		if !assert.NoError(t, err, "Decrypt without a limit succeeds") {
+			return
+		}
+		if !assert.Equal(t, large, decrypted, "payloads should match") {
+			return
+		}
+	})
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); !assert.NoError(t, err, "rand.Read succeeds") {
+		return
+	}
+
+	// brotli is not supported, regardless of what is allowed
+	brotli := jwa.CompressionAlgorithm("BR")
+	t.Run("Encrypt", func(t *testing.T) {
+		_, err := jwe.Encrypt([]byte(examplePayload), jwa.A128KW, key, jwa.A128GCM, brotli)
+		if !assert.Error(t, err, "Encrypt should fail") {
+			return
+		}
+	})
+	t.Run("Decrypt", func(t *testing.T) {
+		compressed, err := jwe.Encrypt([]byte(examplePayload), jwa.A128KW, key, jwa.A128GCM, jwa.Deflate)
+		if !assert.NoError(t, err, "Encrypt succeeds") {
+			return
+		}
+
+		parts := bytes.SplitN(compressed, []byte{'.'}, 2)
+		protected, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+		if !assert.NoError(t, err, "base64 decode succeeds") {
+			return
+		}
+		protected = bytes.Replace(protected, []byte(`"zip":"DEF"`), []byte(`"zip":"BR"`), 1)
+		tampered := base64.RawURLEncoding.EncodeToString(protected) + "." + string(parts[1])
+
+		_, err = jwe.Decrypt([]byte(tampered), jwa.A128KW, key, jwe.WithAllowedCompression(jwa.Deflate, brotli))
+		if !assert.Error(t, err, "Decrypt should fail") {
+			return
+		}
+	})
+}
+
+func TestDecryptWithKeys(t *testing.T) {
+	keys := make([]interface{}, 0, 6)
+	for i := 0; i < 5; i++ {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	matching, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+
+	payload := []byte("Lorem ipsum")
+	encrypted, err := jwe.Encrypt(payload, jwa.RSA_OAEP, &matching.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+		return
+	}
+
+	// put the matching key in the middle of the non-matching ones
+	candidates := append(append(append([]interface{}{}, keys[:3]...), matching), keys[3:]...)
+
+	for _, n := range []int{0, 1, 3, 10} {
+		n := n
+		t.Run(fmt.Sprintf("parallelism=%d", n), func(t *testing.T) {
+			decrypted, err := jwe.DecryptWithKeys(encrypted, jwa.RSA_OAEP, candidates, jwe.WithParallelKeyAttempts(n))
+			if !assert.NoError(t, err, `jwe.DecryptWithKeys should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+				return
+			}
+		})
+	}
+	t.Run("No matching key", func(t *testing.T) {
+		_, err := jwe.DecryptWithKeys(encrypted, jwa.RSA_OAEP, keys, jwe.WithParallelKeyAttempts(3))
+		if !assert.Error(t, err, `jwe.DecryptWithKeys should fail`) {
+			return
+		}
+		if !assert.Equal(t, `failed to decrypt message using any of the given keys`, err.Error(), `error should not reveal per-key failures`) {
+			return
+		}
+	})
+	t.Run("Concurrent calls", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				decrypted, err := jwe.DecryptWithKeys(encrypted, jwa.RSA_OAEP, candidates, jwe.WithParallelKeyAttempts(4))
+				assert.NoError(t, err, `jwe.DecryptWithKeys should succeed`)
+				assert.Equal(t, payload, decrypted, `payloads should match`)
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestRecipientContext(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+
+	payload := []byte("Lorem ipsum")
+
+	t.Run("Single recipient", func(t *testing.T) {
+		rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.NoCompress, jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &rsakey.PublicKey})
+		if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+			return
+		}
+
+		for i := 0; i < 2; i++ {
+			msg, err := rc.Encrypt(payload, jwe.WithSenderKeyID("sender"))
+			if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+				return
+			}
+			skid, ok := msg.ProtectedHeaders().Get(jwe.SenderKeyIDKey)
+			if !assert.True(t, ok, `"skid" should exist`) {
+				return
+			}
+			if !assert.Equal(t, "sender", skid, `"skid" should match`) {
+				return
+			}
+
+			encrypted, err := jwe.Compact(msg)
+			if !assert.NoError(t, err, `jwe.Compact should succeed`) {
+				return
+			}
+
+			decrypted, err := jwe.Decrypt(encrypted, jwa.RSA_OAEP, rsakey)
+			if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Multiple recipients, concurrently", func(t *testing.T) {
+		rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.Deflate,
+			jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &rsakey.PublicKey},
+			jwe.RecipientKey{Algorithm: jwa.ECDH_ES_A128KW, Key: &eckey.PublicKey},
+		)
+		if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				msg, err := rc.Encrypt(payload)
+				if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+					return
+				}
+
+				encrypted, err := jwe.JSON(msg)
+				if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+					return
+				}
+
+				decrypted, err := jwe.Decrypt(encrypted, jwa.RSA_OAEP, rsakey)
+				if !assert.NoError(t, err, `jwe.Decrypt (RSA) should succeed`) {
+					return
+				}
+				assert.Equal(t, payload, decrypted, `payloads should match`)
+
+				decrypted, err = jwe.Decrypt(encrypted, jwa.ECDH_ES_A128KW, eckey)
+				if !assert.NoError(t, err, `jwe.Decrypt (ECDH-ES) should succeed`) {
+					return
+				}
+				assert.Equal(t, payload, decrypted, `payloads should match`)
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("Invalid key", func(t *testing.T) {
+		_, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.NoCompress, jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &eckey.PublicKey})
+		if !assert.Error(t, err, `jwe.NewRecipientContext should fail`) {
+			return
+		}
+	})
+	t.Run("No recipients", func(t *testing.T) {
+		_, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.NoCompress)
+		if !assert.Error(t, err, `jwe.NewRecipientContext should fail`) {
+			return
+		}
+	})
+}
+
+func TestMessageReserialize(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+
+	payload := []byte("Lorem ipsum")
+	compact, err := jwe.Encrypt(payload, jwa.RSA_OAEP, &rsakey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+	if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+		return
+	}
+
+	msg, err := jwe.Parse(compact)
+	if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+		return
+	}
+
+	jsonbuf, err := json.Marshal(msg)
+	if !assert.NoError(t, err, `json.Marshal should succeed`) {
+		return
+	}
+
+	var flattened map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(jsonbuf, &flattened), `json.Unmarshal should succeed`) {
+		return
+	}
+	for _, key := range []string{"header", "encrypted_key"} {
+		if !assert.Contains(t, flattened, key, `flattened JSON should contain %q`, key) {
+			return
+		}
+	}
+	if !assert.NotContains(t, flattened, jwe.RecipientsKey, `flattened JSON should not contain "recipients"`) {
+		return
+	}
+
+	decrypted, err := jwe.Decrypt(jsonbuf, jwa.RSA_OAEP, rsakey)
+	if !assert.NoError(t, err, `jwe.Decrypt (JSON) should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+		return
+	}
+
+	msg2, err := jwe.Parse(jsonbuf)
+	if !assert.NoError(t, err, `jwe.Parse (JSON) should succeed`) {
+		return
+	}
+	if !assert.Len(t, msg2.Recipients(), 1, `there should be one recipient`) {
+		return
+	}
+
+	compact2, err := msg2.Compact()
+	if !assert.NoError(t, err, `msg.Compact should succeed`) {
+		return
+	}
+	if !assert.Equal(t, compact, compact2, `compact serializations should match`) {
+		return
+	}
+
+	decrypted, err = jwe.Decrypt(compact2, jwa.RSA_OAEP, rsakey)
+	if !assert.NoError(t, err, `jwe.Decrypt (compact) should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+		return
+	}
+}
+
+func TestHeaderPlacement(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	payload := []byte("Lorem ipsum")
+
+	// headerNames returns the names of the members of each header
+	// in the JSON serialization of the message
+	headerNames := func(t *testing.T, msg *jwe.Message) (protected map[string]struct{}, recipients []map[string]struct{}) {
+		buf, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return nil, nil
+		}
+
+		var raw struct {
+			Protected  string                       `json:"protected"`
+			Header     map[string]json.RawMessage   `json:"header"`
+			Recipients []map[string]json.RawMessage `json:"recipients"`
+		}
+		if !assert.NoError(t, json.Unmarshal(buf, &raw), `json.Unmarshal should succeed`) {
+			return nil, nil
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(raw.Protected)
+		if !assert.NoError(t, err, `decoding protected header should succeed`) {
+			return nil, nil
+		}
+		var ph map[string]json.RawMessage
+		if !assert.NoError(t, json.Unmarshal(decoded, &ph), `json.Unmarshal should succeed`) {
+			return nil, nil
+		}
+
+		names := func(m map[string]json.RawMessage) map[string]struct{} {
+			set := make(map[string]struct{})
+			for k := range m {
+				set[k] = struct{}{}
+			}
+			return set
+		}
+
+		protected = names(ph)
+		if raw.Recipients == nil {
+			recipients = append(recipients, names(raw.Header))
+		}
+		for _, r := range raw.Recipients {
+			var hdr map[string]json.RawMessage
+			if h, ok := r["header"]; ok {
+				if !assert.NoError(t, json.Unmarshal(h, &hdr), `json.Unmarshal should succeed`) {
+					return nil, nil
+				}
+			}
+			recipients = append(recipients, names(hdr))
+		}
+		return protected, recipients
+	}
+
+	t.Run("Multiple recipients", func(t *testing.T) {
+		rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.Deflate,
+			jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &rsakey.PublicKey},
+			jwe.RecipientKey{Algorithm: jwa.ECDH_ES_A128KW, Key: &eckey.PublicKey},
+		)
+		if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+			return
+		}
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+
+		protected, recipients := headerNames(t, msg)
+		if !assert.Equal(t, map[string]struct{}{"enc": {}, "zip": {}}, protected, `protected header should only contain "enc" and "zip"`) {
+			return
+		}
+		if !assert.Len(t, recipients, 2, `there should be two recipients`) {
+			return
+		}
+		for i, names := range recipients {
+			if !assert.Contains(t, names, "alg", `recipient #%d should contain "alg"`, i) {
+				return
+			}
+			for name := range protected {
+				if !assert.NotContains(t, names, name, `recipient #%d should not contain %q`, i, name) {
+					return
+				}
+			}
+		}
+	})
+	t.Run("Single recipient", func(t *testing.T) {
+		rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.Deflate, jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &rsakey.PublicKey})
+		if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+			return
+		}
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+
+		protected, recipients := headerNames(t, msg)
+		if !assert.Equal(t, map[string]struct{}{"alg": {}, "enc": {}, "zip": {}}, protected, `protected header should contain "alg", "enc", and "zip"`) {
+			return
+		}
+		if !assert.Len(t, recipients, 1, `there should be one recipient`) {
+			return
+		}
+		if !assert.Empty(t, recipients[0], `recipient header should be empty`) {
+			return
+		}
+
+		buf, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(buf, jwa.RSA_OAEP, rsakey)
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Parsed compact", func(t *testing.T) {
+		compact, err := jwe.Encrypt(payload, jwa.RSA_OAEP, &rsakey.PublicKey, jwa.A128GCM, jwa.Deflate)
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		msg, err := jwe.Parse(compact)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+
+		protected, recipients := headerNames(t, msg)
+		if !assert.Equal(t, map[string]struct{}{"enc": {}, "zip": {}}, protected, `protected header should only contain "enc" and "zip"`) {
+			return
+		}
+		if !assert.Equal(t, []map[string]struct{}{{"alg": {}}}, recipients, `recipient header should only contain "alg"`) {
+			return
+		}
+
+		reserialized, err := msg.Compact()
+		if !assert.NoError(t, err, `msg.Compact should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(reserialized, jwa.RSA_OAEP, rsakey)
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+}
+
+func TestDecrypt_ExpectedKeyEncryptionAlgorithm(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	payload := []byte("Lorem ipsum")
+
+	t.Run("Matching algorithm", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(payload, jwa.RSA_OAEP_256, &rsakey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(encrypted, jwa.RSA_OAEP_256, rsakey, jwe.WithExpectedKeyEncryptionAlgorithm(jwa.RSA_OAEP_256))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Downgraded algorithm", func(t *testing.T) {
+		// same key, but wrapped with the weaker RSA1_5
+		encrypted, err := jwe.Encrypt(payload, jwa.RSA1_5, &rsakey.PublicKey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwa.RSA1_5, rsakey, jwe.WithExpectedKeyEncryptionAlgorithm(jwa.RSA_OAEP_256))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `does not match expected algorithm`, `error should mention the mismatch`) {
+			return
+		}
+	})
+	t.Run("Mixed recipients", func(t *testing.T) {
+		rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.NoCompress,
+			jwe.RecipientKey{Algorithm: jwa.RSA_OAEP_256, Key: &rsakey.PublicKey},
+			jwe.RecipientKey{Algorithm: jwa.RSA1_5, Key: &rsakey.PublicKey},
+		)
+		if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+			return
+		}
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+		encrypted, err := jwe.JSON(msg)
+		if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwa.RSA_OAEP_256, rsakey, jwe.WithExpectedKeyEncryptionAlgorithm(jwa.RSA_OAEP_256))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+}
+
+func TestDecrypt_MaxRecipients(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); !assert.NoError(t, err, "rand.Read succeeds") {
+		return
+	}
+	payload := []byte("Lorem ipsum")
+
+	rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.NoCompress,
+		jwe.RecipientKey{Algorithm: jwa.A128KW, Key: key},
+		jwe.RecipientKey{Algorithm: jwa.A128KW, Key: key},
+		jwe.RecipientKey{Algorithm: jwa.A128KW, Key: key},
+	)
+	if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+		return
+	}
+	msg, err := rc.Encrypt(payload)
+	if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+		return
+	}
+	encrypted, err := jwe.JSON(msg)
+	if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+		return
+	}
+
+	t.Run("Within limit", func(t *testing.T) {
+		decrypted, err := jwe.Decrypt(encrypted, jwa.A128KW, key, jwe.WithMaxRecipients(3))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Exceeds limit", func(t *testing.T) {
+		_, err := jwe.Decrypt(encrypted, jwa.A128KW, key, jwe.WithMaxRecipients(2))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+	t.Run("Exceeds default limit", func(t *testing.T) {
+		var raw map[string]json.RawMessage
+		if !assert.NoError(t, json.Unmarshal(encrypted, &raw), `json.Unmarshal should succeed`) {
+			return
+		}
+		var recipients []json.RawMessage
+		if !assert.NoError(t, json.Unmarshal(raw[jwe.RecipientsKey], &recipients), `json.Unmarshal should succeed`) {
+			return
+		}
+		for len(recipients) <= jwe.DefaultMaxRecipients {
+			recipients = append(recipients, recipients[0])
+		}
+		buf, err := json.Marshal(recipients)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		raw[jwe.RecipientsKey] = buf
+		padded, err := json.Marshal(raw)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		_, err = jwe.Decrypt(padded, jwa.A128KW, key)
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(padded, jwa.A128KW, key, jwe.WithMaxRecipients(0))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed without a limit`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+}
+
+func TestMessageAddRecipient(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	newkey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	sharedkey := make([]byte, 16)
+	if _, err := rand.Read(sharedkey); !assert.NoError(t, err, "rand.Read succeeds") {
+		return
+	}
+	payload := []byte("Lorem ipsum")
+
+	rc, err := jwe.NewRecipientContext(jwa.A128GCM, jwa.Deflate,
+		jwe.RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &rsakey.PublicKey},
+		jwe.RecipientKey{Algorithm: jwa.ECDH_ES_A128KW, Key: &eckey.PublicKey},
+	)
+	if !assert.NoError(t, err, `jwe.NewRecipientContext should succeed`) {
+		return
+	}
+
+	t.Run("Encrypted message", func(t *testing.T) {
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+		if !assert.NoError(t, msg.AddRecipient(jwa.RSA_OAEP_256, &newkey.PublicKey), `msg.AddRecipient should succeed`) {
+			return
+		}
+		if !assert.Len(t, msg.Recipients(), 3, `there should be three recipients`) {
+			return
+		}
+
+		encrypted, err := jwe.JSON(msg)
+		if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(encrypted, jwa.RSA_OAEP_256, newkey)
+		if !assert.NoError(t, err, `jwe.Decrypt using the new recipient's key should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+		decrypted, err = jwe.Decrypt(encrypted, jwa.RSA_OAEP, rsakey)
+		if !assert.NoError(t, err, `jwe.Decrypt using an existing recipient's key should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Parsed message", func(t *testing.T) {
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+		encrypted, err := jwe.JSON(msg)
+		if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+			return
+		}
+
+		parsed, err := jwe.Parse(encrypted)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		if !assert.Error(t, parsed.AddRecipient(jwa.RSA_OAEP_256, &newkey.PublicKey), `msg.AddRecipient should fail before decryption`) {
+			return
+		}
+
+		if _, err := parsed.Decrypt(jwa.ECDH_ES_A128KW, eckey); !assert.NoError(t, err, `msg.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Error(t, parsed.AddRecipient(jwa.RSA_OAEP_256, &newkey.PublicKey), `msg.AddRecipient should fail if the key was not kept`) {
+			return
+		}
+
+		if _, err := parsed.Decrypt(jwa.ECDH_ES_A128KW, eckey, jwe.WithKeepContentEncryptionKey(true)); !assert.NoError(t, err, `msg.Decrypt should succeed`) {
+			return
+		}
+		if !assert.NoError(t, parsed.AddRecipient(jwa.RSA_OAEP_256, &newkey.PublicKey), `msg.AddRecipient should succeed after decryption`) {
+			return
+		}
+
+		encrypted, err = jwe.JSON(parsed)
+		if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(encrypted, jwa.RSA_OAEP_256, newkey)
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Algorithm in protected header", func(t *testing.T) {
+		compact, err := jwe.Encrypt(payload, jwa.A128KW, sharedkey, jwa.A128GCM, jwa.NoCompress)
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		msg, err := jwe.Parse(compact)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		if _, err := msg.Decrypt(jwa.A128KW, sharedkey, jwe.WithKeepContentEncryptionKey(true)); !assert.NoError(t, err, `msg.Decrypt should succeed`) {
+			return
+		}
+
+		if !assert.Error(t, msg.AddRecipient(jwa.RSA_OAEP, &rsakey.PublicKey), `msg.AddRecipient with a different algorithm should fail`) {
+			return
+		}
+
+		otherkey := make([]byte, 16)
+		if _, err := rand.Read(otherkey); !assert.NoError(t, err, "rand.Read succeeds") {
+			return
+		}
+		if !assert.NoError(t, msg.AddRecipient(jwa.A128KW, otherkey), `msg.AddRecipient with the same algorithm should succeed`) {
+			return
+		}
+		encrypted, err := jwe.JSON(msg)
+		if !assert.NoError(t, err, `jwe.JSON should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(encrypted, jwa.A128KW, otherkey)
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Direct key agreement", func(t *testing.T) {
+		msg, err := rc.Encrypt(payload)
+		if !assert.NoError(t, err, `rc.Encrypt should succeed`) {
+			return
+		}
+		if !assert.Error(t, msg.AddRecipient(jwa.ECDH_ES, &rsakey.PublicKey), `msg.AddRecipient should fail`) {
+			return
+		}
+	})
+}
+
+func TestDecrypt_CriticalHeaders(t *testing.T) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); !assert.NoError(t, err, "rand.Read succeeds") {
+		return
+	}
+	payload := []byte("Lorem ipsum")
+
+	encrypted, err := jwe.Encrypt(payload, jwa.A128KW, key, jwa.A128GCM, jwa.NoCompress, jwe.WithCriticalHeader("x-policy-id", "policy-1"))
+	if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+		return
+	}
+
+	msg, err := jwe.Parse(encrypted)
+	if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+		return
+	}
+	if !assert.Equal(t, []string{"x-policy-id"}, msg.ProtectedHeaders().Critical(), `"crit" should be set`) {
+		return
+	}
+	if v, ok := msg.ProtectedHeaders().Get("x-policy-id"); !assert.True(t, ok, `"x-policy-id" should be set`) || !assert.Equal(t, "policy-1", v, `"x-policy-id" should match`) {
+		return
+	}
+
+	t.Run("Understood", func(t *testing.T) {
+		decrypted, err := jwe.Decrypt(encrypted, jwa.A128KW, key, jwe.WithCriticalHeaders([]string{"x-other", "x-policy-id"}))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Not understood", func(t *testing.T) {
+		for _, options := range [][]jwe.Option{nil, {jwe.WithCriticalHeaders([]string{"x-other"})}} {
+			_, err := jwe.Decrypt(encrypted, jwa.A128KW, key, options...)
+			if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+				return
+			}
+			if !assert.Contains(t, err.Error(), `x-policy-id`, `error should mention the header`) {
+				return
+			}
+		}
+	})
+	t.Run("Standard header", func(t *testing.T) {
+		_, err := jwe.Encrypt(payload, jwa.A128KW, key, jwa.A128GCM, jwa.NoCompress, jwe.WithCriticalHeader(jwe.KeyIDKey, "foo"))
+		if !assert.Error(t, err, `jwe.Encrypt should fail`) {
+			return
+		}
+	})
+}
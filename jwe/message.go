@@ -10,6 +10,7 @@ import (
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwe/internal/cipher"
+	"github.com/lestrrat-go/jwx/jwe/internal/content_crypt"
 	"github.com/lestrrat-go/pdebug"
 	"github.com/pkg/errors"
 )
@@ -56,6 +57,14 @@ func (r *stdRecipient) UnmarshalJSON(buf []byte) error {
 }
 
 func (r *stdRecipient) MarshalJSON() ([]byte, error) {
+	// The recipient header may be empty, e.g. when all of the members
+	// have been placed in the protected header
+	if z, ok := r.headers.(isZeroer); r.headers == nil || (ok && z.isZero()) {
+		return json.Marshal(struct {
+			EncryptedKey buffer.Buffer `json:"encrypted_key"`
+		}{EncryptedKey: r.encryptedKey})
+	}
+
 	var proxy recipientMarshalProxy
 	proxy.Headers = r.headers
 	proxy.EncryptedKey = r.encryptedKey
@@ -201,10 +210,16 @@ type messageMarshalProxy struct {
 	InitializationVector *buffer.Buffer    `json:"iv,omitempty"`
 	ProtectedHeaders     json.RawMessage   `json:"protected"`
 	Recipients           []json.RawMessage `json:"recipients"`
+	Header               json.RawMessage   `json:"header,omitempty"`
+	EncryptedKey         json.RawMessage   `json:"encrypted_key,omitempty"`
 	Tag                  *buffer.Buffer    `json:"tag,omitempty"`
 	UnprotectedHeaders   Headers           `json:"unprotected,omitempty"`
 }
 
+// MarshalJSON encodes the message in the JWE JSON serialization format.
+// Messages with exactly one recipient are encoded using the flattened
+// syntax, where the recipient's "header" and "encrypted_key" members
+// appear at the top level instead of in the "recipients" array.
 func (m *Message) MarshalJSON() ([]byte, error) {
 	// This is slightly convoluted, but we need to encode the
 	// protected headers, so we do it by hand
@@ -260,9 +275,18 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 	if wrote {
 		fmt.Fprintf(&buf, `,`)
 	}
-	fmt.Fprintf(&buf, `%#v:`, RecipientsKey)
-	if err := enc.Encode(m.Recipients()); err != nil {
-		return nil, errors.Wrapf(err, `failed to encode %s field`, RecipientsKey)
+	if recipients := m.Recipients(); len(recipients) == 1 {
+		// Flattened syntax: inline the members of the sole recipient
+		encoded, err := json.Marshal(recipients[0])
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to encode recipient`)
+		}
+		buf.Write(bytes.TrimSuffix(bytes.TrimPrefix(encoded, []byte{'{'}), []byte{'}'}))
+	} else {
+		fmt.Fprintf(&buf, `%#v:`, RecipientsKey)
+		if err := enc.Encode(recipients); err != nil {
+			return nil, errors.Wrapf(err, `failed to encode %s field`, RecipientsKey)
+		}
 	}
 
 	if tag := m.Tag(); len(tag) > 0 {
@@ -305,6 +329,19 @@ func (m *Message) UnmarshalJSON(buf []byte) error {
 		return errors.Wrap(err, `failed to decode protected headers`)
 	}
 
+	if len(proxy.Header) > 0 || len(proxy.EncryptedKey) > 0 {
+		// Flattened syntax. The recipient members are at the top level
+		if len(proxy.Recipients) > 0 {
+			return errors.New(`message must not contain both "recipients" and flattened recipient members`)
+		}
+
+		recipient := NewRecipient()
+		if err := json.Unmarshal(buf, recipient); err != nil {
+			return errors.Wrap(err, `failed to decode flattened recipient`)
+		}
+		m.recipients = append(m.recipients, recipient)
+	}
+
 	for i, recipientbuf := range proxy.Recipients {
 		recipient := NewRecipient()
 		if err := json.Unmarshal(recipientbuf, recipient); err != nil {
@@ -325,14 +362,58 @@ func (m *Message) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
-// Decrypt decrypts the message using the specified algorithm and key
-func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]byte, error) {
+// Compact encodes the message in the JWE compact serialization format.
+// See `jwe.Compact` for details
+func (m *Message) Compact(options ...Option) ([]byte, error) {
+	return Compact(m, options...)
+}
+
+// Decrypt decrypts the message using the specified algorithm and key.
+// See `jwe.Decrypt` for the options that can be specified.
+func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}, options ...Option) ([]byte, error) {
 	var err error
 
+	allowedCompression := []jwa.CompressionAlgorithm{jwa.Deflate}
+	maxDecompressedSize := int64(DefaultMaxDecompressedSize)
+	var expectedAlg jwa.KeyEncryptionAlgorithm
+	pbes2MinCount := DefaultPBES2MinCount
+	pbes2MaxCount := DefaultPBES2MaxCount
+	maxRecipients := DefaultMaxRecipients
+	var keepKey bool
+	var understoodCritical []string
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyAllowedCompression:
+			allowedCompression = o.Value().([]jwa.CompressionAlgorithm)
+		case optkeyMaxDecompressedSize:
+			maxDecompressedSize = o.Value().(int64)
+		case optkeyExpectedKeyEncryptionAlgorithm:
+			expectedAlg = o.Value().(jwa.KeyEncryptionAlgorithm)
+		case optkeyPBES2MinCount:
+			pbes2MinCount = o.Value().(int)
+		case optkeyPBES2MaxCount:
+			pbes2MaxCount = o.Value().(int)
+		case optkeyMaxRecipients:
+			maxRecipients = o.Value().(int)
+		case optkeyKeepContentEncryptionKey:
+			keepKey = o.Value().(bool)
+		case optkeyCriticalHeaders:
+			understoodCritical = o.Value().([]string)
+		}
+	}
+
 	if len(m.recipients) == 0 {
 		return nil, errors.New("no recipients, can not proceed with decrypt")
 	}
 
+	if maxRecipients > 0 && len(m.recipients) > maxRecipients {
+		return nil, errors.Errorf(`too many recipients (%d > %d)`, len(m.recipients), maxRecipients)
+	}
+
+	if err := m.checkCritical(understoodCritical); err != nil {
+		return nil, errors.Wrap(err, `invalid "crit" header`)
+	}
+
 	enc := m.protectedHeaders.ContentEncryption()
 
 	h, err := mergeHeaders(context.TODO(), nil, m.protectedHeaders)
@@ -347,6 +428,21 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 		return nil, errors.Wrap(err, "failed to merge headers for message decryption")
 	}
 
+	if expectedAlg != "" {
+		if alg != expectedAlg {
+			return nil, errors.Errorf(`key encryption algorithm %s does not match expected algorithm %s`, alg, expectedAlg)
+		}
+		for i, recipient := range m.recipients {
+			v := recipient.Headers().Algorithm()
+			if v == "" {
+				v = h.Algorithm()
+			}
+			if v != expectedAlg {
+				return nil, errors.Errorf(`"alg" header %s of recipient #%d does not match expected algorithm %s`, v, i+1, expectedAlg)
+			}
+		}
+	}
+
 	aad, err := m.authenticatedData.Base64Encode()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to base64 encode authenticated data for message decryption")
@@ -362,20 +458,12 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 	keysize := cipher.KeySize()
 
 	var plaintext []byte
+	var decryptedKey []byte
 	var lastError error
 	for _, recipient := range m.recipients {
 		// strategy: try each recipient. If we fail in one of the steps,
 		// keep looping because there might be another key with the same algo
 
-		if pdebug.Enabled {
-			pdebug.Printf("Attempting to check if we can decode for recipient (alg = %s)", recipient.Headers().Algorithm())
-		}
-
-		if recipient.Headers().Algorithm() != alg {
-			// algorithms don't match
-			continue
-		}
-
 		h2, err := mergeHeaders(context.TODO(), nil, h)
 		if err != nil {
 			lastError = errors.Wrap(err, `failed to copy headers (1)`)
@@ -394,6 +482,35 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 			continue
 		}
 
+		// "alg" is usually in the recipient header, but it may also be
+		// in the protected header when there is only one recipient
+		if pdebug.Enabled {
+			pdebug.Printf("Attempting to check if we can decode for recipient (alg = %s)", h2.Algorithm())
+		}
+
+		if h2.Algorithm() != alg {
+			// algorithms don't match
+			continue
+		}
+
+		if zip := h2.Compression(); zip != jwa.NoCompress && !isAllowedCompression(zip, allowedCompression) {
+			return nil, errors.Errorf(`compression algorithm %s is not allowed`, zip)
+		}
+
+		if isPBES2(alg) {
+			count, err := pbes2Count(h2)
+			if err != nil {
+				lastError = err
+				continue
+			}
+			if count < pbes2MinCount {
+				return nil, errors.Errorf(`PBES2 iteration count %d is less than the minimum %d`, count, pbes2MinCount)
+			}
+			if pbes2MaxCount > 0 && count > pbes2MaxCount {
+				return nil, errors.Errorf(`PBES2 iteration count %d is greater than the maximum %d`, count, pbes2MaxCount)
+			}
+		}
+
 		k, err := buildKeyDecrypter(h2.Algorithm(), h2, key, keysize)
 		if err != nil {
 			lastError = errors.Wrap(err, `failed to build key decrypter`)
@@ -421,9 +538,11 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 			continue
 		}
 
-		if h2.Compression() == jwa.Deflate {
-			buf, err := uncompress(plaintext)
+		if zip := h2.Compression(); zip != jwa.NoCompress {
+			buf, err := uncompress(plaintext, zip, maxDecompressedSize)
 			if err != nil {
+				// do not return the compressed payload
+				plaintext = nil
 				lastError = errors.Wrap(err, `failed to uncompress payload`)
 				if pdebug.Enabled {
 					pdebug.Printf(`%s`, lastError)
@@ -433,6 +552,7 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 			plaintext = buf
 		}
 
+		decryptedKey = cek
 		break
 	}
 
@@ -443,9 +563,106 @@ func (m *Message) Decrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) ([]by
 		return nil, errors.New("failed to find matching recipient to decrypt key")
 	}
 
+	if keepKey {
+		m.mu.Lock()
+		m.cek = decryptedKey
+		m.mu.Unlock()
+	}
+
 	return plaintext, nil
 }
 
+// AddRecipient encrypts the content encryption key of the message for
+// a new recipient using the given key encryption algorithm and key, and
+// appends the recipient to the message. The content is not re-encrypted.
+// Use jwe.JSON or json.Marshal to serialize the resulting message.
+//
+// The content encryption key is only known after the message has been
+// encrypted, or decrypted using the WithKeepContentEncryptionKey option,
+// so this fails for messages that have only been parsed.
+//
+// `alg` must wrap the content encryption key, so "dir" and "ECDH-ES"
+// cannot be used. If the protected header contains "alg" (as messages
+// with a single recipient do), `alg` must match it, as the protected
+// header cannot be changed without re-encrypting.
+func (m *Message) AddRecipient(alg jwa.KeyEncryptionAlgorithm, key interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cek == nil {
+		return errors.New(`content encryption key is not available (encrypt or decrypt the message first)`)
+	}
+
+	switch alg {
+	case jwa.DIRECT, jwa.ECDH_ES:
+		return errors.Errorf(`key encryption algorithm %s cannot be used to add a recipient`, alg)
+	}
+
+	contentcrypt, err := content_crypt.NewAES(m.protectedHeaders.ContentEncryption())
+	if err != nil {
+		return errors.Wrap(err, `failed to create AES encrypter`)
+	}
+
+	enc, keysize, err := buildKeyEncrypter(alg, key, contentcrypt, nil)
+	if err != nil {
+		return err
+	}
+	if enc == nil {
+		return errors.Errorf(`unsupported key encryption algorithm %s`, alg)
+	}
+	if keysize != len(m.cek) {
+		return errors.Errorf(`key encryption algorithm %s requires a different content encryption key size (%d != %d)`, alg, keysize, len(m.cek))
+	}
+
+	enckey, err := enc.Encrypt(m.cek)
+	if err != nil {
+		return errors.Wrap(err, `failed to encrypt key`)
+	}
+
+	r := NewRecipient()
+	if err := r.Headers().Set(AlgorithmKey, alg); err != nil {
+		return errors.Wrap(err, "failed to set header")
+	}
+	if err := r.SetEncryptedKey(enckey.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to set encrypted key")
+	}
+	if hp, ok := enckey.(populater); ok {
+		if err := hp.Populate(r.Headers()); err != nil {
+			return errors.Wrap(err, "failed to populate")
+		}
+	}
+
+	// The protected header and the recipient header must be disjoint
+	hdrs, err := r.Headers().AsMap(context.TODO())
+	if err != nil {
+		return errors.Wrap(err, `failed to convert recipient header to map`)
+	}
+	for name := range hdrs {
+		v, ok := m.protectedHeaders.Get(name)
+		if !ok {
+			continue
+		}
+		if name != AlgorithmKey || v != alg {
+			return errors.Errorf(`header %s of the new recipient conflicts with the protected header`, name)
+		}
+		if err := r.Headers().Remove(name); err != nil {
+			return errors.Wrapf(err, `failed to remove %s from recipient header`, name)
+		}
+	}
+
+	m.recipients = append(m.recipients, r)
+	return nil
+}
+
+func isAllowedCompression(zip jwa.CompressionAlgorithm, allowed []jwa.CompressionAlgorithm) bool {
+	for _, v := range allowed {
+		if v == zip {
+			return true
+		}
+	}
+	return false
+}
+
 func buildContentCipher(alg jwa.ContentEncryptionAlgorithm) (cipher.ContentCipher, error) {
 	switch alg {
 	case jwa.A128GCM, jwa.A192GCM, jwa.A256GCM, jwa.A128CBC_HS256, jwa.A192CBC_HS384, jwa.A256CBC_HS512:
@@ -1,9 +1,154 @@
 package jwe
 
-import "github.com/lestrrat-go/jwx/internal/option"
+import (
+	"crypto/ecdsa"
+
+	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/lestrrat-go/jwx/jwa"
+)
 
 // WithPrettyJSONFormat specifies if the `jwe.JSON` serialization tool
 // should generate pretty-formatted output
 func WithPrettyJSONFormat(b bool) Option {
 	return option.New(optkeyPrettyJSONFormat, b)
 }
+
+// WithPBES2Count specifies the PBKDF2 iteration count used by
+// `jwe.EncryptWithPassword` to derive the key encryption key
+func WithPBES2Count(n int) Option {
+	return option.New(optkeyPBES2Count, n)
+}
+
+// WithPBES2SaltSize specifies the number of random bytes generated for
+// the salt input ("p2s") by `jwe.EncryptWithPassword`. RFC7518 requires
+// this value to be 8 or more
+func WithPBES2SaltSize(n int) Option {
+	return option.New(optkeyPBES2SaltSize, n)
+}
+
+// WithPBES2MinCount specifies the minimum PBKDF2 iteration count ("p2c")
+// that `jwe.Decrypt` accepts for messages encrypted using the PBES2 family
+// of key encryption algorithms. Messages with a lower count are rejected
+// before the key is derived. By default DefaultPBES2MinCount is used.
+func WithPBES2MinCount(n int) Option {
+	return option.New(optkeyPBES2MinCount, n)
+}
+
+// WithPBES2MaxCount specifies the maximum PBKDF2 iteration count ("p2c")
+// that `jwe.Decrypt` accepts for messages encrypted using the PBES2 family
+// of key encryption algorithms. Messages with a higher count are rejected
+// before the key is derived, as the count is chosen by the sender and
+// each iteration costs CPU time. By default DefaultPBES2MaxCount is used.
+// A value of 0 or less removes the limit.
+func WithPBES2MaxCount(n int) Option {
+	return option.New(optkeyPBES2MaxCount, n)
+}
+
+// WithMaxRecipients specifies the maximum number of recipients that a
+// message may have for `jwe.Decrypt` to process it. Messages with more
+// recipients are rejected before any key is unwrapped, as each recipient
+// may cost an expensive key unwrap attempt. By default
+// DefaultMaxRecipients is used. A value of 0 or less removes the limit.
+func WithMaxRecipients(n int) Option {
+	return option.New(optkeyMaxRecipients, n)
+}
+
+// WithKeepContentEncryptionKey specifies whether `(*jwe.Message).Decrypt`
+// should keep the decrypted content encryption key in the message, so
+// that new recipients can be added using `(*jwe.Message).AddRecipient`.
+// By default the key is not kept, so that it does not stay in memory for
+// longer than necessary.
+func WithKeepContentEncryptionKey(b bool) Option {
+	return option.New(optkeyKeepContentEncryptionKey, b)
+}
+
+// WithSenderKeyID specifies the value of the "skid" (sender key ID)
+// header to be included in the protected header by `jwe.Encrypt`
+func WithSenderKeyID(skid string) Option {
+	return option.New(optkeySenderKeyID, skid)
+}
+
+type criticalHeader struct {
+	name  string
+	value interface{}
+}
+
+// WithCriticalHeader specifies an extension header to be included in
+// the protected header by `jwe.Encrypt`. The header is also listed in
+// the "crit" header, so that recipients that do not understand it
+// reject the message. Specify it multiple times for several headers.
+func WithCriticalHeader(name string, value interface{}) Option {
+	return option.New(optkeyCriticalHeader, &criticalHeader{
+		name:  name,
+		value: value,
+	})
+}
+
+// WithContentType specifies the value of the "cty" (content type) header
+// to be included in the protected header by `jwe.Encrypt`. Use "JWT"
+// when the payload is itself a JWT, i.e. for nested tokens.
+func WithContentType(cty string) Option {
+	return option.New(optkeyContentType, cty)
+}
+
+// WithEphemeralKey specifies the ephemeral private key that `jwe.Encrypt`
+// uses for the ECDH-ES key agreement, instead of generating a new one.
+// The key must be on the same curve as the recipient's key, and its
+// public key is written in the "epk" header.
+//
+// This option is meant for producing deterministic test vectors ONLY.
+// Reusing an ephemeral key defeats the forward secrecy that ECDH-ES
+// provides.
+func WithEphemeralKey(priv *ecdsa.PrivateKey) Option {
+	return option.New(optkeyEphemeralKey, priv)
+}
+
+// WithCriticalHeaders specifies the names of the extension headers that
+// the caller of `jwe.Decrypt` understands. Messages whose "crit" header
+// lists any other header are rejected, as required by RFC7516.
+func WithCriticalHeaders(names []string) Option {
+	return option.New(optkeyCriticalHeaders, names)
+}
+
+// WithAllowedCompression specifies the compression algorithms ("zip")
+// that are accepted by `jwe.Decrypt`. Messages compressed using other
+// algorithms are rejected before the payload is decrypted or decompressed.
+// Specifying no algorithms disallows compression altogether.
+//
+// By default `jwa.Deflate` is allowed. It is also the only compression
+// algorithm that is supported: non-standard algorithms such as brotli
+// ("BR") are not registered by RFC7518, have no implementation in the
+// standard library, and are rejected when encrypting and decrypting.
+func WithAllowedCompression(algs ...jwa.CompressionAlgorithm) Option {
+	return option.New(optkeyAllowedCompression, algs)
+}
+
+// WithMaxDecompressedSize specifies the maximum size, in bytes, of the
+// payload after it has been decompressed by `jwe.Decrypt`. Decompression
+// is aborted and the message is rejected once the limit is exceeded,
+// which guards against decompression bombs from untrusted senders.
+//
+// By default the size is limited to DefaultMaxDecompressedSize. Specify
+// zero or a negative value to remove the limit, which should only be
+// done for messages from trusted senders.
+func WithMaxDecompressedSize(n int64) Option {
+	return option.New(optkeyMaxDecompressedSize, n)
+}
+
+// WithExpectedKeyEncryptionAlgorithm pins the key management algorithm
+// ("alg") that `jwe.Decrypt` accepts. If the "alg" header of any of the
+// recipients differs from `alg`, the message is rejected before anything
+// is decrypted. This guards against downgrade attacks, such as forcing
+// ECDH-ES where a sender-authenticated algorithm is expected.
+//
+// Without this option, recipients using other algorithms are skipped.
+func WithExpectedKeyEncryptionAlgorithm(alg jwa.KeyEncryptionAlgorithm) Option {
+	return option.New(optkeyExpectedKeyEncryptionAlgorithm, alg)
+}
+
+// WithParallelKeyAttempts specifies the maximum number of candidate keys
+// that `jwe.DecryptWithKeys` attempts to use concurrently. Values less
+// than 2 mean that the keys are tried sequentially
+func WithParallelKeyAttempts(n int) Option {
+	return option.New(optkeyParallelKeyAttempts, n)
+}
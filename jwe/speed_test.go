@@ -2,7 +2,11 @@ package jwe
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"testing"
+
+	"github.com/lestrrat-go/jwx/jwa"
 )
 
 var s = []byte(`eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ.OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg.48V1_ALb6US04U3b.5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A.XFBoMYUZodetZdvTiFvSkQ`)
@@ -48,3 +52,34 @@ func SplitManual(parts [][]byte, buf []byte) {
 
 	parts[4] = buf
 }
+
+func BenchmarkEncrypt(b *testing.B) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	payload := []byte("Lorem ipsum")
+
+	b.Run("jwe.Encrypt", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Encrypt(payload, jwa.RSA_OAEP, &key.PublicKey, jwa.A128GCM, jwa.NoCompress); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("RecipientContext.Encrypt", func(b *testing.B) {
+		rc, err := NewRecipientContext(jwa.A128GCM, jwa.NoCompress, RecipientKey{Algorithm: jwa.RSA_OAEP, Key: &key.PublicKey})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			msg, err := rc.Encrypt(payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := Compact(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
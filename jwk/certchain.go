@@ -8,6 +8,22 @@ import (
 	"github.com/pkg/errors"
 )
 
+// VerifyX5C verifies the certificate chain stored in the "x5c" field of
+// the given key against the roots in `roots`, and makes sure that the
+// public key in the leaf (first) certificate matches the key. If `roots`
+// is nil, the system roots are used.
+//
+// Note that the certificates in "x5c" are encoded in standard base64,
+// not base64url. Both padded and unpadded values are accepted when
+// the key is parsed.
+func VerifyX5C(key Key, roots *x509.CertPool) error {
+	certs := key.X509CertChain()
+	if len(certs) == 0 {
+		return errors.Errorf(`key does not have the %s field`, X509CertChainKey)
+	}
+	return verifyCertificateChain(key, certs, roots)
+}
+
 func (c CertificateChain) MarshalJSON() ([]byte, error) {
 	certs := c.Get()
 	encoded := make([]string, len(certs))
@@ -6,12 +6,18 @@ import (
 	"crypto/elliptic"
 	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/lestrrat-go/jwx/internal/base64"
+	"github.com/lestrrat-go/jwx/internal/brainpool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
 
+// ecdsaNumericParams lists the EC key members that represent big
+// integers. These are normalized before comparison in Equal
+var ecdsaNumericParams = []string{ECDSADKey, ECDSAXKey, ECDSAYKey}
+
 func NewECDSAPublicKey() ECDSAPublicKey {
 	return newECDSAPublicKey()
 }
@@ -19,6 +25,7 @@ func NewECDSAPublicKey() ECDSAPublicKey {
 func newECDSAPublicKey() *ecdsaPublicKey {
 	return &ecdsaPublicKey{
 		privateParams: make(map[string]interface{}),
+		mu:            &sync.RWMutex{},
 	}
 }
 
@@ -29,67 +36,78 @@ func NewECDSAPrivateKey() ECDSAPrivateKey {
 func newECDSAPrivateKey() *ecdsaPrivateKey {
 	return &ecdsaPrivateKey{
 		privateParams: make(map[string]interface{}),
+		mu:            &sync.RWMutex{},
 	}
 }
 
 func (k *ecdsaPublicKey) FromRaw(rawKey *ecdsa.PublicKey) error {
-	k.x = rawKey.X.Bytes()
-	k.y = rawKey.Y.Bytes()
-	switch rawKey.Curve {
-	case elliptic.P256():
-		if err := k.Set(ECDSACrvKey, jwa.P256); err != nil {
-			return errors.Wrap(err, `failed to set header`)
-		}
-	case elliptic.P384():
-		if err := k.Set(ECDSACrvKey, jwa.P384); err != nil {
-			return errors.Wrap(err, `failed to set header`)
-		}
-	case elliptic.P521():
-		if err := k.Set(ECDSACrvKey, jwa.P521); err != nil {
-			return errors.Wrap(err, `failed to set header`)
-		}
-	default:
+	crv, ok := curveAlgorithm(rawKey.Curve)
+	if !ok {
 		return errors.Errorf(`invalid elliptic curve %s`, rawKey.Curve)
 	}
 
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.comparableID = nil
+	k.x = rawKey.X.Bytes()
+	k.y = rawKey.Y.Bytes()
+	k.crv = &crv
+
 	return nil
 }
 
 func (k *ecdsaPrivateKey) FromRaw(rawKey *ecdsa.PrivateKey) error {
-	k.x = rawKey.X.Bytes()
-	k.y = rawKey.Y.Bytes()
-	switch rawKey.Curve {
-	case elliptic.P256():
-		if err := k.Set(ECDSACrvKey, jwa.P256); err != nil {
-			return errors.Wrap(err, "failed to write header")
-		}
-	case elliptic.P384():
-		if err := k.Set(ECDSACrvKey, jwa.P384); err != nil {
-			return errors.Wrap(err, "failed to write header")
-		}
-	case elliptic.P521():
-		if err := k.Set(ECDSACrvKey, jwa.P521); err != nil {
-			return errors.Wrap(err, "failed to write header")
-		}
-	default:
+	crv, ok := curveAlgorithm(rawKey.Curve)
+	if !ok {
 		return errors.Errorf(`invalid elliptic curve %s`, rawKey.Curve)
 	}
 
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.comparableID = nil
+	k.x = rawKey.X.Bytes()
+	k.y = rawKey.Y.Bytes()
+	k.crv = &crv
 	k.d = rawKey.D.Bytes()
 
 	return nil
 }
 
-func buildECDSAPublicKey(alg jwa.EllipticCurveAlgorithm, xbuf, ybuf []byte) (*ecdsa.PublicKey, error) {
-	var curve elliptic.Curve
-	switch alg {
-	case jwa.P256:
-		curve = elliptic.P256()
-	case jwa.P384:
-		curve = elliptic.P384()
-	case jwa.P521:
-		curve = elliptic.P521()
-	default:
+// ellipticCurves maps the "crv" values to their elliptic.Curve
+// implementations. The Brainpool curves are not registered for use
+// in JOSE, and are provided for interoperability with systems that
+// require them.
+var ellipticCurves = map[jwa.EllipticCurveAlgorithm]elliptic.Curve{
+	jwa.P256:            elliptic.P256(),
+	jwa.P384:            elliptic.P384(),
+	jwa.P521:            elliptic.P521(),
+	jwa.BrainpoolP256r1: brainpool.P256r1(),
+	jwa.BrainpoolP384r1: brainpool.P384r1(),
+	jwa.BrainpoolP512r1: brainpool.P512r1(),
+}
+
+func ellipticCurve(alg jwa.EllipticCurveAlgorithm) (elliptic.Curve, bool) {
+	curve, ok := ellipticCurves[alg]
+	return curve, ok
+}
+
+func curveAlgorithm(curve elliptic.Curve) (jwa.EllipticCurveAlgorithm, bool) {
+	for alg, c := range ellipticCurves {
+		if c == curve {
+			return alg, true
+		}
+	}
+	return jwa.InvalidEllipticCurve, false
+}
+
+func buildECDSAPublicKey(crv *jwa.EllipticCurveAlgorithm, xbuf, ybuf []byte) (*ecdsa.PublicKey, error) {
+	alg := jwa.InvalidEllipticCurve
+	if crv != nil {
+		alg = *crv
+	}
+
+	curve, ok := ellipticCurve(alg)
+	if !ok {
 		return nil, errors.Errorf(`invalid curve algorithm %s`, alg)
 	}
 
@@ -97,12 +115,18 @@ func buildECDSAPublicKey(alg jwa.EllipticCurveAlgorithm, xbuf, ybuf []byte) (*ec
 	x.SetBytes(xbuf)
 	y.SetBytes(ybuf)
 
+	if !curve.IsOnCurve(&x, &y) {
+		return nil, errors.Errorf(`public key is not on curve %s`, alg)
+	}
+
 	return &ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}, nil
 }
 
 // Raw returns the EC-DSA public key represented by this JWK
 func (k *ecdsaPublicKey) Raw(v interface{}) error {
-	pubk, err := buildECDSAPublicKey(k.Crv(), k.x, k.y)
+	k.mu.RLock()
+	pubk, err := buildECDSAPublicKey(k.crv, k.x, k.y)
+	k.mu.RUnlock()
 	if err != nil {
 		return errors.Wrap(err, `failed to build public key`)
 	}
@@ -111,7 +135,10 @@ func (k *ecdsaPublicKey) Raw(v interface{}) error {
 }
 
 func (k *ecdsaPrivateKey) Raw(v interface{}) error {
-	pubk, err := buildECDSAPublicKey(k.Crv(), k.x, k.y)
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	pubk, err := buildECDSAPublicKey(k.crv, k.x, k.y)
 	if err != nil {
 		return errors.Wrap(err, `failed to build public key`)
 	}
@@ -152,7 +179,7 @@ func ecdsaThumbprint(hash crypto.Hash, crv, x, y string) []byte {
 
 // Thumbprint returns the JWK thumbprint using the indicated
 // hashing algorithm, according to RFC 7638
-func (k ecdsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
+func (k *ecdsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	var key ecdsa.PublicKey
 	if err := k.Raw(&key); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize ecdsa.PublicKey for thumbprint generation`)
@@ -165,9 +192,13 @@ func (k ecdsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	), nil
 }
 
+func (k *ecdsaPublicKey) ComparableID() (string, error) {
+	return comparableID(k.mu, &k.comparableID, k.Thumbprint)
+}
+
 // Thumbprint returns the JWK thumbprint using the indicated
 // hashing algorithm, according to RFC 7638
-func (k ecdsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
+func (k *ecdsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	var key ecdsa.PrivateKey
 	if err := k.Raw(&key); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize ecdsa.PrivateKey for thumbprint generation`)
@@ -179,3 +210,7 @@ func (k ecdsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 		base64.EncodeToString(key.Y.Bytes()),
 	), nil
 }
+
+func (k *ecdsaPrivateKey) ComparableID() (string, error) {
+	return comparableID(k.mu, &k.comparableID, k.Thumbprint)
+}
@@ -3,7 +3,6 @@
 package jwk
 
 import (
-	"bytes"
 	"context"
 	"crypto/ecdsa"
 	"crypto/x509"
@@ -11,10 +10,12 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/iter"
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -50,6 +51,8 @@ type ecdsaPrivateKey struct {
 	x509URL                *string           // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	y                      []byte
 	privateParams          map[string]interface{}
+	comparableID           *comparableIDCache
+	mu                     *sync.RWMutex
 }
 
 type ecdsaPrivateKeyMarshalProxy struct {
@@ -73,6 +76,8 @@ func (h ecdsaPrivateKey) KeyType() jwa.KeyType {
 }
 
 func (h *ecdsaPrivateKey) Algorithm() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.algorithm != nil {
 		return *(h.algorithm)
 	}
@@ -80,6 +85,8 @@ func (h *ecdsaPrivateKey) Algorithm() string {
 }
 
 func (h *ecdsaPrivateKey) Crv() jwa.EllipticCurveAlgorithm {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.crv != nil {
 		return *(h.crv)
 	}
@@ -87,10 +94,14 @@ func (h *ecdsaPrivateKey) Crv() jwa.EllipticCurveAlgorithm {
 }
 
 func (h *ecdsaPrivateKey) D() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.d
 }
 
 func (h *ecdsaPrivateKey) KeyID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyID != nil {
 		return *(h.keyID)
 	}
@@ -98,6 +109,8 @@ func (h *ecdsaPrivateKey) KeyID() string {
 }
 
 func (h *ecdsaPrivateKey) KeyUsage() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyUsage != nil {
 		return *(h.keyUsage)
 	}
@@ -105,6 +118,8 @@ func (h *ecdsaPrivateKey) KeyUsage() string {
 }
 
 func (h *ecdsaPrivateKey) KeyOps() KeyOperationList {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyops != nil {
 		return *(h.keyops)
 	}
@@ -112,10 +127,14 @@ func (h *ecdsaPrivateKey) KeyOps() KeyOperationList {
 }
 
 func (h *ecdsaPrivateKey) X() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.x
 }
 
 func (h *ecdsaPrivateKey) X509CertChain() []*x509.Certificate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertChain != nil {
 		return h.x509CertChain.Get()
 	}
@@ -123,6 +142,8 @@ func (h *ecdsaPrivateKey) X509CertChain() []*x509.Certificate {
 }
 
 func (h *ecdsaPrivateKey) X509CertThumbprint() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprint != nil {
 		return *(h.x509CertThumbprint)
 	}
@@ -130,6 +151,8 @@ func (h *ecdsaPrivateKey) X509CertThumbprint() string {
 }
 
 func (h *ecdsaPrivateKey) X509CertThumbprintS256() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprintS256 != nil {
 		return *(h.x509CertThumbprintS256)
 	}
@@ -137,6 +160,8 @@ func (h *ecdsaPrivateKey) X509CertThumbprintS256() string {
 }
 
 func (h *ecdsaPrivateKey) X509URL() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509URL != nil {
 		return *(h.x509URL)
 	}
@@ -144,12 +169,15 @@ func (h *ecdsaPrivateKey) X509URL() string {
 }
 
 func (h *ecdsaPrivateKey) Y() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.y
 }
 
 func (h *ecdsaPrivateKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	defer close(ch)
 
+	h.mu.RLock()
 	var pairs []*HeaderPair
 	pairs = append(pairs, &HeaderPair{Key: "kty", Value: jwa.EC})
 	if h.algorithm != nil {
@@ -191,6 +219,7 @@ func (h *ecdsaPrivateKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	for k, v := range h.privateParams {
 		pairs = append(pairs, &HeaderPair{Key: k, Value: v})
 	}
+	h.mu.RUnlock()
 	for _, pair := range pairs {
 		select {
 		case <-ctx.Done():
@@ -204,7 +233,26 @@ func (h *ecdsaPrivateKey) PrivateParams() map[string]interface{} {
 	return h.privateParams
 }
 
+func (h *ecdsaPrivateKey) PrivateParamKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.privateParams))
+	for k := range h.privateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *ecdsaPrivateKey) PrivateParamLen() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.privateParams)
+}
+
 func (h *ecdsaPrivateKey) Get(name string) (interface{}, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	switch name {
 	case KeyTypeKey:
 		return h.KeyType(), true
@@ -275,6 +323,9 @@ func (h *ecdsaPrivateKey) Get(name string) (interface{}, bool) {
 }
 
 func (h *ecdsaPrivateKey) Set(name string, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	switch name {
 	case "kty":
 		return nil
@@ -371,6 +422,10 @@ func (h *ecdsaPrivateKey) UnmarshalJSON(buf []byte) error {
 	if err := json.Unmarshal(buf, &proxy); err != nil {
 		return errors.Wrap(err, `failed to unmarshal ecdsaPrivateKey`)
 	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	if proxy.XkeyType != jwa.EC {
 		return errors.Errorf(`invalid kty value for ECDSAPrivateKey (%s)`, proxy.XkeyType)
 	}
@@ -435,6 +490,8 @@ func (h *ecdsaPrivateKey) UnmarshalJSON(buf []byte) error {
 }
 
 func (h ecdsaPrivateKey) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	var proxy ecdsaPrivateKeyMarshalProxy
 	proxy.XkeyType = jwa.EC
 	proxy.Xalgorithm = h.algorithm
@@ -458,8 +515,9 @@ func (h ecdsaPrivateKey) MarshalJSON() ([]byte, error) {
 		v := base64.EncodeToString(h.y)
 		proxy.Xy = &v
 	}
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	enc := json.NewEncoder(buf)
 	if err := enc.Encode(proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to encode proxy to JSON`)
 	}
@@ -473,16 +531,18 @@ func (h ecdsaPrivateKey) MarshalJSON() ([]byte, error) {
 		sort.Strings(keys)
 		for i, k := range keys {
 			if hasContent || i > 0 {
-				fmt.Fprintf(&buf, `,`)
+				fmt.Fprintf(buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			fmt.Fprintf(buf, `%s:`, strconv.Quote(k))
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
-		fmt.Fprintf(&buf, `}`)
+		fmt.Fprintf(buf, `}`)
 	}
-	return buf.Bytes(), nil
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result, nil
 }
 
 func (h *ecdsaPrivateKey) Iterate(ctx context.Context) HeaderIterator {
@@ -520,6 +580,8 @@ type ecdsaPublicKey struct {
 	x509URL                *string           // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	y                      []byte
 	privateParams          map[string]interface{}
+	comparableID           *comparableIDCache
+	mu                     *sync.RWMutex
 }
 
 type ecdsaPublicKeyMarshalProxy struct {
@@ -542,6 +604,8 @@ func (h ecdsaPublicKey) KeyType() jwa.KeyType {
 }
 
 func (h *ecdsaPublicKey) Algorithm() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.algorithm != nil {
 		return *(h.algorithm)
 	}
@@ -549,6 +613,8 @@ func (h *ecdsaPublicKey) Algorithm() string {
 }
 
 func (h *ecdsaPublicKey) Crv() jwa.EllipticCurveAlgorithm {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.crv != nil {
 		return *(h.crv)
 	}
@@ -556,6 +622,8 @@ func (h *ecdsaPublicKey) Crv() jwa.EllipticCurveAlgorithm {
 }
 
 func (h *ecdsaPublicKey) KeyID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyID != nil {
 		return *(h.keyID)
 	}
@@ -563,6 +631,8 @@ func (h *ecdsaPublicKey) KeyID() string {
 }
 
 func (h *ecdsaPublicKey) KeyUsage() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyUsage != nil {
 		return *(h.keyUsage)
 	}
@@ -570,6 +640,8 @@ func (h *ecdsaPublicKey) KeyUsage() string {
 }
 
 func (h *ecdsaPublicKey) KeyOps() KeyOperationList {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyops != nil {
 		return *(h.keyops)
 	}
@@ -577,10 +649,14 @@ func (h *ecdsaPublicKey) KeyOps() KeyOperationList {
 }
 
 func (h *ecdsaPublicKey) X() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.x
 }
 
 func (h *ecdsaPublicKey) X509CertChain() []*x509.Certificate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertChain != nil {
 		return h.x509CertChain.Get()
 	}
@@ -588,6 +664,8 @@ func (h *ecdsaPublicKey) X509CertChain() []*x509.Certificate {
 }
 
 func (h *ecdsaPublicKey) X509CertThumbprint() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprint != nil {
 		return *(h.x509CertThumbprint)
 	}
@@ -595,6 +673,8 @@ func (h *ecdsaPublicKey) X509CertThumbprint() string {
 }
 
 func (h *ecdsaPublicKey) X509CertThumbprintS256() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprintS256 != nil {
 		return *(h.x509CertThumbprintS256)
 	}
@@ -602,6 +682,8 @@ func (h *ecdsaPublicKey) X509CertThumbprintS256() string {
 }
 
 func (h *ecdsaPublicKey) X509URL() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509URL != nil {
 		return *(h.x509URL)
 	}
@@ -609,12 +691,15 @@ func (h *ecdsaPublicKey) X509URL() string {
 }
 
 func (h *ecdsaPublicKey) Y() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.y
 }
 
 func (h *ecdsaPublicKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	defer close(ch)
 
+	h.mu.RLock()
 	var pairs []*HeaderPair
 	pairs = append(pairs, &HeaderPair{Key: "kty", Value: jwa.EC})
 	if h.algorithm != nil {
@@ -653,6 +738,7 @@ func (h *ecdsaPublicKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	for k, v := range h.privateParams {
 		pairs = append(pairs, &HeaderPair{Key: k, Value: v})
 	}
+	h.mu.RUnlock()
 	for _, pair := range pairs {
 		select {
 		case <-ctx.Done():
@@ -666,7 +752,26 @@ func (h *ecdsaPublicKey) PrivateParams() map[string]interface{} {
 	return h.privateParams
 }
 
+func (h *ecdsaPublicKey) PrivateParamKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.privateParams))
+	for k := range h.privateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *ecdsaPublicKey) PrivateParamLen() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.privateParams)
+}
+
 func (h *ecdsaPublicKey) Get(name string) (interface{}, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	switch name {
 	case KeyTypeKey:
 		return h.KeyType(), true
@@ -732,6 +837,9 @@ func (h *ecdsaPublicKey) Get(name string) (interface{}, bool) {
 }
 
 func (h *ecdsaPublicKey) Set(name string, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	switch name {
 	case "kty":
 		return nil
@@ -822,6 +930,10 @@ func (h *ecdsaPublicKey) UnmarshalJSON(buf []byte) error {
 	if err := json.Unmarshal(buf, &proxy); err != nil {
 		return errors.Wrap(err, `failed to unmarshal ecdsaPublicKey`)
 	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	if proxy.XkeyType != jwa.EC {
 		return errors.Errorf(`invalid kty value for ECDSAPublicKey (%s)`, proxy.XkeyType)
 	}
@@ -875,6 +987,8 @@ func (h *ecdsaPublicKey) UnmarshalJSON(buf []byte) error {
 }
 
 func (h ecdsaPublicKey) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	var proxy ecdsaPublicKeyMarshalProxy
 	proxy.XkeyType = jwa.EC
 	proxy.Xalgorithm = h.algorithm
@@ -894,8 +1008,9 @@ func (h ecdsaPublicKey) MarshalJSON() ([]byte, error) {
 		v := base64.EncodeToString(h.y)
 		proxy.Xy = &v
 	}
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	enc := json.NewEncoder(buf)
 	if err := enc.Encode(proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to encode proxy to JSON`)
 	}
@@ -909,16 +1024,18 @@ func (h ecdsaPublicKey) MarshalJSON() ([]byte, error) {
 		sort.Strings(keys)
 		for i, k := range keys {
 			if hasContent || i > 0 {
-				fmt.Fprintf(&buf, `,`)
+				fmt.Fprintf(buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			fmt.Fprintf(buf, `%s:`, strconv.Quote(k))
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
-		fmt.Fprintf(&buf, `}`)
+		fmt.Fprintf(buf, `}`)
 	}
-	return buf.Bytes(), nil
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result, nil
 }
 
 func (h *ecdsaPublicKey) Iterate(ctx context.Context) HeaderIterator {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -305,3 +306,83 @@ func TestECDSA(t *testing.T) {
 		}
 	})
 }
+
+func TestECDSABrainpool(t *testing.T) {
+	for _, crv := range []jwa.EllipticCurveAlgorithm{jwa.BrainpoolP256r1, jwa.BrainpoolP384r1, jwa.BrainpoolP512r1} {
+		crv := crv
+		t.Run(crv.String(), func(t *testing.T) {
+			key, err := jwk.GenerateECDSAKey(crv)
+			if !assert.NoError(t, err, `jwk.GenerateECDSAKey should succeed`) {
+				return
+			}
+
+			buf, err := json.Marshal(key)
+			if !assert.NoError(t, err, `json.Marshal should succeed`) {
+				return
+			}
+
+			parsed, err := jwk.ParseKey(buf)
+			if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+				return
+			}
+			if !assert.Equal(t, crv, parsed.(jwk.ECDSAPrivateKey).Crv(), `curves should match`) {
+				return
+			}
+
+			var rawKey ecdsa.PrivateKey
+			if !assert.NoError(t, parsed.Raw(&rawKey), `Raw should succeed`) {
+				return
+			}
+			if !assert.Equal(t, crv.Size()*8, rawKey.Curve.Params().BitSize, `bit size should match`) {
+				return
+			}
+
+			roundtrip := jwk.NewECDSAPrivateKey()
+			if !assert.NoError(t, roundtrip.FromRaw(&rawKey), `FromRaw should succeed`) {
+				return
+			}
+			if !assert.Equal(t, crv, roundtrip.Crv(), `curves should match`) {
+				return
+			}
+		})
+	}
+
+	t.Run("Sign and verify brainpoolP256r1", func(t *testing.T) {
+		key, err := jwk.GenerateECDSAKey(jwa.BrainpoolP256r1)
+		if !assert.NoError(t, err, `jwk.GenerateECDSAKey should succeed`) {
+			return
+		}
+
+		var rawKey ecdsa.PrivateKey
+		if !assert.NoError(t, key.Raw(&rawKey), `Raw should succeed`) {
+			return
+		}
+
+		payload := []byte("Lorem ipsum")
+		signed, err := jws.Sign(payload, jwa.ES256, &rawKey)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		verified, err := jws.Verify(signed, jwa.ES256, &rawKey.PublicKey)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+	})
+
+	t.Run("Point not on curve", func(t *testing.T) {
+		const src = `{"kty":"EC","crv":"brainpoolP256r1","x":"AQ","y":"AQ"}`
+		key, err := jwk.ParseKey([]byte(src))
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+			return
+		}
+
+		var rawKey ecdsa.PublicKey
+		if !assert.Error(t, key.Raw(&rawKey), `Raw should fail`) {
+			return
+		}
+	})
+}
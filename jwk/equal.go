@@ -0,0 +1,141 @@
+package jwk
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"reflect"
+
+	"github.com/lestrrat-go/jwx/jwa"
+)
+
+// keyMaterialParamNames lists the members that make up the key material,
+// for each key type
+var keyMaterialParamNames = map[jwa.KeyType][]string{
+	jwa.RSA:      {RSANKey, RSAEKey, RSADKey, RSAPKey, RSAQKey, RSADPKey, RSADQKey, RSAQIKey},
+	jwa.EC:       {ECDSACrvKey, ECDSAXKey, ECDSAYKey, ECDSADKey},
+	jwa.OctetSeq: {SymmetricOctetsKey},
+}
+
+// Equal returns true if the two keys are cryptographically identical,
+// that is, they are of the same type and contain the same key material.
+// Other members such as "kid", "use", and "alg" are ignored, unless the
+// WithCompareMetadata option is specified, in which case the keys must
+// contain the same set of members with the same values.
+//
+// Members that represent big integers (such as "n" and "e" for RSA
+// keys, or "x", "y", and "d" for EC keys) are compared in their
+// canonical minimal form, i.e. leading zero octets are ignored. This
+// allows keys that are cryptographically identical but were encoded
+// with or without leading zeros to compare equal.
+//
+// Members that hold private key material are compared in constant time.
+func Equal(k1, k2 Key, options ...Option) bool {
+	if k1 == nil || k2 == nil {
+		return k1 == k2
+	}
+
+	var compareMetadata bool
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyCompareMetadata:
+			compareMetadata = option.Value().(bool)
+		}
+	}
+
+	kty := k1.KeyType()
+	if kty != k2.KeyType() {
+		return false
+	}
+
+	m1, err := normalizedMap(k1)
+	if err != nil {
+		return false
+	}
+	m2, err := normalizedMap(k2)
+	if err != nil {
+		return false
+	}
+
+	if !compareMetadata {
+		m1 = keyMaterial(kty, m1)
+		m2 = keyMaterial(kty, m2)
+	}
+
+	if len(m1) != len(m2) {
+		return false
+	}
+
+	private := make(map[string]struct{})
+	for _, name := range privateParamNames[kty] {
+		private[name] = struct{}{}
+	}
+
+	equal := true
+	for name, v1 := range m1 {
+		v2, ok := m2[name]
+		if !ok {
+			return false
+		}
+
+		if _, ok := private[name]; ok {
+			b1, ok1 := v1.([]byte)
+			b2, ok2 := v2.([]byte)
+			if !ok1 || !ok2 {
+				return false
+			}
+			// keep going, so that the time taken does not depend on
+			// which of the private members differ
+			if subtle.ConstantTimeCompare(b1, b2) != 1 {
+				equal = false
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(v1, v2) {
+			return false
+		}
+	}
+	return equal
+}
+
+// keyMaterial returns the subset of m that makes up the key material
+func keyMaterial(kty jwa.KeyType, m map[string]interface{}) map[string]interface{} {
+	names := keyMaterialParamNames[kty]
+	filtered := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		if v, ok := m[name]; ok {
+			filtered[name] = v
+		}
+	}
+	return filtered
+}
+
+func numericParams(key Key) []string {
+	switch key.(type) {
+	case RSAPrivateKey, RSAPublicKey:
+		return rsaNumericParams
+	case ECDSAPrivateKey, ECDSAPublicKey:
+		return ecdsaNumericParams
+	default:
+		return nil
+	}
+}
+
+func normalizedMap(key Key) (map[string]interface{}, error) {
+	m, err := key.AsMap(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range numericParams(key) {
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		if b, ok := v.([]byte); ok {
+			m[name] = bytes.TrimLeft(b, "\x00")
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,160 @@
+package jwk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultFilePollInterval is the interval at which a FileCache checks
+// its file for changes, unless WithPollInterval is specified
+const defaultFilePollInterval = time.Second
+
+// FileCache holds a JWK set that is loaded from a file, and reloaded
+// whenever the contents of the file change. This is useful when the
+// set is kept up to date by an external process, such as an operator
+// rotating keys on disk.
+//
+// The file is checked for changes at a fixed interval (see
+// WithPollInterval). If the new contents cannot be read or parsed, the
+// previously loaded set is retained, and the error is reported to the
+// handler specified via WithReloadErrorHandler. Each failure is only
+// reported once, rather than on every check, until the file changes.
+type FileCache struct {
+	path     string
+	interval time.Duration
+	onError  func(error)
+	options  []Option
+
+	mu   sync.RWMutex
+	set  *Set
+	last []byte
+
+	// The outcome of the last failed reload, so that the same failure
+	// is not reported on every poll. These are only accessed by reload,
+	// which is never called concurrently
+	failed     []byte
+	readFailed bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewFileCache creates a new FileCache for the JWK set in the file at
+// `path`. The file is loaded immediately, and an error is returned if it
+// cannot be read or parsed. Options other than WithPollInterval and
+// WithReloadErrorHandler are passed to `jwk.ParseBytes` on each load.
+//
+// The returned FileCache starts a goroutine to watch the file. Call
+// Close to stop it once the cache is no longer needed.
+func NewFileCache(path string, options ...Option) (*FileCache, error) {
+	fc := &FileCache{
+		path:     path,
+		interval: defaultFilePollInterval,
+		done:     make(chan struct{}),
+	}
+
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyPollInterval:
+			fc.interval = option.Value().(time.Duration)
+		case optkeyReloadErrorHandler:
+			fc.onError = option.Value().(func(error))
+		default:
+			fc.options = append(fc.options, option)
+		}
+	}
+
+	if fc.interval <= 0 {
+		return nil, errors.New(`poll interval must be positive`)
+	}
+
+	if err := fc.reload(); err != nil {
+		return nil, errors.Wrapf(err, `failed to load JWK set from %s`, path)
+	}
+
+	fc.wg.Add(1)
+	go fc.watch()
+	return fc, nil
+}
+
+// Get returns the most recently loaded JWK set. The returned set must
+// not be modified, as it is shared among all callers.
+func (fc *FileCache) Get() *Set {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	return fc.set
+}
+
+// Close stops watching the file. The last loaded set remains available
+// via Get.
+func (fc *FileCache) Close() error {
+	fc.closeOnce.Do(func() {
+		close(fc.done)
+	})
+	fc.wg.Wait()
+	return nil
+}
+
+func (fc *FileCache) watch() {
+	defer fc.wg.Done()
+
+	ticker := time.NewTicker(fc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fc.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := fc.reload(); err != nil && fc.onError != nil {
+			fc.onError(errors.Wrapf(err, `failed to reload JWK set from %s`, fc.path))
+		}
+	}
+}
+
+// reload reads the file, and replaces the current set if the contents
+// have changed since the last successful load. No error is returned if
+// the failure is the same as that of the previous call
+func (fc *FileCache) reload() error {
+	buf, err := ioutil.ReadFile(fc.path)
+	if err != nil {
+		if fc.readFailed {
+			return nil
+		}
+		fc.readFailed = true
+		return errors.Wrap(err, `failed to read file`)
+	}
+	fc.readFailed = false
+
+	fc.mu.RLock()
+	unchanged := fc.set != nil && bytes.Equal(buf, fc.last)
+	fc.mu.RUnlock()
+	if unchanged {
+		fc.failed = nil
+		return nil
+	}
+
+	if fc.failed != nil && bytes.Equal(buf, fc.failed) {
+		return nil
+	}
+
+	set, err := ParseBytes(buf, fc.options...)
+	if err != nil {
+		fc.failed = buf
+		return errors.Wrap(err, `failed to parse JWK set`)
+	}
+	fc.failed = nil
+
+	fc.mu.Lock()
+	fc.set = set
+	fc.last = buf
+	fc.mu.Unlock()
+	return nil
+}
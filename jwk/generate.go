@@ -0,0 +1,127 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"math/big"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/pkg/errors"
+)
+
+func generateRand(options []Option) io.Reader {
+	if r, ok := customRand(options); ok {
+		return r
+	}
+	return rand.Reader
+}
+
+// customRand returns the reader given via WithRand, if any
+func customRand(options []Option) (io.Reader, bool) {
+	var r io.Reader
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyRand:
+			r = o.Value().(io.Reader)
+		}
+	}
+	return r, r != nil
+}
+
+// GenerateRSAKey generates a new RSA private key of the given size in bits.
+//
+// The randomness is taken from crypto/rand, unless the WithRand option
+// is specified. Note that the key is generated using crypto/rsa, and
+// whether the result is reproducible for a given reader depends on the
+// Go version: recent versions of crypto/rsa do not consume the reader
+// deterministically, or ignore it altogether.
+func GenerateRSAKey(bits int, options ...Option) (RSAPrivateKey, error) {
+	raw, err := rsa.GenerateKey(generateRand(options), bits)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to generate RSA key`)
+	}
+
+	key := newRSAPrivateKey()
+	if err := key.FromRaw(raw); err != nil {
+		return nil, errors.Wrap(err, `failed to initialize RSA key`)
+	}
+	return key, nil
+}
+
+// GenerateECDSAKey generates a new ECDSA private key on the given curve.
+//
+// The key is generated using crypto/ecdsa and crypto/rand, unless the
+// WithRand option is specified. crypto/ecdsa does not consume the reader
+// deterministically, so in that case the private scalar is derived from
+// the bytes read from the given reader as described in FIPS 186-4
+// Appendix B.4.1 instead, so that the same reader contents always produce
+// the same key. Only use WithRand for test fixtures.
+func GenerateECDSAKey(crv jwa.EllipticCurveAlgorithm, options ...Option) (ECDSAPrivateKey, error) {
+	curve, ok := ellipticCurve(crv)
+	if !ok {
+		return nil, errors.Errorf(`unsupported curve %s`, crv)
+	}
+
+	var raw *ecdsa.PrivateKey
+	var err error
+	if r, ok := customRand(options); ok {
+		raw, err = deriveECDSAKey(curve, r)
+	} else {
+		raw, err = ecdsa.GenerateKey(curve, rand.Reader)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to generate ECDSA key`)
+	}
+
+	key := newECDSAPrivateKey()
+	if err := key.FromRaw(raw); err != nil {
+		return nil, errors.Wrap(err, `failed to initialize ECDSA key`)
+	}
+	return key, nil
+}
+
+// deriveECDSAKey derives a private key from the bytes read from r, as
+// described in FIPS 186-4 Appendix B.4.1
+func deriveECDSAKey(curve elliptic.Curve, r io.Reader) (*ecdsa.PrivateKey, error) {
+	params := curve.Params()
+	b := make([]byte, params.BitSize/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.Wrap(err, `failed to read random bytes`)
+	}
+
+	one := big.NewInt(1)
+	d := new(big.Int).SetBytes(b)
+	n := new(big.Int).Sub(params.N, one)
+	d.Mod(d, n)
+	d.Add(d, one)
+
+	raw := &ecdsa.PrivateKey{D: d}
+	raw.PublicKey.Curve = curve
+	raw.PublicKey.X, raw.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+	return raw, nil
+}
+
+// GenerateSymmetricKey generates a new symmetric key of the given size
+// in bytes.
+//
+// The randomness is taken from crypto/rand, unless the WithRand option
+// is specified.
+func GenerateSymmetricKey(size int, options ...Option) (SymmetricKey, error) {
+	if size <= 0 {
+		return nil, errors.New(`key size must be positive`)
+	}
+
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(generateRand(options), raw); err != nil {
+		return nil, errors.Wrap(err, `failed to read random bytes`)
+	}
+
+	key := newSymmetricKey()
+	if err := key.FromRaw(raw); err != nil {
+		return nil, errors.Wrap(err, `failed to initialize symmetric key`)
+	}
+	return key, nil
+}
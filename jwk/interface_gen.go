@@ -60,6 +60,16 @@ type Key interface {
 	// hashing algorithm, according to RFC 7638
 	Thumbprint(crypto.Hash) ([]byte, error)
 
+	// ComparableID returns a string that identifies the key material,
+	// suitable for use as a map key. It is the base64url encoded SHA-256
+	// thumbprint of the key, so keys with the same key material have the
+	// same value regardless of their other fields. Note that a private key
+	// and its public key share the same value.
+	//
+	// The value is computed on the first call and cached, until the key
+	// is modified.
+	ComparableID() (string, error)
+
 	// Iterate returns an iterator that returns all keys and values
 	Iterate(ctx context.Context) HeaderIterator
 
@@ -72,6 +82,14 @@ type Key interface {
 	// PrivateParams returns the non-standard elements in the source structure
 	PrivateParams() map[string]interface{}
 
+	// PrivateParamKeys returns a snapshot of the names of the non-standard
+	// elements in the source structure. It is safe for concurrent use
+	PrivateParamKeys() []string
+
+	// PrivateParamLen returns the number of non-standard elements in the
+	// source structure. It is safe for concurrent use
+	PrivateParamLen() int
+
 	KeyType() jwa.KeyType
 	KeyUsage() string
 	KeyOps() KeyOperationList
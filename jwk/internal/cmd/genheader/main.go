@@ -420,6 +420,14 @@ func generateGenericHeaders() error {
 	fmt.Fprintf(&buf, "\n\n// Thumbprint returns the JWK thumbprint using the indicated")
 	fmt.Fprintf(&buf, "\n// hashing algorithm, according to RFC 7638")
 	fmt.Fprintf(&buf, "\nThumbprint(crypto.Hash) ([]byte, error)")
+	fmt.Fprintf(&buf, "\n\n// ComparableID returns a string that identifies the key material,")
+	fmt.Fprintf(&buf, "\n// suitable for use as a map key. It is the base64url encoded SHA-256")
+	fmt.Fprintf(&buf, "\n// thumbprint of the key, so keys with the same key material have the")
+	fmt.Fprintf(&buf, "\n// same value regardless of their other fields. Note that a private key")
+	fmt.Fprintf(&buf, "\n// and its public key share the same value.")
+	fmt.Fprintf(&buf, "\n//\n// The value is computed on the first call and cached, until the key")
+	fmt.Fprintf(&buf, "\n// is modified.")
+	fmt.Fprintf(&buf, "\nComparableID() (string, error)")
 	fmt.Fprintf(&buf, "\n\n// Iterate returns an iterator that returns all keys and values")
 	fmt.Fprintf(&buf, "\nIterate(ctx context.Context) HeaderIterator")
 	fmt.Fprintf(&buf, "\n\n// Walk is a utility tool that allows a visitor to iterate all keys and values")
@@ -428,6 +436,12 @@ func generateGenericHeaders() error {
 	fmt.Fprintf(&buf, "\nAsMap(context.Context) (map[string]interface{}, error)")
 	fmt.Fprintf(&buf, "\n\n// PrivateParams returns the non-standard elements in the source structure")
 	fmt.Fprintf(&buf, "\nPrivateParams() map[string]interface{}")
+	fmt.Fprintf(&buf, "\n\n// PrivateParamKeys returns a snapshot of the names of the non-standard")
+	fmt.Fprintf(&buf, "\n// elements in the source structure. It is safe for concurrent use")
+	fmt.Fprintf(&buf, "\nPrivateParamKeys() []string")
+	fmt.Fprintf(&buf, "\n\n// PrivateParamLen returns the number of non-standard elements in the")
+	fmt.Fprintf(&buf, "\n// source structure. It is safe for concurrent use")
+	fmt.Fprintf(&buf, "\nPrivateParamLen() int")
 	fmt.Fprintf(&buf, "\n\nKeyType() jwa.KeyType")
 	for _, f := range standardHeaders {
 		fmt.Fprintf(&buf, "\n%s() ", f.method)
@@ -468,6 +482,7 @@ func generateHeader(kt keyType) error {
 		"crypto/x509",
 		"fmt",
 		"github.com/lestrrat-go/jwx/internal/base64",
+		"github.com/lestrrat-go/jwx/internal/pool",
 		"github.com/lestrrat-go/jwx/jwa",
 		"github.com/pkg/errors",
 	}
@@ -538,6 +553,8 @@ func generateHeader(kt keyType) error {
 			}
 		}
 		fmt.Fprintf(&buf, "\nprivateParams map[string]interface{}")
+		fmt.Fprintf(&buf, "\ncomparableID *comparableIDCache")
+		fmt.Fprintf(&buf, "\nmu *sync.RWMutex")
 		fmt.Fprintf(&buf, "\n}")
 
 		// Proxy is used when unmarshaling headers
@@ -571,6 +588,8 @@ func generateHeader(kt keyType) error {
 				fmt.Fprintf(&buf, "%s", f.PointerElem())
 			}
 			fmt.Fprintf(&buf, " {")
+			fmt.Fprintf(&buf, "\nh.mu.RLock()")
+			fmt.Fprintf(&buf, "\ndefer h.mu.RUnlock()")
 
 			if f.hasGet {
 				fmt.Fprintf(&buf, "\nif h.%s != nil {", f.name)
@@ -596,7 +615,8 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\ndefer close(ch)")
 
 		// NOTE: building up an array is *slow*?
-		fmt.Fprintf(&buf, "\n\nvar pairs []*HeaderPair")
+		fmt.Fprintf(&buf, "\n\nh.mu.RLock()")
+		fmt.Fprintf(&buf, "\nvar pairs []*HeaderPair")
 		fmt.Fprintf(&buf, "\npairs = append(pairs, &HeaderPair{Key: \"kty\", Value: %s})", kt.keyType)
 		for _, f := range ht.allHeaders {
 			var keyName string
@@ -616,6 +636,7 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\nfor k, v := range h.privateParams {")
 		fmt.Fprintf(&buf, "\npairs = append(pairs, &HeaderPair{Key: k, Value: v})")
 		fmt.Fprintf(&buf, "\n}")
+		fmt.Fprintf(&buf, "\nh.mu.RUnlock()")
 		fmt.Fprintf(&buf, "\nfor _, pair := range pairs {")
 		fmt.Fprintf(&buf, "\nselect {")
 		fmt.Fprintf(&buf, "\ncase <-ctx.Done():")
@@ -629,7 +650,26 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\nreturn h.privateParams")
 		fmt.Fprintf(&buf, "\n}")
 
+		fmt.Fprintf(&buf, "\n\nfunc (h *%s) PrivateParamKeys() []string {", structName)
+		fmt.Fprintf(&buf, "\nh.mu.RLock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.RUnlock()")
+		fmt.Fprintf(&buf, "\nkeys := make([]string, 0, len(h.privateParams))")
+		fmt.Fprintf(&buf, "\nfor k := range h.privateParams {")
+		fmt.Fprintf(&buf, "\nkeys = append(keys, k)")
+		fmt.Fprintf(&buf, "\n}")
+		fmt.Fprintf(&buf, "\nsort.Strings(keys)")
+		fmt.Fprintf(&buf, "\nreturn keys")
+		fmt.Fprintf(&buf, "\n}")
+
+		fmt.Fprintf(&buf, "\n\nfunc (h *%s) PrivateParamLen() int {", structName)
+		fmt.Fprintf(&buf, "\nh.mu.RLock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.RUnlock()")
+		fmt.Fprintf(&buf, "\nreturn len(h.privateParams)")
+		fmt.Fprintf(&buf, "\n}")
+
 		fmt.Fprintf(&buf, "\n\nfunc (h *%s) Get(name string) (interface{}, bool) {", structName)
+		fmt.Fprintf(&buf, "\nh.mu.RLock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.RUnlock()")
 		fmt.Fprintf(&buf, "\nswitch name {")
 		fmt.Fprintf(&buf, "\ncase KeyTypeKey:")
 		fmt.Fprintf(&buf, "\nreturn h.KeyType(), true")
@@ -655,6 +695,9 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\n}") // func (h *%s) Get(name string) (interface{}, bool)
 
 		fmt.Fprintf(&buf, "\n\nfunc (h *%s) Set(name string, value interface{}) error {", structName)
+		fmt.Fprintf(&buf, "\nh.mu.Lock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.Unlock()")
+		fmt.Fprintf(&buf, "\nh.comparableID = nil")
 		fmt.Fprintf(&buf, "\nswitch name {")
 		fmt.Fprintf(&buf, "\ncase \"kty\":")
 		fmt.Fprintf(&buf, "\nreturn nil") // This is not great, but we just ignore it
@@ -714,6 +757,9 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\nif err := json.Unmarshal(buf, &proxy); err != nil {")
 		fmt.Fprintf(&buf, "\nreturn errors.Wrap(err, `failed to unmarshal %s`)", structName)
 		fmt.Fprintf(&buf, "\n}")
+		fmt.Fprintf(&buf, "\n\nh.mu.Lock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.Unlock()")
+		fmt.Fprintf(&buf, "\nh.comparableID = nil")
 
 		fmt.Fprintf(&buf, "\nif proxy.XkeyType != %s {", kt.keyType)
 		fmt.Fprintf(&buf, "\nreturn errors.Errorf(`invalid kty value for %s (%%s)`, proxy.XkeyType)", ifName)
@@ -767,6 +813,8 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\n}")
 
 		fmt.Fprintf(&buf, "\n\nfunc (h %s) MarshalJSON() ([]byte, error) {", structName)
+		fmt.Fprintf(&buf, "\nh.mu.RLock()")
+		fmt.Fprintf(&buf, "\ndefer h.mu.RUnlock()")
 		fmt.Fprintf(&buf, "\nvar proxy %s%sMarshalProxy", strings.ToLower(kt.prefix), ht.name)
 		fmt.Fprintf(&buf, "\nproxy.XkeyType = %s", kt.keyType)
 		for _, f := range ht.allHeaders {
@@ -790,8 +838,9 @@ func generateHeader(kt keyType) error {
 			}
 		}
 
-		fmt.Fprintf(&buf, "\nvar buf bytes.Buffer")
-		fmt.Fprintf(&buf, "\nenc := json.NewEncoder(&buf)")
+		fmt.Fprintf(&buf, "\nbuf := pool.GetBytesBuffer()")
+		fmt.Fprintf(&buf, "\ndefer pool.ReleaseBytesBuffer(buf)")
+		fmt.Fprintf(&buf, "\nenc := json.NewEncoder(buf)")
 		fmt.Fprintf(&buf, "\nif err := enc.Encode(proxy); err != nil {")
 		fmt.Fprintf(&buf, "\nreturn nil, errors.Wrap(err, `failed to encode proxy to JSON`)")
 		fmt.Fprintf(&buf, "\n}")
@@ -805,16 +854,18 @@ func generateHeader(kt keyType) error {
 		fmt.Fprintf(&buf, "\nsort.Strings(keys)")
 		fmt.Fprintf(&buf, "\nfor i, k := range keys {")
 		fmt.Fprintf(&buf, "\nif hasContent || i > 0 {")
-		fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `,`)")
+		fmt.Fprintf(&buf, "\nfmt.Fprintf(buf, `,`)")
 		fmt.Fprintf(&buf, "\n}")
-		fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `%%s:`, strconv.Quote(k))")
+		fmt.Fprintf(&buf, "\nfmt.Fprintf(buf, `%%s:`, strconv.Quote(k))")
 		fmt.Fprintf(&buf, "\nif err := enc.Encode(h.privateParams[k]); err != nil {")
 		fmt.Fprintf(&buf, "\nreturn nil, errors.Wrapf(err, `failed to encode private param %%s`, k)")
 		fmt.Fprintf(&buf, "\n}")
 		fmt.Fprintf(&buf, "\n}")
-		fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `}`)")
+		fmt.Fprintf(&buf, "\nfmt.Fprintf(buf, `}`)")
 		fmt.Fprintf(&buf, "\n}")
-		fmt.Fprintf(&buf, "\nreturn buf.Bytes(), nil")
+		fmt.Fprintf(&buf, "\nresult := make([]byte, buf.Len())")
+		fmt.Fprintf(&buf, "\ncopy(result, buf.Bytes())")
+		fmt.Fprintf(&buf, "\nreturn result, nil")
 		fmt.Fprintf(&buf, "\n}") // end of MarshalJSON
 
 		fmt.Fprintf(&buf, "\n\nfunc (h *%s) Iterate(ctx context.Context) HeaderIterator {", structName)
@@ -8,18 +8,29 @@ import (
 	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/big"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/lestrrat-go/iter/arrayiter"
 	"github.com/lestrrat-go/jwx/internal/base64"
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -87,6 +98,22 @@ func New(key interface{}) (Key, error) {
 	}
 }
 
+// FromPublicKey creates a jwk.Key from a public key held in a
+// crypto.PublicKey, such as the one found in a x509.Certificate. It
+// dispatches on the dynamic type of the key, so callers do not need to
+// perform the type switch themselves. Only RSA and ECDSA public keys are
+// currently supported: other types, including private keys, are rejected
+func FromPublicKey(pub crypto.PublicKey) (Key, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey, rsa.PublicKey, *ecdsa.PublicKey, ecdsa.PublicKey:
+		return New(pub)
+	case ed25519.PublicKey:
+		return nil, errors.New(`jwk.FromPublicKey: ed25519 keys are not supported`)
+	default:
+		return nil, errors.Errorf(`invalid public key type '%T' for jwk.FromPublicKey`, pub)
+	}
+}
+
 // PublicKeyOf returns the corresponding public key of the given
 // value `v`. For example, if v is a `*rsa.PrivateKey`, then
 // `*rsa.PublicKey` is returned.
@@ -132,6 +159,101 @@ func PublicKeyOf(v interface{}) (interface{}, error) {
 	}
 }
 
+// FromCertificateDER creates a jwk.Key from the given DER encoded
+// certificates. The certificates must be given leaf first: the public
+// key is taken from the first certificate, and the entire chain is
+// stored in the "x5c" field. The "x5t#S256" field is populated with
+// the thumbprint of the leaf certificate.
+func FromCertificateDER(der ...[]byte) (Key, error) {
+	if len(der) == 0 {
+		return nil, errors.New(`jwk.FromCertificateDER requires at least one certificate`)
+	}
+
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse leaf certificate`)
+	}
+
+	key, err := New(leaf.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create jwk.Key from leaf certificate`)
+	}
+
+	chain := make([]string, len(der))
+	for i, cert := range der {
+		chain[i] = base64.EncodeToStringStd(cert)
+	}
+	if err := key.Set(X509CertChainKey, chain); err != nil {
+		return nil, errors.Wrapf(err, `failed to set %s`, X509CertChainKey)
+	}
+
+	thumbprint := sha256.Sum256(der[0])
+	if err := key.Set(X509CertThumbprintS256Key, base64.EncodeToString(thumbprint[:])); err != nil {
+		return nil, errors.Wrapf(err, `failed to set %s`, X509CertThumbprintS256Key)
+	}
+
+	return key, nil
+}
+
+// SelfSignedCertificate creates a certificate for the public key of the
+// given private key, signed with the private key itself. RSA and ECDSA
+// private keys are supported.
+//
+// The template is not modified. If the serial number is not set, a random
+// 128 bit serial number is used. If NotBefore is not set, the current time
+// is used, and if NotAfter is not set, the certificate is valid for a year.
+// A nil template is treated as an empty one.
+func SelfSignedCertificate(key Key, template *x509.Certificate) (*x509.Certificate, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return nil, errors.Wrap(err, `failed to get raw key`)
+	}
+
+	var signer crypto.Signer
+	switch x := raw.(type) {
+	case *rsa.PrivateKey:
+		signer = x
+	case rsa.PrivateKey:
+		signer = &x
+	case *ecdsa.PrivateKey:
+		signer = x
+	case ecdsa.PrivateKey:
+		signer = &x
+	default:
+		return nil, errors.Errorf(`invalid key type %T for self-signed certificate (RSA or ECDSA private key required)`, raw)
+	}
+
+	var tmpl x509.Certificate
+	if template != nil {
+		tmpl = *template
+	}
+
+	if tmpl.SerialNumber == nil {
+		serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to generate serial number`)
+		}
+		tmpl.SerialNumber = serial
+	}
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now()
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = tmpl.NotBefore.AddDate(1, 0, 0)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, signer.Public(), signer)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create certificate`)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse created certificate`)
+	}
+	return cert, nil
+}
+
 // Fetch fetches a JWK resource specified by a URL
 func Fetch(urlstring string, options ...Option) (*Set, error) {
 	u, err := url.Parse(urlstring)
@@ -149,7 +271,7 @@ func Fetch(urlstring string, options ...Option) (*Set, error) {
 		}
 		defer f.Close()
 
-		return Parse(f)
+		return Parse(f, options...)
 	}
 	return nil, errors.Errorf(`invalid url scheme %s`, u.Scheme)
 }
@@ -159,13 +281,22 @@ func FetchHTTP(jwkurl string, options ...Option) (*Set, error) {
 	return FetchHTTPWithContext(context.Background(), jwkurl, options...)
 }
 
-// FetchHTTPWithContext fetches the remote JWK and parses its contents
+// FetchHTTPWithContext fetches the remote JWK and parses its contents.
+// The options are also passed to `jwk.Parse`, so for example
+// WithAllowTrailingData can be used for endpoints that append garbage
+// to their responses.
+//
+// If you would like to make sure that the response is actually a
+// JWK set, use the WithRequireContentType option.
 func FetchHTTPWithContext(ctx context.Context, jwkurl string, options ...Option) (*Set, error) {
 	httpcl := http.DefaultClient
+	var contentTypes []string
 	for _, option := range options {
 		switch option.Name() {
 		case optkeyHTTPClient:
 			httpcl = option.Value().(*http.Client)
+		case optkeyRequireContentType:
+			contentTypes = option.Value().([]string)
 		}
 	}
 
@@ -184,10 +315,77 @@ func FetchHTTPWithContext(ctx context.Context, jwkurl string, options ...Option)
 		return nil, fmt.Errorf("failed to fetch remote JWK (status = %d)", res.StatusCode)
 	}
 
-	return Parse(res.Body)
+	if len(contentTypes) > 0 {
+		if err := checkContentType(res.Header.Get(`Content-Type`), contentTypes); err != nil {
+			return nil, errors.Wrap(err, "failed to fetch remote JWK")
+		}
+	}
+
+	return Parse(res.Body, options...)
+}
+
+func checkContentType(v string, accepted []string) error {
+	mediatype, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return errors.Wrapf(err, `invalid content type %q`, v)
+	}
+
+	for _, t := range accepted {
+		if strings.EqualFold(mediatype, t) {
+			return nil
+		}
+	}
+	return errors.Errorf(`unexpected content type %q`, mediatype)
+}
+
+// privateParamNames lists the members that hold private key material,
+// for each key type
+var privateParamNames = map[jwa.KeyType][]string{
+	jwa.RSA:      {RSADKey, RSAPKey, RSAQKey, RSADPKey, RSADQKey, RSAQIKey},
+	jwa.EC:       {ECDSADKey},
+	jwa.OctetSeq: {SymmetricOctetsKey},
 }
 
-func ParseKey(data []byte) (Key, error) {
+// ParseKey parses a single JWK from the given JSON data.
+//
+// If the private key members are stored in a transformed (e.g. encrypted)
+// form, use the WithPrivateParamDecryptor option to convert them before
+// the key is assembled.
+//
+// If the WithPEM option is specified, data is parsed as a PEM encoded
+// key or certificate instead. Encrypted PKCS#8 keys require the
+// WithPEMPassword option.
+func ParseKey(data []byte, options ...Option) (Key, error) {
+	var usePEM bool
+	var password []byte
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyPEM:
+			usePEM = option.Value().(bool)
+		case optkeyPEMPassword:
+			password = option.Value().([]byte)
+		}
+	}
+
+	if usePEM {
+		raw, err := parsePEMKey(data, password)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to parse PEM encoded key`)
+		}
+		return New(raw)
+	}
+
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyPrivateParamDecryptor:
+			decrypted, err := decryptPrivateParams(data, option.Value().(PrivateParamDecryptor))
+			if err != nil {
+				return nil, errors.Wrap(err, `failed to decrypt private parameters`)
+			}
+			data = decrypted
+		}
+	}
+
 	var hint struct {
 		Kty string          `json:"kty"`
 		D   json.RawMessage `json:"d"`
@@ -224,7 +422,46 @@ func ParseKey(data []byte) (Key, error) {
 	return key, nil
 }
 
+// decryptPrivateParams calls the decryptor for each of the private key
+// members found in the data, and replaces them with the result
+func decryptPrivateParams(data []byte, fn PrivateParamDecryptor) ([]byte, error) {
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.Wrap(err, `failed to unmarshal JSON into map`)
+	}
+
+	kty, _ := m[KeyTypeKey].(string)
+	for _, name := range privateParamNames[jwa.KeyType(kty)] {
+		raw, ok := m[name]
+		if !ok {
+			continue
+		}
+
+		v, err := fn(name, raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to decrypt %s`, name)
+		}
+
+		switch v := v.(type) {
+		case []byte:
+			m[name] = base64.EncodeToString(v)
+		case string:
+			m[name] = v
+		default:
+			return nil, errors.Errorf(`invalid value for %s returned from decryptor: %T`, name, v)
+		}
+	}
+
+	return json.Marshal(m)
+}
+
 func (s *Set) UnmarshalJSON(data []byte) error {
+	return s.parse(data)
+}
+
+func (s *Set) parse(data []byte, options ...Option) error {
 	var proxy struct {
 		Keys []json.RawMessage `json:"keys"`
 	}
@@ -234,14 +471,14 @@ func (s *Set) UnmarshalJSON(data []byte) error {
 	}
 
 	if len(proxy.Keys) == 0 {
-		k, err := ParseKey(data)
+		k, err := ParseKey(data, options...)
 		if err != nil {
 			return errors.Wrap(err, `failed to unmarshal key from JSON headers`)
 		}
 		s.Keys = append(s.Keys, k)
 	} else {
 		for i, buf := range proxy.Keys {
-			k, err := ParseKey([]byte(buf))
+			k, err := ParseKey([]byte(buf), options...)
 			if err != nil {
 				return errors.Wrapf(err, `failed to unmarshal key #%d (total %d) from multi-key JWK set`, i+1, len(proxy.Keys))
 			}
@@ -251,15 +488,58 @@ func (s *Set) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// maxTrailingData is the maximum number of bytes following the JSON value
+// that Parse reads in order to check that they are whitespace
+const maxTrailingData = 64 * 1024
+
 // Parse parses JWK from the incoming io.Reader. This function can handle
 // both single-key and multi-key formats. If you know before hand which
 // format the incoming data is in, you might want to consider using
 // "encoding/json" directly
 //
+// The options are the same as those accepted by `jwk.ParseKey`.
+// In addition, WithStrictTrailingData and WithAllowTrailingData control
+// how data following the JSON value is treated. By default trailing
+// whitespace is accepted, and anything else is an error. Unless trailing
+// data is allowed, at most 64KiB of it is read before giving up.
+//
 // Note that a successful parsing does NOT guarantee a valid key
-func Parse(in io.Reader) (*Set, error) {
+func Parse(in io.Reader, options ...Option) (*Set, error) {
+	var strictTrailingData bool
+	var allowTrailingData bool
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyStrictTrailingData:
+			strictTrailingData = option.Value().(bool)
+		case optkeyAllowTrailingData:
+			allowTrailingData = option.Value().(bool)
+		}
+	}
+
+	var raw json.RawMessage
+	dec := json.NewDecoder(in)
+	if err := dec.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal JWK")
+	}
+
+	if strictTrailingData || !allowTrailingData {
+		trailing, err := ioutil.ReadAll(io.LimitReader(io.MultiReader(dec.Buffered(), in), maxTrailingData+1))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read trailing data")
+		}
+		if len(trailing) > maxTrailingData {
+			return nil, errors.New("failed to unmarshal JWK: too much trailing data after JSON value")
+		}
+		if !strictTrailingData {
+			trailing = bytes.TrimSpace(trailing)
+		}
+		if len(trailing) > 0 {
+			return nil, errors.New("failed to unmarshal JWK: trailing data after JSON value")
+		}
+	}
+
 	var s Set
-	if err := json.NewDecoder(in).Decode(&s); err != nil {
+	if err := s.parse(raw, options...); err != nil {
 		return nil, errors.Wrap(err, "failed to unmarshal JWK")
 	}
 	return &s, nil
@@ -268,15 +548,15 @@ func Parse(in io.Reader) (*Set, error) {
 // ParseBytes parses JWK from the incoming byte buffer.
 //
 // Note that a successful parsing does NOT guarantee a valid key
-func ParseBytes(buf []byte) (*Set, error) {
-	return Parse(bytes.NewReader(buf))
+func ParseBytes(buf []byte, options ...Option) (*Set, error) {
+	return Parse(bytes.NewReader(buf), options...)
 }
 
 // ParseString parses JWK from the incoming string.
 //
 // Note that a successful parsing does NOT guarantee a valid key
-func ParseString(s string) (*Set, error) {
-	return Parse(strings.NewReader(s))
+func ParseString(s string, options ...Option) (*Set, error) {
+	return Parse(strings.NewReader(s), options...)
 }
 
 // LookupKeyID looks for keys matching the given key id. Note that the
@@ -389,3 +669,151 @@ func AssignKeyID(key Key, options ...Option) error {
 
 	return nil
 }
+
+// comparableIDCache holds the memoized result of Key.ComparableID.
+// Keys discard their cache whenever they are modified
+type comparableIDCache struct {
+	id    string
+	ready bool
+}
+
+// comparableID implements Key.ComparableID using the key's Thumbprint
+// method. The result is memoized in `*cache`, which is protected by `mu`.
+// The thumbprint is computed without holding the lock, as it reads the
+// key through its own accessors, and the result is only stored if the
+// key has not been modified in the meantime.
+func comparableID(mu *sync.RWMutex, cache **comparableIDCache, thumbprint func(crypto.Hash) ([]byte, error)) (string, error) {
+	mu.RLock()
+	if c := *cache; c != nil && c.ready {
+		mu.RUnlock()
+		return c.id, nil
+	}
+	mu.RUnlock()
+
+	mu.Lock()
+	if *cache == nil {
+		*cache = &comparableIDCache{}
+	}
+	c := *cache
+	mu.Unlock()
+
+	h, err := thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", errors.Wrap(err, `failed to generate thumbprint`)
+	}
+	id := base64.EncodeToString(h)
+
+	mu.Lock()
+	if *cache == c {
+		c.id = id
+		c.ready = true
+	}
+	mu.Unlock()
+	return id, nil
+}
+
+// NamespacedKeyID returns a key ID that is derived deterministically from
+// the key and `namespace`, so that the same key published under different
+// namespaces gets different key IDs. The ID is the base64url encoded hash
+// (using `hash`) of the length of the namespace as a 64-bit big endian
+// integer, the namespace, and the key's thumbprint (RFC7638) computed
+// using the same hash.
+func NamespacedKeyID(key Key, namespace string, hash crypto.Hash) (string, error) {
+	if !hash.Available() {
+		return "", errors.Errorf(`hash function %s is not available`, hash)
+	}
+
+	thumbprint, err := key.Thumbprint(hash)
+	if err != nil {
+		return "", errors.Wrap(err, `failed to generate thumbprint`)
+	}
+
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(namespace)))
+
+	h := hash.New()
+	h.Write(size[:])
+	h.Write([]byte(namespace))
+	h.Write(thumbprint)
+	return base64.EncodeToString(h.Sum(nil)), nil
+}
+
+// AlgorithmFamily returns the family of the algorithm declared in the
+// "alg" member of the key, such as jwa.SignatureFamily for "RS256". The
+// second return value is false if the key does not declare an algorithm,
+// or if the algorithm is not known.
+func AlgorithmFamily(key Key) (jwa.AlgorithmFamily, bool) {
+	family := jwa.FamilyOf(key.Algorithm())
+	return family, family != jwa.UnknownFamily
+}
+
+// Marshal serializes the given Key or *Set into JSON. It behaves like
+// json.Marshal, but accepts options that control the output.
+//
+// If jwk.WithMarshalThumbprintKeyID is specified, keys that do not have
+// the "kid" field are emitted with their thumbprint as the "kid", as
+// jwk.AssignKeyID would assign it. The keys themselves are not modified.
+func Marshal(v interface{}, options ...Option) ([]byte, error) {
+	var thumbprintHash crypto.Hash
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyMarshalThumbprintKeyID:
+			thumbprintHash = option.Value().(crypto.Hash)
+		}
+	}
+
+	if thumbprintHash == 0 {
+		return json.Marshal(v)
+	}
+
+	switch x := v.(type) {
+	case Key:
+		return marshalKeyWithKeyID(x, thumbprintHash)
+	case *Set:
+		keys := make([]json.RawMessage, len(x.Keys))
+		for i, key := range x.Keys {
+			buf, err := marshalKeyWithKeyID(key, thumbprintHash)
+			if err != nil {
+				return nil, errors.Wrapf(err, `failed to marshal key #%d`, i)
+			}
+			keys[i] = buf
+		}
+		return json.Marshal(map[string]interface{}{`keys`: keys})
+	default:
+		return nil, errors.Errorf(`invalid value %T (expected jwk.Key or *jwk.Set)`, v)
+	}
+}
+
+func marshalKeyWithKeyID(key Key, hash crypto.Hash) ([]byte, error) {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to marshal key`)
+	}
+
+	if _, ok := key.Get(KeyIDKey); ok {
+		return buf, nil
+	}
+
+	h, err := key.Thumbprint(hash)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to generate thumbprint`)
+	}
+
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.Wrap(err, `failed to unmarshal key`)
+	}
+	m[KeyIDKey] = base64.EncodeToString(h)
+	return json.Marshal(m)
+}
+
+// SetBufferPoolConfig sets the initial capacity of the buffers that are
+// allocated by the buffer pool used while marshaling keys. Setting this
+// close to the typical size of a marshaled key avoids growing the buffer
+// repeatedly when large keys (e.g. RSA) are serialized. Buffers already
+// in the pool are not affected. By default buffers start empty.
+func SetBufferPoolConfig(initialCap int) {
+	pool.SetBytesBufferInitialCapacity(initialCap)
+}
@@ -2,7 +2,9 @@ package jwk
 
 import (
 	"crypto"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/lestrrat-go/jwx/internal/option"
 )
@@ -10,8 +12,35 @@ import (
 type Option = option.Interface
 
 const (
-	optkeyHTTPClient     = `http-client`
-	optkeyThumbprintHash = `thumbprint-hash`
+	optkeyHTTPClient         = `http-client`
+	optkeyThumbprintHash     = `thumbprint-hash`
+	optkeyRequireContentType = `require-content-type`
+	optkeyRand               = `rand`
+	optkeyAllowedHosts       = `allowed-hosts`
+
+	optkeyPrivateParamDecryptor = `private-param-decryptor`
+	optkeyNotBeforeParam        = `not-before-param`
+	optkeyExpiresParam          = `expires-param`
+
+	optkeyMarshalThumbprintKeyID = `marshal-thumbprint-key-id`
+
+	optkeyStrictTrailingData = `strict-trailing-data`
+	optkeyAllowTrailingData  = `allow-trailing-data`
+
+	optkeyCompareMetadata = `compare-metadata`
+
+	optkeyPEM         = `pem`
+	optkeyPEMPassword = `pem-password`
+
+	optkeyValidator = `validator`
+
+	optkeyDedup = `dedup`
+
+	optkeyCRL               = `crl`
+	optkeyRevocationTimeout = `revocation-timeout`
+
+	optkeyPollInterval       = `poll-interval`
+	optkeyReloadErrorHandler = `reload-error-handler`
 )
 
 func WithHTTPClient(cl *http.Client) Option {
@@ -21,3 +50,151 @@ func WithHTTPClient(cl *http.Client) Option {
 func WithThumbprintHash(h crypto.Hash) Option {
 	return option.New(optkeyThumbprintHash, h)
 }
+
+// WithMarshalThumbprintKeyID specifies that `jwk.Marshal` should emit the
+// thumbprint of the key, computed using the given hash, as the "kid" of
+// keys that do not have one.
+func WithMarshalThumbprintKeyID(hash crypto.Hash) Option {
+	return option.New(optkeyMarshalThumbprintKeyID, hash)
+}
+
+// WithRequireContentType specifies that `jwk.Fetch` and friends should
+// reject HTTP responses whose Content-Type is not one of the given
+// media types. This catches misconfigured endpoints that respond with
+// an HTML error page and a 200 status.
+//
+// If no types are given, "application/json" and "application/jwk-set+json"
+// are accepted.
+func WithRequireContentType(types ...string) Option {
+	if len(types) == 0 {
+		types = []string{`application/json`, `application/jwk-set+json`}
+	}
+	return option.New(optkeyRequireContentType, types)
+}
+
+// WithRand specifies the source of randomness used by the key generation
+// functions such as `jwk.GenerateECDSAKey`. By default crypto/rand is used.
+// This is meant for generating reproducible keys for test fixtures,
+// and should not be used otherwise.
+func WithRand(r io.Reader) Option {
+	return option.New(optkeyRand, r)
+}
+
+// WithAllowedHosts specifies the hosts that `jwk.FetchX5U` and
+// `jwk.CheckRevocation` are allowed to contact, both for the initial
+// request and for any redirect. Host names are compared
+// case-insensitively, without the port.
+func WithAllowedHosts(hosts ...string) Option {
+	return option.New(optkeyAllowedHosts, hosts)
+}
+
+// PrivateParamDecryptor is a function that converts the value of the
+// private key member `name` as found in the JSON representation of a
+// key (such as an encrypted blob) into its canonical form. It must
+// return either the raw bytes, or the base64url encoded string.
+type PrivateParamDecryptor func(name string, raw interface{}) (interface{}, error)
+
+// WithPrivateParamDecryptor specifies a function that is called for
+// each of the private key members ("d", "p", "q", "dp", "dq", and "qi"
+// for RSA keys, "d" for EC keys, and "k" for symmetric keys) found
+// while parsing keys via `jwk.ParseKey` and `jwk.Parse`, before the key
+// is assembled.
+func WithPrivateParamDecryptor(fn PrivateParamDecryptor) Option {
+	return option.New(optkeyPrivateParamDecryptor, fn)
+}
+
+// WithNotBeforeParam specifies the name of the private parameter that
+// `jwk.KeyIsValidAt` reads the start of the key validity period from.
+// By default "iat" is used.
+func WithNotBeforeParam(name string) Option {
+	return option.New(optkeyNotBeforeParam, name)
+}
+
+// WithExpiresParam specifies the name of the private parameter that
+// `jwk.KeyIsValidAt` reads the end of the key validity period from.
+// By default "exp" is used.
+func WithExpiresParam(name string) Option {
+	return option.New(optkeyExpiresParam, name)
+}
+
+// WithStrictTrailingData specifies whether `jwk.Parse` and friends should
+// reject any data following the JSON value, including whitespace such
+// as a trailing newline. By default trailing whitespace is accepted,
+// and anything else is rejected.
+func WithStrictTrailingData(b bool) Option {
+	return option.New(optkeyStrictTrailingData, b)
+}
+
+// WithAllowTrailingData specifies whether `jwk.Parse` and friends should
+// ignore any data following the JSON value, even if it is not whitespace.
+// Use this only for endpoints that are known to append garbage to their
+// responses. WithStrictTrailingData takes precedence over this option.
+func WithAllowTrailingData(b bool) Option {
+	return option.New(optkeyAllowTrailingData, b)
+}
+
+// WithCompareMetadata specifies that `jwk.Equal` should also compare the
+// members that are not part of the key material, such as "kid", "use",
+// and "alg". By default only the key material is compared.
+func WithCompareMetadata() Option {
+	return option.New(optkeyCompareMetadata, true)
+}
+
+// WithPEM specifies that `jwk.ParseKey` should expect the data to be
+// a PEM encoded key (or certificate) instead of a JWK. The first PEM
+// block is used.
+func WithPEM(b bool) Option {
+	return option.New(optkeyPEM, b)
+}
+
+// WithPEMPassword specifies the password used to decrypt PKCS#8
+// "ENCRYPTED PRIVATE KEY" PEM blocks when `jwk.ParseKey` is called
+// with WithPEM(true). Only PBES2 with PBKDF2 and AES-CBC (as produced by
+// `openssl pkcs8 -topk8 -v2 aes-256-cbc`) is supported.
+func WithPEMPassword(password []byte) Option {
+	return option.New(optkeyPEMPassword, password)
+}
+
+// WithValidator specifies a KeyValidator that `jwk.Validate` runs after
+// the built-in checks. Specify it multiple times to run several
+// validators; they are run in the order given, and the first error is
+// returned.
+func WithValidator(v KeyValidator) Option {
+	return option.New(optkeyValidator, v)
+}
+
+// WithDedup specifies whether `Set.AddKey` should replace a key in the
+// set that has the same thumbprint (RFC7638) as the key being added,
+// instead of adding a duplicate. A private key and its public key are
+// not considered duplicates; see `Set.AddKey` for details.
+func WithDedup(b bool) Option {
+	return option.New(optkeyDedup, b)
+}
+
+// WithCRL specifies whether `jwk.CheckRevocation` should consult the CRL
+// distribution points of the certificate when OCSP does not give a
+// definite answer.
+func WithCRL(b bool) Option {
+	return option.New(optkeyCRL, b)
+}
+
+// WithRevocationTimeout specifies the time that `jwk.CheckRevocation`
+// may spend contacting OCSP responders and CRL distribution points.
+// A zero or negative value disables the timeout, leaving only the
+// deadline of the context.
+func WithRevocationTimeout(d time.Duration) Option {
+	return option.New(optkeyRevocationTimeout, d)
+}
+
+// WithPollInterval specifies the interval at which a `jwk.FileCache`
+// checks its file for changes. The default is one second.
+func WithPollInterval(d time.Duration) Option {
+	return option.New(optkeyPollInterval, d)
+}
+
+// WithReloadErrorHandler specifies a function that is called when a
+// `jwk.FileCache` fails to reload its file. The previously loaded set
+// remains in use.
+func WithReloadErrorHandler(fn func(error)) Option {
+	return option.New(optkeyReloadErrorHandler, fn)
+}
@@ -0,0 +1,194 @@
+package jwk
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"hash"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// https://tools.ietf.org/html/rfc5958#section-3
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// https://tools.ietf.org/html/rfc8018#appendix-A.4
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// https://tools.ietf.org/html/rfc8018#appendix-A.2
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// parsePEMKey parses the first PEM block in data into a raw key.
+// Encrypted PKCS#8 blocks are decrypted using password
+func parsePEMKey(data, password []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New(`failed to decode PEM data`)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		if _, ok := block.Headers["DEK-Info"]; ok {
+			return nil, errors.New(`unsupported PEM encryption: legacy encrypted PEM blocks are not supported, use PKCS#8 instead`)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		if _, ok := block.Headers["DEK-Info"]; ok {
+			return nil, errors.New(`unsupported PEM encryption: legacy encrypted PEM blocks are not supported, use PKCS#8 instead`)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		if password == nil {
+			return nil, errors.New(`PEM block is encrypted, but no password was given (use jwk.WithPEMPassword)`)
+		}
+		decrypted, err := decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(decrypted)
+		if err != nil {
+			// a wrong password passes the padding check once in a while
+			return nil, errors.New(`failed to decrypt PEM block: incorrect password`)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to parse certificate`)
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, errors.Errorf(`unsupported PEM block type %q`, block.Type)
+	}
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo structure that uses
+// PBES2 with PBKDF2 and AES-CBC, and returns the DER encoded PKCS#8
+// private key
+func decryptPKCS8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errors.New(`failed to parse encrypted PKCS#8 structure`)
+	}
+
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.Errorf(`unsupported PEM encryption: encryption scheme %s is not supported (only PBES2 is)`, info.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New(`failed to parse PBES2 parameters`)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.Errorf(`unsupported PEM encryption: key derivation function %s is not supported (only PBKDF2 is)`, params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New(`failed to parse PBKDF2 parameters`)
+	}
+
+	var prf func() hash.Hash
+	switch oid := kdfParams.PRF.Algorithm; {
+	case len(oid) == 0, oid.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case oid.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case oid.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case oid.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.Errorf(`unsupported PEM encryption: PBKDF2 pseudorandom function %s is not supported`, oid)
+	}
+
+	var keysize int
+	switch oid := params.EncryptionScheme.Algorithm; {
+	case oid.Equal(oidAES128CBC):
+		keysize = 16
+	case oid.Equal(oidAES192CBC):
+		keysize = 24
+	case oid.Equal(oidAES256CBC):
+		keysize = 32
+	default:
+		return nil, errors.Errorf(`unsupported PEM encryption: cipher %s is not supported (only AES-CBC is)`, oid)
+	}
+	if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keysize {
+		return nil, errors.Errorf(`invalid PBKDF2 key length %d for cipher %s`, kdfParams.KeyLength, params.EncryptionScheme.Algorithm)
+	}
+	if kdfParams.IterationCount <= 0 {
+		return nil, errors.Errorf(`invalid PBKDF2 iteration count %d`, kdfParams.IterationCount)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New(`failed to parse AES-CBC parameters`)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.Errorf(`invalid AES-CBC IV length %d`, len(iv))
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New(`invalid encrypted data length`)
+	}
+
+	key := pbkdf2.Key(password, kdfParams.Salt, kdfParams.IterationCount, keysize, prf)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create AES cipher`)
+	}
+
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	// PKCS#7 padding. As the data is not authenticated, a padding error
+	// is what a wrong password usually looks like
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New(`failed to decrypt PEM block: incorrect password`)
+	}
+	if !hmac.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New(`failed to decrypt PEM block: incorrect password`)
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
@@ -0,0 +1,215 @@
+package jwk
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// defaultRevocationTimeout bounds the time CheckRevocation spends
+// contacting OCSP responders and CRL distribution points
+const defaultRevocationTimeout = 10 * time.Second
+
+// maxRevocationResponseSize limits the size of the OCSP responses and
+// CRLs that CheckRevocation is willing to read
+const maxRevocationResponseSize = 10 << 20
+
+// CheckRevocation reports whether the leaf certificate in the "x5c" field
+// of the given key has been revoked. The chain must contain the issuer of
+// the leaf as its second certificate. The OCSP responders listed in the
+// leaf are consulted in order, and if none of them gives a definite
+// answer, the CRL distribution points are consulted when WithCRL(true)
+// is specified. An error is returned if the status cannot be determined.
+//
+// OCSP responses and CRLs are verified against the issuer taken from the
+// chain, so the chain itself should be verified (for example, using
+// VerifyX5C) before calling this function.
+//
+// Because the URLs come from the certificate, use the WithAllowedHosts
+// option to restrict the hosts that may be contacted, including those
+// that the responders redirect to. The WithHTTPClient option can be
+// used to specify the HTTP client, and the whole check is bounded by
+// WithRevocationTimeout (10 seconds by default).
+func CheckRevocation(ctx context.Context, key Key, options ...Option) (bool, error) {
+	httpcl := http.DefaultClient
+	timeout := defaultRevocationTimeout
+	var allowedHosts []string
+	var useCRL bool
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyHTTPClient:
+			httpcl = option.Value().(*http.Client)
+		case optkeyAllowedHosts:
+			allowedHosts = option.Value().([]string)
+		case optkeyCRL:
+			useCRL = option.Value().(bool)
+		case optkeyRevocationTimeout:
+			timeout = option.Value().(time.Duration)
+		}
+	}
+
+	certs := key.X509CertChain()
+	if len(certs) < 2 {
+		return false, errors.Errorf(`%s must contain the leaf certificate and its issuer`, X509CertChainKey)
+	}
+	leaf, issuer := certs[0], certs[1]
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	fetcher := &revocationFetcher{
+		client:       httpcl,
+		allowedHosts: allowedHosts,
+	}
+
+	var lastErr error
+	for _, server := range leaf.OCSPServer {
+		revoked, err := fetcher.checkOCSP(ctx, server, leaf, issuer)
+		if err == nil {
+			return revoked, nil
+		}
+		lastErr = err
+	}
+
+	if useCRL {
+		for _, dp := range leaf.CRLDistributionPoints {
+			revoked, err := fetcher.checkCRL(ctx, dp, leaf, issuer)
+			if err == nil {
+				return revoked, nil
+			}
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return false, errors.Wrap(lastErr, `failed to determine revocation status`)
+	}
+	return false, errors.New(`failed to determine revocation status: certificate does not list any usable OCSP responders or CRL distribution points`)
+}
+
+type revocationFetcher struct {
+	client       *http.Client
+	allowedHosts []string
+}
+
+// checkURL makes sure that `u` may be contacted. It is applied to the
+// URLs taken from the certificate as well as to every redirect
+func (f *revocationFetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf(`invalid url scheme %s for %s`, u.Scheme, u)
+	}
+
+	if len(f.allowedHosts) > 0 && !isAllowedHost(u.Hostname(), f.allowedHosts) {
+		return errors.Errorf(`host %s is not allowed`, u.Hostname())
+	}
+	return nil
+}
+
+func (f *revocationFetcher) do(ctx context.Context, method, u string, body []byte, contentType string) ([]byte, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to parse url %s`, u)
+	}
+
+	if err := f.checkURL(parsed); err != nil {
+		return nil, err
+	}
+
+	var rdr io.Reader
+	if body != nil {
+		rdr = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, parsed.String(), rdr)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to create request to %s`, u)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := restrictRedirects(f.client, f.checkURL).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to contact %s`, u)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf(`failed to contact %s (status = %d)`, u, res.StatusCode)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(res.Body, maxRevocationResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to read response from %s`, u)
+	}
+	return buf, nil
+}
+
+// checkOCSP asks the OCSP responder at `server` about the leaf
+func (f *revocationFetcher) checkOCSP(ctx context.Context, server string, leaf, issuer *x509.Certificate) (bool, error) {
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to create OCSP request`)
+	}
+
+	buf, err := f.do(ctx, http.MethodPost, server, req, "application/ocsp-request")
+	if err != nil {
+		return false, errors.Wrap(err, `failed to query OCSP responder`)
+	}
+
+	res, err := ocsp.ParseResponseForCert(buf, leaf, issuer)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to parse OCSP response`)
+	}
+
+	if !res.NextUpdate.IsZero() && res.NextUpdate.Before(time.Now()) {
+		return false, errors.Errorf(`stale OCSP response from %s`, server)
+	}
+
+	switch res.Status {
+	case ocsp.Good:
+		return false, nil
+	case ocsp.Revoked:
+		return true, nil
+	default:
+		return false, errors.Errorf(`OCSP responder %s does not know the certificate`, server)
+	}
+}
+
+// checkCRL looks for the leaf in the CRL at `dp`
+func (f *revocationFetcher) checkCRL(ctx context.Context, dp string, leaf, issuer *x509.Certificate) (bool, error) {
+	buf, err := f.do(ctx, http.MethodGet, dp, nil, "")
+	if err != nil {
+		return false, errors.Wrap(err, `failed to fetch CRL`)
+	}
+
+	crl, err := x509.ParseCRL(buf)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to parse CRL`)
+	}
+
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return false, errors.Wrap(err, `failed to verify CRL`)
+	}
+
+	if crl.HasExpired(time.Now()) {
+		return false, errors.Errorf(`stale CRL from %s`, dp)
+	}
+
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
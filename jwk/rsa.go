@@ -6,12 +6,17 @@ import (
 	"crypto/rsa"
 	"encoding/binary"
 	"math/big"
+	"sync"
 
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/pkg/errors"
 )
 
+// rsaNumericParams lists the RSA key members that represent big
+// integers. These are normalized before comparison in Equal
+var rsaNumericParams = []string{RSADKey, RSADPKey, RSADQKey, RSAEKey, RSANKey, RSAPKey, RSAQKey, RSAQIKey}
+
 func NewRSAPublicKey() RSAPublicKey {
 	return newRSAPublicKey()
 }
@@ -19,6 +24,7 @@ func NewRSAPublicKey() RSAPublicKey {
 func newRSAPublicKey() *rsaPublicKey {
 	return &rsaPublicKey{
 		privateParams: make(map[string]interface{}),
+		mu:            &sync.RWMutex{},
 	}
 }
 
@@ -29,15 +35,20 @@ func NewRSAPrivateKey() RSAPrivateKey {
 func newRSAPrivateKey() *rsaPrivateKey {
 	return &rsaPrivateKey{
 		privateParams: make(map[string]interface{}),
+		mu:            &sync.RWMutex{},
 	}
 }
 
 func (k *rsaPrivateKey) FromRaw(rawKey *rsa.PrivateKey) error {
-	k.d = rawKey.D.Bytes()
 	if len(rawKey.Primes) < 2 {
 		return errors.Errorf(`invalid number of primes in rsa.PrivateKey: need 2, got %d`, len(rawKey.Primes))
 	}
 
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.comparableID = nil
+	k.d = rawKey.D.Bytes()
+
 	k.p = rawKey.Primes[0].Bytes()
 	k.q = rawKey.Primes[1].Bytes()
 
@@ -66,6 +77,9 @@ func (k *rsaPrivateKey) FromRaw(rawKey *rsa.PrivateKey) error {
 }
 
 func (k *rsaPublicKey) FromRaw(rawKey *rsa.PublicKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.comparableID = nil
 	k.n = rawKey.N.Bytes()
 	data := make([]byte, 8)
 	binary.BigEndian.PutUint64(data, uint64(rawKey.E))
@@ -81,6 +95,9 @@ func (k *rsaPublicKey) FromRaw(rawKey *rsa.PublicKey) error {
 }
 
 func (k *rsaPrivateKey) Raw(v interface{}) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
 	var d, q, p big.Int // note: do not use from sync.Pool
 
 	d.SetBytes(k.d)
@@ -138,8 +155,10 @@ func (k *rsaPublicKey) Raw(v interface{}) error {
 	e := pool.GetBigInt()
 	defer pool.ReleaseBigInt(e)
 
+	k.mu.RLock()
 	n.SetBytes(k.n)
 	e.SetBytes(k.e)
+	k.mu.RUnlock()
 
 	key.N = n
 	key.E = int(e.Int64())
@@ -147,7 +166,7 @@ func (k *rsaPublicKey) Raw(v interface{}) error {
 	return assignRawResult(v, &key)
 }
 
-func (k rsaPrivateKey) PublicKey() (RSAPublicKey, error) {
+func (k *rsaPrivateKey) PublicKey() (RSAPublicKey, error) {
 	var key rsa.PrivateKey
 	if err := k.Raw(&key); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize key to generate public key`)
@@ -162,7 +181,7 @@ func (k rsaPrivateKey) PublicKey() (RSAPublicKey, error) {
 
 // Thumbprint returns the JWK thumbprint using the indicated
 // hashing algorithm, according to RFC 7638
-func (k rsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
+func (k *rsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	var key rsa.PrivateKey
 	if err := k.Raw(&key); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize RSA private key`)
@@ -170,7 +189,11 @@ func (k rsaPrivateKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	return rsaThumbprint(hash, &key.PublicKey)
 }
 
-func (k rsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
+func (k *rsaPrivateKey) ComparableID() (string, error) {
+	return comparableID(k.mu, &k.comparableID, k.Thumbprint)
+}
+
+func (k *rsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	var key rsa.PublicKey
 	if err := k.Raw(&key); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize RSA public key`)
@@ -178,6 +201,10 @@ func (k rsaPublicKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	return rsaThumbprint(hash, &key)
 }
 
+func (k *rsaPublicKey) ComparableID() (string, error) {
+	return comparableID(k.mu, &k.comparableID, k.Thumbprint)
+}
+
 func rsaThumbprint(hash crypto.Hash, key *rsa.PublicKey) ([]byte, error) {
 	var buf bytes.Buffer
 	buf.WriteString(`{"e":"`)
@@ -3,7 +3,6 @@
 package jwk
 
 import (
-	"bytes"
 	"context"
 	"crypto/rsa"
 	"crypto/x509"
@@ -11,10 +10,12 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/iter"
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -62,6 +63,8 @@ type rsaPrivateKey struct {
 	x509CertThumbprintS256 *string           // https://tools.ietf.org/html/rfc7515#section-4.1.8
 	x509URL                *string           // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	privateParams          map[string]interface{}
+	comparableID           *comparableIDCache
+	mu                     *sync.RWMutex
 }
 
 type rsaPrivateKeyMarshalProxy struct {
@@ -89,6 +92,8 @@ func (h rsaPrivateKey) KeyType() jwa.KeyType {
 }
 
 func (h *rsaPrivateKey) Algorithm() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.algorithm != nil {
 		return *(h.algorithm)
 	}
@@ -96,22 +101,32 @@ func (h *rsaPrivateKey) Algorithm() string {
 }
 
 func (h *rsaPrivateKey) D() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.d
 }
 
 func (h *rsaPrivateKey) DP() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.dp
 }
 
 func (h *rsaPrivateKey) DQ() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.dq
 }
 
 func (h *rsaPrivateKey) E() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.e
 }
 
 func (h *rsaPrivateKey) KeyID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyID != nil {
 		return *(h.keyID)
 	}
@@ -119,6 +134,8 @@ func (h *rsaPrivateKey) KeyID() string {
 }
 
 func (h *rsaPrivateKey) KeyUsage() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyUsage != nil {
 		return *(h.keyUsage)
 	}
@@ -126,6 +143,8 @@ func (h *rsaPrivateKey) KeyUsage() string {
 }
 
 func (h *rsaPrivateKey) KeyOps() KeyOperationList {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyops != nil {
 		return *(h.keyops)
 	}
@@ -133,22 +152,32 @@ func (h *rsaPrivateKey) KeyOps() KeyOperationList {
 }
 
 func (h *rsaPrivateKey) N() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.n
 }
 
 func (h *rsaPrivateKey) P() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.p
 }
 
 func (h *rsaPrivateKey) Q() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.q
 }
 
 func (h *rsaPrivateKey) QI() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.qi
 }
 
 func (h *rsaPrivateKey) X509CertChain() []*x509.Certificate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertChain != nil {
 		return h.x509CertChain.Get()
 	}
@@ -156,6 +185,8 @@ func (h *rsaPrivateKey) X509CertChain() []*x509.Certificate {
 }
 
 func (h *rsaPrivateKey) X509CertThumbprint() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprint != nil {
 		return *(h.x509CertThumbprint)
 	}
@@ -163,6 +194,8 @@ func (h *rsaPrivateKey) X509CertThumbprint() string {
 }
 
 func (h *rsaPrivateKey) X509CertThumbprintS256() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprintS256 != nil {
 		return *(h.x509CertThumbprintS256)
 	}
@@ -170,6 +203,8 @@ func (h *rsaPrivateKey) X509CertThumbprintS256() string {
 }
 
 func (h *rsaPrivateKey) X509URL() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509URL != nil {
 		return *(h.x509URL)
 	}
@@ -179,6 +214,7 @@ func (h *rsaPrivateKey) X509URL() string {
 func (h *rsaPrivateKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	defer close(ch)
 
+	h.mu.RLock()
 	var pairs []*HeaderPair
 	pairs = append(pairs, &HeaderPair{Key: "kty", Value: jwa.RSA})
 	if h.algorithm != nil {
@@ -232,6 +268,7 @@ func (h *rsaPrivateKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	for k, v := range h.privateParams {
 		pairs = append(pairs, &HeaderPair{Key: k, Value: v})
 	}
+	h.mu.RUnlock()
 	for _, pair := range pairs {
 		select {
 		case <-ctx.Done():
@@ -245,7 +282,26 @@ func (h *rsaPrivateKey) PrivateParams() map[string]interface{} {
 	return h.privateParams
 }
 
+func (h *rsaPrivateKey) PrivateParamKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.privateParams))
+	for k := range h.privateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *rsaPrivateKey) PrivateParamLen() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.privateParams)
+}
+
 func (h *rsaPrivateKey) Get(name string) (interface{}, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	switch name {
 	case KeyTypeKey:
 		return h.KeyType(), true
@@ -336,6 +392,9 @@ func (h *rsaPrivateKey) Get(name string) (interface{}, bool) {
 }
 
 func (h *rsaPrivateKey) Set(name string, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	switch name {
 	case "kty":
 		return nil
@@ -456,6 +515,10 @@ func (h *rsaPrivateKey) UnmarshalJSON(buf []byte) error {
 	if err := json.Unmarshal(buf, &proxy); err != nil {
 		return errors.Wrap(err, `failed to unmarshal rsaPrivateKey`)
 	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	if proxy.XkeyType != jwa.RSA {
 		return errors.Errorf(`invalid kty value for RSAPrivateKey (%s)`, proxy.XkeyType)
 	}
@@ -564,6 +627,8 @@ func (h *rsaPrivateKey) UnmarshalJSON(buf []byte) error {
 }
 
 func (h rsaPrivateKey) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	var proxy rsaPrivateKeyMarshalProxy
 	proxy.XkeyType = jwa.RSA
 	proxy.Xalgorithm = h.algorithm
@@ -606,8 +671,9 @@ func (h rsaPrivateKey) MarshalJSON() ([]byte, error) {
 	proxy.Xx509CertThumbprint = h.x509CertThumbprint
 	proxy.Xx509CertThumbprintS256 = h.x509CertThumbprintS256
 	proxy.Xx509URL = h.x509URL
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	enc := json.NewEncoder(buf)
 	if err := enc.Encode(proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to encode proxy to JSON`)
 	}
@@ -621,16 +687,18 @@ func (h rsaPrivateKey) MarshalJSON() ([]byte, error) {
 		sort.Strings(keys)
 		for i, k := range keys {
 			if hasContent || i > 0 {
-				fmt.Fprintf(&buf, `,`)
+				fmt.Fprintf(buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			fmt.Fprintf(buf, `%s:`, strconv.Quote(k))
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
-		fmt.Fprintf(&buf, `}`)
+		fmt.Fprintf(buf, `}`)
 	}
-	return buf.Bytes(), nil
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result, nil
 }
 
 func (h *rsaPrivateKey) Iterate(ctx context.Context) HeaderIterator {
@@ -666,6 +734,8 @@ type rsaPublicKey struct {
 	x509CertThumbprintS256 *string           // https://tools.ietf.org/html/rfc7515#section-4.1.8
 	x509URL                *string           // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	privateParams          map[string]interface{}
+	comparableID           *comparableIDCache
+	mu                     *sync.RWMutex
 }
 
 type rsaPublicKeyMarshalProxy struct {
@@ -687,6 +757,8 @@ func (h rsaPublicKey) KeyType() jwa.KeyType {
 }
 
 func (h *rsaPublicKey) Algorithm() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.algorithm != nil {
 		return *(h.algorithm)
 	}
@@ -694,10 +766,14 @@ func (h *rsaPublicKey) Algorithm() string {
 }
 
 func (h *rsaPublicKey) E() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.e
 }
 
 func (h *rsaPublicKey) KeyID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyID != nil {
 		return *(h.keyID)
 	}
@@ -705,6 +781,8 @@ func (h *rsaPublicKey) KeyID() string {
 }
 
 func (h *rsaPublicKey) KeyUsage() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyUsage != nil {
 		return *(h.keyUsage)
 	}
@@ -712,6 +790,8 @@ func (h *rsaPublicKey) KeyUsage() string {
 }
 
 func (h *rsaPublicKey) KeyOps() KeyOperationList {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyops != nil {
 		return *(h.keyops)
 	}
@@ -719,10 +799,14 @@ func (h *rsaPublicKey) KeyOps() KeyOperationList {
 }
 
 func (h *rsaPublicKey) N() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.n
 }
 
 func (h *rsaPublicKey) X509CertChain() []*x509.Certificate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertChain != nil {
 		return h.x509CertChain.Get()
 	}
@@ -730,6 +814,8 @@ func (h *rsaPublicKey) X509CertChain() []*x509.Certificate {
 }
 
 func (h *rsaPublicKey) X509CertThumbprint() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprint != nil {
 		return *(h.x509CertThumbprint)
 	}
@@ -737,6 +823,8 @@ func (h *rsaPublicKey) X509CertThumbprint() string {
 }
 
 func (h *rsaPublicKey) X509CertThumbprintS256() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprintS256 != nil {
 		return *(h.x509CertThumbprintS256)
 	}
@@ -744,6 +832,8 @@ func (h *rsaPublicKey) X509CertThumbprintS256() string {
 }
 
 func (h *rsaPublicKey) X509URL() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509URL != nil {
 		return *(h.x509URL)
 	}
@@ -753,6 +843,7 @@ func (h *rsaPublicKey) X509URL() string {
 func (h *rsaPublicKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	defer close(ch)
 
+	h.mu.RLock()
 	var pairs []*HeaderPair
 	pairs = append(pairs, &HeaderPair{Key: "kty", Value: jwa.RSA})
 	if h.algorithm != nil {
@@ -788,6 +879,7 @@ func (h *rsaPublicKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	for k, v := range h.privateParams {
 		pairs = append(pairs, &HeaderPair{Key: k, Value: v})
 	}
+	h.mu.RUnlock()
 	for _, pair := range pairs {
 		select {
 		case <-ctx.Done():
@@ -801,7 +893,26 @@ func (h *rsaPublicKey) PrivateParams() map[string]interface{} {
 	return h.privateParams
 }
 
+func (h *rsaPublicKey) PrivateParamKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.privateParams))
+	for k := range h.privateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *rsaPublicKey) PrivateParamLen() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.privateParams)
+}
+
 func (h *rsaPublicKey) Get(name string) (interface{}, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	switch name {
 	case KeyTypeKey:
 		return h.KeyType(), true
@@ -862,6 +973,9 @@ func (h *rsaPublicKey) Get(name string) (interface{}, bool) {
 }
 
 func (h *rsaPublicKey) Set(name string, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	switch name {
 	case "kty":
 		return nil
@@ -946,6 +1060,10 @@ func (h *rsaPublicKey) UnmarshalJSON(buf []byte) error {
 	if err := json.Unmarshal(buf, &proxy); err != nil {
 		return errors.Wrap(err, `failed to unmarshal rsaPublicKey`)
 	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	if proxy.XkeyType != jwa.RSA {
 		return errors.Errorf(`invalid kty value for RSAPublicKey (%s)`, proxy.XkeyType)
 	}
@@ -997,6 +1115,8 @@ func (h *rsaPublicKey) UnmarshalJSON(buf []byte) error {
 }
 
 func (h rsaPublicKey) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	var proxy rsaPublicKeyMarshalProxy
 	proxy.XkeyType = jwa.RSA
 	proxy.Xalgorithm = h.algorithm
@@ -1015,8 +1135,9 @@ func (h rsaPublicKey) MarshalJSON() ([]byte, error) {
 	proxy.Xx509CertThumbprint = h.x509CertThumbprint
 	proxy.Xx509CertThumbprintS256 = h.x509CertThumbprintS256
 	proxy.Xx509URL = h.x509URL
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	enc := json.NewEncoder(buf)
 	if err := enc.Encode(proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to encode proxy to JSON`)
 	}
@@ -1030,16 +1151,18 @@ func (h rsaPublicKey) MarshalJSON() ([]byte, error) {
 		sort.Strings(keys)
 		for i, k := range keys {
 			if hasContent || i > 0 {
-				fmt.Fprintf(&buf, `,`)
+				fmt.Fprintf(buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			fmt.Fprintf(buf, `%s:`, strconv.Quote(k))
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
-		fmt.Fprintf(&buf, `}`)
+		fmt.Fprintf(buf, `}`)
 	}
-	return buf.Bytes(), nil
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result, nil
 }
 
 func (h *rsaPublicKey) Iterate(ctx context.Context) HeaderIterator {
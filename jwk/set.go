@@ -0,0 +1,353 @@
+package jwk
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/pkg/errors"
+)
+
+// SetDiff compares two key sets using the keys' thumbprints (RFC7638),
+// and reports the changes required to go from `old` to `new`.
+// `added` contains keys that only exist in `new`, and `removed` contains
+// keys that only exist in `old`. `changed` contains keys from `new` whose
+// key ID also exists in `old`, but with different key material.
+//
+// Keys that exist in both sets are not reported. Keys are reported in
+// the order they appear in their respective sets.
+func SetDiff(old, new *Set) (added, removed, changed []Key, err error) {
+	oldPrints, err := setThumbprints(old, crypto.SHA256)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, `failed to compute thumbprints for old set`)
+	}
+	newPrints, err := setThumbprints(new, crypto.SHA256)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, `failed to compute thumbprints for new set`)
+	}
+
+	oldKeyIDs := make(map[string]struct{})
+	for _, key := range old.Keys {
+		if kid := key.KeyID(); kid != "" {
+			oldKeyIDs[kid] = struct{}{}
+		}
+	}
+	newKeyIDs := make(map[string]struct{})
+	for _, key := range new.Keys {
+		if kid := key.KeyID(); kid != "" {
+			newKeyIDs[kid] = struct{}{}
+		}
+	}
+
+	for i, key := range new.Keys {
+		if _, ok := oldPrints.set[newPrints.list[i]]; ok {
+			continue
+		}
+
+		if _, ok := oldKeyIDs[key.KeyID()]; ok {
+			changed = append(changed, key)
+		} else {
+			added = append(added, key)
+		}
+	}
+
+	for i, key := range old.Keys {
+		if _, ok := newPrints.set[oldPrints.list[i]]; ok {
+			continue
+		}
+
+		// keys with the same key ID have been reported as changed
+		if _, ok := newKeyIDs[key.KeyID()]; ok {
+			continue
+		}
+		removed = append(removed, key)
+	}
+	return added, removed, changed, nil
+}
+
+type thumbprints struct {
+	list []string
+	set  map[string]struct{}
+}
+
+func setThumbprints(s *Set, hash crypto.Hash) (*thumbprints, error) {
+	tp := &thumbprints{
+		list: make([]string, len(s.Keys)),
+		set:  make(map[string]struct{}, len(s.Keys)),
+	}
+	for i, key := range s.Keys {
+		v, err := key.Thumbprint(hash)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to compute thumbprint for key #%d`, i)
+		}
+		tp.list[i] = string(v)
+		tp.set[string(v)] = struct{}{}
+	}
+	return tp, nil
+}
+
+// AddKey appends the key to the set. If WithDedup(true) is specified and
+// the set already contains a key with the same thumbprint (RFC7638,
+// computed using SHA-256 unless another hash is specified via
+// WithThumbprintHash), that key is replaced instead, so that members
+// such as "kid" and "use" of the newer key win. This makes it safe to
+// merge key sets that overlap.
+//
+// A private key and its public key have the same thumbprint, but they are
+// not considered duplicates of each other: adding the public key of a
+// private key that is already in the set (or vice versa) appends it, so
+// that deduplication never discards private key material, nor replaces a
+// public key that a caller intends to publish with its private key.
+func (s *Set) AddKey(key Key, options ...Option) error {
+	if key == nil {
+		return errors.New(`nil key passed to Set.AddKey`)
+	}
+
+	hash := crypto.SHA256
+	var dedup bool
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyThumbprintHash:
+			hash = option.Value().(crypto.Hash)
+		case optkeyDedup:
+			dedup = option.Value().(bool)
+		}
+	}
+
+	if dedup {
+		thumbprint, err := key.Thumbprint(hash)
+		if err != nil {
+			return errors.Wrap(err, `failed to compute thumbprint`)
+		}
+
+		public := isPublicKey(key)
+		for i, existing := range s.Keys {
+			if isPublicKey(existing) != public {
+				continue
+			}
+			v, err := existing.Thumbprint(hash)
+			if err != nil {
+				return errors.Wrapf(err, `failed to compute thumbprint for key #%d`, i)
+			}
+			if bytes.Equal(v, thumbprint) {
+				s.Keys[i] = key
+				return nil
+			}
+		}
+	}
+
+	s.Keys = append(s.Keys, key)
+	return nil
+}
+
+// Difference returns a new Set containing the keys of this set that do
+// not exist in `other`. Intersection returns the keys that exist in both.
+// Keys are compared using their thumbprints (RFC7638), computed using
+// SHA-256 unless another hash is specified via WithThumbprintHash.
+//
+// The returned set contains copies of the keys, in the order they appear
+// in this set, so modifying them does not affect either set.
+func (s Set) Difference(other Set, options ...Option) (*Set, error) {
+	return s.compare(other, false, options...)
+}
+
+// Intersection returns a new Set containing the keys of this set that
+// also exist in `other`. See Difference for how keys are compared.
+func (s Set) Intersection(other Set, options ...Option) (*Set, error) {
+	return s.compare(other, true, options...)
+}
+
+func (s Set) compare(other Set, keepCommon bool, options ...Option) (*Set, error) {
+	hash := crypto.SHA256
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyThumbprintHash:
+			hash = option.Value().(crypto.Hash)
+		}
+	}
+
+	prints, err := setThumbprints(&s, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to compute thumbprints`)
+	}
+	otherPrints, err := setThumbprints(&other, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to compute thumbprints for other set`)
+	}
+
+	var result Set
+	for i, key := range s.Keys {
+		if _, ok := otherPrints.set[prints.list[i]]; ok != keepCommon {
+			continue
+		}
+
+		cloned, err := cloneKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to copy key #%d`, i)
+		}
+		result.Keys = append(result.Keys, cloned)
+	}
+	return &result, nil
+}
+
+// cloneKey creates a deep copy of the key by serializing it
+func cloneKey(key Key) (Key, error) {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to marshal key`)
+	}
+	return ParseKey(buf)
+}
+
+// SetStats is a summary of the keys in a Set. See Set.Stats
+type SetStats struct {
+	// Total is the number of keys in the set
+	Total int
+	// ByKeyType counts the keys by their "kty"
+	ByKeyType map[jwa.KeyType]int
+	// ByKeyUsage counts the keys by their "use". Keys without "use"
+	// are counted under the empty string
+	ByKeyUsage map[string]int
+	// ByAlgorithm counts the keys by their "alg". Keys without "alg"
+	// are counted under the empty string
+	ByAlgorithm map[string]int
+	// Expired is the number of keys whose expiry time, as recorded in
+	// the private parameter used by KeyIsValidAt, has passed
+	Expired int
+}
+
+// Stats aggregates the keys in the set by type, usage, and algorithm,
+// and counts the keys that have expired. The name of the private
+// parameter that holds the expiry time can be changed by passing
+// WithExpiresParam, as with KeyIsValidAt.
+func (s Set) Stats(options ...Option) SetStats {
+	expName := `exp`
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyExpiresParam:
+			expName = option.Value().(string)
+		}
+	}
+
+	stats := SetStats{
+		Total:       len(s.Keys),
+		ByKeyType:   make(map[jwa.KeyType]int),
+		ByKeyUsage:  make(map[string]int),
+		ByAlgorithm: make(map[string]int),
+	}
+
+	now := time.Now()
+	for _, key := range s.Keys {
+		stats.ByKeyType[key.KeyType()]++
+		stats.ByKeyUsage[key.KeyUsage()]++
+		stats.ByAlgorithm[key.Algorithm()]++
+
+		if v, ok := key.Get(expName); ok {
+			if exp, err := validityTime(v); err == nil && !now.Before(exp) {
+				stats.Expired++
+			}
+		}
+	}
+	return stats
+}
+
+// Sort sorts the keys in the set using `less`, which reports whether `a`
+// should come before `b`. The sort is stable, so keys that compare equal
+// keep their relative order. The set is serialized in the new order.
+func (s *Set) Sort(less func(a, b Key) bool) {
+	sort.SliceStable(s.Keys, func(i, j int) bool {
+		return less(s.Keys[i], s.Keys[j])
+	})
+}
+
+// SortByKeyID returns a function that can be passed to Set.Sort to sort
+// the keys by their "kid" member. Keys without a key ID are sorted after
+// all other keys.
+func SortByKeyID() func(a, b Key) bool {
+	return func(a, b Key) bool {
+		akid := a.KeyID()
+		bkid := b.KeyID()
+		if akid == "" || bkid == "" {
+			return bkid == "" && akid != ""
+		}
+		return akid < bkid
+	}
+}
+
+// PublicSet returns a new Set where each key is replaced by its public
+// form, as returned by PublicKey(). Members other than the key material,
+// such as "kid", "alg", and "use", are carried over. Keys that are
+// already public are copied as is.
+//
+// An error is returned if any of the keys does not have a public form,
+// such as symmetric keys, so that secrets are never published by mistake.
+func (s Set) PublicSet() (*Set, error) {
+	var result Set
+	for i, key := range s.Keys {
+		pubkey, err := publicKey(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to obtain public key for key #%d (kid = %q)`, i, key.KeyID())
+		}
+		result.Keys = append(result.Keys, pubkey)
+	}
+	return &result, nil
+}
+
+// isPublicKey reports whether the key is the public half of an
+// asymmetric key pair.
+func isPublicKey(key Key) bool {
+	switch key.(type) {
+	case RSAPublicKey, ECDSAPublicKey:
+		return true
+	default:
+		return false
+	}
+}
+
+func publicKey(key Key) (Key, error) {
+	var pubkey Key
+	switch key := key.(type) {
+	case RSAPrivateKey:
+		v, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		pubkey = v
+	case ECDSAPrivateKey:
+		v, err := key.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		pubkey = v
+	case RSAPublicKey, ECDSAPublicKey:
+		return cloneKey(key)
+	default:
+		return nil, errors.Errorf(`keys of type %s do not have a public form`, key.KeyType())
+	}
+
+	m, err := key.AsMap(context.TODO())
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to convert key to map`)
+	}
+
+	skip := map[string]struct{}{KeyTypeKey: {}}
+	for _, name := range privateParamNames[key.KeyType()] {
+		skip[name] = struct{}{}
+	}
+	for name, value := range m {
+		if _, ok := skip[name]; ok {
+			continue
+		}
+		if _, ok := pubkey.Get(name); ok {
+			continue
+		}
+		if err := pubkey.Set(name, value); err != nil {
+			return nil, errors.Wrapf(err, `failed to copy %q`, name)
+		}
+	}
+	return pubkey, nil
+}
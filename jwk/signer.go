@@ -0,0 +1,76 @@
+package jwk
+
+import (
+	"crypto"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SignerResolver creates a crypto.Signer from a URI that references
+// key material stored elsewhere, such as a PKCS#11 token
+type SignerResolver func(uri string) (crypto.Signer, error)
+
+type signerResolverEntry struct {
+	scheme   string
+	resolver SignerResolver
+}
+
+var muSignerResolvers sync.RWMutex
+var signerResolvers []signerResolverEntry
+
+// RegisterSignerResolver registers a resolver for keys whose private
+// key material is referenced by a URI instead of being embedded in the key.
+//
+// The URI is expected to be stored in the private parameter named
+// after the scheme, for example a key with a "pkcs11" private parameter
+// containing "pkcs11:token=foo;object=bar" is resolved by the resolver
+// registered for the "pkcs11" scheme. The public members of the key
+// should still describe the key, so that it can be used for verification.
+//
+// If a key references more than one registered scheme, the resolver that
+// was registered first is used. Registering a resolver for a scheme that
+// already has one replaces it, without changing its position.
+func RegisterSignerResolver(scheme string, resolver func(uri string) (crypto.Signer, error)) {
+	muSignerResolvers.Lock()
+	defer muSignerResolvers.Unlock()
+
+	for i, entry := range signerResolvers {
+		if entry.scheme == scheme {
+			signerResolvers[i].resolver = resolver
+			return
+		}
+	}
+	signerResolvers = append(signerResolvers, signerResolverEntry{scheme: scheme, resolver: resolver})
+}
+
+// ResolveSigner returns the crypto.Signer referenced by the key, using
+// the resolvers registered via RegisterSignerResolver. The second return
+// value is false if the key does not reference any registered scheme.
+func ResolveSigner(key Key) (crypto.Signer, bool, error) {
+	// Resolvers may be slow (e.g. talking to a token), so they are
+	// called without holding the lock
+	muSignerResolvers.RLock()
+	resolvers := make([]signerResolverEntry, len(signerResolvers))
+	copy(resolvers, signerResolvers)
+	muSignerResolvers.RUnlock()
+
+	for _, entry := range resolvers {
+		v, ok := key.Get(entry.scheme)
+		if !ok {
+			continue
+		}
+
+		uri, ok := v.(string)
+		if !ok {
+			return nil, true, errors.Errorf(`invalid value for %s: expected string, got %T`, entry.scheme, v)
+		}
+
+		signer, err := entry.resolver(uri)
+		if err != nil {
+			return nil, true, errors.Wrapf(err, `failed to resolve signer for %s`, uri)
+		}
+		return signer, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,37 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHFingerprint returns the fingerprint of the public key in the format
+// used by OpenSSH (e.g. `ssh-keygen -l`), that is, "SHA256:" followed by
+// the unpadded base64 encoded SHA-256 digest of the SSH wire encoding of
+// the key. For private keys, the fingerprint of the public key is
+// returned. Symmetric keys do not have a fingerprint.
+func SSHFingerprint(key Key) (string, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return "", errors.Wrap(err, `failed to get raw key`)
+	}
+
+	switch v := raw.(type) {
+	case *rsa.PrivateKey:
+		raw = &v.PublicKey
+	case *ecdsa.PrivateKey:
+		raw = &v.PublicKey
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return "", errors.Errorf(`unsupported key type for SSH fingerprint: %T`, raw)
+	}
+
+	pubkey, err := ssh.NewPublicKey(raw)
+	if err != nil {
+		return "", errors.Wrap(err, `failed to convert key to SSH public key`)
+	}
+	return ssh.FingerprintSHA256(pubkey), nil
+}
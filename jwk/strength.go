@@ -0,0 +1,71 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+)
+
+// rsaSecurityBits maps RSA modulus sizes to their security strength,
+// according to NIST SP 800-57 Part 1, Table 2
+var rsaSecurityBits = []struct {
+	modulus  int
+	strength int
+}{
+	{modulus: 15360, strength: 256},
+	{modulus: 7680, strength: 192},
+	{modulus: 3072, strength: 128},
+	{modulus: 2048, strength: 112},
+	{modulus: 1024, strength: 80},
+}
+
+// SecurityBits returns the estimated security strength of the key in
+// bits, following NIST SP 800-57 Part 1:
+//
+//   - RSA keys are rated by the size of their modulus (e.g. 112 for 2048
+//     bits, 128 for 3072 bits). Moduli smaller than 1024 bits are rated 0
+//   - EC keys are rated half the size of their curve (e.g. 128 for P-256),
+//     up to 256
+//   - symmetric keys are rated by their length
+//
+// For private keys, the strength of the corresponding public key is
+// returned.
+func SecurityBits(key Key) (int, error) {
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return 0, errors.Wrap(err, `failed to get raw key`)
+	}
+
+	switch v := raw.(type) {
+	case *rsa.PrivateKey:
+		return rsaStrength(&v.PublicKey), nil
+	case *rsa.PublicKey:
+		return rsaStrength(v), nil
+	case *ecdsa.PrivateKey:
+		return ecdsaStrength(&v.PublicKey), nil
+	case *ecdsa.PublicKey:
+		return ecdsaStrength(v), nil
+	case []byte:
+		return len(v) * 8, nil
+	default:
+		return 0, errors.Errorf(`unsupported key type for security strength: %T`, raw)
+	}
+}
+
+func rsaStrength(key *rsa.PublicKey) int {
+	size := key.N.BitLen()
+	for _, v := range rsaSecurityBits {
+		if size >= v.modulus {
+			return v.strength
+		}
+	}
+	return 0
+}
+
+func ecdsaStrength(key *ecdsa.PublicKey) int {
+	if size := key.Curve.Params().BitSize / 2; size < 256 {
+		return size
+	}
+	return 256
+}
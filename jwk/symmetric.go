@@ -3,6 +3,7 @@ package jwk
 import (
 	"crypto"
 	"fmt"
+	"sync"
 
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/pkg/errors"
@@ -15,6 +16,7 @@ func NewSymmetricKey() SymmetricKey {
 func newSymmetricKey() *symmetricKey {
 	return &symmetricKey{
 		privateParams: make(map[string]interface{}),
+		mu:            &sync.RWMutex{},
 	}
 }
 
@@ -23,6 +25,9 @@ func (k *symmetricKey) FromRaw(rawKey []byte) error {
 		return errors.New(`non-empty []byte key required`)
 	}
 
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.comparableID = nil
 	k.octets = rawKey
 
 	return nil
@@ -30,13 +35,15 @@ func (k *symmetricKey) FromRaw(rawKey []byte) error {
 
 // Raw returns the octets for this symmetric key.
 // Since this is a symmetric key, this just calls Octets
-func (k symmetricKey) Raw(v interface{}) error {
+func (k *symmetricKey) Raw(v interface{}) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	return assignRawResult(v, k.octets)
 }
 
 // Thumbprint returns the JWK thumbprint using the indicated
 // hakhing algorithm, according to RFC 7638
-func (k symmetricKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
+func (k *symmetricKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	var octets []byte
 	if err := k.Raw(&octets); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize symmetric key`)
@@ -48,3 +55,7 @@ func (k symmetricKey) Thumbprint(hash crypto.Hash) ([]byte, error) {
 	fmt.Fprint(h, `","kty":"oct"}`)
 	return h.Sum(nil), nil
 }
+
+func (k *symmetricKey) ComparableID() (string, error) {
+	return comparableID(k.mu, &k.comparableID, k.Thumbprint)
+}
@@ -3,17 +3,18 @@
 package jwk
 
 import (
-	"bytes"
 	"context"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/internal/base64"
 	"github.com/lestrrat-go/jwx/internal/iter"
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
@@ -39,6 +40,8 @@ type symmetricKey struct {
 	x509CertThumbprintS256 *string           // https://tools.ietf.org/html/rfc7515#section-4.1.8
 	x509URL                *string           // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	privateParams          map[string]interface{}
+	comparableID           *comparableIDCache
+	mu                     *sync.RWMutex
 }
 
 type symmetricSymmetricKeyMarshalProxy struct {
@@ -59,6 +62,8 @@ func (h symmetricKey) KeyType() jwa.KeyType {
 }
 
 func (h *symmetricKey) Algorithm() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.algorithm != nil {
 		return *(h.algorithm)
 	}
@@ -66,6 +71,8 @@ func (h *symmetricKey) Algorithm() string {
 }
 
 func (h *symmetricKey) KeyID() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyID != nil {
 		return *(h.keyID)
 	}
@@ -73,6 +80,8 @@ func (h *symmetricKey) KeyID() string {
 }
 
 func (h *symmetricKey) KeyUsage() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyUsage != nil {
 		return *(h.keyUsage)
 	}
@@ -80,6 +89,8 @@ func (h *symmetricKey) KeyUsage() string {
 }
 
 func (h *symmetricKey) KeyOps() KeyOperationList {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.keyops != nil {
 		return *(h.keyops)
 	}
@@ -87,10 +98,14 @@ func (h *symmetricKey) KeyOps() KeyOperationList {
 }
 
 func (h *symmetricKey) Octets() []byte {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	return h.octets
 }
 
 func (h *symmetricKey) X509CertChain() []*x509.Certificate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertChain != nil {
 		return h.x509CertChain.Get()
 	}
@@ -98,6 +113,8 @@ func (h *symmetricKey) X509CertChain() []*x509.Certificate {
 }
 
 func (h *symmetricKey) X509CertThumbprint() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprint != nil {
 		return *(h.x509CertThumbprint)
 	}
@@ -105,6 +122,8 @@ func (h *symmetricKey) X509CertThumbprint() string {
 }
 
 func (h *symmetricKey) X509CertThumbprintS256() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509CertThumbprintS256 != nil {
 		return *(h.x509CertThumbprintS256)
 	}
@@ -112,6 +131,8 @@ func (h *symmetricKey) X509CertThumbprintS256() string {
 }
 
 func (h *symmetricKey) X509URL() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	if h.x509URL != nil {
 		return *(h.x509URL)
 	}
@@ -121,6 +142,7 @@ func (h *symmetricKey) X509URL() string {
 func (h *symmetricKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	defer close(ch)
 
+	h.mu.RLock()
 	var pairs []*HeaderPair
 	pairs = append(pairs, &HeaderPair{Key: "kty", Value: jwa.OctetSeq})
 	if h.algorithm != nil {
@@ -153,6 +175,7 @@ func (h *symmetricKey) iterate(ctx context.Context, ch chan *HeaderPair) {
 	for k, v := range h.privateParams {
 		pairs = append(pairs, &HeaderPair{Key: k, Value: v})
 	}
+	h.mu.RUnlock()
 	for _, pair := range pairs {
 		select {
 		case <-ctx.Done():
@@ -166,7 +189,26 @@ func (h *symmetricKey) PrivateParams() map[string]interface{} {
 	return h.privateParams
 }
 
+func (h *symmetricKey) PrivateParamKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.privateParams))
+	for k := range h.privateParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *symmetricKey) PrivateParamLen() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.privateParams)
+}
+
 func (h *symmetricKey) Get(name string) (interface{}, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	switch name {
 	case KeyTypeKey:
 		return h.KeyType(), true
@@ -222,6 +264,9 @@ func (h *symmetricKey) Get(name string) (interface{}, bool) {
 }
 
 func (h *symmetricKey) Set(name string, value interface{}) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	switch name {
 	case "kty":
 		return nil
@@ -300,6 +345,10 @@ func (h *symmetricKey) UnmarshalJSON(buf []byte) error {
 	if err := json.Unmarshal(buf, &proxy); err != nil {
 		return errors.Wrap(err, `failed to unmarshal symmetricKey`)
 	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.comparableID = nil
 	if proxy.XkeyType != jwa.OctetSeq {
 		return errors.Errorf(`invalid kty value for SymmetricKey (%s)`, proxy.XkeyType)
 	}
@@ -340,6 +389,8 @@ func (h *symmetricKey) UnmarshalJSON(buf []byte) error {
 }
 
 func (h symmetricKey) MarshalJSON() ([]byte, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	var proxy symmetricSymmetricKeyMarshalProxy
 	proxy.XkeyType = jwa.OctetSeq
 	proxy.Xalgorithm = h.algorithm
@@ -354,8 +405,9 @@ func (h symmetricKey) MarshalJSON() ([]byte, error) {
 	proxy.Xx509CertThumbprint = h.x509CertThumbprint
 	proxy.Xx509CertThumbprintS256 = h.x509CertThumbprintS256
 	proxy.Xx509URL = h.x509URL
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	enc := json.NewEncoder(buf)
 	if err := enc.Encode(proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to encode proxy to JSON`)
 	}
@@ -369,16 +421,18 @@ func (h symmetricKey) MarshalJSON() ([]byte, error) {
 		sort.Strings(keys)
 		for i, k := range keys {
 			if hasContent || i > 0 {
-				fmt.Fprintf(&buf, `,`)
+				fmt.Fprintf(buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			fmt.Fprintf(buf, `%s:`, strconv.Quote(k))
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
-		fmt.Fprintf(&buf, `}`)
+		fmt.Fprintf(buf, `}`)
 	}
-	return buf.Bytes(), nil
+	result := make([]byte, buf.Len())
+	copy(result, buf.Bytes())
+	return result, nil
 }
 
 func (h *symmetricKey) Iterate(ctx context.Context) HeaderIterator {
@@ -0,0 +1,105 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+)
+
+// KeyValidator checks a key against additional constraints, such as a
+// minimum key size required by your policy. See WithValidator
+type KeyValidator interface {
+	Validate(Key) error
+}
+
+// KeyValidatorFunc is a function that implements the KeyValidator interface
+type KeyValidatorFunc func(Key) error
+
+func (fn KeyValidatorFunc) Validate(key Key) error {
+	return fn(key)
+}
+
+// Validate makes sure that the key is usable: RSA keys must have a
+// modulus and a public exponent greater than 1 (private keys are checked
+// using rsa.PrivateKey.Validate), the point of EC keys must be on their
+// curve, and symmetric keys must not be empty.
+//
+// Validators given by WithValidator are run after these checks pass.
+// Their errors are returned wrapped, so use errors.Cause to get the
+// original error.
+func Validate(key Key, options ...Option) error {
+	var validators []KeyValidator
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyValidator:
+			validators = append(validators, option.Value().(KeyValidator))
+		}
+	}
+
+	var raw interface{}
+	if err := key.Raw(&raw); err != nil {
+		return errors.Wrap(err, `failed to get raw key`)
+	}
+
+	switch v := raw.(type) {
+	case *rsa.PrivateKey:
+		if err := validateRSAPublicKey(&v.PublicKey); err != nil {
+			return err
+		}
+		if err := v.Validate(); err != nil {
+			return errors.Wrap(err, `invalid RSA private key`)
+		}
+	case *rsa.PublicKey:
+		if err := validateRSAPublicKey(v); err != nil {
+			return err
+		}
+	case *ecdsa.PrivateKey:
+		if err := validateECDSAPublicKey(&v.PublicKey); err != nil {
+			return err
+		}
+		if v.D == nil || v.D.Sign() <= 0 || v.D.Cmp(v.Curve.Params().N) >= 0 {
+			return errors.New(`invalid EC private key: "d" is out of range`)
+		}
+	case *ecdsa.PublicKey:
+		if err := validateECDSAPublicKey(v); err != nil {
+			return err
+		}
+	case []byte:
+		if len(v) == 0 {
+			return errors.New(`invalid symmetric key: "k" is empty`)
+		}
+	default:
+		return errors.Errorf(`unsupported key type for validation: %T`, raw)
+	}
+
+	for i, v := range validators {
+		if err := v.Validate(key); err != nil {
+			return errors.Wrapf(err, `key validator #%d failed`, i+1)
+		}
+	}
+	return nil
+}
+
+func validateRSAPublicKey(key *rsa.PublicKey) error {
+	if key.N == nil || key.N.Sign() <= 0 {
+		return errors.New(`invalid RSA key: "n" is missing`)
+	}
+	if key.E < 2 {
+		return errors.New(`invalid RSA key: "e" must be greater than 1`)
+	}
+	return nil
+}
+
+func validateECDSAPublicKey(key *ecdsa.PublicKey) error {
+	if key.Curve == nil {
+		return errors.New(`invalid EC key: unknown curve`)
+	}
+	if key.X == nil || key.Y == nil {
+		return errors.New(`invalid EC key: "x" or "y" is missing`)
+	}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return errors.New(`invalid EC key: point is not on the curve`)
+	}
+	return nil
+}
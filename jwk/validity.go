@@ -0,0 +1,92 @@
+package jwk
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KeyIsValidAt reports whether the key is usable at time `t`, according
+// to the validity period recorded in its private parameters.
+//
+// By convention the key is not usable before the time stored in the
+// "iat" (key issued at) member, and not usable after the time stored
+// in the "exp" (key expiry) member. Both are expressed as NumericDate
+// values, that is, the number of seconds since the Unix epoch. Members
+// that are not present are not checked. Use WithNotBeforeParam and
+// WithExpiresParam to read the values from other members, such as "nbf".
+//
+// An error is returned if a member is present but its value cannot be
+// interpreted as a time.
+func KeyIsValidAt(key Key, t time.Time, options ...Option) (bool, error) {
+	nbfName := `iat`
+	expName := `exp`
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyNotBeforeParam:
+			nbfName = option.Value().(string)
+		case optkeyExpiresParam:
+			expName = option.Value().(string)
+		}
+	}
+
+	if v, ok := key.Get(nbfName); ok {
+		nbf, err := validityTime(v)
+		if err != nil {
+			return false, errors.Wrapf(err, `invalid value for %s`, nbfName)
+		}
+		if t.Before(nbf) {
+			return false, nil
+		}
+	}
+
+	if v, ok := key.Get(expName); ok {
+		exp, err := validityTime(v)
+		if err != nil {
+			return false, errors.Wrapf(err, `invalid value for %s`, expName)
+		}
+		if !t.Before(exp) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ValidKeysAt returns a new Set containing the keys that are usable at
+// time `t`, as reported by KeyIsValidAt. Keys whose validity period
+// cannot be interpreted are excluded.
+func (s Set) ValidKeysAt(t time.Time, options ...Option) *Set {
+	var set Set
+	for iter := s.Iterate(context.TODO()); iter.Next(context.TODO()); {
+		key := iter.Pair().Value.(Key)
+		if ok, err := KeyIsValidAt(key, t, options...); err == nil && ok {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	return &set
+}
+
+func validityTime(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case int64:
+		return time.Unix(x, 0), nil
+	case int:
+		return time.Unix(int64(x), 0), nil
+	case float64:
+		sec, frac := math.Modf(x)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	case json.Number:
+		f, err := x.Float64()
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, `failed to parse number`)
+		}
+		return validityTime(f)
+	default:
+		return time.Time{}, errors.Errorf(`expected a numeric date, got %T`, v)
+	}
+}
@@ -1,11 +1,30 @@
 package jwk_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
 )
 
 func Test_X5CHeader(t *testing.T) {
@@ -65,6 +84,56 @@ func Test_X5CHeader(t *testing.T) {
 		}
 	})
 
+	t.Run("FromCertificateDER", func(t *testing.T) {
+		// leaf + intermediate
+		der := make([][]byte, 2)
+		for i := range der {
+			buf, err := base64.StdEncoding.DecodeString(certs[i])
+			if !assert.NoError(t, err, `base64 decode should succeed`) {
+				return
+			}
+			der[i] = buf
+		}
+
+		key, err := jwk.FromCertificateDER(der...)
+		if !assert.NoError(t, err, `jwk.FromCertificateDER should succeed`) {
+			return
+		}
+
+		leaf, err := x509.ParseCertificate(der[0])
+		if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+			return
+		}
+
+		var pubkey interface{}
+		if !assert.NoError(t, key.Raw(&pubkey), `key.Raw should succeed`) {
+			return
+		}
+		if !assert.Equal(t, leaf.PublicKey, pubkey, `public keys should match`) {
+			return
+		}
+
+		chain := key.X509CertChain()
+		if !assert.Len(t, chain, 2, `should have 2 certs`) {
+			return
+		}
+		for i, cert := range chain {
+			if !assert.Equal(t, der[i], cert.Raw, `certificate %d should match`, i) {
+				return
+			}
+		}
+
+		thumbprint := sha256.Sum256(der[0])
+		if !assert.Equal(t, base64.RawURLEncoding.EncodeToString(thumbprint[:]), key.X509CertThumbprintS256(), `x5t#S256 should match`) {
+			return
+		}
+
+		_, err = jwk.FromCertificateDER()
+		if !assert.Error(t, err, `jwk.FromCertificateDER with no certificates should fail`) {
+			return
+		}
+	})
+
 	for _, key := range []jwk.Key{
 		jwk.NewRSAPrivateKey(),
 		jwk.NewRSAPublicKey(),
@@ -124,3 +193,617 @@ func Test_X5CHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchX5U(t *testing.T) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+		return
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+
+	var chain bytes.Buffer
+	for _, der := range [][]byte{leafDER, caDER} {
+		if !assert.NoError(t, pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der}), `pem.Encode should succeed`) {
+			return
+		}
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, srv.URL+"/chain.pem", http.StatusFound)
+		case "/redirect-host":
+			http.Redirect(w, r, "https://disallowed.test/chain.pem", http.StatusFound)
+		case "/redirect-http":
+			http.Redirect(w, r, strings.Replace(srv.URL, "https://", "http://", 1)+"/chain.pem", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "application/pem-certificate-chain")
+			_, _ = w.Write(chain.Bytes())
+		}
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	newKey := func(t *testing.T, raw interface{}, x5u string) jwk.Key {
+		key, err := jwk.New(raw)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return nil
+		}
+		if !assert.NoError(t, key.Set(jwk.X509URLKey, x5u), `key.Set should succeed`) {
+			return nil
+		}
+		return key
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, srv.URL+"/chain.pem")
+		if key == nil {
+			return
+		}
+		if !assert.Equal(t, srv.URL+"/chain.pem", key.X509URL(), `key.X509URL should match`) {
+			return
+		}
+
+		certs, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()), jwk.WithAllowedHosts("127.0.0.1"))
+		if !assert.NoError(t, err, `jwk.FetchX5U should succeed`) {
+			return
+		}
+		if !assert.Len(t, certs, 2, `there should be 2 certificates`) {
+			return
+		}
+		if !assert.Equal(t, leafDER, certs[0].Raw, `leaf certificate should match`) {
+			return
+		}
+	})
+	t.Run("Host not allowed", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, srv.URL+"/chain.pem")
+		if key == nil {
+			return
+		}
+		_, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()), jwk.WithAllowedHosts("example.com"))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+	t.Run("Redirect", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, srv.URL+"/redirect")
+		if key == nil {
+			return
+		}
+		certs, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()), jwk.WithAllowedHosts("127.0.0.1"))
+		if !assert.NoError(t, err, `jwk.FetchX5U should succeed`) {
+			return
+		}
+		if !assert.Len(t, certs, 2, `there should be 2 certificates`) {
+			return
+		}
+	})
+	t.Run("Redirect to host not allowed", func(t *testing.T) {
+		// route every host name to the test server, so that the redirect
+		// would succeed if it were followed
+		tr := srv.Client().Transport.(*http.Transport).Clone()
+		tr.TLSClientConfig.ServerName = "example.com"
+		tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, srv.Listener.Addr().String())
+		}
+		cl := &http.Client{Transport: tr}
+
+		key := newKey(t, &leafKey.PublicKey, "https://allowed.test/chain.pem")
+		if key == nil {
+			return
+		}
+		_, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(cl), jwk.WithAllowedHosts("allowed.test"))
+		if !assert.NoError(t, err, `jwk.FetchX5U should succeed`) {
+			return
+		}
+
+		key = newKey(t, &leafKey.PublicKey, "https://allowed.test/redirect-host")
+		if key == nil {
+			return
+		}
+		_, err = jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(cl), jwk.WithAllowedHosts("allowed.test"))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+	t.Run("Redirect to non-https URL", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, srv.URL+"/redirect-http")
+		if key == nil {
+			return
+		}
+		_, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+	t.Run("Non-https URL", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, "http://127.0.0.1/chain.pem")
+		if key == nil {
+			return
+		}
+		_, err := jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+	t.Run("Untrusted chain", func(t *testing.T) {
+		key := newKey(t, &leafKey.PublicKey, srv.URL+"/chain.pem")
+		if key == nil {
+			return
+		}
+		_, err := jwk.FetchX5U(context.Background(), key, x509.NewCertPool(), jwk.WithHTTPClient(srv.Client()))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+	t.Run("Leaf does not match key", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return
+		}
+		key := newKey(t, &otherKey.PublicKey, srv.URL+"/chain.pem")
+		if key == nil {
+			return
+		}
+		_, err = jwk.FetchX5U(context.Background(), key, roots, jwk.WithHTTPClient(srv.Client()))
+		if !assert.Error(t, err, `jwk.FetchX5U should fail`) {
+			return
+		}
+	})
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	key, err := jwk.New(rsakey)
+	if !assert.NoError(t, err, `jwk.New should succeed`) {
+		return
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "localhost"},
+	}
+	cert, err := jwk.SelfSignedCertificate(key, template)
+	if !assert.NoError(t, err, `jwk.SelfSignedCertificate should succeed`) {
+		return
+	}
+	if !assert.Nil(t, template.SerialNumber, `template should not be modified`) {
+		return
+	}
+
+	parsed, err := x509.ParseCertificate(cert.Raw)
+	if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+		return
+	}
+	if !assert.Equal(t, "localhost", parsed.Subject.CommonName, `subject should match`) {
+		return
+	}
+	if !assert.NotNil(t, parsed.SerialNumber, `serial number should be set`) {
+		return
+	}
+	if !assert.True(t, parsed.NotAfter.After(parsed.NotBefore), `validity period should be set`) {
+		return
+	}
+	if !assert.NoError(t, parsed.CheckSignature(parsed.SignatureAlgorithm, parsed.RawTBSCertificate, parsed.Signature), `certificate should verify with its own key`) {
+		return
+	}
+	if !assert.Equal(t, &rsakey.PublicKey, parsed.PublicKey, `public keys should match`) {
+		return
+	}
+
+	t.Run("Public key", func(t *testing.T) {
+		pub, err := jwk.New(&rsakey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		_, err = jwk.SelfSignedCertificate(pub, nil)
+		if !assert.Error(t, err, `jwk.SelfSignedCertificate should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyX5C(t *testing.T) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+		return
+	}
+
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	t.Run("Success", func(t *testing.T) {
+		key, err := jwk.FromCertificateDER(leafDER, caDER)
+		if !assert.NoError(t, err, `jwk.FromCertificateDER should succeed`) {
+			return
+		}
+		if !assert.NoError(t, jwk.VerifyX5C(key, roots), `jwk.VerifyX5C should succeed`) {
+			return
+		}
+	})
+	t.Run("Private key", func(t *testing.T) {
+		key, err := jwk.New(leafKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		if !assert.NoError(t, key.Set(jwk.X509CertChainKey, []string{base64.StdEncoding.EncodeToString(leafDER)}), `key.Set should succeed`) {
+			return
+		}
+		if !assert.NoError(t, jwk.VerifyX5C(key, roots), `jwk.VerifyX5C should succeed`) {
+			return
+		}
+	})
+	t.Run("Padded standard base64 in JSON", func(t *testing.T) {
+		pubkey, err := jwk.New(&leafKey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		buf, err := json.Marshal(pubkey)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		var m map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(buf, &m), `json.Unmarshal should succeed`) {
+			return
+		}
+		m["x5c"] = []string{
+			base64.StdEncoding.EncodeToString(leafDER),
+			base64.StdEncoding.EncodeToString(caDER),
+		}
+		buf, err = json.Marshal(m)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		key, err := jwk.ParseKey(buf)
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+			return
+		}
+		if !assert.Len(t, key.X509CertChain(), 2, `there should be 2 certificates`) {
+			return
+		}
+		if !assert.NoError(t, jwk.VerifyX5C(key, roots), `jwk.VerifyX5C should succeed`) {
+			return
+		}
+	})
+	t.Run("Untrusted chain", func(t *testing.T) {
+		key, err := jwk.FromCertificateDER(leafDER, caDER)
+		if !assert.NoError(t, err, `jwk.FromCertificateDER should succeed`) {
+			return
+		}
+		if !assert.Error(t, jwk.VerifyX5C(key, x509.NewCertPool()), `jwk.VerifyX5C should fail`) {
+			return
+		}
+	})
+	t.Run("Leaf does not match key", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return
+		}
+		key, err := jwk.New(&otherKey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		if !assert.NoError(t, key.Set(jwk.X509CertChainKey, []string{base64.StdEncoding.EncodeToString(leafDER)}), `key.Set should succeed`) {
+			return
+		}
+		if !assert.Error(t, jwk.VerifyX5C(key, roots), `jwk.VerifyX5C should fail`) {
+			return
+		}
+	})
+	t.Run("Missing x5c", func(t *testing.T) {
+		key, err := jwk.New(&leafKey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		if !assert.Error(t, jwk.VerifyX5C(key, roots), `jwk.VerifyX5C should fail`) {
+			return
+		}
+	})
+}
+
+func TestCheckRevocation(t *testing.T) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+		return
+	}
+
+	// stubbed OCSP responder and CRL distribution point. ocspStatus is
+	// the status reported for every certificate
+	ocspStatus := ocsp.Good
+	var revokedSerials []*big.Int
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ocsp":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req, err := ocsp.ParseRequest(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			res, err := ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+				Status:       ocspStatus,
+				SerialNumber: req.SerialNumber,
+				ThisUpdate:   now.Add(-time.Minute),
+				NextUpdate:   now.Add(time.Hour),
+				RevokedAt:    now.Add(-time.Minute),
+			}, caKey)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/ocsp-response")
+			_, _ = w.Write(res)
+		case "/crl":
+			var revoked []pkix.RevokedCertificate
+			for _, serial := range revokedSerials {
+				revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now.Add(-time.Minute)})
+			}
+			crl, err := caCert.CreateCRL(rand.Reader, caKey, revoked, now.Add(-time.Minute), now.Add(time.Hour))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/pkix-crl")
+			_, _ = w.Write(crl)
+		case "/redirect":
+			http.Redirect(w, r, "http://disallowed.test/ocsp", http.StatusTemporaryRedirect)
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	newKey := func(t *testing.T, serial int64, ocspServers, crlDPs []string) jwk.Key {
+		leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return nil
+		}
+		leafTemplate := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: "Test Leaf"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+			OCSPServer:            ocspServers,
+			CRLDistributionPoints: crlDPs,
+		}
+		leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+		if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+			return nil
+		}
+		key, err := jwk.FromCertificateDER(leafDER, caDER)
+		if !assert.NoError(t, err, `jwk.FromCertificateDER should succeed`) {
+			return nil
+		}
+		return key
+	}
+
+	t.Run("OCSP", func(t *testing.T) {
+		key := newKey(t, 2, []string{srv.URL + "/ocsp"}, nil)
+		if key == nil {
+			return
+		}
+
+		statuses := map[int]bool{
+			ocsp.Good:    false,
+			ocsp.Revoked: true,
+		}
+		for status, expected := range statuses {
+			ocspStatus = status
+			revoked, err := jwk.CheckRevocation(context.Background(), key)
+			if !assert.NoError(t, err, `jwk.CheckRevocation should succeed`) {
+				return
+			}
+			if !assert.Equal(t, expected, revoked, `revocation status should match`) {
+				return
+			}
+		}
+
+		ocspStatus = ocsp.Unknown
+		_, err := jwk.CheckRevocation(context.Background(), key)
+		if !assert.Error(t, err, `jwk.CheckRevocation should fail for unknown status`) {
+			return
+		}
+		ocspStatus = ocsp.Good
+	})
+	t.Run("CRL fallback", func(t *testing.T) {
+		key := newKey(t, 3, []string{srv.URL + "/broken"}, []string{srv.URL + "/crl"})
+		if key == nil {
+			return
+		}
+
+		_, err := jwk.CheckRevocation(context.Background(), key)
+		if !assert.Error(t, err, `jwk.CheckRevocation without WithCRL should fail`) {
+			return
+		}
+
+		revoked, err := jwk.CheckRevocation(context.Background(), key, jwk.WithCRL(true))
+		if !assert.NoError(t, err, `jwk.CheckRevocation should succeed`) {
+			return
+		}
+		if !assert.False(t, revoked, `certificate should not be revoked`) {
+			return
+		}
+
+		revokedSerials = []*big.Int{big.NewInt(3)}
+		defer func() { revokedSerials = nil }()
+		revoked, err = jwk.CheckRevocation(context.Background(), key, jwk.WithCRL(true))
+		if !assert.NoError(t, err, `jwk.CheckRevocation should succeed`) {
+			return
+		}
+		if !assert.True(t, revoked, `certificate should be revoked`) {
+			return
+		}
+	})
+	t.Run("Host not allowed", func(t *testing.T) {
+		key := newKey(t, 4, []string{srv.URL + "/ocsp"}, nil)
+		if key == nil {
+			return
+		}
+		_, err := jwk.CheckRevocation(context.Background(), key, jwk.WithAllowedHosts("example.com"))
+		if !assert.Error(t, err, `jwk.CheckRevocation should fail`) {
+			return
+		}
+	})
+	t.Run("Redirect to host not allowed", func(t *testing.T) {
+		// route every host name to the test server, so that the redirect
+		// would succeed if it were followed
+		cl := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, srv.Listener.Addr().String())
+				},
+			},
+		}
+
+		key := newKey(t, 7, []string{"http://allowed.test/ocsp"}, nil)
+		if key == nil {
+			return
+		}
+		_, err := jwk.CheckRevocation(context.Background(), key, jwk.WithHTTPClient(cl), jwk.WithAllowedHosts("allowed.test"))
+		if !assert.NoError(t, err, `jwk.CheckRevocation should succeed`) {
+			return
+		}
+
+		key = newKey(t, 8, []string{"http://allowed.test/redirect"}, nil)
+		if key == nil {
+			return
+		}
+		_, err = jwk.CheckRevocation(context.Background(), key, jwk.WithHTTPClient(cl), jwk.WithAllowedHosts("allowed.test"))
+		if !assert.Error(t, err, `jwk.CheckRevocation should fail`) {
+			return
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		key := newKey(t, 5, []string{srv.URL + "/slow"}, nil)
+		if key == nil {
+			return
+		}
+		_, err := jwk.CheckRevocation(context.Background(), key, jwk.WithRevocationTimeout(50*time.Millisecond))
+		if !assert.Error(t, err, `jwk.CheckRevocation should fail`) {
+			return
+		}
+	})
+	t.Run("Missing issuer", func(t *testing.T) {
+		key := newKey(t, 6, []string{srv.URL + "/ocsp"}, nil)
+		if key == nil {
+			return
+		}
+		chain := key.X509CertChain()
+		if !assert.NoError(t, key.Set(jwk.X509CertChainKey, []string{base64.StdEncoding.EncodeToString(chain[0].Raw)}), `key.Set should succeed`) {
+			return
+		}
+		_, err := jwk.CheckRevocation(context.Background(), key)
+		if !assert.Error(t, err, `jwk.CheckRevocation should fail`) {
+			return
+		}
+	})
+}
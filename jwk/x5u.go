@@ -0,0 +1,193 @@
+package jwk
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxX5UResponseSize limits the size of the certificate chain that
+// FetchX5U is willing to read
+const maxX5UResponseSize = 1 << 20
+
+// FetchX5U retrieves the PEM encoded certificate chain referenced by
+// the "x5u" field of the given key, verifies it against the roots in
+// `pool`, and makes sure that the public key in the leaf certificate
+// matches the key. The verified chain is returned, leaf first.
+//
+// The URL must use the https scheme. If `pool` is nil, the system roots
+// are used. Because the URL comes from the key itself, which may not
+// be trusted, you should use the WithAllowedHosts option to restrict
+// the hosts that may be contacted. The WithHTTPClient option can be
+// used to specify the HTTP client. Redirects are followed only if the
+// target also satisfies these restrictions.
+func FetchX5U(ctx context.Context, key Key, pool *x509.CertPool, options ...Option) ([]*x509.Certificate, error) {
+	httpcl := http.DefaultClient
+	var allowedHosts []string
+	for _, option := range options {
+		switch option.Name() {
+		case optkeyHTTPClient:
+			httpcl = option.Value().(*http.Client)
+		case optkeyAllowedHosts:
+			allowedHosts = option.Value().([]string)
+		}
+	}
+
+	x5u := key.X509URL()
+	if x5u == "" {
+		return nil, errors.Errorf(`key does not have the %s field`, X509URLKey)
+	}
+
+	u, err := url.Parse(x5u)
+	if err != nil {
+		return nil, errors.Wrapf(err, `failed to parse %s`, X509URLKey)
+	}
+
+	checkURL := func(u *url.URL) error {
+		if u.Scheme != "https" {
+			return errors.Errorf(`invalid url scheme %s for %s (only https is allowed)`, u.Scheme, X509URLKey)
+		}
+		if len(allowedHosts) > 0 && !isAllowedHost(u.Hostname(), allowedHosts) {
+			return errors.Errorf(`host %s is not allowed`, u.Hostname())
+		}
+		return nil
+	}
+
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to new request to remote certificate chain")
+	}
+
+	res, err := restrictRedirects(httpcl, checkURL).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch remote certificate chain")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch remote certificate chain (status = %d)", res.StatusCode)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(res.Body, maxX5UResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read remote certificate chain")
+	}
+
+	certs, err := parsePEMCertificates(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse remote certificate chain")
+	}
+
+	if err := verifyCertificateChain(key, certs, pool); err != nil {
+		return nil, errors.Wrap(err, "invalid remote certificate chain")
+	}
+
+	return certs, nil
+}
+
+// verifyCertificateChain verifies the chain `certs` (leaf first) against
+// the roots in `pool`, and makes sure that the public key in the leaf
+// certificate matches the key
+func verifyCertificateChain(key Key, certs []*x509.Certificate, pool *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "failed to verify certificate chain")
+	}
+
+	leafKey, err := New(certs[0].PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to create jwk.Key from leaf certificate")
+	}
+
+	expected, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return errors.Wrap(err, "failed to compute thumbprint of key")
+	}
+	actual, err := leafKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return errors.Wrap(err, "failed to compute thumbprint of leaf certificate key")
+	}
+	if !bytes.Equal(expected, actual) {
+		return errors.New("leaf certificate does not match the key")
+	}
+	return nil
+}
+
+// maxRedirects is the number of redirects that restrictRedirects allows,
+// the same as the default of net/http
+const maxRedirects = 10
+
+// restrictRedirects returns a shallow copy of `cl` that only follows a
+// redirect if `check` accepts its target. Without this, the checks made
+// on the original URL could be bypassed by redirecting elsewhere
+func restrictRedirects(cl *http.Client, check func(*url.URL) error) *http.Client {
+	restricted := *cl
+	restricted.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := check(req.URL); err != nil {
+			return errors.Wrap(err, `refusing to follow redirect`)
+		}
+		if cl.CheckRedirect != nil {
+			return cl.CheckRedirect(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return errors.Errorf(`stopped after %d redirects`, maxRedirects)
+		}
+		return nil
+	}
+	return &restricted
+}
+
+func isAllowedHost(host string, allowed []string) bool {
+	for _, h := range allowed {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePEMCertificates(buf []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, buf = pem.Decode(buf)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
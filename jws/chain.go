@@ -0,0 +1,104 @@
+package jws
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/internal/base64"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/pkg/errors"
+)
+
+// PreviousSignatureKey is the name of the protected header member that
+// `jws.ChainSigner` uses to record the signature of the preceding record
+const PreviousSignatureKey = "prev"
+
+// ChainSigner signs records of an append-only log such that each
+// signature also covers the signature of the record before it. Removing,
+// reordering, or altering any record invalidates every record after it.
+//
+// The base64url encoded signature of the previous record is stored in the
+// protected header under PreviousSignatureKey. The first record has no
+// such member. Use `jws.VerifyChain` to verify the records.
+//
+// ChainSigner is safe for concurrent use, but records appended
+// concurrently are chained in an unspecified order.
+type ChainSigner struct {
+	mu   sync.Mutex
+	alg  jwa.SignatureAlgorithm
+	key  interface{}
+	prev []byte
+}
+
+// NewChainSigner creates a new ChainSigner that signs records using the
+// given algorithm and key
+func NewChainSigner(alg jwa.SignatureAlgorithm, key interface{}) *ChainSigner {
+	return &ChainSigner{
+		alg: alg,
+		key: key,
+	}
+}
+
+// Append signs the record, chaining it to the previously appended record,
+// and returns the result in compact serialization format
+func (s *ChainSigner) Append(record []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hdr := NewHeaders()
+	if s.prev != nil {
+		if err := hdr.Set(PreviousSignatureKey, string(s.prev)); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, PreviousSignatureKey)
+		}
+	}
+
+	signed, err := Sign(record, s.alg, s.key, WithHeaders(hdr))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to sign record`)
+	}
+
+	_, _, signature, err := SplitCompact(bytes.NewReader(signed))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to extract signature`)
+	}
+	s.prev = append([]byte(nil), signature...)
+	return signed, nil
+}
+
+// VerifyChain verifies records that were signed by `jws.ChainSigner`,
+// in the order that they were appended, and returns their payloads.
+// The chain must be complete: the first record must not refer to a
+// previous signature, and each subsequent record must refer to the
+// signature of the record that precedes it.
+func VerifyChain(chain [][]byte, alg jwa.SignatureAlgorithm, key interface{}) ([][]byte, error) {
+	payloads := make([][]byte, 0, len(chain))
+	var prev string
+	for i, signed := range chain {
+		payload, err := Verify(signed, alg, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to verify record #%d`, i)
+		}
+
+		m, err := Parse(bytes.NewReader(signed))
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to parse record #%d`, i)
+		}
+		if len(m.Signatures()) != 1 {
+			return nil, errors.Errorf(`record #%d must have exactly one signature`, i)
+		}
+		sig := m.Signatures()[0]
+
+		v, ok := sig.ProtectedHeaders().Get(PreviousSignatureKey)
+		if i == 0 {
+			if ok {
+				return nil, errors.Errorf(`record #%d must not refer to a previous signature`, i)
+			}
+		} else if s, _ := v.(string); !ok || s != prev {
+			return nil, errors.Errorf(`record #%d does not refer to the signature of record #%d`, i, i-1)
+		}
+
+		prev = base64.EncodeToString(sig.Signature())
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
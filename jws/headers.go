@@ -1,10 +1,13 @@
 package jws
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/internal/iter"
+	"github.com/pkg/errors"
 )
 
 // Iterate returns a channel that successively returns all the
@@ -22,3 +25,161 @@ func (h *stdHeaders) Walk(ctx context.Context, visitor Visitor) error {
 func (h *stdHeaders) AsMap(ctx context.Context) (map[string]interface{}, error) {
 	return iter.AsMap(ctx, h)
 }
+
+// headers defined in RFC7515, which may not be listed in "crit"
+var standardHeaderNames = map[string]struct{}{
+	AlgorithmKey:              {},
+	ContentTypeKey:            {},
+	CriticalKey:               {},
+	JWKKey:                    {},
+	JWKSetURLKey:              {},
+	KeyIDKey:                  {},
+	TypeKey:                   {},
+	X509CertChainKey:          {},
+	X509CertThumbprintKey:     {},
+	X509CertThumbprintS256Key: {},
+	X509URLKey:                {},
+}
+
+// validateCritical checks the contents of the "crit" header as
+// described in https://tools.ietf.org/html/rfc7515#section-4.1.11:
+// the entries must be non-empty and unique, and must not name
+// standard headers.
+func validateCritical(crit []string) error {
+	seen := make(map[string]struct{}, len(crit))
+	for _, name := range crit {
+		if name == "" {
+			return errors.New(`empty header name in crit`)
+		}
+		if _, ok := standardHeaderNames[name]; ok {
+			return errors.Errorf(`standard header %s may not be listed in crit`, name)
+		}
+		if _, ok := seen[name]; ok {
+			return errors.Errorf(`duplicate header %s in crit`, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
+type jsonField struct {
+	name  string
+	value json.RawMessage
+}
+
+// objectFields splits a JSON object into its members, in the order
+// they appear
+func objectFields(buf []byte) ([]jsonField, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to read JSON object`)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New(`expected JSON object`)
+	}
+
+	var fields []jsonField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to read field name`)
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, errors.Errorf(`expected field name, got %v`, tok)
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, errors.Wrapf(err, `failed to read value of field %s`, name)
+		}
+		fields = append(fields, jsonField{name: name, value: value})
+	}
+	return fields, nil
+}
+
+// fieldOrder returns the names of the members of a JSON object, in the
+// order they appear
+func fieldOrder(buf []byte) ([]string, error) {
+	fields, err := objectFields(buf)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// reorderFields rewrites the JSON object in buf so that the members
+// named in order come first, in that order. Members that are not named
+// follow in their original order
+func reorderFields(buf []byte, order []string) ([]byte, error) {
+	fields, err := objectFields(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to parse marshaled headers`)
+	}
+
+	byName := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f.value
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	write := func(name string, value json.RawMessage) error {
+		quoted, err := json.Marshal(name)
+		if err != nil {
+			return errors.Wrapf(err, `failed to marshal header name %q`, name)
+		}
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		out.Write(quoted)
+		out.WriteByte(':')
+		out.Write(value)
+		return nil
+	}
+
+	written := make(map[string]struct{}, len(fields))
+	for _, name := range order {
+		value, ok := byName[name]
+		if !ok {
+			continue
+		}
+		if _, ok := written[name]; ok {
+			continue
+		}
+		if err := write(name, value); err != nil {
+			return nil, err
+		}
+		written[name] = struct{}{}
+	}
+	for _, f := range fields {
+		if _, ok := written[f.name]; ok {
+			continue
+		}
+		if err := write(f.name, f.value); err != nil {
+			return nil, err
+		}
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// preserveFieldOrder records the order of the members of the JSON
+// object in buf on h, so that it is replayed by MarshalJSON
+func preserveFieldOrder(h Headers, buf []byte) error {
+	std, ok := h.(*stdHeaders)
+	if !ok {
+		return nil
+	}
+	order, err := fieldOrder(buf)
+	if err != nil {
+		return err
+	}
+	std.fieldOrder = order
+	return nil
+}
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
-	"strconv"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
@@ -41,6 +40,7 @@ type Headers interface {
 	X509CertThumbprint() string
 	X509CertThumbprintS256() string
 	X509URL() string
+	SetCritical([]string) error
 	Iterate(ctx context.Context) Iterator
 	Walk(ctx context.Context, v Visitor) error
 	AsMap(ctx context.Context) (map[string]interface{}, error)
@@ -61,6 +61,7 @@ type stdHeaders struct {
 	x509CertThumbprintS256 *string                 `json:"x5t#S256,omitempty"` // https://tools.ietf.org/html/rfc7515#section-4.1.8
 	x509URL                *string                 `json:"x5u,omitempty"`      // https://tools.ietf.org/html/rfc7515#section-4.1.5
 	privateParams          map[string]interface{}
+	fieldOrder             []string // order of the fields as parsed. See WithPreserveHeaderOrder
 }
 
 type standardHeadersMarshalProxy struct {
@@ -264,6 +265,10 @@ func (h *stdHeaders) Get(name string) (interface{}, bool) {
 	}
 }
 
+func (h *stdHeaders) SetCritical(v []string) error {
+	return h.Set(CriticalKey, v)
+}
+
 func (h *stdHeaders) Set(name string, value interface{}) error {
 	switch name {
 	case AlgorithmKey:
@@ -281,6 +286,9 @@ func (h *stdHeaders) Set(name string, value interface{}) error {
 		return errors.Errorf(`invalid value for %s key: %T`, ContentTypeKey, value)
 	case CriticalKey:
 		if v, ok := value.([]string); ok {
+			if err := validateCritical(v); err != nil {
+				return errors.Wrapf(err, `invalid value for %s key`, CriticalKey)
+			}
 			h.critical = v
 			return nil
 		}
@@ -358,6 +366,9 @@ func (h *stdHeaders) UnmarshalJSON(buf []byte) error {
 	}
 	h.algorithm = proxy.Xalgorithm
 	h.contentType = proxy.XcontentType
+	if err := validateCritical(proxy.Xcritical); err != nil {
+		return errors.Wrapf(err, `invalid value for %s key`, CriticalKey)
+	}
 	h.critical = proxy.Xcritical
 	h.jwkSetURL = proxy.XjwkSetURL
 	h.keyID = proxy.XkeyID
@@ -421,12 +432,20 @@ func (h stdHeaders) MarshalJSON() ([]byte, error) {
 			if hasContent || i > 0 {
 				fmt.Fprintf(&buf, `,`)
 			}
-			fmt.Fprintf(&buf, `%s:`, strconv.Quote(k))
+			name, err := json.Marshal(k)
+			if err != nil {
+				return nil, errors.Wrapf(err, `failed to encode private param name %s`, k)
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
 			if err := enc.Encode(h.privateParams[k]); err != nil {
 				return nil, errors.Wrapf(err, `failed to encode private param %s`, k)
 			}
 		}
 		fmt.Fprintf(&buf, `}`)
 	}
+	if len(h.fieldOrder) > 0 {
+		return reorderFields(buf.Bytes(), h.fieldOrder)
+	}
 	return buf.Bytes(), nil
 }
@@ -255,3 +255,44 @@ func TestHeader(t *testing.T) {
 		})
 	})
 }
+
+func TestHeaderCritical(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		h := jws.NewHeaders()
+		if !assert.NoError(t, h.SetCritical([]string{"exp", "b64"}), `h.SetCritical should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []string{"exp", "b64"}, h.Critical(), `h.Critical should match`) {
+			return
+		}
+	})
+
+	invalid := map[string][]string{
+		"Empty entry":     {"exp", ""},
+		"Duplicate entry": {"exp", "exp"},
+		"Standard header": {"exp", jws.KeyIDKey},
+	}
+	for name, crit := range invalid {
+		crit := crit
+		t.Run(name, func(t *testing.T) {
+			h := jws.NewHeaders()
+			if !assert.Error(t, h.SetCritical(crit), `h.SetCritical should fail`) {
+				return
+			}
+			if !assert.Error(t, h.Set(jws.CriticalKey, crit), `h.Set should fail`) {
+				return
+			}
+			if !assert.Nil(t, h.Critical(), `crit should not be set`) {
+				return
+			}
+
+			buf, err := json.Marshal(map[string]interface{}{"alg": "HS256", "crit": crit})
+			if !assert.NoError(t, err, `json.Marshal should succeed`) {
+				return
+			}
+			if !assert.Error(t, json.Unmarshal(buf, jws.NewHeaders()), `json.Unmarshal should fail`) {
+				return
+			}
+		})
+	}
+}
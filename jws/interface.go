@@ -1,6 +1,8 @@
 package jws
 
 import (
+	"context"
+
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/internal/iter"
 	"github.com/lestrrat-go/jwx/jwa"
@@ -34,7 +36,9 @@ type PayloadSigner interface {
 // signed payloads with. You should only use this when you want to actually
 // want to programmatically view the contents for the full JWS payload.
 //
-// To sign and verify, use the appropriate `Sign()` nad `Verify()` functions
+// To sign and verify, use the appropriate `Sign()` nad `Verify()` functions.
+// The only exception is `Message.Sign()`, which can be used to add
+// signatures to an already parsed message.
 type Message struct {
 	payload    []byte
 	signatures []*Signature
@@ -44,6 +48,64 @@ type Signature struct {
 	headers   Headers // Unprotected Headers
 	protected Headers // Protected Headers
 	signature []byte  // Signature
+
+	// encodedProtected is the base64 encoded protected header as it
+	// appeared in the signing input. It is kept so that the message can
+	// be serialized again without invalidating the signature
+	encodedProtected string
+}
+
+// VerifyErrors collects the reasons why each candidate key or signature
+// failed to verify a message. See WithCollectErrors.
+//
+// These errors are meant for debugging. They may contain details about
+// your keys and your configuration, so do not send them to the party
+// that sent you the message.
+type VerifyErrors struct {
+	Errors []error
+}
+
+func (e *VerifyErrors) add(err error) {
+	if e != nil {
+		e.Errors = append(e.Errors, err)
+	}
+}
+
+// KeySink receives the keys that a KeyProvider finds for a signature.
+// Keys are tried in the order they were given.
+type KeySink interface {
+	Key(alg jwa.SignatureAlgorithm, key interface{})
+}
+
+// KeyProvider looks up the keys to verify a signature with, usually
+// based on the headers of the signature (such as "kid" or "jku").
+// Lookups that may block should honor the deadline of ctx, which is the
+// context given by the WithVerifyContext option.
+//
+// If FetchKeys returns an error, or does not provide any keys, the
+// signature is treated as unverifiable.
+type KeyProvider interface {
+	FetchKeys(ctx context.Context, sink KeySink, sig *Signature, msg *Message) error
+}
+
+// KeyProviderFunc is a function that implements the KeyProvider interface
+type KeyProviderFunc func(context.Context, KeySink, *Signature, *Message) error
+
+func (fn KeyProviderFunc) FetchKeys(ctx context.Context, sink KeySink, sig *Signature, msg *Message) error {
+	return fn(ctx, sink, sig, msg)
+}
+
+type verificationKey struct {
+	alg jwa.SignatureAlgorithm
+	key interface{}
+}
+
+type keySink struct {
+	keys []verificationKey
+}
+
+func (s *keySink) Key(alg jwa.SignatureAlgorithm, key interface{}) {
+	s.keys = append(s.keys, verificationKey{alg: alg, key: key})
 }
 
 // JWKAcceptor decides which keys can be accepted
@@ -75,3 +137,15 @@ type Visitor = iter.MapVisitor
 type VisitorFunc = iter.MapVisitorFunc
 type HeaderPair = mapiter.Pair
 type Iterator = mapiter.Iterator
+
+// PayloadCanonicalization describes the canonicalization scheme that
+// is applied to the payload before computing the signing input.
+// See WithPayloadCanonicalization
+type PayloadCanonicalization string
+
+const (
+	// NoCanonicalization signs and verifies the payload as is
+	NoCanonicalization PayloadCanonicalization = ""
+	// JCS applies the JSON Canonicalization Scheme (RFC8785)
+	JCS PayloadCanonicalization = "JCS"
+)
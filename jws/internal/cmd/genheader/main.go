@@ -32,6 +32,9 @@ type headerField struct {
 	comment   string
 	hasAccept bool
 	jsonTag   string
+	// validator is the name of the function that validates the value
+	// before it is stored. Fields with a validator also get a typed setter
+	validator string
 }
 
 func (f headerField) IsPointer() bool {
@@ -88,12 +91,13 @@ func generateHeaders() error {
 			jsonTag: "`" + `json:"cty,omitempty"` + "`",
 		},
 		{
-			name:    `critical`,
-			method:  `Critical`,
-			typ:     `[]string`,
-			key:     `crit`,
-			comment: `https://tools.ietf.org/html/rfc7515#section-4.1.11`,
-			jsonTag: "`" + `json:"crit,omitempty"` + "`",
+			name:      `critical`,
+			method:    `Critical`,
+			typ:       `[]string`,
+			key:       `crit`,
+			comment:   `https://tools.ietf.org/html/rfc7515#section-4.1.11`,
+			jsonTag:   "`" + `json:"crit,omitempty"` + "`",
+			validator: `validateCritical`,
 		},
 		{
 			name:    `jwk`,
@@ -177,7 +181,6 @@ func generateHeaders() error {
 		"encoding/json",
 		"fmt",
 		"sort",
-		"strconv",
 		"github.com/lestrrat-go/jwx/jwa",
 		"github.com/lestrrat-go/jwx/jwk",
 		"github.com/pkg/errors",
@@ -199,6 +202,12 @@ func generateHeaders() error {
 	for _, f := range fields {
 		fmt.Fprintf(&buf, "\n%s() %s", f.method, f.PointerElem())
 	}
+	for _, f := range fields {
+		if f.validator == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "\nSet%s(%s) error", f.method, f.PointerElem())
+	}
 
 	// These are used to iterate through all keys in a header
 	fmt.Fprintf(&buf, "\nIterate(ctx context.Context) Iterator")
@@ -216,6 +225,7 @@ func generateHeaders() error {
 		fmt.Fprintf(&buf, "\n%s %s %s // %s", f.name, fieldStorageType(f.typ), f.jsonTag, f.comment)
 	}
 	fmt.Fprintf(&buf, "\nprivateParams map[string]interface{}")
+	fmt.Fprintf(&buf, "\nfieldOrder []string // order of the fields as parsed. See WithPreserveHeaderOrder")
 	fmt.Fprintf(&buf, "\n}") // end type StandardHeaders
 
 	// Proxy is used when unmarshaling headers
@@ -297,6 +307,15 @@ func generateHeaders() error {
 	fmt.Fprintf(&buf, "\n}") // end switch name
 	fmt.Fprintf(&buf, "\n}") // func (h *stdHeaders) Get(name string) (interface{}, bool)
 
+	for _, f := range fields {
+		if f.validator == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "\n\nfunc (h *stdHeaders) Set%s(v %s) error {", f.method, f.PointerElem())
+		fmt.Fprintf(&buf, "\nreturn h.Set(%sKey, v)", f.method)
+		fmt.Fprintf(&buf, "\n}")
+	}
+
 	fmt.Fprintf(&buf, "\n\nfunc (h *stdHeaders) Set(name string, value interface{}) error {")
 	fmt.Fprintf(&buf, "\nswitch name {")
 	for _, f := range fields {
@@ -310,6 +329,11 @@ func generateHeaders() error {
 			fmt.Fprintf(&buf, "\nreturn nil")
 		} else {
 			fmt.Fprintf(&buf, "\nif v, ok := value.(%s); ok {", f.typ)
+			if f.validator != "" {
+				fmt.Fprintf(&buf, "\nif err := %s(v); err != nil {", f.validator)
+				fmt.Fprintf(&buf, "\nreturn errors.Wrapf(err, `invalid value for %%s key`, %sKey)", f.method)
+				fmt.Fprintf(&buf, "\n}")
+			}
 			if fieldStorageTypeIsIndirect(f.typ) {
 				fmt.Fprintf(&buf, "\nh.%s = &v", f.name)
 			} else {
@@ -350,6 +374,11 @@ func generateHeaders() error {
 			continue
 		}
 
+		if f.validator != "" {
+			fmt.Fprintf(&buf, "\nif err := %s(proxy.X%s); err != nil {", f.validator, f.name)
+			fmt.Fprintf(&buf, "\nreturn errors.Wrapf(err, `invalid value for %%s key`, %sKey)", f.method)
+			fmt.Fprintf(&buf, "\n}")
+		}
 		fmt.Fprintf(&buf, "\nh.%[1]s = proxy.X%[1]s", f.name)
 	}
 
@@ -401,13 +430,22 @@ func generateHeaders() error {
 	fmt.Fprintf(&buf, "\nif hasContent || i > 0 {")
 	fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `,`)")
 	fmt.Fprintf(&buf, "\n}")
-	fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `%%s:`, strconv.Quote(k))")
+	// strconv.Quote does not produce valid JSON for all names
+	fmt.Fprintf(&buf, "\nname, err := json.Marshal(k)")
+	fmt.Fprintf(&buf, "\nif err != nil {")
+	fmt.Fprintf(&buf, "\nreturn nil, errors.Wrapf(err, `failed to encode private param name %%s`, k)")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\nbuf.Write(name)")
+	fmt.Fprintf(&buf, "\nbuf.WriteByte(':')")
 	fmt.Fprintf(&buf, "\nif err := enc.Encode(h.privateParams[k]); err != nil {")
 	fmt.Fprintf(&buf, "\nreturn nil, errors.Wrapf(err, `failed to encode private param %%s`, k)")
 	fmt.Fprintf(&buf, "\n}")
 	fmt.Fprintf(&buf, "\n}")
 	fmt.Fprintf(&buf, "\nfmt.Fprintf(&buf, `}`)")
 	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\nif len(h.fieldOrder) > 0 {")
+	fmt.Fprintf(&buf, "\nreturn reorderFields(buf.Bytes(), h.fieldOrder)")
+	fmt.Fprintf(&buf, "\n}")
 	fmt.Fprintf(&buf, "\nreturn buf.Bytes(), nil")
 	fmt.Fprintf(&buf, "\n}") // end of MarshalJSON
 
@@ -25,12 +25,17 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/elliptic"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"strings"
 	"unicode"
 
+	"github.com/lestrrat-go/jwx/internal/jcs"
 	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
@@ -67,24 +72,88 @@ func (s *payloadSigner) PublicHeader() Headers {
 // multiple signers.
 //
 // If you would like to pass custom headers, use the WithHeaders option.
+//
+// If you would like to obtain the jws.Message object that represents
+// the generated signature, use the WithMessage option.
+//
+// If you would like to sign over a canonicalized form of the payload,
+// use the WithPayloadCanonicalization option.
+//
+// If you would like the protected header to carry the digest of the
+// payload, use the WithPayloadDigestHeader option.
+//
+// If you would like the payload to be carried without being base64url
+// encoded (RFC7797), use the WithB64 option. If you would like the
+// payload to be detached from the message, use the WithDetached option.
+//
+// `key` may also be a jwk.Key. If the key references its private key
+// material by URI (see jwk.RegisterSignerResolver), the registered
+// resolver is used to obtain the signer.
 func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) ([]byte, error) {
 	var hdrs Headers = NewHeaders()
+	var msg *Message
+	var canonicalization PayloadCanonicalization
+	var digest *payloadDigest
+	encodePayload := true
+	var detached bool
+	b64 := base64.RawURLEncoding
 	for _, o := range options {
 		switch o.Name() {
+		case optkeyB64:
+			encodePayload = o.Value().(bool)
+		case optkeyDetached:
+			detached = o.Value().(bool)
+		case optkeyBase64Encoding:
+			b64 = o.Value().(*base64.Encoding)
 		case optkeyHeaders:
 			hdrs = o.Value().(Headers)
+		case optkeyMessage:
+			msg = o.Value().(*Message)
+		case optkeyPayloadCanonicalization:
+			canonicalization = o.Value().(PayloadCanonicalization)
+		case optkeyPayloadDigestHeader:
+			digest = o.Value().(*payloadDigest)
 		}
 	}
 
+	signingPayload, err := canonicalizePayload(canonicalization, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to canonicalize payload`)
+	}
+
 	signer, err := sign.New(alg)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to create signer`)
 	}
 
+	key, err = signingKey(key)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := hdrs.Set(AlgorithmKey, signer.Algorithm()); err != nil {
 		return nil, errors.Wrap(err, `failed to set header`)
 	}
 
+	if !encodePayload {
+		if !detached && bytes.IndexByte(payload, '.') >= 0 {
+			return nil, errors.New(`unencoded payload may not contain '.' in compact serialization`)
+		}
+		if err := setUnencodedPayloadHeaders(hdrs); err != nil {
+			return nil, err
+		}
+	}
+
+	if digest != nil {
+		v, err := computePayloadDigest(digest, payload)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to compute payload digest`)
+		}
+		if err := hdrs.Set(digest.name, v); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %q header`, digest.name)
+		}
+	}
+
 	hdrbuf, err := json.Marshal(hdrs)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to marshal headers`)
@@ -92,7 +161,7 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 
 	buf := pool.GetBytesBuffer()
 	defer pool.ReleaseBytesBuffer(buf)
-	enc := base64.NewEncoder(base64.RawURLEncoding, buf)
+	enc := base64.NewEncoder(b64, buf)
 	if _, err := enc.Write(hdrbuf); err != nil {
 		return nil, errors.Wrap(err, `failed to write headers as base64`)
 	}
@@ -101,12 +170,9 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 	}
 
 	buf.WriteByte('.')
-	enc = base64.NewEncoder(base64.RawURLEncoding, buf)
-	if _, err := enc.Write(payload); err != nil {
-		return nil, errors.Wrap(err, `failed to write payload as base64`)
-	}
-	if err := enc.Close(); err != nil {
-		return nil, errors.Wrap(err, `failed to finalize writing payload as base64`)
+	hdrlen := buf.Len()
+	if err := writePayload(buf, b64, encodePayload, signingPayload); err != nil {
+		return nil, err
 	}
 
 	signature, err := signer.Sign(buf.Bytes(), key)
@@ -114,8 +180,19 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 		return nil, errors.Wrap(err, `failed to sign payload`)
 	}
 
+	// The signature was computed over the canonical form, but the
+	// message carries the payload as it was given to us
+	if detached {
+		buf.Truncate(hdrlen)
+	} else if canonicalization != NoCanonicalization {
+		buf.Truncate(hdrlen)
+		if err := writePayload(buf, b64, encodePayload, payload); err != nil {
+			return nil, err
+		}
+	}
+
 	buf.WriteByte('.')
-	enc = base64.NewEncoder(base64.RawURLEncoding, buf)
+	enc = base64.NewEncoder(b64, buf)
 	if _, err := enc.Write(signature); err != nil {
 		return nil, errors.Wrap(err, `failed to write signature as base64`)
 	}
@@ -123,11 +200,164 @@ func Sign(payload []byte, alg jwa.SignatureAlgorithm, key interface{}, options .
 		return nil, errors.Wrap(err, `failed to finalize writing signature as base64`)
 	}
 
+	if msg != nil {
+		msg.payload = payload
+		msg.signatures = []*Signature{
+			{
+				protected:        hdrs,
+				signature:        signature,
+				encodedProtected: string(buf.Bytes()[:hdrlen-1]),
+			},
+		}
+	}
+
 	result := make([]byte, buf.Len())
 	copy(result, buf.Bytes())
 	return result, nil
 }
 
+// writePayload writes the payload segment of the message to buf,
+// base64 encoding it unless encodePayload is false
+func writePayload(buf *bytes.Buffer, b64 *base64.Encoding, encodePayload bool, payload []byte) error {
+	if !encodePayload {
+		buf.Write(payload)
+		return nil
+	}
+
+	enc := base64.NewEncoder(b64, buf)
+	if _, err := enc.Write(payload); err != nil {
+		return errors.Wrap(err, `failed to write payload as base64`)
+	}
+	if err := enc.Close(); err != nil {
+		return errors.Wrap(err, `failed to finalize writing payload as base64`)
+	}
+	return nil
+}
+
+// setUnencodedPayloadHeaders sets the "b64" header to false, and makes
+// sure that it is listed in the "crit" header, as required by RFC7797
+func setUnencodedPayloadHeaders(hdrs Headers) error {
+	if err := hdrs.Set("b64", false); err != nil {
+		return errors.Wrap(err, `failed to set "b64" header`)
+	}
+
+	crit := hdrs.Critical()
+	for _, name := range crit {
+		if name == "b64" {
+			return nil
+		}
+	}
+	if err := hdrs.Set(CriticalKey, append(append([]string(nil), crit...), "b64")); err != nil {
+		return errors.Wrap(err, `failed to set "crit" header`)
+	}
+	return nil
+}
+
+// isUnencodedPayload reports whether the protected header specifies
+// `"b64": false` (RFC7797)
+func isUnencodedPayload(protected Headers) bool {
+	if protected == nil {
+		return false
+	}
+	v, ok := protected.Get("b64")
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	return ok && !b
+}
+
+// payloadEncoded reports whether the payload is base64url encoded for a
+// signature with the given protected header. As required by RFC7797,
+// `"b64": false` is only accepted when "b64" is listed in "crit"
+func payloadEncoded(protected Headers) (bool, error) {
+	if !isUnencodedPayload(protected) {
+		return true, nil
+	}
+	for _, name := range protected.Critical() {
+		if name == "b64" {
+			return false, nil
+		}
+	}
+	return false, errors.New(`"b64" header must be listed in the "crit" header`)
+}
+
+// encodedPayloadEncoded works like payloadEncoded, but takes the encoded
+// protected header
+func encodedPayloadEncoded(b64 *base64.Encoding, encodedProtected []byte) (bool, error) {
+	if len(encodedProtected) == 0 {
+		return true, nil
+	}
+
+	decoded, err := decodeBase64(b64, encodedProtected)
+	if err != nil {
+		return false, errors.Wrap(err, `failed to decode protected header`)
+	}
+
+	protected := NewHeaders()
+	if err := json.Unmarshal(decoded, protected); err != nil {
+		return false, errors.Wrap(err, `failed to parse protected header`)
+	}
+	return payloadEncoded(protected)
+}
+
+// verificationPayload returns the payload segment that the signature is
+// computed over (taking the canonicalization into account), and the
+// decoded payload. If detached is non-nil, it is used in place of the
+// payload segment found in the message
+func verificationPayload(b64 *base64.Encoding, c PayloadCanonicalization, segment, detached []byte, encoded bool) ([]byte, []byte, error) {
+	if !encoded {
+		payload := segment
+		if detached != nil {
+			payload = detached
+		}
+		signingPayload, err := canonicalizePayload(c, payload)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, `failed to canonicalize payload`)
+		}
+		return signingPayload, payload, nil
+	}
+
+	if detached != nil {
+		segment = make([]byte, b64.EncodedLen(len(detached)))
+		b64.Encode(segment, detached)
+	}
+
+	signingPayload, err := canonicalizeEncodedPayload(b64, c, segment)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, `failed to canonicalize payload`)
+	}
+
+	decodedPayload, err := decodeBase64(b64, segment)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, `failed to decode payload`)
+	}
+	return signingPayload, decodedPayload, nil
+}
+
+// signingKey converts a jwk.Key into a key that can be passed to
+// the signers. Other types of keys are returned as is
+func signingKey(key interface{}) (interface{}, error) {
+	jwkKey, ok := key.(jwk.Key)
+	if !ok {
+		return key, nil
+	}
+
+	signer, ok, err := jwk.ResolveSigner(jwkKey)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to resolve signer from jwk.Key`)
+	}
+	if ok {
+		return signer, nil
+	}
+
+	var rawkey interface{}
+	if err := jwkKey.Raw(&rawkey); err != nil {
+		return nil, errors.Wrap(err, `failed to materialize jwk.Key`)
+	}
+	return rawkey, nil
+}
+
 // SignLiteral generates a signature for the given payload and headers, and serializes
 // it in compact serialization format. In this format you may NOT use
 // multiple signers.
@@ -239,10 +469,79 @@ func SignMulti(payload []byte, options ...Option) ([]byte, error) {
 // payload that was signed is returned. If you need more fine-grained
 // control of the verification process, manually call `Parse`, generate a
 // verifier, and call `Verify` on the parsed JWS message object.
-func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte, err error) {
-	verifier, err := verify.New(alg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create verifier")
+//
+// If you would like to bound the time spent on verification, use the
+// WithVerifyContext option.
+//
+// If the message was signed over a canonicalized form of the payload,
+// use the WithPayloadCanonicalization option.
+//
+// If the "alg" header of the message must match the algorithm that is
+// fixed by the key, use the WithKeyFixedAlgorithm option.
+//
+// If the message must carry the digest of the payload in its protected
+// header, use the WithPayloadDigestHeader option.
+//
+// If the message was signed with a detached payload, pass the payload
+// using the WithDetachedPayload option.
+//
+// If the verification keys should be chosen based on each signature,
+// use the WithKeyProvider option.
+//
+// If the payload is JSON and should be unmarshaled as well, use the
+// WithDecodePayload option.
+//
+// If the protected header contains `"b64": false` (RFC7797), and "b64"
+// is listed in its "crit" header, the payload is used as is instead of
+// being base64url decoded.
+func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}, options ...Option) (ret []byte, err error) {
+	ctx := verifyContext(options)
+	var canonicalization PayloadCanonicalization
+	var fixedAlgorithm bool
+	var verifyErrors *VerifyErrors
+	var requireLowS bool
+	var digest *payloadDigest
+	var detachedPayload []byte
+	var provider KeyProvider
+	var decodeTarget interface{}
+	var requireJSONPayload bool
+	b64 := base64.RawURLEncoding
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyBase64Encoding:
+			b64 = o.Value().(*base64.Encoding)
+		case optkeyDecodePayload:
+			decodeTarget = o.Value()
+		case optkeyRequireJSONPayload:
+			requireJSONPayload = o.Value().(bool)
+		case optkeyKeyProvider:
+			provider = o.Value().(KeyProvider)
+		case optkeyDetachedPayload:
+			detachedPayload = o.Value().([]byte)
+		case optkeyPayloadDigestHeader:
+			digest = o.Value().(*payloadDigest)
+		case optkeyRequireLowS:
+			requireLowS = o.Value().(bool)
+		case optkeyCollectErrors:
+			verifyErrors = o.Value().(*VerifyErrors)
+		case optkeyPayloadCanonicalization:
+			canonicalization = o.Value().(PayloadCanonicalization)
+		case optkeyKeyFixedAlgorithm:
+			fixed := o.Value().(*fixedAlgorithmKey)
+			alg = fixed.alg
+			key = fixed.key
+			fixedAlgorithm = true
+		}
+	}
+
+	var verifier verify.Verifier
+	if provider == nil {
+		verifier, err = verify.New(alg)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create verifier")
+		}
+	} else if fixedAlgorithm {
+		return nil, errors.New(`WithKeyProvider and WithKeyFixedAlgorithm cannot be used together`)
 	}
 
 	buf = bytes.TrimSpace(buf)
@@ -250,6 +549,19 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 		return nil, errors.New(`attempt to verify empty buffer`)
 	}
 
+	// the key provider is given the parsed message, so that it can
+	// look at the headers of each signature
+	var msg *Message
+	if provider != nil {
+		msg, err = Parse(bytes.NewReader(buf), WithBase64Encoding(b64))
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to parse message`)
+		}
+		if detachedPayload != nil {
+			msg.payload = detachedPayload
+		}
+	}
+
 	if buf[0] == '{' {
 		// FUuuuuuuuuuuuuuuuck // WTF am I doing here.
 		var proxy fullMessageProxy
@@ -257,8 +569,12 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 			return nil, errors.Wrap(err, `failed to unmarshal JWS message`)
 		}
 
-		// There's something wrong if the Message part is not initialized
-		if len(proxy.Payload) == 0 {
+		if detachedPayload != nil {
+			if len(proxy.Payload) > 0 {
+				return nil, errors.New(`invalid JWS message format (payload exists, but a detached payload was given)`)
+			}
+		} else if len(proxy.Payload) == 0 {
+			// There's something wrong if the Message part is not initialized
 			return nil, errors.New(`invalid JWS message format (missing payload)`)
 		}
 
@@ -276,26 +592,72 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 			proxy.Signatures = append(proxy.Signatures, encodedSig)
 		}
 
-		buf := pool.GetBytesBuffer()
-		defer pool.ReleaseBytesBuffer(buf)
-		for _, sig := range proxy.Signatures {
-			buf.Reset()
-			buf.WriteString(sig.Protected)
-			buf.WriteByte('.')
-			buf.WriteString(proxy.Payload)
-			decodedSignature, err := base64.RawURLEncoding.DecodeString(sig.Signature)
+		for i, sig := range proxy.Signatures {
+			if err := ctx.Err(); err != nil {
+				return nil, errors.Wrap(err, `verification aborted`)
+			}
+
+			// whether the payload is encoded is decided by each signature
+			encoded, err := encodedPayloadEncoded(b64, []byte(sig.Protected))
 			if err != nil {
+				verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
+				continue
+			}
+			signingPayload, decodedPayload, err := verificationPayload(b64, canonicalization, []byte(proxy.Payload), detachedPayload, encoded)
+			if err != nil {
+				verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
 				continue
 			}
 
-			if err := verifier.Verify(buf.Bytes(), decodedSignature, key); err == nil {
-				// verified!
-				decodedPayload, err := base64.RawURLEncoding.DecodeString(proxy.Payload)
+			if fixedAlgorithm {
+				if err := checkHeaderAlgorithm(b64, []byte(sig.Protected), sig.Headers, alg); err != nil {
+					verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
+					continue
+				}
+			}
+
+			decodedSignature, err := b64.DecodeString(sig.Signature)
+			if err != nil {
+				verifyErrors.add(errors.Wrapf(err, `signature #%d: failed to decode signature`, i+1))
+				continue
+			}
+
+			candidates := []verificationKey{{alg: alg, key: key}}
+			if provider != nil {
+				candidates, err = fetchVerificationKeys(ctx, provider, msg, i)
 				if err != nil {
-					return nil, errors.Wrap(err, `message verified, failed to decode payload`)
+					verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
+					continue
 				}
-				return decodedPayload, nil
 			}
+
+			var verified bool
+			for _, candidate := range candidates {
+				if err := verifySigningInput(candidate, verifier, requireLowS, []byte(sig.Protected), signingPayload, decodedSignature); err != nil {
+					verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
+					continue
+				}
+				verified = true
+				break
+			}
+			if !verified {
+				continue
+			}
+
+			// verified!
+			if digest != nil {
+				if err := checkPayloadDigest(b64, []byte(sig.Protected), decodedPayload, digest); err != nil {
+					verifyErrors.add(errors.Wrapf(err, `signature #%d`, i+1))
+					continue
+				}
+			}
+
+			if decodeTarget != nil {
+				if err := decodeJSONPayload(b64, []byte(sig.Protected), sig.Headers, decodedPayload, decodeTarget, requireJSONPayload); err != nil {
+					return nil, errors.Wrap(err, `message verified`)
+				}
+			}
+			return decodedPayload, nil
 		}
 		return nil, errors.New(`could not verify with any of the signatures`)
 	}
@@ -305,28 +667,153 @@ func Verify(buf []byte, alg jwa.SignatureAlgorithm, key interface{}) (ret []byte
 		return nil, errors.Wrap(err, `failed extract from compact serialization format`)
 	}
 
-	verifyBuf := pool.GetBytesBuffer()
-	defer pool.ReleaseBytesBuffer(verifyBuf)
+	if detachedPayload != nil && len(payload) > 0 {
+		return nil, errors.New(`invalid JWS message format (payload exists, but a detached payload was given)`)
+	}
 
-	verifyBuf.Write(protected)
-	verifyBuf.WriteByte('.')
-	verifyBuf.Write(payload)
+	if fixedAlgorithm {
+		if err := checkHeaderAlgorithm(b64, protected, nil, alg); err != nil {
+			return nil, errors.Wrap(err, `failed to verify message`)
+		}
+	}
 
-	decodedSignature := make([]byte, base64.RawURLEncoding.DecodedLen(len(signature)))
-	if _, err := base64.RawURLEncoding.Decode(decodedSignature, signature); err != nil {
+	encoded, err := encodedPayloadEncoded(b64, protected)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to verify message`)
+	}
+	signingPayload, decodedPayload, err := verificationPayload(b64, canonicalization, payload, detachedPayload, encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	decodedSignature, err := decodeBase64(b64, signature)
+	if err != nil {
 		return nil, errors.Wrap(err, `failed to decode signature`)
 	}
-	if err := verifier.Verify(verifyBuf.Bytes(), decodedSignature, key); err != nil {
-		return nil, errors.Wrap(err, `failed to verify message`)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, `verification aborted`)
+	}
+
+	if provider == nil {
+		if err := verifySigningInput(verificationKey{alg: alg, key: key}, verifier, requireLowS, protected, signingPayload, decodedSignature); err != nil {
+			return nil, errors.Wrap(err, `failed to verify message`)
+		}
+	} else {
+		candidates, err := fetchVerificationKeys(ctx, provider, msg, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to verify message`)
+		}
+
+		var verified bool
+		for i, candidate := range candidates {
+			if err := verifySigningInput(candidate, nil, requireLowS, protected, signingPayload, decodedSignature); err != nil {
+				verifyErrors.add(errors.Wrapf(err, `key #%d`, i+1))
+				continue
+			}
+			verified = true
+			break
+		}
+		if !verified {
+			return nil, errors.New(`failed to verify message with any of the keys from the key provider`)
+		}
 	}
 
-	decodedPayload := make([]byte, base64.RawURLEncoding.DecodedLen(len(payload)))
-	if _, err := base64.RawURLEncoding.Decode(decodedPayload, payload); err != nil {
-		return nil, errors.Wrap(err, `message verified, failed to decode payload`)
+	if digest != nil {
+		if err := checkPayloadDigest(b64, protected, decodedPayload, digest); err != nil {
+			return nil, errors.Wrap(err, `failed to verify message`)
+		}
+	}
+
+	if decodeTarget != nil {
+		if err := decodeJSONPayload(b64, protected, nil, decodedPayload, decodeTarget, requireJSONPayload); err != nil {
+			return nil, errors.Wrap(err, `message verified`)
+		}
 	}
 	return decodedPayload, nil
 }
 
+// decodeJSONPayload unmarshals the payload into v if the "cty" header
+// (protected or public) indicates JSON. If it does not, an error is
+// returned only when strict is true
+func decodeJSONPayload(b64 *base64.Encoding, encodedProtected []byte, public Headers, payload []byte, v interface{}, strict bool) error {
+	decoded, err := decodeBase64(b64, encodedProtected)
+	if err != nil {
+		return errors.Wrap(err, `failed to decode protected header`)
+	}
+
+	protected := NewHeaders()
+	if err := json.Unmarshal(decoded, protected); err != nil {
+		return errors.Wrap(err, `failed to parse protected header`)
+	}
+
+	cty := protected.ContentType()
+	if cty == "" && public != nil {
+		cty = public.ContentType()
+	}
+
+	if !isJSONContentType(cty) {
+		if strict {
+			return errors.Errorf(`"cty" header %q does not indicate a JSON payload`, cty)
+		}
+		return nil
+	}
+
+	if err := json.Unmarshal(payload, v); err != nil {
+		return errors.Wrap(err, `failed to decode JSON payload`)
+	}
+	return nil
+}
+
+// isJSONContentType returns true if the "cty" value indicates JSON.
+// The "application/" prefix may be omitted, as RFC7515 recommends
+func isJSONContentType(cty string) bool {
+	cty = strings.ToLower(strings.TrimSpace(cty))
+	if i := strings.IndexByte(cty, ';'); i >= 0 {
+		cty = strings.TrimSpace(cty[:i])
+	}
+	cty = strings.TrimPrefix(cty, "application/")
+	return cty == "json" || strings.HasSuffix(cty, "+json")
+}
+
+// verifySigningInput verifies the signature over the signing input made
+// of the encoded protected header and payload. If verifier is nil, one
+// is created for the algorithm of the key
+func verifySigningInput(vk verificationKey, verifier verify.Verifier, requireLowS bool, protected, payload, signature []byte) error {
+	if verifier == nil {
+		v, err := verify.New(vk.alg)
+		if err != nil {
+			return errors.Wrap(err, `failed to create verifier`)
+		}
+		verifier = v
+	}
+
+	sv, err := newStreamVerifier(vk.alg, verifier, vk.key, requireLowS, protected)
+	if err != nil {
+		return err
+	}
+	if _, err := sv.Write(payload); err != nil {
+		return err
+	}
+	return sv.Finalize(signature)
+}
+
+// fetchVerificationKeys asks the provider for the keys to verify the
+// signature at index idx of msg with
+func fetchVerificationKeys(ctx context.Context, provider KeyProvider, msg *Message, idx int) ([]verificationKey, error) {
+	if idx >= len(msg.signatures) {
+		return nil, errors.Errorf(`signature #%d not found in parsed message`, idx+1)
+	}
+
+	var sink keySink
+	if err := provider.FetchKeys(ctx, &sink, msg.signatures[idx], msg); err != nil {
+		return nil, errors.Wrap(err, `key provider failed`)
+	}
+	if len(sink.keys) == 0 {
+		return nil, errors.New(`key provider did not provide any keys`)
+	}
+	return sink.keys, nil
+}
+
 // VerifyWithJKU wraps VerifyWithJKUAndContext using the background context.
 func VerifyWithJKU(buf []byte, jwkurl string, options ...Option) ([]byte, error) {
 	return VerifyWithJKUAndContext(context.Background(), buf, jwkurl, options...)
@@ -340,17 +827,17 @@ func VerifyWithJKUAndContext(ctx context.Context, buf []byte, jwkurl string, opt
 		return nil, errors.Wrap(err, `failed to fetch jwk via HTTP`)
 	}
 
-	return VerifyWithJWKSet(buf, key, nil)
+	return VerifyWithJWKSet(buf, key, nil, WithVerifyContext(ctx))
 }
 
 // VerifyWithJWK verifies the JWS message using the specified JWK
-func VerifyWithJWK(buf []byte, key jwk.Key) (payload []byte, err error) {
+func VerifyWithJWK(buf []byte, key jwk.Key, options ...Option) (payload []byte, err error) {
 	var rawkey interface{}
 	if err := key.Raw(&rawkey); err != nil {
 		return nil, errors.Wrap(err, `failed to materialize jwk.Key`)
 	}
 
-	payload, err = Verify(buf, jwa.SignatureAlgorithm(key.Algorithm()), rawkey)
+	payload, err = Verify(buf, jwa.SignatureAlgorithm(key.Algorithm()), rawkey, options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to verify message")
 	}
@@ -361,20 +848,61 @@ func VerifyWithJWK(buf []byte, key jwk.Key) (payload []byte, err error) {
 // By default it will only pick up keys that have the "use" key
 // set to either "sig" or "enc", but you can override it by
 // providing a keyaccept function.
-func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc) ([]byte, error) {
+//
+// If the WithVerifyContext option is given, the context is checked
+// before each key is tried.
+//
+// Keys whose "alg" does not match the "alg" header of any of the
+// signatures in the message, or whose type cannot be used with that
+// algorithm, are skipped without being tried.
+func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc, options ...Option) ([]byte, error) {
 	if keyaccept == nil {
 		keyaccept = DefaultJWKAcceptor
 	}
 
-	for _, key := range keyset.Keys {
+	ctx := verifyContext(options)
+
+	// errors are collected per key here, so the option is not passed down
+	var verifyErrors *VerifyErrors
+	keyOptions := make([]Option, 0, len(options))
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyCollectErrors:
+			verifyErrors = o.Value().(*VerifyErrors)
+		default:
+			keyOptions = append(keyOptions, o)
+		}
+	}
+
+	// Only consider keys that can possibly verify one of the signatures.
+	// If the message cannot be parsed, let VerifyWithJWK report the error
+	var algs map[jwa.SignatureAlgorithm]struct{}
+	if msg, err := Parse(bytes.NewReader(buf), keyOptions...); err == nil {
+		algs = messageAlgorithms(msg)
+	}
+
+	for i, key := range keyset.Keys {
+		if algs != nil {
+			if err := checkCompatibleKey(key, algs); err != nil {
+				verifyErrors.add(errors.Wrapf(err, `key #%d (kid = %q)`, i+1, key.KeyID()))
+				continue
+			}
+		}
+
 		if !keyaccept(key) {
+			verifyErrors.add(errors.Errorf(`key #%d (kid = %q): rejected by key acceptor`, i+1, key.KeyID()))
 			continue
 		}
 
-		payload, err := VerifyWithJWK(buf, key)
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Wrap(err, `verification aborted`)
+		}
+
+		payload, err := VerifyWithJWK(buf, key, keyOptions...)
 		if err == nil {
 			return payload, nil
 		}
+		verifyErrors.add(errors.Wrapf(err, `key #%d (kid = %q)`, i+1, key.KeyID()))
 	}
 
 	// refs #140, #141
@@ -389,9 +917,243 @@ func VerifyWithJWKSet(buf []byte, keyset *jwk.Set, keyaccept JWKAcceptFunc) ([]b
 	return nil, errors.New("failed to verify with any of the keys")
 }
 
+// signatureKeyTypes maps the signature algorithms defined in RFC7518 to
+// the type of key they require
+var signatureKeyTypes = map[jwa.SignatureAlgorithm]jwa.KeyType{
+	jwa.ES256: jwa.EC,
+	jwa.ES384: jwa.EC,
+	jwa.ES512: jwa.EC,
+	jwa.HS256: jwa.OctetSeq,
+	jwa.HS384: jwa.OctetSeq,
+	jwa.HS512: jwa.OctetSeq,
+	jwa.PS256: jwa.RSA,
+	jwa.PS384: jwa.RSA,
+	jwa.PS512: jwa.RSA,
+	jwa.RS256: jwa.RSA,
+	jwa.RS384: jwa.RSA,
+	jwa.RS512: jwa.RSA,
+}
+
+// messageAlgorithms collects the "alg" headers of all signatures in msg
+func messageAlgorithms(msg *Message) map[jwa.SignatureAlgorithm]struct{} {
+	algs := make(map[jwa.SignatureAlgorithm]struct{})
+	for _, sig := range msg.signatures {
+		for _, h := range []Headers{sig.protected, sig.headers} {
+			if h == nil {
+				continue
+			}
+			if alg := h.Algorithm(); alg != "" {
+				algs[alg] = struct{}{}
+			}
+		}
+	}
+	return algs
+}
+
+// checkCompatibleKey makes sure that key, which is used with its own
+// "alg", can verify a signature made with one of algs. The returned
+// error describes why the key cannot be used
+func checkCompatibleKey(key jwk.Key, algs map[jwa.SignatureAlgorithm]struct{}) error {
+	alg := jwa.SignatureAlgorithm(key.Algorithm())
+	if _, ok := algs[alg]; !ok {
+		return errors.Errorf(`"alg" (%s) is not used by the message`, alg)
+	}
+	if kty, ok := signatureKeyTypes[alg]; ok && kty != key.KeyType() {
+		return errors.Errorf(`"kty" (%s) cannot be used with "alg" (%s), which requires %s`, key.KeyType(), alg, kty)
+	}
+	return nil
+}
+
+// checkHeaderAlgorithm makes sure that the "alg" header in the encoded
+// protected header, as well as the one in the public header if present,
+// matches the expected algorithm
+func checkHeaderAlgorithm(b64 *base64.Encoding, encodedProtected []byte, public Headers, alg jwa.SignatureAlgorithm) error {
+	decoded, err := decodeBase64(b64, encodedProtected)
+	if err != nil {
+		return errors.Wrap(err, `failed to decode protected header`)
+	}
+
+	protected := NewHeaders()
+	if err := json.Unmarshal(decoded, protected); err != nil {
+		return errors.Wrap(err, `failed to parse protected header`)
+	}
+
+	if v := protected.Algorithm(); v != alg {
+		return errors.Errorf(`"alg" header %s does not match expected algorithm %s`, v, alg)
+	}
+
+	if public != nil {
+		if v := public.Algorithm(); v != "" && v != alg {
+			return errors.Errorf(`"alg" header %s does not match expected algorithm %s`, v, alg)
+		}
+	}
+	return nil
+}
+
+// checkLowS makes sure that the S value of the ECDSA signature is not
+// greater than half of the curve order. Other algorithms are not checked
+func checkLowS(alg jwa.SignatureAlgorithm, signature []byte) error {
+	var curve elliptic.Curve
+	switch alg {
+	case jwa.ES256:
+		curve = elliptic.P256()
+	case jwa.ES384:
+		curve = elliptic.P384()
+	case jwa.ES512:
+		curve = elliptic.P521()
+	default:
+		return nil
+	}
+
+	var s big.Int
+	s.SetBytes(signature[len(signature)/2:])
+
+	var half big.Int
+	half.Rsh(curve.Params().N, 1)
+	if s.Cmp(&half) > 0 {
+		return errors.New(`ecdsa signature has a high S value`)
+	}
+	return nil
+}
+
+// computePayloadDigest returns the base64url encoded digest of the
+// payload, as stored in the header specified by WithPayloadDigestHeader
+func computePayloadDigest(d *payloadDigest, payload []byte) (string, error) {
+	if !d.hash.Available() {
+		return "", errors.Errorf(`hash function %s is not available`, d.hash)
+	}
+	h := d.hash.New()
+	h.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkPayloadDigest makes sure that the header specified by
+// WithPayloadDigestHeader in the encoded protected header matches the
+// digest of the payload
+func checkPayloadDigest(b64 *base64.Encoding, encodedProtected []byte, payload []byte, d *payloadDigest) error {
+	decoded, err := decodeBase64(b64, encodedProtected)
+	if err != nil {
+		return errors.Wrap(err, `failed to decode protected header`)
+	}
+
+	protected := NewHeaders()
+	if err := json.Unmarshal(decoded, protected); err != nil {
+		return errors.Wrap(err, `failed to parse protected header`)
+	}
+
+	v, ok := protected.Get(d.name)
+	if !ok {
+		return errors.Errorf(`missing %q header`, d.name)
+	}
+	actual, ok := v.(string)
+	if !ok {
+		return errors.Errorf(`invalid %q header: expected string, got %T`, d.name, v)
+	}
+
+	expected, err := computePayloadDigest(d, payload)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) != 1 {
+		return errors.Errorf(`%q header does not match the payload`, d.name)
+	}
+	return nil
+}
+
+// canonicalizePayload returns the canonical form of the payload
+// according to the given scheme. Payloads that are not JSON are
+// returned as is
+func canonicalizePayload(c PayloadCanonicalization, payload []byte) ([]byte, error) {
+	switch c {
+	case NoCanonicalization:
+		return payload, nil
+	case JCS:
+		if !json.Valid(payload) {
+			return payload, nil
+		}
+		return jcs.Transform(payload)
+	default:
+		return nil, errors.Errorf(`unsupported payload canonicalization %s`, c)
+	}
+}
+
+// canonicalizeEncodedPayload works like canonicalizePayload, but
+// takes and returns base64 encoded payloads
+func canonicalizeEncodedPayload(b64 *base64.Encoding, c PayloadCanonicalization, payload []byte) ([]byte, error) {
+	if c == NoCanonicalization {
+		return payload, nil
+	}
+
+	decoded, err := decodeBase64(b64, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to decode payload`)
+	}
+
+	canonical, err := canonicalizePayload(c, decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]byte, b64.EncodedLen(len(canonical)))
+	b64.Encode(encoded, canonical)
+	return encoded, nil
+}
+
+// decodeBase64 decodes src using the given encoding. Unlike a plain call
+// to Decode, the result does not contain the extra bytes that DecodedLen
+// accounts for when the encoding uses padding
+func decodeBase64(b64 *base64.Encoding, src []byte) ([]byte, error) {
+	dst := make([]byte, b64.DecodedLen(len(src)))
+	n, err := b64.Decode(dst, src)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n], nil
+}
+
+func verifyContext(options []Option) context.Context {
+	ctx := context.Background()
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyVerifyContext:
+			ctx = o.Value().(context.Context)
+		}
+	}
+	return ctx
+}
+
 // Parse parses contents from the given source and creates a jws.Message
 // struct. The input can be in either compact or full JSON serialization.
-func Parse(src io.Reader) (m *Message, err error) {
+//
+// The WithBase64Encoding option is honored. To keep the order of the
+// header members when the headers are marshaled again, use the
+// WithPreserveHeaderOrder option.
+//
+// If the protected header contains `"b64": false` (RFC7797), the payload
+// is used as is. Such messages are rejected unless "b64" is listed in
+// the "crit" header.
+func Parse(src io.Reader, options ...Option) (m *Message, err error) {
+	b64 := base64.RawURLEncoding
+	var preserveHeaderOrder bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyBase64Encoding:
+			b64 = o.Value().(*base64.Encoding)
+		case optkeyPreserveHeaderOrder:
+			preserveHeaderOrder = o.Value().(bool)
+		}
+	}
+
+	// the field order is read from the raw input once parsing succeeds
+	var raw []byte
+	if preserveHeaderOrder {
+		raw, err = ioutil.ReadAll(src)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to read source`)
+		}
+		src = bytes.NewReader(raw)
+	}
+
 	rdr := bufio.NewReader(src)
 	var first rune
 	for {
@@ -409,24 +1171,79 @@ func Parse(src io.Reader) (m *Message, err error) {
 		}
 	}
 
-	var parser func(io.Reader) (*Message, error)
+	var parser func(io.Reader, *base64.Encoding) (*Message, error)
 	if first == '{' {
 		parser = parseJSON
 	} else {
 		parser = parseCompact
 	}
 
-	m, err = parser(rdr)
+	m, err = parser(rdr, b64)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to parse jws message`)
 	}
 
+	if preserveHeaderOrder {
+		if err := preserveHeaderFieldOrder(m, raw, first == '{', b64); err != nil {
+			return nil, errors.Wrap(err, `failed to record header order`)
+		}
+	}
+
 	return m, nil
 }
 
+// preserveHeaderFieldOrder records the order of the header members, as
+// found in the raw message, on the headers of each signature in m
+func preserveHeaderFieldOrder(m *Message, raw []byte, isJSON bool, b64 *base64.Encoding) error {
+	for i, sig := range m.signatures {
+		if sig.protected == nil {
+			continue
+		}
+		decoded, err := b64.DecodeString(sig.encodedProtected)
+		if err != nil {
+			return errors.Wrapf(err, `failed to decode protected header for signature #%d`, i+1)
+		}
+		if err := preserveFieldOrder(sig.protected, decoded); err != nil {
+			return errors.Wrapf(err, `failed to read protected header for signature #%d`, i+1)
+		}
+	}
+
+	if !isJSON {
+		return nil
+	}
+
+	var proxy struct {
+		Headers    json.RawMessage `json:"header"`
+		Signatures []struct {
+			Headers json.RawMessage `json:"header"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(raw, &proxy); err != nil {
+		return errors.Wrap(err, `failed to unmarshal jws message`)
+	}
+
+	public := make([]json.RawMessage, len(proxy.Signatures))
+	for i, sig := range proxy.Signatures {
+		public[i] = sig.Headers
+	}
+	if len(public) == 0 {
+		public = append(public, proxy.Headers)
+	}
+
+	for i, sig := range m.signatures {
+		if i >= len(public) || sig.headers == nil || len(public[i]) == 0 {
+			continue
+		}
+		if err := preserveFieldOrder(sig.headers, public[i]); err != nil {
+			return errors.Wrapf(err, `failed to read public header for signature #%d`, i+1)
+		}
+	}
+	return nil
+}
+
 // ParseString is the same as Parse, but take in a string
-func ParseString(s string) (*Message, error) {
-	return Parse(strings.NewReader(s))
+func ParseString(s string, options ...Option) (*Message, error) {
+	return Parse(strings.NewReader(s), options...)
 }
 
 type fullMessageProxy struct {
@@ -456,7 +1273,7 @@ func (proxy *fullMessageProxy) encodedSignature() (*encodedSignature, error) {
 	return &encodedSig, nil
 }
 
-func parseJSON(src io.Reader) (result *Message, err error) {
+func parseJSON(src io.Reader, b64 *base64.Encoding) (result *Message, err error) {
 	var proxy fullMessageProxy
 	if err := json.NewDecoder(src).Decode(&proxy); err != nil {
 		return nil, errors.Wrap(err, `failed to unmarshal jws message`)
@@ -475,19 +1292,15 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 	}
 
 	var plain Message
-	plain.payload, err = base64.RawURLEncoding.DecodeString(proxy.Payload)
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to decode payload`)
-	}
-
 	for i, sig := range proxy.Signatures {
 		var plainSig Signature
 
 		plainSig.headers = sig.Headers
+		plainSig.encodedProtected = sig.Protected
 
 		if l := len(sig.Protected); l > 0 {
 			plainSig.protected = NewHeaders()
-			hdrbuf, err := base64.RawURLEncoding.DecodeString(sig.Protected)
+			hdrbuf, err := b64.DecodeString(sig.Protected)
 			if err != nil {
 				return nil, errors.Wrapf(err, `failed to base64 decode protected header for signature #%d`, i+1)
 			}
@@ -496,7 +1309,7 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 			}
 		}
 
-		plainSig.signature, err = base64.RawURLEncoding.DecodeString(sig.Signature)
+		plainSig.signature, err = b64.DecodeString(sig.Signature)
 		if err != nil {
 			return nil, errors.Wrapf(err, `failed to decode signature #%d`, i)
 		}
@@ -504,6 +1317,28 @@ func parseJSON(src io.Reader) (result *Message, err error) {
 		plain.signatures = append(plain.signatures, &plainSig)
 	}
 
+	// all signatures must agree on whether the payload is encoded
+	encoded := true
+	for i, sig := range plain.signatures {
+		v, err := payloadEncoded(sig.protected)
+		if err != nil {
+			return nil, errors.Wrapf(err, `invalid protected header for signature #%d`, i+1)
+		}
+		if i > 0 && v != encoded {
+			return nil, errors.Errorf(`signature #%d does not agree on whether the payload is encoded`, i+1)
+		}
+		encoded = v
+	}
+
+	if encoded {
+		plain.payload, err = b64.DecodeString(proxy.Payload)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to decode payload`)
+		}
+	} else {
+		plain.payload = []byte(proxy.Payload)
+	}
+
 	return &plain, nil
 }
 
@@ -574,14 +1409,14 @@ func SplitCompact(rdr io.Reader) ([]byte, []byte, []byte, error) {
 }
 
 // parseCompact parses a JWS value serialized via compact serialization.
-func parseCompact(rdr io.Reader) (m *Message, err error) {
+func parseCompact(rdr io.Reader, b64 *base64.Encoding) (m *Message, err error) {
 	protected, payload, signature, err := SplitCompact(rdr)
 	if err != nil {
 		return nil, errors.Wrap(err, `invalid compact serialization format`)
 	}
 
-	decodedHeader := make([]byte, base64.RawURLEncoding.DecodedLen(len(protected)))
-	if _, err := base64.RawURLEncoding.Decode(decodedHeader, protected); err != nil {
+	decodedHeader, err := decodeBase64(b64, protected)
+	if err != nil {
 		return nil, errors.Wrap(err, `failed to decode headers`)
 	}
 	var hdr stdHeaders
@@ -589,21 +1424,36 @@ func parseCompact(rdr io.Reader) (m *Message, err error) {
 		return nil, errors.Wrap(err, `failed to parse JOSE headers`)
 	}
 
-	decodedPayload := make([]byte, base64.RawURLEncoding.DecodedLen(len(payload)))
-	if _, err = base64.RawURLEncoding.Decode(decodedPayload, payload); err != nil {
-		return nil, errors.Wrap(err, `failed to decode payload`)
+	encoded, err := payloadEncoded(&hdr)
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid protected header`)
+	}
+
+	decodedPayload := payload
+	if encoded {
+		decodedPayload, err = decodeBase64(b64, payload)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to decode payload`)
+		}
 	}
 
-	decodedSignature := make([]byte, base64.RawURLEncoding.DecodedLen(len(signature)))
-	if _, err := base64.RawURLEncoding.Decode(decodedSignature, signature); err != nil {
+	decodedSignature, err := decodeBase64(b64, signature)
+	if err != nil {
 		return nil, errors.Wrap(err, `failed to decode signature`)
 	}
 
 	var msg Message
 	msg.payload = decodedPayload
 	msg.signatures = append(msg.signatures, &Signature{
-		protected: &hdr,
-		signature: decodedSignature,
+		protected:        &hdr,
+		signature:        decodedSignature,
+		encodedProtected: string(protected),
 	})
 	return &msg, nil
 }
+
+// SetBufferPoolConfig is equivalent to jwk.SetBufferPoolConfig, as the
+// buffer pool is shared among the jwk, jws, jwe, and jwt packages.
+func SetBufferPoolConfig(initialCap int) {
+	pool.SetBytesBufferInitialCapacity(initialCap)
+}
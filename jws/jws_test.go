@@ -2,15 +2,22 @@ package jws_test
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/buffer"
 	"github.com/lestrrat-go/jwx/jwa"
@@ -18,6 +25,7 @@ import (
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jws/sign"
 	"github.com/lestrrat-go/jwx/jws/verify"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -186,6 +194,120 @@ func TestVerifyWithJWKSet(t *testing.T) {
 	}
 }
 
+// mixedKeySet creates a key set with n RSA keys, n EC keys, and a
+// symmetric key with which the returned message is signed, in that order
+func mixedKeySet(tb testing.TB, n int) (*jwk.Set, []byte) {
+	tb.Helper()
+
+	var set jwk.Set
+	add := func(raw interface{}, alg jwa.SignatureAlgorithm) {
+		key, err := jwk.New(raw)
+		if err != nil {
+			tb.Fatalf("jwk.New failed: %s", err)
+		}
+		if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+			tb.Fatalf("key.Set failed: %s", err)
+		}
+		set.Keys = append(set.Keys, key)
+	}
+
+	for i := 0; i < n; i++ {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			tb.Fatalf("rsa.GenerateKey failed: %s", err)
+		}
+		add(&rsaKey.PublicKey, jwa.RS256)
+	}
+	for i := 0; i < n; i++ {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			tb.Fatalf("ecdsa.GenerateKey failed: %s", err)
+		}
+		add(&ecKey.PublicKey, jwa.ES256)
+	}
+
+	secret := []byte("mixed-key-set-secret")
+	add(secret, jwa.HS256)
+
+	signed, err := jws.Sign([]byte("Hello, World!"), jwa.HS256, secret)
+	if err != nil {
+		tb.Fatalf("jws.Sign failed: %s", err)
+	}
+	return &set, signed
+}
+
+func TestVerifyWithJWKSetCompatibleKeys(t *testing.T) {
+	set, signed := mixedKeySet(t, 2)
+
+	var attempts int
+	acceptor := jws.JWKAcceptFunc(func(jwk.Key) bool {
+		attempts++
+		return true
+	})
+
+	var verifyErrors jws.VerifyErrors
+	_, err := jws.VerifyWithJWKSet(signed, set, acceptor, jws.WithCollectErrors(&verifyErrors))
+	if !assert.NoError(t, err, `jws.VerifyWithJWKSet should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 1, attempts, `only the HS256 key should have been tried`) {
+		return
+	}
+	if !assert.Len(t, verifyErrors.Errors, 4, `incompatible keys should be reported`) {
+		return
+	}
+	for _, err := range verifyErrors.Errors {
+		if !assert.Contains(t, err.Error(), `is not used by the message`, `error should mention the reason`) {
+			return
+		}
+	}
+
+	t.Run("Key type mismatch", func(t *testing.T) {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+			return
+		}
+		key, err := jwk.New(&rsaKey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		if !assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256), `key.Set should succeed`) {
+			return
+		}
+
+		var verifyErrors jws.VerifyErrors
+		_, err = jws.VerifyWithJWKSet(signed, &jwk.Set{Keys: []jwk.Key{key}}, nil, jws.WithCollectErrors(&verifyErrors))
+		if !assert.Error(t, err, `jws.VerifyWithJWKSet should fail`) {
+			return
+		}
+		if !assert.Len(t, verifyErrors.Errors, 1, `the key should be reported`) {
+			return
+		}
+		if !assert.Contains(t, verifyErrors.Errors[0].Error(), `"kty" (RSA) cannot be used with "alg" (HS256)`, `error should mention the key type`) {
+			return
+		}
+	})
+}
+
+func BenchmarkVerifyWithJWKSet(b *testing.B) {
+	set, signed := mixedKeySet(b, 32)
+
+	var attempts int
+	acceptor := jws.JWKAcceptFunc(func(jwk.Key) bool {
+		attempts++
+		return true
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jws.VerifyWithJWKSet(signed, set, acceptor); err != nil {
+			b.Fatalf("jws.VerifyWithJWKSet failed: %s", err)
+		}
+	}
+	b.ReportMetric(float64(attempts)/float64(b.N), "attempts/op")
+}
+
 func TestRoundtrip_RSACompact(t *testing.T) {
 	payload := []byte("Hello, World!")
 	for _, alg := range []jwa.SignatureAlgorithm{jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512} {
@@ -940,3 +1062,1406 @@ func TestGHIssue126(t *testing.T) {
 		return
 	}
 }
+
+func TestSignWithMessage(t *testing.T) {
+	key := []byte("secret")
+	payload := []byte("Hello, World!")
+
+	hdrs := jws.NewHeaders()
+	if !assert.NoError(t, hdrs.Set(jws.KeyIDKey, "helloworld01"), `hdrs.Set should succeed`) {
+		return
+	}
+
+	var msg jws.Message
+	signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithHeaders(hdrs), jws.WithMessage(&msg))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	if !assert.Equal(t, payload, msg.Payload(), `payloads should match`) {
+		return
+	}
+
+	if !assert.Len(t, msg.Signatures(), 1, `there should be exactly one signature`) {
+		return
+	}
+
+	sig := msg.Signatures()[0]
+	if !assert.Equal(t, "helloworld01", sig.ProtectedHeaders().KeyID(), `key ID should match`) {
+		return
+	}
+	if !assert.Equal(t, jwa.HS256, sig.ProtectedHeaders().Algorithm(), `algorithm should match`) {
+		return
+	}
+
+	_, _, encodedSignature, err := jws.SplitCompact(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.SplitCompact should succeed`) {
+		return
+	}
+	if !assert.Equal(t, string(encodedSignature), base64.RawURLEncoding.EncodeToString(sig.Signature()), `signatures should match`) {
+		return
+	}
+}
+
+func TestVerifyWithContext(t *testing.T) {
+	payload := []byte("Hello, World!")
+	key := []byte("secret")
+
+	buf, err := jws.Sign(payload, jwa.HS256, key)
+	if !assert.NoError(t, err, "Signature generated successfully") {
+		return
+	}
+
+	t.Run("Verify", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		verified, err := jws.Verify(buf, jwa.HS256, key, jws.WithVerifyContext(ctx))
+		if !assert.NoError(t, err, "Verify is successful") {
+			return
+		}
+		if !assert.Equal(t, payload, verified, "Verified payload is the same") {
+			return
+		}
+
+		cancel()
+		_, err = jws.Verify(buf, jwa.HS256, key, jws.WithVerifyContext(ctx))
+		if !assert.Error(t, err, "Verify with canceled context should fail") {
+			return
+		}
+		if !assert.Equal(t, context.Canceled, errors.Cause(err), "error should be context.Canceled") {
+			return
+		}
+	})
+	t.Run("VerifyWithJWKSet", func(t *testing.T) {
+		var set jwk.Set
+		for _, raw := range [][]byte{[]byte("wrong"), key} {
+			k, err := jwk.New(raw)
+			if !assert.NoError(t, err, "jwk.New should succeed") {
+				return
+			}
+			if !assert.NoError(t, k.Set(jwk.AlgorithmKey, jwa.HS256), "Algorithm set successfully") {
+				return
+			}
+			set.Keys = append(set.Keys, k)
+		}
+
+		// Cancel the context while iterating through the keys. The first
+		// key does not match, and the second key (which does) should not
+		// be tried because the context is canceled by then
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var attempts int
+		acceptor := jws.JWKAcceptFunc(func(jwk.Key) bool {
+			attempts++
+			if attempts > 1 {
+				cancel()
+			}
+			return true
+		})
+
+		_, err := jws.VerifyWithJWKSet(buf, &set, acceptor, jws.WithVerifyContext(ctx))
+		if !assert.Error(t, err, "Verify with canceled context should fail") {
+			return
+		}
+		if !assert.Equal(t, context.Canceled, errors.Cause(err), "error should be context.Canceled") {
+			return
+		}
+		if !assert.Equal(t, 2, attempts, "two keys should have been considered") {
+			return
+		}
+	})
+}
+
+func TestPayloadCanonicalization(t *testing.T) {
+	key := []byte("secret")
+	canonical := []byte(`{"aud":"bar","iss":"foo","nested":{"a":1,"b":[true,null]}}`)
+	reordered := []byte(`{ "nested": { "b": [ true, null ], "a": 1.0 }, "iss": "foo", "aud": "bar" }`)
+
+	// The partner signs over the canonical form, but sends the
+	// non-canonical form as the payload
+	signedCanonical, err := jws.Sign(canonical, jwa.HS256, key)
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+	protected, _, signature, err := jws.SplitCompact(bytes.NewReader(signedCanonical))
+	if !assert.NoError(t, err, `jws.SplitCompact should succeed`) {
+		return
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(reordered)
+	compact := []byte(string(protected) + "." + encodedPayload + "." + string(signature))
+
+	t.Run("Verify compact", func(t *testing.T) {
+		_, err := jws.Verify(compact, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.Verify without canonicalization should fail`) {
+			return
+		}
+
+		verified, err := jws.Verify(compact, jwa.HS256, key, jws.WithPayloadCanonicalization(jws.JCS))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, reordered, verified, `payload should be returned as is`) {
+			return
+		}
+	})
+	t.Run("Verify JSON", func(t *testing.T) {
+		buf, err := json.Marshal(map[string]interface{}{
+			"payload": encodedPayload,
+			"signatures": []map[string]string{
+				{
+					"protected": string(protected),
+					"signature": string(signature),
+				},
+			},
+		})
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		_, err = jws.Verify(buf, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.Verify without canonicalization should fail`) {
+			return
+		}
+
+		verified, err := jws.Verify(buf, jwa.HS256, key, jws.WithPayloadCanonicalization(jws.JCS))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, reordered, verified, `payload should be returned as is`) {
+			return
+		}
+	})
+	t.Run("Sign", func(t *testing.T) {
+		signed, err := jws.Sign(reordered, jwa.HS256, key, jws.WithPayloadCanonicalization(jws.JCS))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		if !assert.Equal(t, compact, signed, `message should contain the original payload and the signature over the canonical form`) {
+			return
+		}
+
+		verified, err := jws.Verify(signed, jwa.HS256, key, jws.WithPayloadCanonicalization(jws.JCS))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, reordered, verified, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Non-JSON payload", func(t *testing.T) {
+		payload := []byte("Hello, World!")
+		signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithPayloadCanonicalization(jws.JCS))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		verified, err := jws.Verify(signed, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+	})
+}
+
+func TestMessageSign(t *testing.T) {
+	payload := []byte("Hello, World!")
+	hmacKey := []byte("secret")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+
+	signer, err := sign.New(jwa.HS256)
+	if !assert.NoError(t, err, `sign.New should succeed`) {
+		return
+	}
+	signed, err := jws.SignMulti(payload, jws.WithSigner(signer, hmacKey, nil, nil))
+	if !assert.NoError(t, err, `jws.SignMulti should succeed`) {
+		return
+	}
+
+	m, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+
+	hdrs := jws.NewHeaders()
+	if !assert.NoError(t, hdrs.Set(jws.KeyIDKey, "cosigner"), `hdrs.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, m.Sign(jwa.ES256, ecKey, jws.WithHeaders(hdrs)), `m.Sign should succeed`) {
+		return
+	}
+	if !assert.Len(t, m.Signatures(), 2, `there should be two signatures`) {
+		return
+	}
+	if !assert.Len(t, m.LookupSignature("cosigner"), 1, `the new signature should be found by kid`) {
+		return
+	}
+
+	cosigned, err := json.Marshal(m)
+	if !assert.NoError(t, err, `json.Marshal should succeed`) {
+		return
+	}
+
+	verified, err := jws.Verify(cosigned, jwa.HS256, hmacKey)
+	if !assert.NoError(t, err, `jws.Verify with the original key should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, verified, `payloads should match`) {
+		return
+	}
+
+	verified, err = jws.Verify(cosigned, jwa.ES256, &ecKey.PublicKey)
+	if !assert.NoError(t, err, `jws.Verify with the new key should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, verified, `payloads should match`) {
+		return
+	}
+}
+
+func TestVerifyWithKeyFixedAlgorithm(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+	payload := []byte("Lorem ipsum")
+
+	toJSON := func(compact []byte) []byte {
+		parts := bytes.Split(compact, []byte{'.'})
+		return []byte(`{"payload":"` + string(parts[1]) + `","signatures":[{"protected":"` + string(parts[0]) + `","signature":"` + string(parts[2]) + `"}]}`)
+	}
+
+	t.Run("Matching header", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		for _, buf := range [][]byte{signed, toJSON(signed)} {
+			verified, err := jws.Verify(buf, "", nil, jws.WithKeyFixedAlgorithm(jwa.HS256, key))
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, verified, `payloads should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Forged header", func(t *testing.T) {
+		// The signature is valid for HS256, but the header claims HS512
+		signed, err := jws.SignLiteral(payload, jwa.HS256, key, []byte(`{"alg":"HS512"}`))
+		if !assert.NoError(t, err, `jws.SignLiteral should succeed`) {
+			return
+		}
+
+		for _, buf := range [][]byte{signed, toJSON(signed)} {
+			// Without the option, the header is not consulted at all
+			_, err = jws.Verify(buf, jwa.HS256, key)
+			if !assert.NoError(t, err, `jws.Verify without jws.WithKeyFixedAlgorithm should succeed`) {
+				return
+			}
+
+			_, err = jws.Verify(buf, jwa.HS256, key, jws.WithKeyFixedAlgorithm(jwa.HS256, key))
+			if !assert.Error(t, err, `jws.Verify should fail`) {
+				return
+			}
+		}
+	})
+	t.Run("Forged public header", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		parts := bytes.Split(signed, []byte{'.'})
+		buf := []byte(`{"payload":"` + string(parts[1]) + `","signatures":[{"protected":"` + string(parts[0]) + `","header":{"alg":"none"},"signature":"` + string(parts[2]) + `"}]}`)
+		_, err = jws.Verify(buf, "", nil, jws.WithKeyFixedAlgorithm(jwa.HS256, key))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyWithCollectErrors(t *testing.T) {
+	payload := []byte("Lorem ipsum")
+	signed, err := jws.Sign(payload, jwa.HS256, []byte("correct-secret"))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	newKey := func(t *testing.T, secret, kid string, alg jwa.SignatureAlgorithm, use string) jwk.Key {
+		key, err := jwk.New([]byte(secret))
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return nil
+		}
+		if !assert.NoError(t, key.Set(jwk.KeyIDKey, kid), `key.Set should succeed`) {
+			return nil
+		}
+		if alg != "" {
+			if !assert.NoError(t, key.Set(jwk.AlgorithmKey, alg), `key.Set should succeed`) {
+				return nil
+			}
+		}
+		if use != "" {
+			if !assert.NoError(t, key.Set(jwk.KeyUsageKey, use), `key.Set should succeed`) {
+				return nil
+			}
+		}
+		return key
+	}
+
+	var keyset jwk.Set
+	for _, key := range []jwk.Key{
+		newKey(t, "wrong-secret", "bad-signature", jwa.HS256, ""),
+		newKey(t, "correct-secret", "wrong-alg", jwa.HS512, ""),
+		newKey(t, "correct-secret", "wrong-use", jwa.HS256, "foo"),
+	} {
+		if key == nil {
+			return
+		}
+		keyset.Keys = append(keyset.Keys, key)
+	}
+
+	var verifyErrors jws.VerifyErrors
+	_, err = jws.VerifyWithJWKSet(signed, &keyset, nil, jws.WithCollectErrors(&verifyErrors))
+	if !assert.Error(t, err, `jws.VerifyWithJWKSet should fail`) {
+		return
+	}
+	if !assert.Equal(t, `failed to verify with any of the keys`, err.Error(), `returned error should be generic`) {
+		return
+	}
+
+	if !assert.Len(t, verifyErrors.Errors, 3, `there should be one error per key`) {
+		return
+	}
+	for i, kid := range []string{"bad-signature", "wrong-alg", "wrong-use"} {
+		if !assert.Contains(t, verifyErrors.Errors[i].Error(), kid, `error should mention the key ID`) {
+			return
+		}
+	}
+	if !assert.Contains(t, verifyErrors.Errors[2].Error(), `rejected by key acceptor`, `error should mention the reason`) {
+		return
+	}
+
+	t.Run("Multiple signatures", func(t *testing.T) {
+		parts := bytes.Split(signed, []byte{'.'})
+		buf := []byte(`{"payload":"` + string(parts[1]) + `","signatures":[{"protected":"` + string(parts[0]) + `","signature":"!!!"},{"protected":"` + string(parts[0]) + `","signature":"` + string(parts[2]) + `"}]}`)
+
+		var verifyErrors jws.VerifyErrors
+		_, err := jws.Verify(buf, jwa.HS256, []byte("wrong-secret"), jws.WithCollectErrors(&verifyErrors))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Len(t, verifyErrors.Errors, 2, `there should be one error per signature`) {
+			return
+		}
+		if !assert.Contains(t, verifyErrors.Errors[0].Error(), `failed to decode signature`, `error should mention the reason`) {
+			return
+		}
+	})
+}
+
+func TestChainSigner(t *testing.T) {
+	key := []byte("chained-log-secret")
+	records := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+
+	signer := jws.NewChainSigner(jwa.HS256, key)
+	var chain [][]byte
+	for _, record := range records {
+		signed, err := signer.Append(record)
+		if !assert.NoError(t, err, `signer.Append should succeed`) {
+			return
+		}
+		chain = append(chain, signed)
+	}
+
+	t.Run("Valid chain", func(t *testing.T) {
+		payloads, err := jws.VerifyChain(chain, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.VerifyChain should succeed`) {
+			return
+		}
+		if !assert.Equal(t, records, payloads, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Tampered middle record", func(t *testing.T) {
+		parts := bytes.Split(chain[1], []byte{'.'})
+		parts[1] = []byte(base64.RawURLEncoding.EncodeToString([]byte("tampered")))
+		tampered := [][]byte{chain[0], bytes.Join(parts, []byte{'.'}), chain[2]}
+
+		_, err := jws.VerifyChain(tampered, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.VerifyChain should fail`) {
+			return
+		}
+	})
+	t.Run("Re-signed middle record", func(t *testing.T) {
+		// Even with access to the key, replacing a record breaks the
+		// link from the record that follows it
+		hdr := jws.NewHeaders()
+		_, _, sig, err := jws.SplitCompact(bytes.NewReader(chain[0]))
+		if !assert.NoError(t, err, `jws.SplitCompact should succeed`) {
+			return
+		}
+		if !assert.NoError(t, hdr.Set(jws.PreviousSignatureKey, string(sig)), `hdr.Set should succeed`) {
+			return
+		}
+		replaced, err := jws.Sign([]byte("tampered"), jwa.HS256, key, jws.WithHeaders(hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		_, err = jws.VerifyChain([][]byte{chain[0], replaced, chain[2]}, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.VerifyChain should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `record #2`, `error should point at the record following the replaced one`) {
+			return
+		}
+	})
+	t.Run("Removed record", func(t *testing.T) {
+		_, err := jws.VerifyChain([][]byte{chain[0], chain[2]}, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.VerifyChain should fail`) {
+			return
+		}
+	})
+	t.Run("Truncated head", func(t *testing.T) {
+		_, err := jws.VerifyChain(chain[1:], jwa.HS256, key)
+		if !assert.Error(t, err, `jws.VerifyChain should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyRequireLowS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	half := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+	var signed []byte
+	for i := 0; i < 16; i++ {
+		signed, err = jws.Sign([]byte("Lorem ipsum"), jwa.ES256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		parts := bytes.Split(signed, []byte{'.'})
+		sig, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+		if !assert.NoError(t, err, `decoding signature should succeed`) {
+			return
+		}
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !assert.True(t, s.Cmp(half) <= 0, `jws.Sign should produce a low S value`) {
+			return
+		}
+	}
+
+	// Flip S to N - S, which is an equally valid signature
+	parts := bytes.Split(signed, []byte{'.'})
+	sig, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	if !assert.NoError(t, err, `decoding signature should succeed`) {
+		return
+	}
+	s := new(big.Int).SetBytes(sig[32:])
+	s.Sub(elliptic.P256().Params().N, s)
+	highS := make([]byte, 64)
+	copy(highS, sig[:32])
+	sBytes := s.Bytes()
+	copy(highS[64-len(sBytes):], sBytes)
+	parts[2] = []byte(base64.RawURLEncoding.EncodeToString(highS))
+	malleated := bytes.Join(parts, []byte{'.'})
+
+	t.Run("Without option", func(t *testing.T) {
+		_, err := jws.Verify(malleated, jwa.ES256, &key.PublicKey)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+	t.Run("High S rejected", func(t *testing.T) {
+		_, err := jws.Verify(malleated, jwa.ES256, &key.PublicKey, jws.WithRequireLowS(true))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Low S accepted", func(t *testing.T) {
+		_, err := jws.Verify(signed, jwa.ES256, &key.PublicKey, jws.WithRequireLowS(true))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+}
+
+func TestStreamVerifier(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+
+	payload := bytes.Repeat([]byte("Lorem ipsum dolor sit amet. "), 10000)
+
+	testcases := []struct {
+		alg       jwa.SignatureAlgorithm
+		signKey   interface{}
+		verifyKey interface{}
+	}{
+		{alg: jwa.HS256, signKey: []byte("stream-secret"), verifyKey: []byte("stream-secret")},
+		{alg: jwa.RS256, signKey: rsakey, verifyKey: &rsakey.PublicKey},
+		{alg: jwa.PS384, signKey: rsakey, verifyKey: &rsakey.PublicKey},
+		{alg: jwa.ES256, signKey: eckey, verifyKey: &eckey.PublicKey},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.alg.String(), func(t *testing.T) {
+			signed, err := jws.Sign(payload, tc.alg, tc.signKey)
+			if !assert.NoError(t, err, `jws.Sign should succeed`) {
+				return
+			}
+			protected, _, encodedSig, err := jws.SplitCompact(bytes.NewReader(signed))
+			if !assert.NoError(t, err, `jws.SplitCompact should succeed`) {
+				return
+			}
+			signature, err := base64.RawURLEncoding.DecodeString(string(encodedSig))
+			if !assert.NoError(t, err, `decoding signature should succeed`) {
+				return
+			}
+
+			// feed the payload in chunks that do not align with the
+			// base64 block size
+			feed := func(sv *jws.StreamVerifier, src []byte) error {
+				for len(src) > 0 {
+					n := 1000
+					if n > len(src) {
+						n = len(src)
+					}
+					if _, err := sv.Write(src[:n]); err != nil {
+						return err
+					}
+					src = src[n:]
+				}
+				return nil
+			}
+
+			t.Run("Valid payload", func(t *testing.T) {
+				sv, err := jws.NewVerifier(tc.alg, tc.verifyKey, protected)
+				if !assert.NoError(t, err, `jws.NewVerifier should succeed`) {
+					return
+				}
+				if !assert.NoError(t, feed(sv, payload), `writing the payload should succeed`) {
+					return
+				}
+				if !assert.NoError(t, sv.Finalize(signature), `Finalize should succeed`) {
+					return
+				}
+				if !assert.Error(t, sv.Finalize(signature), `second Finalize should fail`) {
+					return
+				}
+				_, err = sv.Write([]byte("trailing"))
+				if !assert.Error(t, err, `Write after Finalize should fail`) {
+					return
+				}
+			})
+			t.Run("Tampered payload", func(t *testing.T) {
+				sv, err := jws.NewVerifier(tc.alg, tc.verifyKey, protected)
+				if !assert.NoError(t, err, `jws.NewVerifier should succeed`) {
+					return
+				}
+				tampered := append([]byte{}, payload...)
+				tampered[len(tampered)/2] ^= 0x01
+				if !assert.NoError(t, feed(sv, tampered), `writing the payload should succeed`) {
+					return
+				}
+				if !assert.Error(t, sv.Finalize(signature), `Finalize should fail`) {
+					return
+				}
+			})
+		})
+	}
+}
+
+func TestPayloadDigestHeader(t *testing.T) {
+	key := []byte("digest-secret")
+	payload := []byte("content addressed payload")
+
+	signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithPayloadDigestHeader("digest", crypto.SHA256))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	m, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+	v, ok := m.Signatures()[0].ProtectedHeaders().Get("digest")
+	if !assert.True(t, ok, `"digest" header should exist`) {
+		return
+	}
+	expected := sha256.Sum256(payload)
+	if !assert.Equal(t, base64.RawURLEncoding.EncodeToString(expected[:]), v, `"digest" header should match`) {
+		return
+	}
+
+	t.Run("Matching digest", func(t *testing.T) {
+		verified, err := jws.Verify(signed, jwa.HS256, key, jws.WithPayloadDigestHeader("digest", crypto.SHA256))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Mismatched digest", func(t *testing.T) {
+		// The signature is valid, but the header was computed over a
+		// different payload
+		hdrs := jws.NewHeaders()
+		wrong := sha256.Sum256([]byte("something else"))
+		if !assert.NoError(t, hdrs.Set("digest", base64.RawURLEncoding.EncodeToString(wrong[:])), `hdrs.Set should succeed`) {
+			return
+		}
+		signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithHeaders(hdrs))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jwa.HS256, key, jws.WithPayloadDigestHeader("digest", crypto.SHA256))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Different hash", func(t *testing.T) {
+		_, err := jws.Verify(signed, jwa.HS256, key, jws.WithPayloadDigestHeader("digest", crypto.SHA512))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Missing header", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jwa.HS256, key, jws.WithPayloadDigestHeader("digest", crypto.SHA256))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestBase64Encoding(t *testing.T) {
+	key := []byte("interop-secret")
+	// chosen so that the standard encoding contains '+', '/', and padding
+	payload := []byte{0xfb, 0xff, 0xbf, 0x00}
+
+	signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithBase64Encoding(base64.StdEncoding))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	parts := bytes.Split(signed, []byte{'.'})
+	if !assert.Len(t, parts, 3, `message should have 3 segments`) {
+		return
+	}
+	if !assert.Equal(t, base64.StdEncoding.EncodeToString(payload), string(parts[1]), `payload should be encoded using standard base64`) {
+		return
+	}
+
+	t.Run("Verify", func(t *testing.T) {
+		verified, err := jws.Verify(signed, jwa.HS256, key, jws.WithBase64Encoding(base64.StdEncoding))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+
+		_, err = jws.Verify(signed, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.Verify without the option should fail`) {
+			return
+		}
+	})
+	t.Run("Parse", func(t *testing.T) {
+		m, err := jws.Parse(bytes.NewReader(signed), jws.WithBase64Encoding(base64.StdEncoding))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, m.Payload(), `payloads should match`) {
+			return
+		}
+		if !assert.Equal(t, jwa.HS256, m.Signatures()[0].ProtectedHeaders().Algorithm(), `"alg" should match`) {
+			return
+		}
+	})
+}
+
+func TestMessageSigningInput(t *testing.T) {
+	key := []byte("signing-input-secret")
+	signed, err := jws.Sign([]byte("Lorem ipsum"), jwa.HS256, key)
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	m, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		input, err := m.SigningInput(0)
+		if !assert.NoError(t, err, `SigningInput should succeed`) {
+			return
+		}
+		if !assert.Equal(t, string(signed[:bytes.LastIndexByte(signed, '.')]), string(input), `signing input should match`) {
+			return
+		}
+	})
+	t.Run("Invalid index", func(t *testing.T) {
+		_, err := m.SigningInput(1)
+		if !assert.Error(t, err, `SigningInput should fail`) {
+			return
+		}
+		_, err = m.SigningInput(-1)
+		if !assert.Error(t, err, `SigningInput should fail`) {
+			return
+		}
+	})
+}
+
+func TestUnencodedPayload(t *testing.T) {
+	key := []byte("unencoded-payload-secret")
+	payload := []byte(`{"hello": "world"}`)
+
+	var m jws.Message
+	signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithB64(false), jws.WithMessage(&m))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	parts := bytes.Split(signed, []byte{'.'})
+	if !assert.Len(t, parts, 3, `compact serialization should have 3 parts`) {
+		return
+	}
+	if !assert.Equal(t, payload, parts[1], `payload should be carried as is`) {
+		return
+	}
+
+	hdrbuf, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if !assert.NoError(t, err, `decoding protected header should succeed`) {
+		return
+	}
+	var hdr map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(hdrbuf, &hdr), `json.Unmarshal should succeed`) {
+		return
+	}
+	if !assert.Equal(t, false, hdr["b64"], `"b64" should be false`) {
+		return
+	}
+	if !assert.Equal(t, []interface{}{"b64"}, hdr["crit"], `"crit" should contain "b64"`) {
+		return
+	}
+
+	parsed, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, parsed.Payload(), `parsed payload should match`) {
+		return
+	}
+
+	verified, err := jws.Verify(signed, jwa.HS256, key)
+	if !assert.NoError(t, err, `jws.Verify should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, verified, `verified payload should match`) {
+		return
+	}
+
+	t.Run("Wrong key", func(t *testing.T) {
+		_, err := jws.Verify(signed, jwa.HS256, []byte("wrong-secret"))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("JSON serialization", func(t *testing.T) {
+		buf, err := json.Marshal(m)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		var raw struct {
+			Payload string `json:"payload"`
+		}
+		if !assert.NoError(t, json.Unmarshal(buf, &raw), `json.Unmarshal should succeed`) {
+			return
+		}
+		if !assert.Equal(t, string(payload), raw.Payload, `payload should be carried as is`) {
+			return
+		}
+
+		parsed, err := jws.Parse(bytes.NewReader(buf))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, parsed.Payload(), `parsed payload should match`) {
+			return
+		}
+
+		verified, err := jws.Verify(buf, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `verified payload should match`) {
+			return
+		}
+	})
+	t.Run("Detached", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithB64(false), jws.WithDetached())
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		verified, err := jws.Verify(signed, jwa.HS256, key, jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `verified payload should match`) {
+			return
+		}
+	})
+	t.Run("b64 not in crit", func(t *testing.T) {
+		signed, err := jws.SignLiteral(payload, jwa.HS256, key, []byte(`{"alg":"HS256","b64":false}`))
+		if !assert.NoError(t, err, `jws.SignLiteral should succeed`) {
+			return
+		}
+		_, err = jws.Parse(bytes.NewReader(signed))
+		if !assert.Error(t, err, `jws.Parse should fail`) {
+			return
+		}
+		_, err = jws.Verify(signed, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("SigningInput", func(t *testing.T) {
+		input, err := m.SigningInput(0)
+		if !assert.NoError(t, err, `SigningInput should succeed`) {
+			return
+		}
+		if !assert.Equal(t, string(signed[:bytes.LastIndexByte(signed, '.')]), string(input), `signing input should match`) {
+			return
+		}
+	})
+	t.Run("Existing crit", func(t *testing.T) {
+		hdrs := jws.NewHeaders()
+		if !assert.NoError(t, hdrs.Set("exp", 1600000000), `hdrs.Set should succeed`) {
+			return
+		}
+		if !assert.NoError(t, hdrs.SetCritical([]string{"exp"}), `hdrs.SetCritical should succeed`) {
+			return
+		}
+		if _, err := jws.Sign(payload, jwa.HS256, key, jws.WithB64(false), jws.WithHeaders(hdrs)); !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []string{"exp", "b64"}, hdrs.Critical(), `"b64" should be appended to "crit"`) {
+			return
+		}
+	})
+	t.Run("Payload with '.'", func(t *testing.T) {
+		_, err := jws.Sign([]byte("$.02"), jwa.HS256, key, jws.WithB64(false))
+		if !assert.Error(t, err, `jws.Sign should fail`) {
+			return
+		}
+	})
+	t.Run("Co-signing encoded payload", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		m, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.Error(t, m.Sign(jwa.HS256, key, jws.WithB64(false)), `m.Sign should fail`) {
+			return
+		}
+	})
+}
+
+func TestDetachedPayload(t *testing.T) {
+	key := []byte("detached-payload-secret")
+	payload := []byte("Lorem ipsum")
+
+	signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithDetached())
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+	parts := bytes.Split(signed, []byte{'.'})
+	if !assert.Len(t, parts, 3, `compact serialization should have 3 parts`) {
+		return
+	}
+	if !assert.Empty(t, parts[1], `payload segment should be empty`) {
+		return
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		verified, err := jws.Verify(signed, jwa.HS256, key, jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+
+		_, err = jws.Verify(signed, jwa.HS256, key, jws.WithDetachedPayload([]byte("Lorem ipsum dolor")))
+		if !assert.Error(t, err, `jws.Verify with the wrong payload should fail`) {
+			return
+		}
+		_, err = jws.Verify(signed, jwa.HS256, key)
+		if !assert.Error(t, err, `jws.Verify without the payload should fail`) {
+			return
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		buf, err := json.Marshal(map[string]interface{}{
+			"protected": string(parts[0]),
+			"header":    map[string]interface{}{},
+			"signature": string(parts[2]),
+		})
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		verified, err := jws.Verify(buf, jwa.HS256, key, jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Attached payload", func(t *testing.T) {
+		attached, err := jws.Sign(payload, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(attached, jwa.HS256, key, jws.WithDetachedPayload(payload))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyWithKeyProvider(t *testing.T) {
+	payload := []byte("Lorem ipsum")
+	keys := map[string][]byte{
+		"tenant-a": []byte("tenant-a-secret"),
+		"tenant-b": []byte("tenant-b-secret"),
+	}
+
+	provider := jws.KeyProviderFunc(func(_ context.Context, sink jws.KeySink, sig *jws.Signature, _ *jws.Message) error {
+		kid := sig.ProtectedHeaders().KeyID()
+		key, ok := keys[kid]
+		if !ok {
+			return errors.Errorf(`unknown key ID %q`, kid)
+		}
+		sink.Key(jwa.HS256, key)
+		return nil
+	})
+
+	sign := func(t *testing.T, kid string, key []byte) []byte {
+		t.Helper()
+		signed, err := jws.SignLiteral(payload, jwa.HS256, key, []byte(`{"alg":"HS256","kid":"`+kid+`"}`))
+		if !assert.NoError(t, err, `jws.SignLiteral should succeed`) {
+			return nil
+		}
+		return signed
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		for kid, key := range keys {
+			signed := sign(t, kid, key)
+			if signed == nil {
+				return
+			}
+			verified, err := jws.Verify(signed, "", nil, jws.WithKeyProvider(provider))
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, verified, `payloads should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Unknown key ID", func(t *testing.T) {
+		signed := sign(t, "tenant-c", []byte("tenant-c-secret"))
+		if signed == nil {
+			return
+		}
+		_, err := jws.Verify(signed, "", nil, jws.WithKeyProvider(provider))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Wrong key", func(t *testing.T) {
+		// claims to be tenant-a, but is signed by somebody else
+		signed := sign(t, "tenant-a", keys["tenant-b"])
+		if signed == nil {
+			return
+		}
+		_, err := jws.Verify(signed, "", nil, jws.WithKeyProvider(provider))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Multiple signatures", func(t *testing.T) {
+		unknown := bytes.Split(sign(t, "tenant-c", []byte("tenant-c-secret")), []byte{'.'})
+		known := bytes.Split(sign(t, "tenant-b", keys["tenant-b"]), []byte{'.'})
+		buf := []byte(`{"payload":"` + string(known[1]) + `","signatures":[{"protected":"` + string(unknown[0]) + `","signature":"` + string(unknown[2]) + `"},{"protected":"` + string(known[0]) + `","signature":"` + string(known[2]) + `"}]}`)
+
+		var verifyErrors jws.VerifyErrors
+		verified, err := jws.Verify(buf, "", nil, jws.WithKeyProvider(provider), jws.WithCollectErrors(&verifyErrors))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+		if !assert.Len(t, verifyErrors.Errors, 1, `the first signature should have failed`) {
+			return
+		}
+		if !assert.Contains(t, verifyErrors.Errors[0].Error(), `tenant-c`, `error should come from the key provider`) {
+			return
+		}
+	})
+	t.Run("Context deadline", func(t *testing.T) {
+		signed := sign(t, "tenant-a", keys["tenant-a"])
+		if signed == nil {
+			return
+		}
+
+		slow := jws.KeyProviderFunc(func(ctx context.Context, _ jws.KeySink, _ *jws.Signature, _ *jws.Message) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := jws.Verify(signed, "", nil, jws.WithKeyProvider(slow), jws.WithVerifyContext(ctx))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Equal(t, context.DeadlineExceeded, errors.Cause(err), `error should be context.DeadlineExceeded`) {
+			return
+		}
+	})
+	t.Run("With WithKeyFixedAlgorithm", func(t *testing.T) {
+		signed := sign(t, "tenant-a", keys["tenant-a"])
+		if signed == nil {
+			return
+		}
+		_, err := jws.Verify(signed, "", nil, jws.WithKeyProvider(provider), jws.WithKeyFixedAlgorithm(jwa.HS256, keys["tenant-a"]))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestParsePreserveHeaderOrder(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+	const header = `{"typ":"JWT","x-custom":"foo","kid":"my-key","alg":"HS256"}`
+	signed, err := jws.SignLiteral([]byte("Lorem ipsum"), jwa.HS256, key, []byte(header))
+	if !assert.NoError(t, err, `jws.SignLiteral should succeed`) {
+		return
+	}
+
+	t.Run("Compact", func(t *testing.T) {
+		msg, err := jws.Parse(bytes.NewReader(signed), jws.WithPreserveHeaderOrder(true))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		hdrs := msg.Signatures()[0].ProtectedHeaders()
+		buf, err := json.Marshal(hdrs)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.Equal(t, header, string(buf), `headers should be marshaled in the original order`) {
+			return
+		}
+
+		if !assert.NoError(t, hdrs.Set(jws.ContentTypeKey, "example"), `hdrs.Set should succeed`) {
+			return
+		}
+		buf, err = json.Marshal(hdrs)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.Equal(t, `{"typ":"JWT","x-custom":"foo","kid":"my-key","alg":"HS256","cty":"example"}`, string(buf), `new headers should come last`) {
+			return
+		}
+	})
+	t.Run("Without option", func(t *testing.T) {
+		msg, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		buf, err := json.Marshal(msg.Signatures()[0].ProtectedHeaders())
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.NotEqual(t, header, string(buf), `headers should be marshaled in the canonical order`) {
+			return
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		parts := bytes.Split(signed, []byte{'.'})
+		const public = `{"x-trace":"abc","kid":"my-key"}`
+		buf := []byte(`{"payload":"` + string(parts[1]) + `","signatures":[{"protected":"` + string(parts[0]) + `","header":` + public + `,"signature":"` + string(parts[2]) + `"}]}`)
+
+		msg, err := jws.Parse(bytes.NewReader(buf), jws.WithPreserveHeaderOrder(true))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		sig := msg.Signatures()[0]
+		for expected, hdrs := range map[string]jws.Headers{header: sig.ProtectedHeaders(), public: sig.PublicHeaders()} {
+			marshaled, err := json.Marshal(hdrs)
+			if !assert.NoError(t, err, `json.Marshal should succeed`) {
+				return
+			}
+			if !assert.Equal(t, expected, string(marshaled), `headers should be marshaled in the original order`) {
+				return
+			}
+		}
+	})
+	t.Run("Header names that need escaping", func(t *testing.T) {
+		const header = `{"typ":"JWT","x-\u007f":"foo","x-\u00fc\"":"bar","alg":"HS256"}`
+		signed, err := jws.SignLiteral([]byte("Lorem ipsum"), jwa.HS256, key, []byte(header))
+		if !assert.NoError(t, err, `jws.SignLiteral should succeed`) {
+			return
+		}
+		msg, err := jws.Parse(bytes.NewReader(signed), jws.WithPreserveHeaderOrder(true))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		buf, err := json.Marshal(msg.Signatures()[0].ProtectedHeaders())
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "{\"typ\":\"JWT\",\"x-\x7f\":\"foo\",\"x-\u00fc\\\"\":\"bar\",\"alg\":\"HS256\"}", string(buf), `headers should be marshaled as valid JSON in the original order`) {
+			return
+		}
+	})
+}
+
+func TestVerifyX509CertChain(t *testing.T) {
+	now := time.Now()
+	payload := []byte("Lorem ipsum")
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if !assert.NoError(t, err, `x509.ParseCertificate should succeed`) {
+		return
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if !assert.NoError(t, err, `x509.CreateCertificate should succeed`) {
+		return
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	// x5c uses standard base64 (with padding), not base64url
+	chain := []string{
+		base64.StdEncoding.EncodeToString(leafDER),
+		base64.StdEncoding.EncodeToString(caDER),
+	}
+
+	sign := func(t *testing.T, key interface{}, chain []string) []byte {
+		t.Helper()
+		hdr := jws.NewHeaders()
+		if chain != nil {
+			if !assert.NoError(t, hdr.Set(jws.X509CertChainKey, chain), `hdr.Set should succeed`) {
+				return nil
+			}
+		}
+		signed, err := jws.Sign(payload, jwa.ES256, key, jws.WithHeaders(hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return nil
+		}
+		return signed
+	}
+
+	t.Run("Trusted chain", func(t *testing.T) {
+		signed := sign(t, leafKey, chain)
+		if signed == nil {
+			return
+		}
+		verified, err := jws.Verify(signed, "", nil, jws.WithX509CertChainVerification(roots))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payloads should match`) {
+			return
+		}
+	})
+	t.Run("Untrusted chain", func(t *testing.T) {
+		signed := sign(t, leafKey, chain)
+		if signed == nil {
+			return
+		}
+		_, err := jws.Verify(signed, "", nil, jws.WithX509CertChainVerification(x509.NewCertPool()))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Signed by another key", func(t *testing.T) {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return
+		}
+		signed := sign(t, otherKey, chain)
+		if signed == nil {
+			return
+		}
+		_, err = jws.Verify(signed, "", nil, jws.WithX509CertChainVerification(roots))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Missing x5c", func(t *testing.T) {
+		signed := sign(t, leafKey, nil)
+		if signed == nil {
+			return
+		}
+		_, err := jws.Verify(signed, "", nil, jws.WithX509CertChainVerification(roots))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyDecodePayload(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+	type claims struct {
+		Name  string `json:"name"`
+		Admin bool   `json:"admin"`
+	}
+
+	sign := func(t *testing.T, cty string, payload []byte) []byte {
+		t.Helper()
+		hdr := jws.NewHeaders()
+		if cty != "" {
+			if !assert.NoError(t, hdr.Set(jws.ContentTypeKey, cty), `hdr.Set should succeed`) {
+				return nil
+			}
+		}
+		signed, err := jws.Sign(payload, jwa.HS256, key, jws.WithHeaders(hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return nil
+		}
+		return signed
+	}
+
+	t.Run("JSON payload", func(t *testing.T) {
+		for _, cty := range []string{"JSON", "application/json", "application/example+json; charset=utf-8"} {
+			signed := sign(t, cty, []byte(`{"name":"John Doe","admin":true}`))
+			if signed == nil {
+				return
+			}
+
+			var c claims
+			if _, err := jws.Verify(signed, jwa.HS256, key, jws.WithDecodePayload(&c)); !assert.NoError(t, err, `jws.Verify should succeed (cty = %s)`, cty) {
+				return
+			}
+			if !assert.Equal(t, claims{Name: "John Doe", Admin: true}, c, `decoded payload should match (cty = %s)`, cty) {
+				return
+			}
+		}
+	})
+	t.Run("JSON serialization", func(t *testing.T) {
+		signed := sign(t, "JSON", []byte(`{"name":"John Doe"}`))
+		if signed == nil {
+			return
+		}
+		m, err := jws.Parse(bytes.NewReader(signed))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		buf, err := json.Marshal(m)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		var c claims
+		if _, err := jws.Verify(buf, jwa.HS256, key, jws.WithDecodePayload(&c)); !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "John Doe", c.Name, `decoded payload should match`) {
+			return
+		}
+	})
+	t.Run("Non-JSON payload", func(t *testing.T) {
+		for _, cty := range []string{"", "text/plain"} {
+			signed := sign(t, cty, []byte(`Lorem ipsum`))
+			if signed == nil {
+				return
+			}
+
+			var c claims
+			payload, err := jws.Verify(signed, jwa.HS256, key, jws.WithDecodePayload(&c))
+			if !assert.NoError(t, err, `jws.Verify should succeed (cty = %q)`, cty) {
+				return
+			}
+			if !assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`) {
+				return
+			}
+			if !assert.Equal(t, claims{}, c, `target should be untouched`) {
+				return
+			}
+
+			_, err = jws.Verify(signed, jwa.HS256, key, jws.WithDecodePayload(&c), jws.WithRequireJSONPayload(true))
+			if !assert.Error(t, err, `jws.Verify should fail (cty = %q)`, cty) {
+				return
+			}
+		}
+	})
+	t.Run("Malformed JSON payload", func(t *testing.T) {
+		signed := sign(t, "JSON", []byte(`{"name":`))
+		if signed == nil {
+			return
+		}
+		var c claims
+		if _, err := jws.Verify(signed, jwa.HS256, key, jws.WithDecodePayload(&c)); !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
@@ -1,5 +1,15 @@
 package jws
 
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/lestrrat-go/jwx/internal/pool"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws/sign"
+	"github.com/pkg/errors"
+)
+
 func (s Signature) PublicHeaders() Headers {
 	return s.headers
 }
@@ -20,6 +30,42 @@ func (m Message) Signatures() []*Signature {
 	return m.signatures
 }
 
+// SigningInput returns the bytes that were signed to produce the
+// signature at index `idx`, that is, the encoded protected header and the
+// encoded payload joined by a '.'. This is meant for troubleshooting
+// signatures that fail to verify.
+//
+// The protected header is used exactly as it appeared in the parsed
+// message. If the protected header contains `"b64": false` (RFC7797),
+// the payload is used as is instead of being base64url encoded. For
+// messages with a detached payload, the payload part is empty unless
+// the payload has been attached to the message.
+func (m Message) SigningInput(idx int) ([]byte, error) {
+	if idx < 0 || idx >= len(m.signatures) {
+		return nil, errors.Errorf(`invalid signature index %d (message has %d signatures)`, idx, len(m.signatures))
+	}
+	sig := m.signatures[idx]
+
+	encodedProtected := sig.encodedProtected
+	if encodedProtected == "" && sig.protected != nil {
+		hdrbuf, err := json.Marshal(sig.protected)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to marshal protected header`)
+		}
+		encodedProtected = base64.RawURLEncoding.EncodeToString(hdrbuf)
+	}
+
+	var buf []byte
+	buf = append(buf, encodedProtected...)
+	buf = append(buf, '.')
+	if !isUnencodedPayload(sig.protected) {
+		buf = append(buf, base64.RawURLEncoding.EncodeToString(m.payload)...)
+	} else {
+		buf = append(buf, m.payload...)
+	}
+	return buf, nil
+}
+
 // LookupSignature looks up a particular signature entry using
 // the `kid` value
 func (m Message) LookupSignature(kid string) []*Signature {
@@ -43,3 +89,108 @@ func (m Message) LookupSignature(kid string) []*Signature {
 	}
 	return sigs
 }
+
+// Sign appends a new signature over the message's payload, using the
+// given algorithm and key. The protected header of the new signature
+// contains the "alg" header. If you would like to include other headers
+// in the protected header, use the WithHeaders option.
+//
+// The existing signatures are left untouched, so this can be used to
+// co-sign a message that has already been parsed. Use json.Marshal to
+// obtain the message in general JSON serialization format.
+//
+// If you would like the payload to be carried without being base64url
+// encoded (RFC7797), use the WithB64 option. All signatures of a message
+// must agree on whether the payload is encoded.
+func (m *Message) Sign(alg jwa.SignatureAlgorithm, key interface{}, options ...Option) error {
+	var hdrs Headers = NewHeaders()
+	encodePayload := true
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyB64:
+			encodePayload = o.Value().(bool)
+		case optkeyHeaders:
+			hdrs = o.Value().(Headers)
+		}
+	}
+
+	for i, sig := range m.signatures {
+		if isUnencodedPayload(sig.protected) == encodePayload {
+			return errors.Errorf(`signature #%d does not agree on whether the payload is encoded`, i+1)
+		}
+	}
+
+	signer, err := sign.New(alg)
+	if err != nil {
+		return errors.Wrap(err, `failed to create signer`)
+	}
+
+	key, err = signingKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := hdrs.Set(AlgorithmKey, signer.Algorithm()); err != nil {
+		return errors.Wrap(err, `failed to set header`)
+	}
+	if !encodePayload {
+		if err := setUnencodedPayloadHeaders(hdrs); err != nil {
+			return err
+		}
+	}
+
+	hdrbuf, err := json.Marshal(hdrs)
+	if err != nil {
+		return errors.Wrap(err, `failed to marshal headers`)
+	}
+	encodedProtected := base64.RawURLEncoding.EncodeToString(hdrbuf)
+
+	buf := pool.GetBytesBuffer()
+	defer pool.ReleaseBytesBuffer(buf)
+	buf.WriteString(encodedProtected)
+	buf.WriteByte('.')
+	if err := writePayload(buf, base64.RawURLEncoding, encodePayload, m.payload); err != nil {
+		return err
+	}
+
+	signature, err := signer.Sign(buf.Bytes(), key)
+	if err != nil {
+		return errors.Wrap(err, `failed to sign payload`)
+	}
+
+	m.signatures = append(m.signatures, &Signature{
+		protected:        hdrs,
+		signature:        signature,
+		encodedProtected: encodedProtected,
+	})
+	return nil
+}
+
+// MarshalJSON serializes the message in general JSON serialization format.
+// If the protected header specifies `"b64": false`, the payload is
+// emitted as is.
+func (m Message) MarshalJSON() ([]byte, error) {
+	var proxy encodedMessage
+	if len(m.signatures) > 0 && isUnencodedPayload(m.signatures[0].protected) {
+		proxy.Payload = string(m.payload)
+	} else {
+		proxy.Payload = base64.RawURLEncoding.EncodeToString(m.payload)
+	}
+	for i, sig := range m.signatures {
+		encodedProtected := sig.encodedProtected
+		if encodedProtected == "" && sig.protected != nil {
+			hdrbuf, err := json.Marshal(sig.protected)
+			if err != nil {
+				return nil, errors.Wrapf(err, `failed to marshal protected header for signature #%d`, i+1)
+			}
+			encodedProtected = base64.RawURLEncoding.EncodeToString(hdrbuf)
+		}
+
+		proxy.Signatures = append(proxy.Signatures, &encodedSignature{
+			Headers:   sig.headers,
+			Protected: encodedProtected,
+			Signature: base64.RawURLEncoding.EncodeToString(sig.signature),
+		})
+	}
+	return json.Marshal(proxy)
+}
@@ -1,7 +1,13 @@
 package jws
 
 import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+
 	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jws/sign"
 )
 
@@ -10,6 +16,22 @@ type Option = option.Interface
 const (
 	optkeyPayloadSigner = `payload-signer`
 	optkeyHeaders       = `headers`
+	optkeyMessage       = `message`
+	optkeyVerifyContext = `verify-context`
+
+	optkeyPayloadCanonicalization = `payload-canonicalization`
+	optkeyKeyFixedAlgorithm       = `key-fixed-algorithm`
+	optkeyCollectErrors           = `collect-errors`
+	optkeyRequireLowS             = `require-low-s`
+	optkeyPayloadDigestHeader     = `payload-digest-header`
+	optkeyBase64Encoding          = `base64-encoding`
+	optkeyB64                     = `b64`
+	optkeyDetached                = `detached`
+	optkeyDetachedPayload         = `detached-payload`
+	optkeyKeyProvider             = `key-provider`
+	optkeyPreserveHeaderOrder     = `preserve-header-order`
+	optkeyDecodePayload           = `decode-payload`
+	optkeyRequireJSONPayload      = `require-json-payload`
 )
 
 func WithSigner(signer sign.Signer, key interface{}, public, protected Headers) Option {
@@ -24,3 +46,195 @@ func WithSigner(signer sign.Signer, key interface{}, public, protected Headers)
 func WithHeaders(h Headers) Option {
 	return option.New(optkeyHeaders, h)
 }
+
+// WithMessage specifies a Message object to be populated by Sign.
+// Upon successful signing, the given Message will contain the payload
+// and the signature (along with its protected headers) that was used
+// to generate the compact serialization, so that you do not need to
+// parse the result again.
+func WithMessage(m *Message) Option {
+	return option.New(optkeyMessage, m)
+}
+
+// WithVerifyContext specifies the context.Context to be used while
+// verifying messages. The context is checked before each expensive
+// signature verification operation, as well as between each attempt
+// when multiple signatures or keys are tried, and verification is
+// aborted once the context is canceled or its deadline is exceeded.
+func WithVerifyContext(ctx context.Context) Option {
+	return option.New(optkeyVerifyContext, ctx)
+}
+
+// WithPayloadCanonicalization specifies that the payload should be
+// canonicalized using the given scheme before the signing input is
+// computed. It can be passed to `jws.Sign` and `jws.Verify`.
+//
+// If the payload is not a valid JSON document, the payload is used as is.
+// The serialized message still contains the payload as it was given,
+// only the signature is computed over the canonical form.
+//
+// Note that this deviates from standard JWS (RFC7515), where the signing
+// input is always computed over the payload as it appears in the message.
+// Messages signed this way can only be verified by parties who have
+// agreed to apply the same canonicalization.
+func WithPayloadCanonicalization(c PayloadCanonicalization) Option {
+	return option.New(optkeyPayloadCanonicalization, c)
+}
+
+type fixedAlgorithmKey struct {
+	alg jwa.SignatureAlgorithm
+	key interface{}
+}
+
+// WithKeyFixedAlgorithm specifies that `jws.Verify` must verify the
+// message using `alg` and `key`, where the algorithm is fixed by the key
+// (or by your policy) instead of being chosen from the message. When this
+// option is given, the `alg` and `key` arguments to `jws.Verify` are ignored.
+//
+// In addition, the "alg" header of each signature must be equal to `alg`,
+// otherwise the signature is rejected without being verified. This is
+// stricter than merely verifying with a fixed algorithm, and guards
+// against algorithm confusion attacks where the header is forged.
+func WithKeyFixedAlgorithm(alg jwa.SignatureAlgorithm, key interface{}) Option {
+	return option.New(optkeyKeyFixedAlgorithm, &fixedAlgorithmKey{
+		alg: alg,
+		key: key,
+	})
+}
+
+// WithCollectErrors specifies that `jws.Verify` and `jws.VerifyWithJWKSet`
+// should record why each signature or key failed to verify the message
+// in `errs`. The returned error remains a generic one.
+//
+// Do not expose the collected errors to untrusted parties, as they may
+// reveal information about your keys and your configuration.
+func WithCollectErrors(errs *VerifyErrors) Option {
+	return option.New(optkeyCollectErrors, errs)
+}
+
+// WithRequireLowS specifies whether `jws.Verify` should reject ECDSA
+// signatures whose S value is greater than half of the curve order.
+// For any valid signature (R, S), (R, N-S) is also valid, so accepting
+// both makes the signature bytes malleable. Enable this when the
+// signature is used to identify the message. `jws.Sign` always
+// produces signatures with a low S value.
+func WithRequireLowS(b bool) Option {
+	return option.New(optkeyRequireLowS, b)
+}
+
+// WithDecodePayload specifies that `jws.Verify` should unmarshal the
+// payload into `v` (which must be a pointer) once the message has been
+// verified, if the "cty" header of the verified signature indicates JSON
+// ("JSON", "application/json", or any "+json" media type). If "cty" is
+// absent or indicates some other content type, `v` is left untouched,
+// unless WithRequireJSONPayload is specified.
+func WithDecodePayload(v interface{}) Option {
+	return option.New(optkeyDecodePayload, v)
+}
+
+// WithRequireJSONPayload specifies whether `jws.Verify` should fail when
+// WithDecodePayload is given, but the "cty" header of the verified
+// signature does not indicate JSON.
+func WithRequireJSONPayload(b bool) Option {
+	return option.New(optkeyRequireJSONPayload, b)
+}
+
+type payloadDigest struct {
+	name string
+	hash crypto.Hash
+}
+
+// WithPayloadDigestHeader specifies that the protected header member
+// `name` holds the digest of the payload computed using `hash`, encoded
+// in base64url. This explicitly binds the header to the payload, which
+// is useful for content-addressable storage.
+//
+// When passed to `jws.Sign`, the digest is computed and inserted into
+// the protected header before signing. When passed to `jws.Verify`, the
+// digest is recomputed over the payload, and the message is rejected if
+// the header is missing or does not match.
+//
+// The digest is always computed over the payload as it appears in the
+// message, even when WithPayloadCanonicalization is specified.
+func WithPayloadDigestHeader(name string, hash crypto.Hash) Option {
+	return option.New(optkeyPayloadDigestHeader, &payloadDigest{
+		name: name,
+		hash: hash,
+	})
+}
+
+// WithBase64Encoding specifies the encoding of the segments of the
+// message, that is, the protected header, the payload, and the signature.
+// It can be passed to `jws.Sign`, `jws.Verify`, and `jws.Parse`. The
+// signing input is computed over the segments as they appear in the
+// message, encoded using `enc`.
+//
+// This option is only meant for interoperating with implementations that
+// do not follow RFC7515, for example ones that use standard base64 with
+// padding. By default base64url without padding is used, as RFC7515
+// requires, and you should not use this option otherwise.
+func WithBase64Encoding(enc *base64.Encoding) Option {
+	return option.New(optkeyBase64Encoding, enc)
+}
+
+// WithB64 specifies whether the payload should be base64url encoded when
+// signing with `jws.Sign` or `(*jws.Message).Sign`. When `b` is false,
+// the payload is carried and signed as is, as described in RFC7797, and
+// the protected header contains `"b64": false`, with "b64" added to its
+// "crit" header.
+//
+// As the compact serialization cannot contain a payload that includes
+// a '.', `jws.Sign` fails for such payloads. Use `(*jws.Message).Sign`
+// and json.Marshal to create a JSON serialization instead.
+func WithB64(b bool) Option {
+	return option.New(optkeyB64, b)
+}
+
+// WithDetached specifies that `jws.Sign` should produce a message with a
+// detached payload, as described in RFC7515 Appendix F. The signature is
+// computed over the payload as usual, but the payload segment is left
+// empty (`header..signature`), and must be conveyed to the verifier by
+// other means. Use WithDetachedPayload to verify such messages.
+func WithDetached() Option {
+	return option.New(optkeyDetached, true)
+}
+
+// WithDetachedPayload specifies the payload of a message with a detached
+// payload for `jws.Verify`. The payload segment of the message must be
+// empty. `payload` is the raw payload, not its base64url encoding.
+func WithDetachedPayload(payload []byte) Option {
+	return option.New(optkeyDetachedPayload, payload)
+}
+
+// WithKeyProvider specifies that `jws.Verify` should ask `p` for the keys
+// to verify each signature with, instead of using a single key. When this
+// option is given, the `alg` and `key` arguments to `jws.Verify` are
+// ignored, and the algorithm of each key is the one given to the KeySink.
+//
+// This option cannot be combined with WithKeyFixedAlgorithm.
+func WithKeyProvider(p KeyProvider) Option {
+	return option.New(optkeyKeyProvider, p)
+}
+
+// WithX509CertChainVerification specifies that `jws.Verify` should
+// verify each signature with the public key of the leaf certificate in
+// the "x5c" member of its protected header, after verifying the chain
+// against the roots in `roots` (the system roots if nil). The algorithm
+// is taken from the "alg" member of the protected header. Signatures
+// that carry "x5c" only in their public header are rejected.
+//
+// This option is implemented as a KeyProvider: it replaces any
+// previously given WithKeyProvider option (and vice versa), and cannot
+// be combined with WithKeyFixedAlgorithm.
+func WithX509CertChainVerification(roots *x509.CertPool) Option {
+	return WithKeyProvider(&x5cKeyProvider{roots: roots})
+}
+
+// WithPreserveHeaderOrder specifies whether `jws.Parse` should record the
+// order of the members of the protected and public headers of each
+// signature, so that marshaling the headers again (for example, to sign
+// a new message with them) emits the members in the same order. Members
+// added after parsing are emitted after the original ones.
+func WithPreserveHeaderOrder(b bool) Option {
+	return option.New(optkeyPreserveHeaderOrder, b)
+}
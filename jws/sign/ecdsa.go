@@ -4,6 +4,8 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
+	"encoding/asn1"
+	"math/big"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
@@ -12,20 +14,19 @@ import (
 var ecdsaSignFuncs = map[jwa.SignatureAlgorithm]ecdsaSignFunc{}
 
 func init() {
-	algs := map[jwa.SignatureAlgorithm]crypto.Hash{
-		jwa.ES256: crypto.SHA256,
-		jwa.ES384: crypto.SHA384,
-		jwa.ES512: crypto.SHA512,
-	}
-
-	for alg, h := range algs {
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256, jwa.ES384, jwa.ES512} {
+		h, _ := jwa.HashForSignatureAlgorithm(alg)
 		ecdsaSignFuncs[alg] = makeECDSASignFunc(h)
 	}
 }
 
 func makeECDSASignFunc(hash crypto.Hash) ecdsaSignFunc {
-	return func(payload []byte, key *ecdsa.PrivateKey) ([]byte, error) {
-		curveBits := key.Curve.Params().BitSize
+	return func(payload []byte, key crypto.Signer) ([]byte, error) {
+		pubkey, ok := key.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf(`invalid crypto.Signer public key type %T. *ecdsa.PublicKey is required`, key.Public())
+		}
+		curveBits := pubkey.Curve.Params().BitSize
 		keyBytes := curveBits / 8
 		// Curve bits do not need to be a multiple of 8.
 		if curveBits%8 > 0 {
@@ -35,9 +36,35 @@ func makeECDSASignFunc(hash crypto.Hash) ecdsaSignFunc {
 		if _, err := h.Write(payload); err != nil {
 			return nil, errors.Wrap(err, "failed to write payload using ecdsa")
 		}
-		r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to sign payload using ecdsa")
+
+		var r, s *big.Int
+		if privkey, ok := key.(*ecdsa.PrivateKey); ok {
+			var err error
+			r, s, err = ecdsa.Sign(rand.Reader, privkey, h.Sum(nil))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to sign payload using ecdsa")
+			}
+		} else {
+			// crypto.Signer implementations return ASN.1 DER encoded
+			// signatures, while JWS requires R || S
+			signed, err := key.Sign(rand.Reader, h.Sum(nil), hash)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to sign payload using crypto.Signer")
+			}
+			var sig struct {
+				R, S *big.Int
+			}
+			if _, err := asn1.Unmarshal(signed, &sig); err != nil {
+				return nil, errors.Wrap(err, "failed to unmarshal ASN.1 encoded ecdsa signature")
+			}
+			r, s = sig.R, sig.S
+		}
+
+		// Normalize to the low S form, as (R, N-S) is also a valid
+		// signature. See jws.WithRequireLowS
+		n := pubkey.Curve.Params().N
+		if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+			s = new(big.Int).Sub(n, s)
 		}
 
 		rBytes := r.Bytes()
@@ -74,12 +101,14 @@ func (s ECDSASigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 		return nil, errors.New(`missing private key while signing payload`)
 	}
 
-	var pubkey *ecdsa.PrivateKey
+	var pubkey crypto.Signer
 	switch v := key.(type) {
 	case ecdsa.PrivateKey:
 		pubkey = &v
 	case *ecdsa.PrivateKey:
 		pubkey = v
+	case crypto.Signer:
+		pubkey = v
 	default:
 		return nil, errors.Errorf(`invalid key type %T. *ecdsa.PrivateKey is required`, key)
 	}
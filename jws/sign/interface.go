@@ -1,8 +1,7 @@
 package sign
 
 import (
-	"crypto/ecdsa"
-	"crypto/rsa"
+	"crypto"
 
 	"github.com/lestrrat-go/jwx/jwa"
 )
@@ -19,7 +18,7 @@ type Signer interface {
 	Algorithm() jwa.SignatureAlgorithm
 }
 
-type rsaSignFunc func([]byte, *rsa.PrivateKey) ([]byte, error)
+type rsaSignFunc func([]byte, crypto.Signer) ([]byte, error)
 
 // RSASigner uses crypto/rsa to sign the payloads.
 type RSASigner struct {
@@ -27,7 +26,7 @@ type RSASigner struct {
 	sign rsaSignFunc
 }
 
-type ecdsaSignFunc func([]byte, *ecdsa.PrivateKey) ([]byte, error)
+type ecdsaSignFunc func([]byte, crypto.Signer) ([]byte, error)
 
 // ECDSASigner uses crypto/ecdsa to sign the payloads.
 type ECDSASigner struct {
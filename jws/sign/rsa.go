@@ -48,23 +48,24 @@ func init() {
 }
 
 func makeSignPKCS1v15(hash crypto.Hash) rsaSignFunc {
-	return func(payload []byte, key *rsa.PrivateKey) ([]byte, error) {
+	return func(payload []byte, key crypto.Signer) ([]byte, error) {
 		h := hash.New()
 		if _, err := h.Write(payload); err != nil {
 			return nil, errors.Wrap(err, "failed to write payload using SignPKCS1v15")
 		}
-		return rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+		return key.Sign(rand.Reader, h.Sum(nil), hash)
 	}
 }
 
 func makeSignPSS(hash crypto.Hash) rsaSignFunc {
-	return func(payload []byte, key *rsa.PrivateKey) ([]byte, error) {
+	return func(payload []byte, key crypto.Signer) ([]byte, error) {
 		h := hash.New()
 		if _, err := h.Write(payload); err != nil {
 			return nil, errors.Wrap(err, "failed to write payload using SignPSS")
 		}
-		return rsa.SignPSS(rand.Reader, key, hash, h.Sum(nil), &rsa.PSSOptions{
+		return key.Sign(rand.Reader, h.Sum(nil), &rsa.PSSOptions{
 			SaltLength: rsa.PSSSaltLengthAuto,
+			Hash:       hash,
 		})
 	}
 }
@@ -85,18 +86,24 @@ func (s RSASigner) Algorithm() jwa.SignatureAlgorithm {
 }
 
 // Sign creates a signature using crypto/rsa. key must be a non-nil instance of
-// `*"crypto/rsa".PrivateKey`.
+// `*"crypto/rsa".PrivateKey`, or a `crypto.Signer` backed by an RSA key
+// (such as a hardware token)
 func (s RSASigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 	if key == nil {
 		return nil, errors.New(`missing private key while signing payload`)
 	}
 
-	var privkey *rsa.PrivateKey
+	var privkey crypto.Signer
 	switch v := key.(type) {
 	case rsa.PrivateKey:
 		privkey = &v
 	case *rsa.PrivateKey:
 		privkey = v
+	case crypto.Signer:
+		if _, ok := v.Public().(*rsa.PublicKey); !ok {
+			return nil, errors.Errorf(`invalid crypto.Signer public key type %T. *rsa.PublicKey is required`, v.Public())
+		}
+		privkey = v
 	default:
 		return nil, errors.Errorf(`invalid key type %T. *rsa.PrivateKey is required`, key)
 	}
@@ -1,20 +1,68 @@
 package sign
 
 import (
+	"sync"
+
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
 
+// Factory creates a Signer for the given signature algorithm
+type Factory func(jwa.SignatureAlgorithm) (Signer, error)
+
+var muSignerDB sync.RWMutex
+var signerDB = map[jwa.SignatureAlgorithm]Factory{}
+var builtinSigners = map[jwa.SignatureAlgorithm]struct{}{}
+
+func init() {
+	rsaFactory := func(alg jwa.SignatureAlgorithm) (Signer, error) { return newRSA(alg) }
+	ecdsaFactory := func(alg jwa.SignatureAlgorithm) (Signer, error) { return newECDSA(alg) }
+	hmacFactory := func(alg jwa.SignatureAlgorithm) (Signer, error) { return newHMAC(alg) }
+
+	for alg, f := range map[jwa.SignatureAlgorithm]Factory{
+		jwa.RS256: rsaFactory,
+		jwa.RS384: rsaFactory,
+		jwa.RS512: rsaFactory,
+		jwa.PS256: rsaFactory,
+		jwa.PS384: rsaFactory,
+		jwa.PS512: rsaFactory,
+		jwa.ES256: ecdsaFactory,
+		jwa.ES384: ecdsaFactory,
+		jwa.ES512: ecdsaFactory,
+		jwa.HS256: hmacFactory,
+		jwa.HS384: hmacFactory,
+		jwa.HS512: hmacFactory,
+	} {
+		signerDB[alg] = f
+		builtinSigners[alg] = struct{}{}
+	}
+}
+
+// Register registers a factory that creates signers for the given
+// signature algorithm, so that `New` (and therefore `jws.Sign`) can
+// dispatch to it. Signers for the built-in algorithms may not be replaced,
+// and none may be registered for "none" (jwa.NoSignature).
+func Register(alg jwa.SignatureAlgorithm, f Factory) error {
+	if alg == jwa.NoSignature {
+		return errors.Errorf(`cannot register signer for %s`, alg)
+	}
+	if _, ok := builtinSigners[alg]; ok {
+		return errors.Errorf(`cannot replace signer for built-in signature algorithm %s`, alg)
+	}
+
+	muSignerDB.Lock()
+	signerDB[alg] = f
+	muSignerDB.Unlock()
+	return nil
+}
+
 // New creates a signer that signs payloads using the given signature algorithm.
 func New(alg jwa.SignatureAlgorithm) (Signer, error) {
-	switch alg {
-	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512:
-		return newRSA(alg)
-	case jwa.ES256, jwa.ES384, jwa.ES512:
-		return newECDSA(alg)
-	case jwa.HS256, jwa.HS384, jwa.HS512:
-		return newHMAC(alg)
-	default:
+	muSignerDB.RLock()
+	f, ok := signerDB[alg]
+	muSignerDB.RUnlock()
+	if !ok {
 		return nil, errors.Errorf(`unsupported signature algorithm %s`, alg)
 	}
+	return f(alg)
 }
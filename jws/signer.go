@@ -1 +1,38 @@
 package jws
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws/sign"
+	"github.com/lestrrat-go/jwx/jws/verify"
+	"github.com/pkg/errors"
+)
+
+// RegisterSigner registers a signer for a custom signature algorithm,
+// so that `jws.Sign` and friends dispatch to it when `alg` is specified.
+// The algorithm is also registered via `jwa.RegisterSignatureAlgorithm`,
+// so that it is accepted as the value of the "alg" header.
+//
+// Signers for the algorithms defined in RFC7518 cannot be replaced, and
+// none can be registered for "none" (jwa.NoSignature).
+func RegisterSigner(alg jwa.SignatureAlgorithm, signer sign.Signer) error {
+	if err := sign.Register(alg, func(jwa.SignatureAlgorithm) (sign.Signer, error) { return signer, nil }); err != nil {
+		return errors.Wrap(err, `failed to register signer`)
+	}
+	jwa.RegisterSignatureAlgorithm(alg.String())
+	return nil
+}
+
+// RegisterVerifier registers a verifier for a custom signature algorithm,
+// so that `jws.Verify` and friends dispatch to it when `alg` is specified.
+// The algorithm is also registered via `jwa.RegisterSignatureAlgorithm`,
+// so that it is accepted as the value of the "alg" header.
+//
+// Verifiers for the algorithms defined in RFC7518 cannot be replaced, and
+// none can be registered for "none" (jwa.NoSignature).
+func RegisterVerifier(alg jwa.SignatureAlgorithm, verifier verify.Verifier) error {
+	if err := verify.Register(alg, func(jwa.SignatureAlgorithm) (verify.Verifier, error) { return verifier, nil }); err != nil {
+		return errors.Wrap(err, `failed to register verifier`)
+	}
+	jwa.RegisterSignatureAlgorithm(alg.String())
+	return nil
+}
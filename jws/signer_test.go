@@ -1,14 +1,20 @@
 package jws_test
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io"
 	"strings"
 	"testing"
 
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jws/sign"
 	"github.com/lestrrat-go/jwx/jws/verify"
@@ -98,3 +104,224 @@ func TestSignMulti(t *testing.T) {
 
 	t.Logf("%s", m)
 }
+
+type trivialSigner struct {
+	alg jwa.SignatureAlgorithm
+}
+
+func (s trivialSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
+	h := sha256.Sum256(append(key.([]byte), payload...))
+	return h[:], nil
+}
+
+func (s trivialSigner) Algorithm() jwa.SignatureAlgorithm {
+	return s.alg
+}
+
+type trivialVerifier struct {
+	signer trivialSigner
+}
+
+func (v trivialVerifier) Verify(payload, signature []byte, key interface{}) error {
+	expected, err := v.signer.Sign(payload, key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(expected, signature) {
+		return errors.New(`signature mismatch`)
+	}
+	return nil
+}
+
+func TestRegisterSigner(t *testing.T) {
+	alg := jwa.SignatureAlgorithm("X-TRIVIAL")
+	signer := trivialSigner{alg: alg}
+
+	t.Run("Built-in algorithms cannot be replaced", func(t *testing.T) {
+		if !assert.Error(t, jws.RegisterSigner(jwa.HS256, signer), `jws.RegisterSigner should fail`) {
+			return
+		}
+		if !assert.Error(t, jws.RegisterVerifier(jwa.HS256, trivialVerifier{signer: signer}), `jws.RegisterVerifier should fail`) {
+			return
+		}
+	})
+	t.Run(`"none" cannot be registered`, func(t *testing.T) {
+		if !assert.Error(t, jws.RegisterSigner(jwa.NoSignature, signer), `jws.RegisterSigner should fail`) {
+			return
+		}
+		if !assert.Error(t, jws.RegisterVerifier(jwa.NoSignature, trivialVerifier{signer: signer}), `jws.RegisterVerifier should fail`) {
+			return
+		}
+	})
+
+	if !assert.NoError(t, jws.RegisterSigner(alg, signer), `jws.RegisterSigner should succeed`) {
+		return
+	}
+	if !assert.NoError(t, jws.RegisterVerifier(alg, trivialVerifier{signer: signer}), `jws.RegisterVerifier should succeed`) {
+		return
+	}
+
+	key := []byte("secret")
+	payload := []byte("Hello, World!")
+	signed, err := jws.Sign(payload, alg, key)
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	m, err := jws.Parse(bytes.NewReader(signed))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+	if !assert.Equal(t, alg, m.Signatures()[0].ProtectedHeaders().Algorithm(), `algorithm should match`) {
+		return
+	}
+
+	verified, err := jws.Verify(signed, alg, key)
+	if !assert.NoError(t, err, `jws.Verify should succeed`) {
+		return
+	}
+	if !assert.Equal(t, payload, verified, `payloads should match`) {
+		return
+	}
+
+	_, err = jws.Verify(signed, alg, []byte("wrong"))
+	if !assert.Error(t, err, `jws.Verify with the wrong key should fail`) {
+		return
+	}
+
+	// built-in algorithms are unaffected
+	hsSigned, err := jws.Sign(payload, jwa.HS256, key)
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+	if _, err := jws.Verify(hsSigned, jwa.HS256, key); !assert.NoError(t, err, `jws.Verify should succeed`) {
+		return
+	}
+}
+
+// opaqueSigner hides the concrete private key type, much like a
+// crypto.Signer backed by a hardware token would
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestSignWithSignerResolver(t *testing.T) {
+	rsakey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	eckey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+
+	signers := map[string]crypto.Signer{
+		"pkcs11:object=rsa": opaqueSigner{signer: rsakey},
+		"pkcs11:object=ec":  opaqueSigner{signer: eckey},
+	}
+	jwk.RegisterSignerResolver("pkcs11", func(uri string) (crypto.Signer, error) {
+		signer, ok := signers[uri]
+		if !ok {
+			return nil, errors.New(`key not found`)
+		}
+		return signer, nil
+	})
+
+	testcases := []struct {
+		Name   string
+		URI    string
+		Public interface{}
+		Alg    jwa.SignatureAlgorithm
+	}{
+		{Name: "RS256", URI: "pkcs11:object=rsa", Public: &rsakey.PublicKey, Alg: jwa.RS256},
+		{Name: "PS256", URI: "pkcs11:object=rsa", Public: &rsakey.PublicKey, Alg: jwa.PS256},
+		{Name: "ES256", URI: "pkcs11:object=ec", Public: &eckey.PublicKey, Alg: jwa.ES256},
+	}
+
+	payload := []byte("Hello, World!")
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			key, err := jwk.New(tc.Public)
+			if !assert.NoError(t, err, `jwk.New should succeed`) {
+				return
+			}
+			if !assert.NoError(t, key.Set("pkcs11", tc.URI), `key.Set should succeed`) {
+				return
+			}
+
+			signed, err := jws.Sign(payload, tc.Alg, key)
+			if !assert.NoError(t, err, `jws.Sign should succeed`) {
+				return
+			}
+
+			verified, err := jws.Verify(signed, tc.Alg, tc.Public)
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, verified, `payloads should match`) {
+				return
+			}
+		})
+	}
+
+	t.Run("Unknown URI", func(t *testing.T) {
+		key, err := jwk.New(&rsakey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		if !assert.NoError(t, key.Set("pkcs11", "pkcs11:object=unknown"), `key.Set should succeed`) {
+			return
+		}
+		_, err = jws.Sign(payload, jwa.RS256, key)
+		if !assert.Error(t, err, `jws.Sign should fail`) {
+			return
+		}
+	})
+
+	t.Run("Multiple schemes", func(t *testing.T) {
+		// The resolver registered first wins, regardless of map ordering.
+		// Resolvers are called without holding the registry lock, so they
+		// may register resolvers themselves
+		jwk.RegisterSignerResolver("x-first", func(string) (crypto.Signer, error) {
+			jwk.RegisterSignerResolver("x-third", func(string) (crypto.Signer, error) {
+				return nil, errors.New(`unexpected resolver`)
+			})
+			return opaqueSigner{signer: rsakey}, nil
+		})
+		jwk.RegisterSignerResolver("x-second", func(string) (crypto.Signer, error) {
+			return nil, errors.New(`unexpected resolver`)
+		})
+
+		key, err := jwk.New(&rsakey.PublicKey)
+		if !assert.NoError(t, err, `jwk.New should succeed`) {
+			return
+		}
+		for _, scheme := range []string{"x-first", "x-second", "x-third"} {
+			if !assert.NoError(t, key.Set(scheme, scheme+":key"), `key.Set should succeed`) {
+				return
+			}
+		}
+
+		for i := 0; i < 10; i++ {
+			signer, ok, err := jwk.ResolveSigner(key)
+			if !assert.NoError(t, err, `jwk.ResolveSigner should succeed`) {
+				return
+			}
+			if !assert.True(t, ok, `key should reference a registered scheme`) {
+				return
+			}
+			if !assert.Equal(t, opaqueSigner{signer: rsakey}, signer, `signer should come from the first resolver`) {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package jws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"hash"
+	"io"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws/verify"
+	"github.com/pkg/errors"
+)
+
+// StreamVerifier verifies a JWS signature over a payload that is fed to
+// it incrementally, which allows verifying large detached payloads without
+// keeping them in memory. Create one using `jws.NewVerifier`, write the
+// payload to it, and call `Finalize` with the signature.
+//
+// The payload is written to the hash as soon as it is received. Only
+// verifiers registered via `jws.RegisterVerifier` that do not implement
+// `verify.DigestVerifier` cause the signing input to be buffered.
+//
+// A StreamVerifier is not safe for concurrent use.
+type StreamVerifier struct {
+	alg         jwa.SignatureAlgorithm
+	verifier    verify.Verifier
+	key         interface{}
+	requireLowS bool
+	digest      hash.Hash
+	buf         *bytes.Buffer
+	dst         io.Writer
+	enc         io.WriteCloser
+	finalized   bool
+}
+
+// NewVerifier creates a StreamVerifier that verifies a message signed
+// using `alg` and `key`. `protected` is the base64url encoded protected
+// header of the message, exactly as it appears in the message.
+//
+// The payload written to the StreamVerifier is the raw payload: it is
+// base64url encoded by the StreamVerifier to compute the signing input.
+//
+// The WithRequireLowS option is honored.
+func NewVerifier(alg jwa.SignatureAlgorithm, key interface{}, protected []byte, options ...Option) (*StreamVerifier, error) {
+	var requireLowS bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyRequireLowS:
+			requireLowS = o.Value().(bool)
+		}
+	}
+
+	verifier, err := verify.New(alg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create verifier")
+	}
+
+	sv, err := newStreamVerifier(alg, verifier, key, requireLowS, protected)
+	if err != nil {
+		return nil, err
+	}
+	sv.enc = base64.NewEncoder(base64.RawURLEncoding, sv.dst)
+	return sv, nil
+}
+
+func newStreamVerifier(alg jwa.SignatureAlgorithm, verifier verify.Verifier, key interface{}, requireLowS bool, protected []byte) (*StreamVerifier, error) {
+	sv := &StreamVerifier{
+		alg:         alg,
+		verifier:    verifier,
+		key:         key,
+		requireLowS: requireLowS,
+	}
+
+	if dv, ok := verifier.(verify.DigestVerifier); ok {
+		h, err := dv.NewHash(key)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to create hash`)
+		}
+		sv.digest = h
+		sv.dst = h
+	} else {
+		sv.buf = &bytes.Buffer{}
+		sv.dst = sv.buf
+	}
+
+	if _, err := sv.dst.Write(protected); err != nil {
+		return nil, errors.Wrap(err, `failed to write protected header`)
+	}
+	if _, err := sv.dst.Write([]byte{'.'}); err != nil {
+		return nil, errors.Wrap(err, `failed to write separator`)
+	}
+	return sv, nil
+}
+
+// Write feeds the next chunk of the raw payload to the StreamVerifier
+func (sv *StreamVerifier) Write(p []byte) (int, error) {
+	if sv.finalized {
+		return 0, errors.New(`write after Finalize`)
+	}
+
+	if sv.enc == nil {
+		return sv.dst.Write(p)
+	}
+	return sv.enc.Write(p)
+}
+
+// Finalize checks whether `signature` is valid for the payload that has
+// been written so far. `signature` is the decoded signature, not its
+// base64url encoded form.
+//
+// Finalize can only be called once, and nothing may be written to the
+// StreamVerifier afterwards.
+func (sv *StreamVerifier) Finalize(signature []byte) error {
+	if sv.finalized {
+		return errors.New(`Finalize has already been called`)
+	}
+	sv.finalized = true
+
+	if sv.enc != nil {
+		if err := sv.enc.Close(); err != nil {
+			return errors.Wrap(err, `failed to flush payload`)
+		}
+	}
+
+	if sv.requireLowS {
+		if err := checkLowS(sv.alg, signature); err != nil {
+			return err
+		}
+	}
+
+	if sv.digest != nil {
+		return sv.verifier.(verify.DigestVerifier).VerifyDigest(sv.digest.Sum(nil), signature, sv.key)
+	}
+	return sv.verifier.Verify(sv.buf.Bytes(), signature, sv.key)
+}
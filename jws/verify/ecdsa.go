@@ -1,76 +1,80 @@
 package verify
 
 import (
-	"crypto"
 	"crypto/ecdsa"
+	"hash"
 
 	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
 
-var ecdsaVerifyFuncs = map[jwa.SignatureAlgorithm]ecdsaVerifyFunc{}
-
-func init() {
-	algs := map[jwa.SignatureAlgorithm]crypto.Hash{
-		jwa.ES256: crypto.SHA256,
-		jwa.ES384: crypto.SHA384,
-		jwa.ES512: crypto.SHA512,
-	}
-
-	for alg, h := range algs {
-		ecdsaVerifyFuncs[alg] = makeECDSAVerifyFunc(h)
-	}
+var ecdsaAlgorithms = map[jwa.SignatureAlgorithm]struct{}{
+	jwa.ES256: {},
+	jwa.ES384: {},
+	jwa.ES512: {},
 }
 
-func makeECDSAVerifyFunc(hash crypto.Hash) ecdsaVerifyFunc {
-	return func(payload []byte, signature []byte, key *ecdsa.PublicKey) error {
-		r := pool.GetBigInt()
-		s := pool.GetBigInt()
-		defer pool.ReleaseBigInt(r)
-		defer pool.ReleaseBigInt(s)
+func verifyECDSA(digest []byte, signature []byte, key *ecdsa.PublicKey) error {
+	r := pool.GetBigInt()
+	s := pool.GetBigInt()
+	defer pool.ReleaseBigInt(r)
+	defer pool.ReleaseBigInt(s)
 
-		n := len(signature) / 2
-		r.SetBytes(signature[:n])
-		s.SetBytes(signature[n:])
+	n := len(signature) / 2
+	r.SetBytes(signature[:n])
+	s.SetBytes(signature[n:])
 
-		h := hash.New()
-		if _, err := h.Write(payload); err != nil {
-			return errors.Wrap(err, "failed to write payload using ecdsa")
-		}
-
-		if !ecdsa.Verify(key, h.Sum(nil), r, s) {
-			return errors.New(`failed to verify signature using ecdsa`)
-		}
-		return nil
+	if !ecdsa.Verify(key, digest, r, s) {
+		return errors.New(`failed to verify signature using ecdsa`)
 	}
+	return nil
 }
 
 func newECDSA(alg jwa.SignatureAlgorithm) (*ECDSAVerifier, error) {
-	verifyfn, ok := ecdsaVerifyFuncs[alg]
-	if !ok {
+	if _, ok := ecdsaAlgorithms[alg]; !ok {
 		return nil, errors.Errorf(`unsupported algorithm while trying to create ECDSA verifier: %s`, alg)
 	}
 
+	h, _ := jwa.HashForSignatureAlgorithm(alg)
 	return &ECDSAVerifier{
-		verify: verifyfn,
+		hash: h,
 	}, nil
 }
 
-func (v ECDSAVerifier) Verify(payload []byte, signature []byte, key interface{}) error {
+func ecdsaPublicKey(key interface{}) (*ecdsa.PublicKey, error) {
 	if key == nil {
-		return errors.New(`missing public key while verifying payload`)
+		return nil, errors.New(`missing public key while verifying payload`)
 	}
 
-	var pubkey *ecdsa.PublicKey
 	switch v := key.(type) {
 	case ecdsa.PublicKey:
-		pubkey = &v
+		return &v, nil
 	case *ecdsa.PublicKey:
-		pubkey = v
+		return v, nil
 	default:
-		return errors.Errorf(`invalid key type %T. *ecdsa.PublicKey is required`, key)
+		return nil, errors.Errorf(`invalid key type %T. *ecdsa.PublicKey is required`, key)
+	}
+}
+
+func (v ECDSAVerifier) Verify(payload []byte, signature []byte, key interface{}) error {
+	return verifyWithDigest(v, payload, signature, key)
+}
+
+// NewHash creates the hash that the signing input is written to
+func (v ECDSAVerifier) NewHash(key interface{}) (hash.Hash, error) {
+	if _, err := ecdsaPublicKey(key); err != nil {
+		return nil, err
 	}
+	return v.hash.New(), nil
+}
 
-	return v.verify(payload, signature, pubkey)
+// VerifyDigest checks whether the signature is valid for the digest
+// of the signing input, computed using the hash created by NewHash
+func (v ECDSAVerifier) VerifyDigest(digest, signature []byte, key interface{}) error {
+	pubkey, err := ecdsaPublicKey(key)
+	if err != nil {
+		return err
+	}
+	return verifyECDSA(digest, signature, pubkey)
 }
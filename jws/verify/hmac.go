@@ -2,6 +2,7 @@ package verify
 
 import (
 	"crypto/hmac"
+	"hash"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jws/sign"
@@ -13,20 +14,32 @@ func newHMAC(alg jwa.SignatureAlgorithm) (*HMACVerifier, error) {
 	if !ok {
 		return nil, errors.Errorf(`unsupported algorithm while trying to create HMAC signer: %s`, alg)
 	}
-	s, err := sign.New(alg)
-	if err != nil {
-		return nil, errors.Wrap(err, `failed to generate HMAC signer`)
-	}
-	return &HMACVerifier{signer: s}, nil
+	h, _ := jwa.HashForSignatureAlgorithm(alg)
+	return &HMACVerifier{hash: h}, nil
 }
 
 func (v HMACVerifier) Verify(payload, signature []byte, key interface{}) (err error) {
-	expected, err := v.signer.Sign(payload, key)
-	if err != nil {
-		return errors.Wrap(err, `failed to generated signature`)
+	return verifyWithDigest(v, payload, signature, key)
+}
+
+// NewHash creates the HMAC that the signing input is written to
+func (v HMACVerifier) NewHash(key interface{}) (hash.Hash, error) {
+	hmackey, ok := key.([]byte)
+	if !ok {
+		return nil, errors.Errorf(`invalid key type %T. []byte is required`, key)
 	}
 
-	if !hmac.Equal(signature, expected) {
+	if len(hmackey) == 0 {
+		return nil, errors.New(`missing key while verifying payload`)
+	}
+
+	return hmac.New(v.hash.New, hmackey), nil
+}
+
+// VerifyDigest checks whether the signature matches the HMAC of the
+// signing input, computed using the hash created by NewHash
+func (v HMACVerifier) VerifyDigest(digest, signature []byte, _ interface{}) error {
+	if !hmac.Equal(signature, digest) {
 		return errors.New(`failed to match hmac signature`)
 	}
 	return nil
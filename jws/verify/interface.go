@@ -1,10 +1,9 @@
 package verify
 
 import (
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/rsa"
-
-	"github.com/lestrrat-go/jwx/jws/sign"
+	"hash"
 )
 
 type Verifier interface {
@@ -18,18 +17,49 @@ type Verifier interface {
 	Verify(payload []byte, signature []byte, key interface{}) error
 }
 
-type rsaVerifyFunc func([]byte, []byte, *rsa.PublicKey) error
+// DigestVerifier is implemented by verifiers whose signature algorithm
+// hashes the signing input, which allows the signing input to be written
+// to the hash incrementally instead of being kept in memory. All of the
+// built-in verifiers implement this interface.
+type DigestVerifier interface {
+	Verifier
+
+	// NewHash creates the hash that the signing input is written to.
+	// It fails if the key is not suitable for this verifier
+	NewHash(key interface{}) (hash.Hash, error)
+
+	// VerifyDigest checks whether the signature is valid for `digest`,
+	// which is the result of writing the signing input to a hash created
+	// by NewHash using the same key
+	VerifyDigest(digest, signature []byte, key interface{}) error
+}
+
+// verifyWithDigest implements Verifier.Verify using the DigestVerifier
+// methods, so that both forms of verification behave the same
+func verifyWithDigest(v DigestVerifier, payload, signature []byte, key interface{}) error {
+	h, err := v.NewHash(key)
+	if err != nil {
+		return err
+	}
+	if _, err := h.Write(payload); err != nil {
+		return err
+	}
+	return v.VerifyDigest(h.Sum(nil), signature, key)
+}
+
+type rsaVerifyFunc struct {
+	hash   crypto.Hash
+	verify func([]byte, []byte, *rsa.PublicKey) error
+}
 
 type RSAVerifier struct {
 	verify rsaVerifyFunc
 }
 
-type ecdsaVerifyFunc func([]byte, []byte, *ecdsa.PublicKey) error
-
 type ECDSAVerifier struct {
-	verify ecdsaVerifyFunc
+	hash crypto.Hash
 }
 
 type HMACVerifier struct {
-	signer sign.Signer
+	hash crypto.Hash
 }
@@ -3,6 +3,7 @@ package verify
 import (
 	"crypto"
 	"crypto/rsa"
+	"hash"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
@@ -11,59 +12,36 @@ import (
 var rsaVerifyFuncs = map[jwa.SignatureAlgorithm]rsaVerifyFunc{}
 
 func init() {
-	algs := map[jwa.SignatureAlgorithm]struct {
-		Hash       crypto.Hash
-		VerifyFunc func(crypto.Hash) rsaVerifyFunc
-	}{
-		jwa.RS256: {
-			Hash:       crypto.SHA256,
-			VerifyFunc: makeVerifyPKCS1v15,
-		},
-		jwa.RS384: {
-			Hash:       crypto.SHA384,
-			VerifyFunc: makeVerifyPKCS1v15,
-		},
-		jwa.RS512: {
-			Hash:       crypto.SHA512,
-			VerifyFunc: makeVerifyPKCS1v15,
-		},
-		jwa.PS256: {
-			Hash:       crypto.SHA256,
-			VerifyFunc: makeVerifyPSS,
-		},
-		jwa.PS384: {
-			Hash:       crypto.SHA384,
-			VerifyFunc: makeVerifyPSS,
-		},
-		jwa.PS512: {
-			Hash:       crypto.SHA512,
-			VerifyFunc: makeVerifyPSS,
-		},
+	algs := map[jwa.SignatureAlgorithm]func(crypto.Hash) rsaVerifyFunc{
+		jwa.RS256: makeVerifyPKCS1v15,
+		jwa.RS384: makeVerifyPKCS1v15,
+		jwa.RS512: makeVerifyPKCS1v15,
+		jwa.PS256: makeVerifyPSS,
+		jwa.PS384: makeVerifyPSS,
+		jwa.PS512: makeVerifyPSS,
 	}
 
-	for alg, item := range algs {
-		rsaVerifyFuncs[alg] = item.VerifyFunc(item.Hash)
+	for alg, f := range algs {
+		h, _ := jwa.HashForSignatureAlgorithm(alg)
+		rsaVerifyFuncs[alg] = f(h)
 	}
 }
 
 func makeVerifyPKCS1v15(hash crypto.Hash) rsaVerifyFunc {
-	return func(payload, signature []byte, key *rsa.PublicKey) error {
-		h := hash.New()
-		if _, err := h.Write(payload); err != nil {
-			return errors.Wrap(err, "failed to write payload using PKCS1v15")
-		}
-
-		return rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature)
+	return rsaVerifyFunc{
+		hash: hash,
+		verify: func(digest, signature []byte, key *rsa.PublicKey) error {
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+		},
 	}
 }
 
 func makeVerifyPSS(hash crypto.Hash) rsaVerifyFunc {
-	return func(payload, signature []byte, key *rsa.PublicKey) error {
-		h := hash.New()
-		if _, err := h.Write(payload); err != nil {
-			return errors.Wrap(err, "failed to write payload using PSS")
-		}
-		return rsa.VerifyPSS(key, hash, h.Sum(nil), signature, nil)
+	return rsaVerifyFunc{
+		hash: hash,
+		verify: func(digest, signature []byte, key *rsa.PublicKey) error {
+			return rsa.VerifyPSS(key, hash, digest, signature, nil)
+		},
 	}
 }
 
@@ -78,20 +56,39 @@ func newRSA(alg jwa.SignatureAlgorithm) (*RSAVerifier, error) {
 	}, nil
 }
 
-func (v RSAVerifier) Verify(payload, signature []byte, key interface{}) error {
+func rsaPublicKey(key interface{}) (*rsa.PublicKey, error) {
 	if key == nil {
-		return errors.New(`missing public key while verifying payload`)
+		return nil, errors.New(`missing public key while verifying payload`)
 	}
 
-	var pubkey *rsa.PublicKey
 	switch v := key.(type) {
 	case rsa.PublicKey:
-		pubkey = &v
+		return &v, nil
 	case *rsa.PublicKey:
-		pubkey = v
+		return v, nil
 	default:
-		return errors.Errorf(`invalid key type %T. *rsa.PublicKey is required`, key)
+		return nil, errors.Errorf(`invalid key type %T. *rsa.PublicKey is required`, key)
 	}
+}
+
+func (v RSAVerifier) Verify(payload, signature []byte, key interface{}) error {
+	return verifyWithDigest(v, payload, signature, key)
+}
 
-	return v.verify(payload, signature, pubkey)
+// NewHash creates the hash that the signing input is written to
+func (v RSAVerifier) NewHash(key interface{}) (hash.Hash, error) {
+	if _, err := rsaPublicKey(key); err != nil {
+		return nil, err
+	}
+	return v.verify.hash.New(), nil
+}
+
+// VerifyDigest checks whether the signature is valid for the digest
+// of the signing input, computed using the hash created by NewHash
+func (v RSAVerifier) VerifyDigest(digest, signature []byte, key interface{}) error {
+	pubkey, err := rsaPublicKey(key)
+	if err != nil {
+		return err
+	}
+	return v.verify.verify(digest, signature, pubkey)
 }
@@ -1,21 +1,69 @@
 package verify
 
 import (
+	"sync"
+
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/pkg/errors"
 )
 
+// Factory creates a Verifier for the given signature algorithm
+type Factory func(jwa.SignatureAlgorithm) (Verifier, error)
+
+var muVerifierDB sync.RWMutex
+var verifierDB = map[jwa.SignatureAlgorithm]Factory{}
+var builtinVerifiers = map[jwa.SignatureAlgorithm]struct{}{}
+
+func init() {
+	rsaFactory := func(alg jwa.SignatureAlgorithm) (Verifier, error) { return newRSA(alg) }
+	ecdsaFactory := func(alg jwa.SignatureAlgorithm) (Verifier, error) { return newECDSA(alg) }
+	hmacFactory := func(alg jwa.SignatureAlgorithm) (Verifier, error) { return newHMAC(alg) }
+
+	for alg, f := range map[jwa.SignatureAlgorithm]Factory{
+		jwa.RS256: rsaFactory,
+		jwa.RS384: rsaFactory,
+		jwa.RS512: rsaFactory,
+		jwa.PS256: rsaFactory,
+		jwa.PS384: rsaFactory,
+		jwa.PS512: rsaFactory,
+		jwa.ES256: ecdsaFactory,
+		jwa.ES384: ecdsaFactory,
+		jwa.ES512: ecdsaFactory,
+		jwa.HS256: hmacFactory,
+		jwa.HS384: hmacFactory,
+		jwa.HS512: hmacFactory,
+	} {
+		verifierDB[alg] = f
+		builtinVerifiers[alg] = struct{}{}
+	}
+}
+
+// Register registers a factory that creates verifiers for the given
+// signature algorithm, so that `New` (and therefore `jws.Verify`) can
+// dispatch to it. Verifiers for the built-in algorithms may not be replaced,
+// and none may be registered for "none" (jwa.NoSignature).
+func Register(alg jwa.SignatureAlgorithm, f Factory) error {
+	if alg == jwa.NoSignature {
+		return errors.Errorf(`cannot register verifier for %s`, alg)
+	}
+	if _, ok := builtinVerifiers[alg]; ok {
+		return errors.Errorf(`cannot replace verifier for built-in signature algorithm %s`, alg)
+	}
+
+	muVerifierDB.Lock()
+	verifierDB[alg] = f
+	muVerifierDB.Unlock()
+	return nil
+}
+
 // New creates a new JWS verifier using the specified algorithm
 // and the public key
 func New(alg jwa.SignatureAlgorithm) (Verifier, error) {
-	switch alg {
-	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512:
-		return newRSA(alg)
-	case jwa.ES256, jwa.ES384, jwa.ES512:
-		return newECDSA(alg)
-	case jwa.HS256, jwa.HS384, jwa.HS512:
-		return newHMAC(alg)
-	default:
+	muVerifierDB.RLock()
+	f, ok := verifierDB[alg]
+	muVerifierDB.RUnlock()
+	if !ok {
 		return nil, errors.Errorf(`unsupported signature algorithm: %s`, alg)
 	}
+	return f(alg)
 }
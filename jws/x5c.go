@@ -0,0 +1,51 @@
+package jws
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+)
+
+// x5cKeyProvider is the KeyProvider behind WithX509CertChainVerification
+type x5cKeyProvider struct {
+	roots *x509.CertPool
+}
+
+func (p *x5cKeyProvider) FetchKeys(_ context.Context, sink KeySink, sig *Signature, _ *Message) error {
+	hdr := sig.ProtectedHeaders()
+	if hdr == nil {
+		return errors.New(`signature does not have protected headers`)
+	}
+
+	list := hdr.X509CertChain()
+	if len(list) == 0 {
+		return errors.Errorf(`protected headers do not have the %s field`, X509CertChainKey)
+	}
+
+	alg := hdr.Algorithm()
+	if alg == "" {
+		return errors.Errorf(`protected headers do not have the %s field`, AlgorithmKey)
+	}
+
+	var chain jwk.CertificateChain
+	if err := chain.Accept(list); err != nil {
+		return errors.Wrapf(err, `invalid value for %s`, X509CertChainKey)
+	}
+	leaf := chain.Get()[0]
+
+	key, err := jwk.New(leaf.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, `failed to create jwk.Key from leaf certificate`)
+	}
+	if err := key.Set(jwk.X509CertChainKey, list); err != nil {
+		return errors.Wrapf(err, `failed to set %s`, jwk.X509CertChainKey)
+	}
+	if err := jwk.VerifyX5C(key, p.roots); err != nil {
+		return errors.Wrapf(err, `failed to verify %s`, X509CertChainKey)
+	}
+
+	sink.Key(alg, leaf.PublicKey)
+	return nil
+}
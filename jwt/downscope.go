@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/pkg/errors"
+)
+
+// ScopeKey is the name of the claim that holds the space-delimited list
+// of scopes, as described in https://tools.ietf.org/html/rfc8693#section-4.2
+const ScopeKey = "scope"
+
+const (
+	optkeyDownscopeAudience = `downscopeAudience`
+	optkeyDownscopeScopes   = `downscopeScopes`
+)
+
+// WithDownscopeAudience specifies the audiences that the token created by
+// `jwt.Downscope` should be restricted to. Each of them must be an
+// audience of the source token.
+func WithDownscopeAudience(aud ...string) Option {
+	return option.New(optkeyDownscopeAudience, aud)
+}
+
+// WithDownscopeScopes specifies the scopes that the token created by
+// `jwt.Downscope` should be restricted to. Each of them must be a scope
+// of the source token. If no scopes are given, the "scope" claim is
+// removed.
+func WithDownscopeScopes(scopes ...string) Option {
+	return option.New(optkeyDownscopeScopes, scopes)
+}
+
+// Downscope creates a new token from `src` with a narrowed audience and
+// a reduced set of scopes, as done in token exchange (RFC8693). All other
+// claims are copied as-is. Specify WithDownscopeAudience and
+// WithDownscopeScopes to restrict the "aud" and "scope" claims; claims
+// without a corresponding option are copied unchanged.
+//
+// An error is returned if the options would widen the token, that is,
+// if they request an audience or a scope that the source token does not
+// have. The "scope" claim may be a space-delimited string or a list of
+// strings in the source token, and is always emitted as a space-delimited
+// string.
+func Downscope(src Token, options ...Option) (Token, error) {
+	var audience, scopes []string
+	var restrictAudience, restrictScopes bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyDownscopeAudience:
+			audience = o.Value().([]string)
+			restrictAudience = true
+		case optkeyDownscopeScopes:
+			scopes = o.Value().([]string)
+			restrictScopes = true
+		}
+	}
+
+	claims, err := src.AsMap(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to convert token to map`)
+	}
+
+	dst := New()
+	for name, value := range claims {
+		// the scopes are set below
+		if restrictScopes && name == ScopeKey {
+			continue
+		}
+		if err := dst.Set(name, value); err != nil {
+			return nil, errors.Wrapf(err, `failed to copy claim %s`, name)
+		}
+	}
+
+	if restrictAudience {
+		if err := checkSubset(audience, src.Audience()); err != nil {
+			return nil, errors.Wrapf(err, `cannot widen %s`, AudienceKey)
+		}
+		if err := dst.Set(AudienceKey, audience); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, AudienceKey)
+		}
+	}
+
+	if restrictScopes {
+		current, err := tokenScopes(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSubset(scopes, current); err != nil {
+			return nil, errors.Wrapf(err, `cannot widen %s`, ScopeKey)
+		}
+
+		if len(scopes) > 0 {
+			if err := dst.Set(ScopeKey, strings.Join(scopes, " ")); err != nil {
+				return nil, errors.Wrapf(err, `failed to set %s`, ScopeKey)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// tokenScopes returns the scopes in the "scope" claim of the token
+func tokenScopes(t Token) ([]string, error) {
+	v, ok := t.Get(ScopeKey)
+	if !ok {
+		return nil, nil
+	}
+
+	switch x := v.(type) {
+	case string:
+		return strings.Fields(x), nil
+	case []string:
+		return x, nil
+	case []interface{}:
+		list := make([]string, len(x))
+		for i, e := range x {
+			s, ok := e.(string)
+			if !ok {
+				return nil, errors.Errorf(`invalid %s claim: expected string, got %T at element %d`, ScopeKey, e, i)
+			}
+			list[i] = s
+		}
+		return list, nil
+	default:
+		return nil, errors.Errorf(`invalid %s claim: %T`, ScopeKey, v)
+	}
+}
+
+// checkSubset makes sure that every element of values exists in allowed
+func checkSubset(values, allowed []string) error {
+	set := make(map[string]struct{}, len(allowed))
+	for _, v := range allowed {
+		set[v] = struct{}{}
+	}
+	for _, v := range values {
+		if _, ok := set[v]; !ok {
+			return errors.Errorf(`%q is not in the source token`, v)
+		}
+	}
+	return nil
+}
@@ -378,6 +378,10 @@ func generateToken(tt tokenType) error {
 	fmt.Fprintf(&buf, "\nIterate(context.Context) Iterator")
 	fmt.Fprintf(&buf, "\nWalk(context.Context, Visitor) error")
 	fmt.Fprintf(&buf, "\nAsMap(context.Context) (map[string]interface{}, error)")
+	fmt.Fprintf(&buf, "\nIntrospectionResponse(bool) (map[string]interface{}, error)")
+	fmt.Fprintf(&buf, "\nDecodeInto(interface{}) error")
+	fmt.Fprintf(&buf, "\nAudienceIsSingular() bool")
+	fmt.Fprintf(&buf, "\nReset()")
 	fmt.Fprintf(&buf, "\n}")
 
 	fmt.Fprintf(&buf, "\ntype %s struct {", tt.structName)
@@ -648,7 +652,12 @@ func generateToken(tt tokenType) error {
 
 	// Now for the fun part... It's quite silly, but we need to check if we
 	// have other parameters.
-	fmt.Fprintf(&buf, "\nvar m map[string]interface{}")
+	// An empty map (as in a new or reset token) is reused, which saves an
+	// allocation when tokens are taken from a TokenPool
+	fmt.Fprintf(&buf, "\nm := t.privateClaims")
+	fmt.Fprintf(&buf, "\nif len(m) > 0 {")
+	fmt.Fprintf(&buf, "\nm = nil")
+	fmt.Fprintf(&buf, "\n}")
 	fmt.Fprintf(&buf, "\nif err := json.Unmarshal(buf, &m); err != nil {")
 	fmt.Fprintf(&buf, "\nreturn errors.Wrap(err, `failed to parse privsate parameters`)")
 	fmt.Fprintf(&buf, "\n}")
@@ -719,5 +728,68 @@ func generateToken(tt tokenType) error {
 	fmt.Fprintf(&buf, "\nreturn iter.AsMap(ctx, t)")
 	fmt.Fprintf(&buf, "\n}")
 
+	fmt.Fprintf(&buf, "\n\n// IntrospectionResponse returns the token as an OAuth 2.0 token")
+	fmt.Fprintf(&buf, "\n// introspection response, as described in https://tools.ietf.org/html/rfc7662#section-2.2")
+	fmt.Fprintf(&buf, "\n//\n// Date claims are represented as the number of seconds since the epoch.")
+	fmt.Fprintf(&buf, "\n// All other claims, including private claims such as \"scope\" and")
+	fmt.Fprintf(&buf, "\n// \"client_id\", are included as-is, except for \"active\", which is always")
+	fmt.Fprintf(&buf, "\n// set to the given value. If `active` is false, the response only contains")
+	fmt.Fprintf(&buf, "\n// the \"active\" field, as RFC7662 recommends against disclosing information")
+	fmt.Fprintf(&buf, "\n// about inactive tokens")
+	fmt.Fprintf(&buf, "\nfunc (t *%s) IntrospectionResponse(active bool) (map[string]interface{}, error) {", tt.structName)
+	fmt.Fprintf(&buf, "\nif !active {")
+	fmt.Fprintf(&buf, "\nreturn map[string]interface{}{`active`: false}, nil")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\n\nres, err := t.AsMap(context.Background())")
+	fmt.Fprintf(&buf, "\nif err != nil {")
+	fmt.Fprintf(&buf, "\nreturn nil, errors.Wrap(err, `failed to convert token to map`)")
+	fmt.Fprintf(&buf, "\n}")
+	for _, f := range fields {
+		if f.typ != "types.NumericDate" {
+			continue
+		}
+		fmt.Fprintf(&buf, "\nif v, ok := res[%sKey].(time.Time); ok {", f.method)
+		fmt.Fprintf(&buf, "\nres[%sKey] = v.Unix()", f.method)
+		fmt.Fprintf(&buf, "\n}")
+	}
+	fmt.Fprintf(&buf, "\nres[`active`] = true")
+	fmt.Fprintf(&buf, "\nreturn res, nil")
+	fmt.Fprintf(&buf, "\n}")
+
+	fmt.Fprintf(&buf, "\n\n// DecodeInto stores the claims of the token in the value pointed to")
+	fmt.Fprintf(&buf, "\n// by v, in the same manner as json.Unmarshal would if it were given")
+	fmt.Fprintf(&buf, "\n// the JSON representation of the token. Date claims are decoded into")
+	fmt.Fprintf(&buf, "\n// struct fields of type time.Time as is, and into numeric fields as")
+	fmt.Fprintf(&buf, "\n// the number of seconds since the epoch.")
+	fmt.Fprintf(&buf, "\nfunc (t *%s) DecodeInto(v interface{}) error {", tt.structName)
+	fmt.Fprintf(&buf, "\nclaims, err := t.AsMap(context.Background())")
+	fmt.Fprintf(&buf, "\nif err != nil {")
+	fmt.Fprintf(&buf, "\nreturn errors.Wrap(err, `failed to convert token to map`)")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\nreturn types.DecodeInto(claims, v)")
+	fmt.Fprintf(&buf, "\n}")
+
+	fmt.Fprintf(&buf, "\n\n// AudienceIsSingular reports whether the token has exactly one")
+	fmt.Fprintf(&buf, "\n// audience, in which case the \"aud\" claim may be serialized as a")
+	fmt.Fprintf(&buf, "\n// plain string instead of an array. See jwt.WithCompactAudience")
+	fmt.Fprintf(&buf, "\nfunc (t *%s) AudienceIsSingular() bool {", tt.structName)
+	fmt.Fprintf(&buf, "\nreturn len(t.Audience()) == 1")
+	fmt.Fprintf(&buf, "\n}")
+
+	fmt.Fprintf(&buf, "\n\n// Reset removes all claims from the token, including private claims,")
+	fmt.Fprintf(&buf, "\n// so that the token can be reused. See jwt.TokenPool")
+	fmt.Fprintf(&buf, "\nfunc (t *%s) Reset() {", tt.structName)
+	fmt.Fprintf(&buf, "\nclaims := t.privateClaims")
+	fmt.Fprintf(&buf, "\nif claims == nil {")
+	fmt.Fprintf(&buf, "\nclaims = make(map[string]interface{})")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\nfor name := range claims {")
+	fmt.Fprintf(&buf, "\ndelete(claims, name)")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\n*t = %s{", tt.structName)
+	fmt.Fprintf(&buf, "\nprivateClaims: claims,")
+	fmt.Fprintf(&buf, "\n}")
+	fmt.Fprintf(&buf, "\n}")
+
 	return codegen.WriteFormattedCodeToFile(tt.filename, &buf)
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -95,3 +96,30 @@ func (n *NumericDate) UnmarshalJSON(data []byte) error {
 	*n = n2
 	return nil
 }
+
+// FormatNumericDate formats the given time as a JSON NumericDate value,
+// truncated to the given precision. Precisions of one second or more
+// (as well as non-positive values) produce integers, while finer
+// precisions produce as many fractional digits as required to
+// represent them
+func FormatNumericDate(t time.Time, precision time.Duration) json.Number {
+	if precision <= 0 {
+		precision = time.Second
+	}
+	t = t.Truncate(precision)
+
+	var digits int
+	for p := time.Second; p > precision && digits < 9; p /= 10 {
+		digits++
+	}
+
+	if digits == 0 {
+		return json.Number(strconv.FormatInt(t.Unix(), 10))
+	}
+
+	frac := t.Nanosecond()
+	for i := digits; i < 9; i++ {
+		frac /= 10
+	}
+	return json.Number(fmt.Sprintf("%d.%0*d", t.Unix(), digits, frac))
+}
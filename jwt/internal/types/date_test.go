@@ -54,3 +54,27 @@ func TestDate(t *testing.T) {
 		}
 	})
 }
+
+func TestFormatNumericDate(t *testing.T) {
+	tm := time.Unix(1600000000, 123456789)
+	testcases := []struct {
+		precision time.Duration
+		expected  string
+	}{
+		{precision: 0, expected: "1600000000"},
+		{precision: time.Second, expected: "1600000000"},
+		{precision: time.Minute, expected: "1599999960"},
+		{precision: 100 * time.Millisecond, expected: "1600000000.1"},
+		{precision: time.Millisecond, expected: "1600000000.123"},
+		{precision: time.Microsecond, expected: "1600000000.123456"},
+		{precision: time.Nanosecond, expected: "1600000000.123456789"},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.precision.String(), func(t *testing.T) {
+			if !assert.Equal(t, json.Number(tc.expected), types.FormatNumericDate(tm, tc.precision), `formatted values should match`) {
+				return
+			}
+		})
+	}
+}
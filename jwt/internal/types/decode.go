@@ -0,0 +1,89 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// DecodeInto stores the given claims in the value pointed to by v, in the
+// same manner as json.Unmarshal. Claims that hold a time.Time are passed
+// as the number of seconds since the epoch, unless the struct field that
+// they are decoded into is a time.Time or a *time.Time.
+func DecodeInto(claims map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf(`argument to DecodeInto must be a non-nil pointer (got %T)`, v)
+	}
+
+	timeFields := make(map[string]struct{})
+	if rt := rv.Type().Elem(); rt.Kind() == reflect.Struct {
+		collectTimeFields(rt, timeFields)
+	}
+
+	converted := make(map[string]interface{}, len(claims))
+	for name, value := range claims {
+		if tm, ok := value.(time.Time); ok {
+			if _, ok := timeFields[strings.ToLower(name)]; ok {
+				value = tm.Format(time.RFC3339Nano)
+			} else {
+				value = tm.Unix()
+			}
+		}
+		converted[name] = value
+	}
+
+	buf, err := json.Marshal(converted)
+	if err != nil {
+		return errors.Wrap(err, `failed to marshal claims`)
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
+		return errors.Wrap(err, `failed to unmarshal claims`)
+	}
+	return nil
+}
+
+// collectTimeFields records the lower cased JSON names of the fields of
+// the struct type rt, including those of embedded structs, whose type is
+// time.Time or *time.Time
+func collectTimeFields(rt reflect.Type, dst map[string]struct{}) {
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		name := field.Name
+		tag := field.Tag.Get(`json`)
+		if tag == `-` {
+			continue
+		}
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			tag = tag[:i]
+		}
+		if tag != "" {
+			name = tag
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if field.Anonymous && tag == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			collectTimeFields(ft, dst)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if ft == timeType {
+			dst[strings.ToLower(name)] = struct{}{}
+		}
+	}
+}
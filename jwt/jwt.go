@@ -5,13 +5,20 @@ package jwt
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"strings"
+	"time"
 
+	"github.com/lestrrat-go/jwx/internal/pool"
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt/internal/types"
 	"github.com/pkg/errors"
 )
 
@@ -31,31 +38,290 @@ func ParseBytes(s []byte, options ...Option) (Token, error) {
 // If the token is signed and you want to verify the payload, you must
 // pass the jwt.WithVerify(alg, key) option. If you do not specify these
 // parameters, no verification will be performed.
+//
+// If you would like to transform the values of specific claims before
+// the token is returned, pass the jwt.WithClaimTransform(name, fn) option.
+//
+// To verify an OpenID Connect ID token using the metadata published by
+// its provider, pass the jwt.WithOIDCDiscovery(issuer) option. The
+// context given via jwt.WithContext is used to fetch the metadata.
+//
+// If the token has already been verified by a trusted party, you may pass
+// the jwt.WithoutSignatureVerification() option to skip signature
+// verification while still validating the claims. Read its documentation
+// carefully before using it.
+//
+// If the token is a nested token that was signed and then encrypted,
+// pass the jwt.WithDecrypt(alg, key) option to decrypt it first.
+//
+// To validate the claims of the token after its signature has been
+// verified, pass the jwt.WithValidate(true) option. If you would like the
+// token to be returned along with the error when its claims fail
+// validation, pass the jwt.WithReturnInvalidToken(true) option.
 func Parse(src io.Reader, options ...Option) (Token, error) {
 	var params VerifyParameters
+	var transforms []*claimTransform
+	var skipVerification bool
+	var commaSeparatedAudience bool
+	var discovery *oidcDiscovery
+	var returnInvalidToken bool
+	var validate bool
+	var minKeyStrength int
+	var decrypt *decryptParams
+	var tokenPool *TokenPool
+	var validateOptions []Option
+	ctx := context.Background()
 	for _, o := range options {
 		switch o.Name() {
+		case optkeyContext:
+			// also passed to jwt.Verify
+			ctx = o.Value().(context.Context)
+			validateOptions = append(validateOptions, o)
+		case optkeyTokenPool:
+			tokenPool = o.Value().(*TokenPool)
+		case optkeyDecrypt:
+			decrypt = o.Value().(*decryptParams)
 		case optkeyVerify:
 			params = o.Value().(VerifyParameters)
+		case optkeyClaimTransform:
+			transforms = append(transforms, o.Value().(*claimTransform))
+		case optkeyWithoutSignatureVerification:
+			skipVerification = o.Value().(bool)
+		case optkeyCommaSeparatedAudience:
+			commaSeparatedAudience = o.Value().(bool)
+		case optkeyOIDCDiscovery:
+			discovery = o.Value().(*oidcDiscovery)
+		case optkeyReturnInvalidToken:
+			returnInvalidToken = o.Value().(bool)
+		case optkeyValidate:
+			validate = o.Value().(bool)
+		case optkeyMinimumKeyStrength:
+			minKeyStrength = o.Value().(int)
+		case optkeyToken:
+		default:
+			validateOptions = append(validateOptions, o)
+		}
+	}
+
+	if skipVerification && params != nil {
+		return nil, errors.New(`jwt.WithoutSignatureVerification cannot be used with jwt.WithVerify`)
+	}
+
+	if decrypt != nil {
+		data, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to read token from source`)
+		}
+
+		decrypted, err := jwe.Decrypt(bytes.TrimSpace(data), decrypt.alg, decrypt.key)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to decrypt token`)
+		}
+		src = bytes.NewReader(decrypted)
+	}
+
+	if discovery != nil && (params != nil || skipVerification) {
+		return nil, errors.New(`jwt.WithOIDCDiscovery cannot be used with jwt.WithVerify or jwt.WithoutSignatureVerification`)
+	}
+
+	var acquired Token
+	if tokenPool != nil {
+		acquired = tokenPool.Get()
+	} else {
+		acquired = New()
+	}
+
+	token := acquired
+	var err error
+	if discovery != nil {
+		token, err = parseWithOIDCDiscovery(ctx, src, token, discovery, minKeyStrength, commaSeparatedAudience)
+	} else {
+		token, err = parse(src, token, params, minKeyStrength, commaSeparatedAudience)
+	}
+	if err == nil && (validate || skipVerification) {
+		if verr := Verify(token, validateOptions...); verr != nil {
+			err = &validationError{errors.Wrap(verr, `failed to validate token`)}
+		}
+	}
+	if err != nil {
+		if returnInvalidToken && token != nil && IsValidationError(err) {
+			return token, err
 		}
+		if tokenPool != nil {
+			tokenPool.Put(acquired)
+		}
+		return nil, err
 	}
 
+	for _, transform := range transforms {
+		v, ok := token.Get(transform.name)
+		if !ok {
+			continue
+		}
+
+		transformed, err := transform.fn(v)
+		if err != nil {
+			if tokenPool != nil {
+				tokenPool.Put(acquired)
+			}
+			return nil, errors.Wrapf(err, `failed to transform claim %s`, transform.name)
+		}
+
+		if err := token.Set(transform.name, transformed); err != nil {
+			if tokenPool != nil {
+				tokenPool.Put(acquired)
+			}
+			return nil, errors.Wrapf(err, `failed to set transformed claim %s`, transform.name)
+		}
+	}
+	return token, nil
+}
+
+func parse(src io.Reader, token Token, params VerifyParameters, minKeyStrength int, commaSeparatedAudience bool) (Token, error) {
+	var payload []byte
 	if params != nil {
-		return ParseVerify(src, params.Algorithm(), params.Key())
+		if err := checkKeyStrength(params.Key(), minKeyStrength); err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to read token from source`)
+		}
+
+		payload, err = jws.Verify(data, params.Algorithm(), params.Key())
+		if err != nil {
+			return nil, errors.Wrap(err, `failed to verify jws signature`)
+		}
+	} else {
+		m, err := jws.Parse(src)
+		if err != nil {
+			return nil, errors.Wrap(err, `invalid jws message`)
+		}
+		payload = m.Payload()
 	}
 
-	m, err := jws.Parse(src)
+	return tokenFromPayload(token, payload, commaSeparatedAudience)
+}
+
+func parseWithOIDCDiscovery(ctx context.Context, src io.Reader, token Token, discovery *oidcDiscovery, minKeyStrength int, commaSeparatedAudience bool) (Token, error) {
+	data, err := ioutil.ReadAll(src)
 	if err != nil {
-		return nil, errors.Wrap(err, `invalid jws message`)
+		return nil, errors.Wrap(err, `failed to read token from source`)
+	}
+
+	payload, err := discovery.verify(ctx, data, minKeyStrength)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = tokenFromPayload(token, payload, commaSeparatedAudience)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := token.Issuer(); v != discovery.issuer {
+		return token, &validationError{errors.Errorf(`iss not satisfied: %q does not match the provider`, v)}
+	}
+	return token, nil
+}
+
+// checkKeyStrength makes sure that the security strength of the
+// verification key is at least minKeyStrength bits
+func checkKeyStrength(key interface{}, minKeyStrength int) error {
+	if minKeyStrength <= 0 {
+		return nil
 	}
 
-	token := New()
-	if err := json.Unmarshal(m.Payload(), token); err != nil {
+	jwkKey, ok := key.(jwk.Key)
+	if !ok {
+		var err error
+		jwkKey, err = jwk.New(key)
+		if err != nil {
+			return errors.Wrap(err, `failed to determine key strength`)
+		}
+	}
+
+	bits, err := jwk.SecurityBits(jwkKey)
+	if err != nil {
+		return errors.Wrap(err, `failed to determine key strength`)
+	}
+	if bits < minKeyStrength {
+		return errors.Errorf(`key strength of %d bits is less than the minimum %d bits`, bits, minKeyStrength)
+	}
+	return nil
+}
+
+// tokenFromPayload stores the claims in the payload in the given token
+func tokenFromPayload(token Token, payload []byte, commaSeparatedAudience bool) (Token, error) {
+	if err := json.Unmarshal(payload, token); err != nil {
 		return nil, errors.Wrap(err, `failed to parse token`)
 	}
+
+	if commaSeparatedAudience {
+		if err := splitAudience(token, payload); err != nil {
+			return nil, errors.Wrap(err, `failed to split comma separated audience`)
+		}
+	}
 	return token, nil
 }
 
+// splitAudience replaces the audience of the token with the result of
+// splitting it on commas, if the "aud" claim in the payload is a string
+func splitAudience(token Token, payload []byte) error {
+	var raw struct {
+		Audience json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return errors.Wrap(err, `failed to parse token`)
+	}
+
+	var aud string
+	if err := json.Unmarshal(raw.Audience, &aud); err != nil {
+		// not a string: either missing, or an array
+		return nil
+	}
+
+	var list []string
+	for _, v := range strings.Split(aud, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return token.Set(AudienceKey, list)
+}
+
+// validationError is returned by Parse when the token was parsed (and
+// its signature verified, if requested), but its claims are not valid
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *validationError) Cause() error {
+	return e.err
+}
+
+// IsValidationError reports whether the error returned by `jwt.Parse`
+// was caused by the claims of the token failing validation, as opposed
+// to the token failing to be parsed or verified.
+func IsValidationError(err error) bool {
+	for err != nil {
+		if _, ok := err.(*validationError); ok {
+			return true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+	return false
+}
+
 // ParseVerify is a function that is similar to Parse(), but does not
 // allow for parsing without signature verification parameters.
 func ParseVerify(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}) (Token, error) {
@@ -79,8 +345,24 @@ func ParseVerify(src io.Reader, alg jwa.SignatureAlgorithm, key interface{}) (To
 // Sign is a convenience function to create a signed JWT token serialized in
 // compact form. `key` must match the key type required by the given
 // signature method `method`
-func Sign(t Token, method jwa.SignatureAlgorithm, key interface{}) ([]byte, error) {
-	buf, err := json.Marshal(t)
+//
+// If you would like to control the precision of the date claims, use
+// the WithNumericDateMarshalPrecision option. If you would like a single
+// audience to be serialized as a plain string, use the WithCompactAudience
+// option.
+func Sign(t Token, method jwa.SignatureAlgorithm, key interface{}, options ...Option) ([]byte, error) {
+	precision := time.Second
+	var compactAudience bool
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyNumericDatePrecision:
+			precision = o.Value().(time.Duration)
+		case optkeyCompactAudience:
+			compactAudience = o.Value().(bool)
+		}
+	}
+
+	buf, err := marshalToken(t, precision, compactAudience)
 	if err != nil {
 		return nil, errors.Wrap(err, `failed to marshal token`)
 	}
@@ -99,3 +381,55 @@ func Sign(t Token, method jwa.SignatureAlgorithm, key interface{}) ([]byte, erro
 
 	return sign, nil
 }
+
+// marshalToken serializes the token into JSON, emitting the date claims
+// with the given precision. If compactAudience is true, a single audience
+// is emitted as a plain string
+func marshalToken(t Token, precision time.Duration, compactAudience bool) ([]byte, error) {
+	compactAudience = compactAudience && t.AudienceIsSingular()
+	if precision == time.Second && !compactAudience {
+		return json.Marshal(t)
+	}
+
+	m, err := t.AsMap(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to convert token to map`)
+	}
+	for k, v := range m {
+		if tm, ok := v.(time.Time); ok {
+			m[k] = types.FormatNumericDate(tm, precision)
+		}
+	}
+	if compactAudience {
+		m[AudienceKey] = t.Audience()[0]
+	}
+	return json.Marshal(m)
+}
+
+// AccessTokenHash computes the value of the OpenID Connect "at_hash"
+// claim for the given access token, which is the base64url encoded
+// left-most half of the hash of the token. The hash function is the one
+// used by `alg`, the algorithm that the ID token is signed with.
+//
+// The same rule applies to the "c_hash" claim, so an authorization code
+// can be passed in place of the access token.
+func AccessTokenHash(accessToken string, alg jwa.SignatureAlgorithm) (string, error) {
+	hash, ok := jwa.HashForSignatureAlgorithm(alg)
+	if !ok {
+		return "", errors.Errorf(`algorithm %s does not have an associated hash function`, alg)
+	}
+	if !hash.Available() {
+		return "", errors.Errorf(`hash function %s is not available`, hash)
+	}
+
+	h := hash.New()
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// SetBufferPoolConfig is equivalent to jwk.SetBufferPoolConfig, as the
+// buffer pool is shared among the jwk, jws, jwe, and jwt packages.
+func SetBufferPoolConfig(initialCap int) {
+	pool.SetBytesBufferInitialCapacity(initialCap)
+}
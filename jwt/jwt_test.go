@@ -2,16 +2,23 @@ package jwt_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jwt"
 	"github.com/stretchr/testify/assert"
@@ -253,3 +260,932 @@ func TestUnmarshalJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestParseWithClaimTransform(t *testing.T) {
+	alg := jwa.HS256
+	key := []byte("secret")
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "Alice")
+	t1.Set("email", "alice@example.com")
+	signed, err := jwt.Sign(t1, alg, key)
+	if !assert.NoError(t, err, "jwt.Sign should succeed") {
+		return
+	}
+
+	redact := func(v interface{}) (interface{}, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New(`expected string`)
+		}
+		return strings.Repeat("*", len(s)), nil
+	}
+
+	t.Run("transform claims", func(t *testing.T) {
+		t2, err := jwt.Parse(bytes.NewReader(signed),
+			jwt.WithVerify(alg, key),
+			jwt.WithClaimTransform("email", redact),
+			jwt.WithClaimTransform(jwt.SubjectKey, func(v interface{}) (interface{}, error) {
+				return strings.ToLower(v.(string)), nil
+			}),
+			jwt.WithClaimTransform("missing", redact),
+		)
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+
+		email, ok := t2.Get("email")
+		if !assert.True(t, ok, `email claim should exist`) {
+			return
+		}
+		if !assert.Equal(t, "*****************", email, `email claim should be transformed`) {
+			return
+		}
+		if !assert.Equal(t, "alice", t2.Subject(), `sub claim should be transformed`) {
+			return
+		}
+		if _, ok := t2.Get("missing"); !assert.False(t, ok, `missing claim should not be created`) {
+			return
+		}
+	})
+	t.Run("transform error", func(t *testing.T) {
+		_, err := jwt.Parse(bytes.NewReader(signed), jwt.WithClaimTransform("email", func(interface{}) (interface{}, error) {
+			return nil, errors.New(`transform failed`)
+		}))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+}
+
+func TestParseWithoutSignatureVerification(t *testing.T) {
+	key := []byte("secret")
+	now := time.Now()
+
+	sign := func(exp time.Time) []byte {
+		t1 := jwt.New()
+		t1.Set(jwt.AudienceKey, "service")
+		t1.Set(jwt.ExpirationKey, exp)
+		signed, err := jwt.Sign(t1, jwa.HS256, key)
+		if err != nil {
+			panic(err)
+		}
+		return signed
+	}
+
+	// corrupt the signature, which would fail verification
+	valid := sign(now.Add(time.Hour))
+	tampered := append(append([]byte{}, valid[:len(valid)-4]...), []byte("AAAA")...)
+
+	t.Run("Signature is not verified", func(t *testing.T) {
+		_, err := jwt.ParseBytes(tampered, jwt.WithVerify(jwa.HS256, key))
+		if !assert.Error(t, err, `jwt.Parse with verification should fail`) {
+			return
+		}
+
+		t1, err := jwt.ParseBytes(tampered, jwt.WithoutSignatureVerification(), jwt.WithAudience("service"))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []string{"service"}, t1.Audience(), `audience should match`) {
+			return
+		}
+	})
+	t.Run("Claims are validated", func(t *testing.T) {
+		_, err := jwt.ParseBytes(valid, jwt.WithoutSignatureVerification(), jwt.WithAudience("other"))
+		if !assert.Error(t, err, `jwt.Parse with wrong audience should fail`) {
+			return
+		}
+
+		_, err = jwt.ParseBytes(sign(now.Add(-time.Hour)), jwt.WithoutSignatureVerification())
+		if !assert.Error(t, err, `jwt.Parse of expired token should fail`) {
+			return
+		}
+
+		clock := jwt.ClockFunc(func() time.Time { return now.Add(-2 * time.Hour) })
+		_, err = jwt.ParseBytes(sign(now.Add(-time.Hour)), jwt.WithoutSignatureVerification(), jwt.WithClock(clock))
+		if !assert.NoError(t, err, `jwt.Parse with clock should succeed`) {
+			return
+		}
+
+		// with signature verification, the claims are validated on request
+		_, err = jwt.ParseBytes(sign(now.Add(-time.Hour)), jwt.WithVerify(jwa.HS256, key))
+		if !assert.NoError(t, err, `jwt.Parse of expired token without WithValidate should succeed`) {
+			return
+		}
+		_, err = jwt.ParseBytes(sign(now.Add(-time.Hour)), jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true))
+		if !assert.Error(t, err, `jwt.Parse of expired token should fail`) {
+			return
+		}
+		_, err = jwt.ParseBytes(valid, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithAudience("other"))
+		if !assert.Error(t, err, `jwt.Parse with wrong audience should fail`) {
+			return
+		}
+		_, err = jwt.ParseBytes(valid, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithAudience("service"))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+	})
+	t.Run("Return invalid token", func(t *testing.T) {
+		expired := sign(now.Add(-time.Hour))
+		t1, err := jwt.ParseBytes(expired, jwt.WithoutSignatureVerification())
+		if !assert.Error(t, err, `jwt.Parse of expired token should fail`) {
+			return
+		}
+		if !assert.Nil(t, t1, `token should not be returned by default`) {
+			return
+		}
+
+		t1, err = jwt.ParseBytes(expired, jwt.WithoutSignatureVerification(), jwt.WithReturnInvalidToken(true))
+		if !assert.Error(t, err, `jwt.Parse of expired token should fail`) {
+			return
+		}
+		if !assert.True(t, jwt.IsValidationError(err), `error should be a validation error`) {
+			return
+		}
+		if !assert.NotNil(t, t1, `token should be returned`) {
+			return
+		}
+		if !assert.Equal(t, []string{"service"}, t1.Audience(), `audience should match`) {
+			return
+		}
+
+		t1, err = jwt.ParseBytes(expired, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithReturnInvalidToken(true))
+		if !assert.Error(t, err, `jwt.Parse of expired token should fail`) {
+			return
+		}
+		if !assert.True(t, jwt.IsValidationError(err), `error should be a validation error`) {
+			return
+		}
+		if !assert.NotNil(t, t1, `token should be returned`) {
+			return
+		}
+		if !assert.Equal(t, []string{"service"}, t1.Audience(), `audience should match`) {
+			return
+		}
+
+		_, err = jwt.ParseBytes(tampered, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithReturnInvalidToken(true))
+		if !assert.Error(t, err, `jwt.Parse with verification should fail`) {
+			return
+		}
+		if !assert.False(t, jwt.IsValidationError(err), `error should not be a validation error`) {
+			return
+		}
+	})
+	t.Run("Cannot be used with WithVerify", func(t *testing.T) {
+		_, err := jwt.ParseBytes(valid, jwt.WithoutSignatureVerification(), jwt.WithVerify(jwa.HS256, key))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+}
+
+func TestParseClaimValueOptionNames(t *testing.T) {
+	// claims that happen to share their names with options must be
+	// treated as claims
+	key := []byte("abracadabra")
+	names := []string{"returnInvalidToken", "validate", "decrypt", "tokenPool", "minimumKeyStrength", "oidcDiscovery", "claimTransform", "withoutSignatureVerification", "commaSeparatedAudience", "verify", "token"}
+	for _, name := range names {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t1 := jwt.New()
+			if !assert.NoError(t, t1.Set(name, "value"), `t1.Set should succeed`) {
+				return
+			}
+			signed, err := jwt.Sign(t1, jwa.HS256, key)
+			if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+				return
+			}
+
+			_, err = jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithClaimValue(name, "value"))
+			if !assert.NoError(t, err, `jwt.ParseBytes should succeed`) {
+				return
+			}
+			_, err = jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key), jwt.WithValidate(true), jwt.WithClaimValue(name, "other"))
+			if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+				return
+			}
+		})
+	}
+}
+
+func TestSignNumericDatePrecision(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+	tm := time.Unix(1600000000, 250000000)
+
+	tok := jwt.New()
+	if !assert.NoError(t, tok.Set(jwt.IssuedAtKey, tm), `tok.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, tok.Set(jwt.ExpirationKey, tm.Add(time.Hour)), `tok.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, tok.Set(jwt.SubjectKey, "user-id"), `tok.Set should succeed`) {
+		return
+	}
+
+	payloadOf := func(t *testing.T, options ...jwt.Option) (map[string]interface{}, bool) {
+		signed, err := jwt.Sign(tok, jwa.HS256, key, options...)
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return nil, false
+		}
+
+		payload, err := jws.Verify(signed, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return nil, false
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		var m map[string]interface{}
+		if !assert.NoError(t, dec.Decode(&m), `payload should be valid JSON`) {
+			return nil, false
+		}
+		return m, true
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		m, ok := payloadOf(t)
+		if !ok {
+			return
+		}
+		if !assert.Equal(t, json.Number("1600000000"), m[jwt.IssuedAtKey], `"iat" should be an integer`) {
+			return
+		}
+		if !assert.Equal(t, json.Number("1600003600"), m[jwt.ExpirationKey], `"exp" should be an integer`) {
+			return
+		}
+	})
+	t.Run("Millisecond", func(t *testing.T) {
+		m, ok := payloadOf(t, jwt.WithNumericDateMarshalPrecision(time.Millisecond))
+		if !ok {
+			return
+		}
+		if !assert.Equal(t, json.Number("1600000000.250"), m[jwt.IssuedAtKey], `"iat" should have fractional seconds`) {
+			return
+		}
+		if !assert.Equal(t, json.Number("1600003600.250"), m[jwt.ExpirationKey], `"exp" should have fractional seconds`) {
+			return
+		}
+		if !assert.Equal(t, "user-id", m[jwt.SubjectKey], `"sub" should be preserved`) {
+			return
+		}
+	})
+}
+
+func TestParseWithCommaSeparatedAudience(t *testing.T) {
+	alg := jwa.HS256
+	key := []byte("secret")
+
+	testcases := []struct {
+		name     string
+		payload  string
+		split    bool
+		expected []string
+	}{
+		{name: "comma separated, strict", payload: `{"aud":"a,b,c"}`, split: false, expected: []string{"a,b,c"}},
+		{name: "comma separated, split", payload: `{"aud":"a, b ,c"}`, split: true, expected: []string{"a", "b", "c"}},
+		{name: "single string, split", payload: `{"aud":"a"}`, split: true, expected: []string{"a"}},
+		{name: "array, strict", payload: `{"aud":["a,b","c"]}`, split: false, expected: []string{"a,b", "c"}},
+		{name: "array, split", payload: `{"aud":["a,b","c"]}`, split: true, expected: []string{"a,b", "c"}},
+		{name: "missing, split", payload: `{"sub":"alice"}`, split: true, expected: nil},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			signed, err := jws.Sign([]byte(tc.payload), alg, key)
+			if !assert.NoError(t, err, `jws.Sign should succeed`) {
+				return
+			}
+
+			for _, verify := range []bool{true, false} {
+				options := []jwt.Option{jwt.WithCommaSeparatedAudience(tc.split)}
+				if verify {
+					options = append(options, jwt.WithVerify(alg, key))
+				}
+
+				tok, err := jwt.Parse(bytes.NewReader(signed), options...)
+				if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+					return
+				}
+				if !assert.Equal(t, tc.expected, tok.Audience(), `audience should match`) {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestAccessTokenHash(t *testing.T) {
+	// Values taken from the examples in OpenID Connect Core 1.0, Appendix A
+	testcases := []struct {
+		name     string
+		input    string
+		alg      jwa.SignatureAlgorithm
+		expected string
+	}{
+		{name: "at_hash RS256", input: "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", alg: jwa.RS256, expected: "77QmUPtjPfzWtF2AnpK9RQ"},
+		{name: "at_hash ES256", input: "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", alg: jwa.ES256, expected: "77QmUPtjPfzWtF2AnpK9RQ"},
+		{name: "c_hash RS256", input: "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk", alg: jwa.RS256, expected: "LDktKdoQak3Pk0cnXxCltA"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := jwt.AccessTokenHash(tc.input, tc.alg)
+			if !assert.NoError(t, err, `jwt.AccessTokenHash should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.expected, v, `hash should match`) {
+				return
+			}
+		})
+	}
+
+	t.Run("Longer hash", func(t *testing.T) {
+		v, err := jwt.AccessTokenHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", jwa.ES512)
+		if !assert.NoError(t, err, `jwt.AccessTokenHash should succeed`) {
+			return
+		}
+		// half of a SHA-512 digest is 32 bytes
+		if !assert.Len(t, v, 43, `hash should be 32 bytes long`) {
+			return
+		}
+	})
+	t.Run("Algorithm without hash", func(t *testing.T) {
+		_, err := jwt.AccessTokenHash("token", jwa.NoSignature)
+		if !assert.Error(t, err, `jwt.AccessTokenHash should fail`) {
+			return
+		}
+	})
+}
+
+func TestSignCompactAudience(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+
+	payloadOf := func(t *testing.T, tok jwt.Token, options ...jwt.Option) (map[string]interface{}, bool) {
+		signed, err := jwt.Sign(tok, jwa.HS256, key, options...)
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return nil, false
+		}
+
+		payload, err := jws.Verify(signed, jwa.HS256, key)
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return nil, false
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(payload))
+		dec.UseNumber()
+		var m map[string]interface{}
+		if !assert.NoError(t, dec.Decode(&m), `payload should be valid JSON`) {
+			return nil, false
+		}
+
+		parsed, err := jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key))
+		if !assert.NoError(t, err, `jwt.ParseBytes should succeed`) {
+			return nil, false
+		}
+		if !assert.Equal(t, tok.Audience(), parsed.Audience(), `audience should round trip`) {
+			return nil, false
+		}
+		return m, true
+	}
+
+	single := jwt.New()
+	if !assert.NoError(t, single.Set(jwt.AudienceKey, "client"), `tok.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, single.Set(jwt.IssuedAtKey, time.Unix(1600000000, 0)), `tok.Set should succeed`) {
+		return
+	}
+	if !assert.True(t, single.AudienceIsSingular(), `AudienceIsSingular should be true`) {
+		return
+	}
+
+	multi := jwt.New()
+	if !assert.NoError(t, multi.Set(jwt.AudienceKey, []string{"client", "other"}), `tok.Set should succeed`) {
+		return
+	}
+	if !assert.False(t, multi.AudienceIsSingular(), `AudienceIsSingular should be false`) {
+		return
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		m, ok := payloadOf(t, single)
+		if !ok {
+			return
+		}
+		if !assert.Equal(t, []interface{}{"client"}, m[jwt.AudienceKey], `"aud" should be an array`) {
+			return
+		}
+	})
+	t.Run("Compact single audience", func(t *testing.T) {
+		m, ok := payloadOf(t, single, jwt.WithCompactAudience(true))
+		if !ok {
+			return
+		}
+		if !assert.Equal(t, "client", m[jwt.AudienceKey], `"aud" should be a string`) {
+			return
+		}
+		if !assert.Equal(t, json.Number("1600000000"), m[jwt.IssuedAtKey], `"iat" should be an integer`) {
+			return
+		}
+	})
+	t.Run("Compact multiple audiences", func(t *testing.T) {
+		m, ok := payloadOf(t, multi, jwt.WithCompactAudience(true))
+		if !ok {
+			return
+		}
+		if !assert.Equal(t, []interface{}{"client", "other"}, m[jwt.AudienceKey], `"aud" should be an array`) {
+			return
+		}
+	})
+}
+
+func TestParseWithOIDCDiscovery(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	pubkey, err := jwk.New(&key.PublicKey)
+	if !assert.NoError(t, err, `jwk.New should succeed`) {
+		return
+	}
+	if !assert.NoError(t, pubkey.Set(jwk.KeyIDKey, "provider-key"), `pubkey.Set should succeed`) {
+		return
+	}
+
+	var discoveryRequests int
+	var failDiscovery bool
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc(jwt.OIDCDiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		discoveryRequests++
+		if failDiscovery {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(`Content-Type`, `application/json`)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                srv.URL,
+			"jwks_uri":                              srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jwk.Key{pubkey}})
+	})
+
+	signToken := func(t *testing.T, iss string, alg jwa.SignatureAlgorithm, signKey interface{}) []byte {
+		tok := jwt.New()
+		tok.Set(jwt.IssuerKey, iss)
+		tok.Set(jwt.SubjectKey, "user-id")
+
+		payload, err := json.Marshal(tok)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return nil
+		}
+		hdr := jws.NewHeaders()
+		hdr.Set(jws.KeyIDKey, "provider-key")
+		signed, err := jws.Sign(payload, alg, signKey, jws.WithHeaders(hdr))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return nil
+		}
+		return signed
+	}
+
+	discovery := jwt.WithOIDCDiscovery(srv.URL)
+
+	t.Run("Valid token", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			tok, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), discovery)
+			if !assert.NoError(t, err, `jwt.ParseBytes should succeed`) {
+				return
+			}
+			if !assert.Equal(t, "user-id", tok.Subject(), `"sub" should match`) {
+				return
+			}
+		}
+		if !assert.Equal(t, 1, discoveryRequests, `discovery document should be fetched once`) {
+			return
+		}
+	})
+	t.Run("Wrong issuer", func(t *testing.T) {
+		_, err := jwt.ParseBytes(signToken(t, "https://attacker.example.com", jwa.RS256, key), discovery)
+		if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+			return
+		}
+	})
+	t.Run("Unsupported algorithm", func(t *testing.T) {
+		_, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.PS256, key), discovery)
+		if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+			return
+		}
+	})
+	t.Run("Unknown key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+			return
+		}
+		_, err = jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, other), discovery)
+		if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+			return
+		}
+	})
+	t.Run("Issuer mismatch in discovery document", func(t *testing.T) {
+		_, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), jwt.WithOIDCDiscovery(srv.URL+"/"))
+		if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+			return
+		}
+	})
+	t.Run("Failures are not cached", func(t *testing.T) {
+		discovery := jwt.WithOIDCDiscovery(srv.URL)
+
+		failDiscovery = true
+		_, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), discovery)
+		failDiscovery = false
+		if !assert.Error(t, err, `jwt.ParseBytes should fail`) {
+			return
+		}
+
+		_, err = jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), discovery)
+		if !assert.NoError(t, err, `jwt.ParseBytes should succeed once the provider is available`) {
+			return
+		}
+	})
+	t.Run("Context", func(t *testing.T) {
+		discovery := jwt.WithOIDCDiscovery(srv.URL)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), discovery, jwt.WithContext(ctx))
+		if !assert.Error(t, err, `jwt.ParseBytes with canceled context should fail`) {
+			return
+		}
+
+		_, err = jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), discovery, jwt.WithContext(context.Background()))
+		if !assert.NoError(t, err, `jwt.ParseBytes should succeed`) {
+			return
+		}
+	})
+	t.Run("HTTP client", func(t *testing.T) {
+		var requests int
+		cl := &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				requests++
+				return http.DefaultTransport.RoundTrip(r)
+			}),
+		}
+
+		_, err := jwt.ParseBytes(signToken(t, srv.URL, jwa.RS256, key), jwt.WithOIDCDiscovery(srv.URL, jwt.WithHTTPClient(cl)))
+		if !assert.NoError(t, err, `jwt.ParseBytes should succeed`) {
+			return
+		}
+		if !assert.Equal(t, 2, requests, `discovery document and JWKS should be fetched using the client`) {
+			return
+		}
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestParseMinimumKeyStrength(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	strong, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "key-strength")
+
+	t.Run("Weak key", func(t *testing.T) {
+		signed, err := jwt.Sign(t1, jwa.RS256, weak)
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return
+		}
+		_, err = jwt.ParseBytes(signed, jwt.WithVerify(jwa.RS256, &weak.PublicKey))
+		if !assert.NoError(t, err, `jwt.Parse without minimum should succeed`) {
+			return
+		}
+		_, err = jwt.ParseBytes(signed, jwt.WithVerify(jwa.RS256, &weak.PublicKey), jwt.WithMinimumKeyStrength(112))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+	t.Run("Strong key", func(t *testing.T) {
+		signed, err := jwt.Sign(t1, jwa.RS256, strong)
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return
+		}
+		t2, err := jwt.ParseBytes(signed, jwt.WithVerify(jwa.RS256, &strong.PublicKey), jwt.WithMinimumKeyStrength(112))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "key-strength", t2.Subject(), `subject should match`) {
+			return
+		}
+	})
+}
+
+func TestSerializer(t *testing.T) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err, `rsa.GenerateKey should succeed`) {
+		return
+	}
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "john.doe")
+	t1.Set(jwt.IssuedAtKey, time.Now())
+
+	t.Run("Sign then encrypt", func(t *testing.T) {
+		serialized, err := jwt.NewSerializer().
+			Sign(jwa.RS256, signingKey).
+			Encrypt(jwa.RSA_OAEP, &encryptionKey.PublicKey, jwa.A256GCM, jwa.NoCompress).
+			Serialize(t1)
+		if !assert.NoError(t, err, `serializer.Serialize should succeed`) {
+			return
+		}
+
+		// in the compact serialization, every header is protected
+		encoded := bytes.SplitN(serialized, []byte{'.'}, 2)[0]
+		decoded, err := base64.RawURLEncoding.DecodeString(string(encoded))
+		if !assert.NoError(t, err, `base64 decoding the header should succeed`) {
+			return
+		}
+		protected := jwe.NewHeaders()
+		if !assert.NoError(t, json.Unmarshal(decoded, protected), `json.Unmarshal should succeed`) {
+			return
+		}
+		if !assert.Equal(t, "JWT", protected.ContentType(), `"cty" should be "JWT"`) {
+			return
+		}
+
+		t2, err := jwt.Parse(bytes.NewReader(serialized), jwt.WithDecrypt(jwa.RSA_OAEP, encryptionKey), jwt.WithVerify(jwa.RS256, &signingKey.PublicKey))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, t1.Subject(), t2.Subject(), `"sub" should match`) {
+			return
+		}
+
+		_, err = jwt.Parse(bytes.NewReader(serialized), jwt.WithVerify(jwa.RS256, &signingKey.PublicKey))
+		if !assert.Error(t, err, `jwt.Parse without WithDecrypt should fail`) {
+			return
+		}
+	})
+	t.Run("Sign only", func(t *testing.T) {
+		serialized, err := jwt.NewSerializer().
+			Sign(jwa.RS256, signingKey).
+			Serialize(t1)
+		if !assert.NoError(t, err, `serializer.Serialize should succeed`) {
+			return
+		}
+
+		msg, err := jws.Parse(bytes.NewReader(serialized))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		hdr := msg.Signatures()[0].ProtectedHeaders()
+		if !assert.Equal(t, "JWT", hdr.Type(), `"typ" should be "JWT"`) {
+			return
+		}
+		if !assert.Empty(t, hdr.ContentType(), `"cty" should not be set`) {
+			return
+		}
+
+		t2, err := jwt.Parse(bytes.NewReader(serialized), jwt.WithVerify(jwa.RS256, &signingKey.PublicKey))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, t1.Subject(), t2.Subject(), `"sub" should match`) {
+			return
+		}
+	})
+	t.Run("No steps", func(t *testing.T) {
+		_, err := jwt.NewSerializer().Serialize(t1)
+		if !assert.Error(t, err, `serializer.Serialize should fail`) {
+			return
+		}
+	})
+}
+
+func TestDownscope(t *testing.T) {
+	src := jwt.New()
+	src.Set(jwt.SubjectKey, "john.doe")
+	src.Set(jwt.AudienceKey, []string{"api", "billing", "reports"})
+	src.Set(jwt.ScopeKey, "read write admin")
+	src.Set("client_id", "my-client")
+
+	t.Run("Narrowing", func(t *testing.T) {
+		dst, err := jwt.Downscope(src, jwt.WithDownscopeAudience("billing"), jwt.WithDownscopeScopes("read"))
+		if !assert.NoError(t, err, `jwt.Downscope should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []string{"billing"}, dst.Audience(), `"aud" should be narrowed`) {
+			return
+		}
+		v, ok := dst.Get(jwt.ScopeKey)
+		if !assert.True(t, ok, `"scope" should exist`) {
+			return
+		}
+		if !assert.Equal(t, "read", v, `"scope" should be narrowed`) {
+			return
+		}
+
+		// other claims are copied, and the source is untouched
+		if !assert.Equal(t, "john.doe", dst.Subject(), `"sub" should be copied`) {
+			return
+		}
+		v, ok = dst.Get("client_id")
+		if !assert.True(t, ok, `"client_id" should be copied`) {
+			return
+		}
+		if !assert.Equal(t, "my-client", v, `"client_id" should be copied`) {
+			return
+		}
+		if !assert.Len(t, src.Audience(), 3, `source "aud" should be untouched`) {
+			return
+		}
+	})
+	t.Run("No restrictions", func(t *testing.T) {
+		dst, err := jwt.Downscope(src)
+		if !assert.NoError(t, err, `jwt.Downscope should succeed`) {
+			return
+		}
+		if !assert.Equal(t, src.Audience(), dst.Audience(), `"aud" should be copied`) {
+			return
+		}
+		v, _ := dst.Get(jwt.ScopeKey)
+		if !assert.Equal(t, "read write admin", v, `"scope" should be copied`) {
+			return
+		}
+	})
+	t.Run("Scope as a list", func(t *testing.T) {
+		src := jwt.New()
+		src.Set(jwt.ScopeKey, []interface{}{"read", "write"})
+
+		dst, err := jwt.Downscope(src, jwt.WithDownscopeScopes("write"))
+		if !assert.NoError(t, err, `jwt.Downscope should succeed`) {
+			return
+		}
+		v, _ := dst.Get(jwt.ScopeKey)
+		if !assert.Equal(t, "write", v, `"scope" should be narrowed`) {
+			return
+		}
+	})
+	t.Run("Removing all scopes", func(t *testing.T) {
+		dst, err := jwt.Downscope(src, jwt.WithDownscopeScopes())
+		if !assert.NoError(t, err, `jwt.Downscope should succeed`) {
+			return
+		}
+		_, ok := dst.Get(jwt.ScopeKey)
+		if !assert.False(t, ok, `"scope" should be removed`) {
+			return
+		}
+	})
+	t.Run("Widening", func(t *testing.T) {
+		_, err := jwt.Downscope(src, jwt.WithDownscopeAudience("billing", "admin-console"))
+		if !assert.Error(t, err, `jwt.Downscope should fail to widen "aud"`) {
+			return
+		}
+		_, err = jwt.Downscope(src, jwt.WithDownscopeScopes("read", "delete"))
+		if !assert.Error(t, err, `jwt.Downscope should fail to widen "scope"`) {
+			return
+		}
+
+		noscope := jwt.New()
+		_, err = jwt.Downscope(noscope, jwt.WithDownscopeScopes("read"))
+		if !assert.Error(t, err, `jwt.Downscope should fail to add "scope"`) {
+			return
+		}
+		_, err = jwt.Downscope(noscope, jwt.WithDownscopeAudience("api"))
+		if !assert.Error(t, err, `jwt.Downscope should fail to add "aud"`) {
+			return
+		}
+	})
+}
+
+func TestTokenPool(t *testing.T) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "john.doe")
+	t1.Set(jwt.AudienceKey, "api")
+	t1.Set("client_id", "my-client")
+	signed, err := jwt.Sign(t1, jwa.HS256, key)
+	if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+		return
+	}
+
+	t.Run("Reset", func(t *testing.T) {
+		t2 := jwt.New()
+		t2.Set(jwt.SubjectKey, "john.doe")
+		t2.Set("client_id", "my-client")
+		t2.Reset()
+		claims, err := t2.AsMap(context.Background())
+		if !assert.NoError(t, err, `t2.AsMap should succeed`) {
+			return
+		}
+		if !assert.Empty(t, claims, `token should be empty after Reset`) {
+			return
+		}
+		if !assert.NoError(t, t2.Set("client_id", "other-client"), `token should be usable after Reset`) {
+			return
+		}
+		claims, err = t2.AsMap(context.Background())
+		if !assert.NoError(t, err, `t2.AsMap should succeed`) {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"client_id": "other-client"}, claims, `token should have 1 claim`) {
+			return
+		}
+	})
+	t.Run("Parse", func(t *testing.T) {
+		pool := jwt.NewTokenPool()
+		for i := 0; i < 3; i++ {
+			t2, err := jwt.Parse(bytes.NewReader(signed), jwt.WithVerify(jwa.HS256, key), jwt.WithTokenPool(pool))
+			if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+				return
+			}
+			if !assert.Equal(t, "john.doe", t2.Subject(), `"sub" should match`) {
+				return
+			}
+			if !assert.Equal(t, []string{"api"}, t2.Audience(), `"aud" should match`) {
+				return
+			}
+			v, _ := t2.Get("client_id")
+			if !assert.Equal(t, "my-client", v, `"client_id" should match`) {
+				return
+			}
+			pool.Put(t2)
+		}
+
+		_, err := jwt.Parse(bytes.NewReader(signed), jwt.WithVerify(jwa.HS256, []byte("wrong-key")), jwt.WithTokenPool(pool))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+	t.Run("Get returns empty tokens", func(t *testing.T) {
+		pool := jwt.NewTokenPool()
+		t2 := pool.Get()
+		t2.Set(jwt.SubjectKey, "john.doe")
+		pool.Put(t2)
+
+		// pools may or may not return the same instance
+		claims, err := pool.Get().AsMap(context.Background())
+		if !assert.NoError(t, err, `AsMap should succeed`) {
+			return
+		}
+		if !assert.Empty(t, claims, `token from pool should be empty`) {
+			return
+		}
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	key := []byte("abracadabra-abracadabra-abracadabra")
+
+	t1 := jwt.New()
+	t1.Set(jwt.SubjectKey, "john.doe")
+	t1.Set(jwt.AudienceKey, "api")
+	t1.Set(jwt.IssuedAtKey, time.Now())
+	signed, err := jwt.Sign(t1, jwa.HS256, key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("New token", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Token pool", func(b *testing.B) {
+		pool := jwt.NewTokenPool()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			token, err := jwt.ParseBytes(signed, jwt.WithVerify(jwa.HS256, key), jwt.WithTokenPool(pool))
+			if err != nil {
+				b.Fatal(err)
+			}
+			pool.Put(token)
+		}
+	})
+}
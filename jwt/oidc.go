@@ -0,0 +1,206 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/pkg/errors"
+)
+
+// OIDCDiscoveryPath is the path, relative to the issuer, of the OpenID
+// Connect discovery document
+const OIDCDiscoveryPath = `/.well-known/openid-configuration`
+
+// OIDCProviderMetadata holds the members of the OpenID Connect discovery
+// document that are used to verify tokens
+type OIDCProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+const optkeyHTTPClient = "jwt.oidc.httpClient"
+
+type oidcDiscovery struct {
+	issuer string
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *OIDCProviderMetadata
+	keyset   *jwk.Set
+}
+
+// WithHTTPClient specifies the HTTP client that WithOIDCDiscovery uses to
+// fetch the discovery document and the JWKS. By default
+// http.DefaultClient is used.
+func WithHTTPClient(cl *http.Client) Option {
+	return option.New(optkeyHTTPClient, cl)
+}
+
+// WithOIDCDiscovery specifies that `jwt.Parse` should verify the token
+// using the metadata published by the OpenID Connect provider `issuer`.
+// The discovery document is fetched from `issuer` + OIDCDiscoveryPath,
+// and the keys are fetched from its "jwks_uri". Then:
+//
+//   - the "alg" header of the token must be one of the algorithms listed
+//     in "id_token_signing_alg_values_supported"
+//   - the signature must be verifiable by a key in the JWKS, selected by
+//     the "kid" header if present
+//   - the "iss" claim must be equal to the issuer
+//
+// The documents are fetched the first time the option is used, using the
+// context given to `jwt.Parse` via WithContext, and are reused for as long
+// as the option is. If fetching fails, it is retried the next time the
+// option is used. Create a new option to pick up key rotations. Use the
+// WithHTTPClient option to specify the HTTP client.
+//
+// This option cannot be used with WithVerify.
+func WithOIDCDiscovery(issuer string, options ...Option) Option {
+	client := http.DefaultClient
+	for _, o := range options {
+		switch o.Name() {
+		case optkeyHTTPClient:
+			client = o.Value().(*http.Client)
+		}
+	}
+
+	return option.New(optkeyOIDCDiscovery, &oidcDiscovery{
+		issuer: issuer,
+		client: client,
+	})
+}
+
+// fetch returns the provider metadata and keys, fetching them if they
+// have not been fetched successfully yet. Failures are not cached
+func (d *oidcDiscovery) fetch(ctx context.Context) (*OIDCProviderMetadata, *jwk.Set, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.keyset != nil {
+		return d.metadata, d.keyset, nil
+	}
+
+	metadata, err := fetchOIDCProviderMetadata(ctx, d.client, d.issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyset, err := jwk.FetchHTTPWithContext(ctx, metadata.JWKSURI, jwk.WithHTTPClient(d.client))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, `failed to fetch JWKS`)
+	}
+
+	d.metadata = metadata
+	d.keyset = keyset
+	return metadata, keyset, nil
+}
+
+func fetchOIDCProviderMetadata(ctx context.Context, client *http.Client, issuer string) (*OIDCProviderMetadata, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(issuer, "/")+OIDCDiscoveryPath, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to create discovery request`)
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to fetch discovery document`)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`failed to fetch discovery document (status = %d)`, res.StatusCode)
+	}
+
+	var metadata OIDCProviderMetadata
+	if err := json.NewDecoder(res.Body).Decode(&metadata); err != nil {
+		return nil, errors.Wrap(err, `failed to parse discovery document`)
+	}
+
+	// OpenID Connect Discovery 1.0, section 4.3
+	if metadata.Issuer != issuer {
+		return nil, errors.Errorf(`issuer in discovery document %q does not match %q`, metadata.Issuer, issuer)
+	}
+	if metadata.JWKSURI == "" {
+		return nil, errors.New(`discovery document does not contain "jwks_uri"`)
+	}
+	return &metadata, nil
+}
+
+// verify verifies the signature of the token using the provider's keys,
+// and returns the payload
+func (d *oidcDiscovery) verify(ctx context.Context, data []byte, minKeyStrength int) ([]byte, error) {
+	metadata, keyset, err := d.fetch(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to discover OpenID Connect provider`)
+	}
+
+	m, err := jws.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, `invalid jws message`)
+	}
+	if len(m.Signatures()) != 1 {
+		return nil, errors.New(`token must have exactly one signature`)
+	}
+	hdr := m.Signatures()[0].ProtectedHeaders()
+
+	alg := hdr.Algorithm()
+	if !isSupportedOIDCAlgorithm(alg, metadata.IDTokenSigningAlgValuesSupported) {
+		return nil, errors.Errorf(`algorithm %s is not supported by the provider`, alg)
+	}
+
+	candidates := keyset.Keys
+	if kid := hdr.KeyID(); kid != "" {
+		candidates = keyset.LookupKeyID(kid)
+	}
+
+	for _, key := range candidates {
+		if v := key.Algorithm(); v != "" && v != alg.String() {
+			continue
+		}
+		if v := key.KeyUsage(); v != "" && v != "sig" {
+			continue
+		}
+
+		var rawkey interface{}
+		if err := key.Raw(&rawkey); err != nil {
+			continue
+		}
+
+		payload, err := jws.Verify(data, alg, rawkey)
+		if err != nil {
+			continue
+		}
+		if err := checkKeyStrength(key, minKeyStrength); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+	return nil, errors.New(`failed to verify jws signature using the provider's keys`)
+}
+
+// isSupportedOIDCAlgorithm reports whether alg may be used. When the
+// provider does not list its algorithms, RS256 is assumed, as required by
+// OpenID Connect Discovery 1.0
+func isSupportedOIDCAlgorithm(alg jwa.SignatureAlgorithm, supported []string) bool {
+	if alg == jwa.NoSignature {
+		return false
+	}
+	if len(supported) == 0 {
+		return alg == jwa.RS256
+	}
+	for _, v := range supported {
+		if v == alg.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -78,6 +78,10 @@ type Token interface {
 	Iterate(context.Context) Iterator
 	Walk(context.Context, Visitor) error
 	AsMap(context.Context) (map[string]interface{}, error)
+	IntrospectionResponse(bool) (map[string]interface{}, error)
+	DecodeInto(interface{}) error
+	AudienceIsSingular() bool
+	Reset()
 }
 type stdToken struct {
 	audience            types.StringList       // https://tools.ietf.org/html/rfc7519#section-4.1.3
@@ -845,7 +849,10 @@ func (t *stdToken) UnmarshalJSON(buf []byte) error {
 	t.phoneNumberVerified = proxy.XphoneNumberVerified
 	t.address = proxy.Xaddress
 	t.updatedAt = proxy.XupdatedAt
-	var m map[string]interface{}
+	m := t.privateClaims
+	if len(m) > 0 {
+		m = nil
+	}
 	if err := json.Unmarshal(buf, &m); err != nil {
 		return errors.Wrap(err, `failed to parse privsate parameters`)
 	}
@@ -947,3 +954,72 @@ func (t *stdToken) Walk(ctx context.Context, visitor Visitor) error {
 func (t *stdToken) AsMap(ctx context.Context) (map[string]interface{}, error) {
 	return iter.AsMap(ctx, t)
 }
+
+// IntrospectionResponse returns the token as an OAuth 2.0 token
+// introspection response, as described in https://tools.ietf.org/html/rfc7662#section-2.2
+//
+// Date claims are represented as the number of seconds since the epoch.
+// All other claims, including private claims such as "scope" and
+// "client_id", are included as-is, except for "active", which is always
+// set to the given value. If `active` is false, the response only contains
+// the "active" field, as RFC7662 recommends against disclosing information
+// about inactive tokens
+func (t *stdToken) IntrospectionResponse(active bool) (map[string]interface{}, error) {
+	if !active {
+		return map[string]interface{}{`active`: false}, nil
+	}
+
+	res, err := t.AsMap(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to convert token to map`)
+	}
+	if v, ok := res[ExpirationKey].(time.Time); ok {
+		res[ExpirationKey] = v.Unix()
+	}
+	if v, ok := res[IssuedAtKey].(time.Time); ok {
+		res[IssuedAtKey] = v.Unix()
+	}
+	if v, ok := res[NotBeforeKey].(time.Time); ok {
+		res[NotBeforeKey] = v.Unix()
+	}
+	if v, ok := res[UpdatedAtKey].(time.Time); ok {
+		res[UpdatedAtKey] = v.Unix()
+	}
+	res[`active`] = true
+	return res, nil
+}
+
+// DecodeInto stores the claims of the token in the value pointed to
+// by v, in the same manner as json.Unmarshal would if it were given
+// the JSON representation of the token. Date claims are decoded into
+// struct fields of type time.Time as is, and into numeric fields as
+// the number of seconds since the epoch.
+func (t *stdToken) DecodeInto(v interface{}) error {
+	claims, err := t.AsMap(context.Background())
+	if err != nil {
+		return errors.Wrap(err, `failed to convert token to map`)
+	}
+	return types.DecodeInto(claims, v)
+}
+
+// AudienceIsSingular reports whether the token has exactly one
+// audience, in which case the "aud" claim may be serialized as a
+// plain string instead of an array. See jwt.WithCompactAudience
+func (t *stdToken) AudienceIsSingular() bool {
+	return len(t.Audience()) == 1
+}
+
+// Reset removes all claims from the token, including private claims,
+// so that the token can be reused. See jwt.TokenPool
+func (t *stdToken) Reset() {
+	claims := t.privateClaims
+	if claims == nil {
+		claims = make(map[string]interface{})
+	}
+	for name := range claims {
+		delete(claims, name)
+	}
+	*t = stdToken{
+		privateClaims: claims,
+	}
+}
@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"time"
+
 	"github.com/lestrrat-go/jwx/internal/option"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwt/openid"
@@ -9,8 +11,25 @@ import (
 type Option = option.Interface
 
 const (
-	optkeyVerify = `verify`
-	optkeyToken  = `token`
+	optkeyNumericDatePrecision = `numericDatePrecision`
+	optkeyCompactAudience      = `compactAudience`
+)
+
+// Options that Parse does not recognize are passed on to Verify, which
+// treats them as claim values (see WithClaimValue), so the options below
+// are namespaced to keep them from colliding with the names of claims
+const (
+	optkeyReturnInvalidToken           = `jwt.parse.returnInvalidToken`
+	optkeyValidate                     = `jwt.parse.validate`
+	optkeyDecrypt                      = `jwt.parse.decrypt`
+	optkeyTokenPool                    = `jwt.parse.tokenPool`
+	optkeyMinimumKeyStrength           = `jwt.parse.minimumKeyStrength`
+	optkeyOIDCDiscovery                = `jwt.parse.oidcDiscovery`
+	optkeyClaimTransform               = `jwt.parse.claimTransform`
+	optkeyWithoutSignatureVerification = `jwt.parse.withoutSignatureVerification`
+	optkeyCommaSeparatedAudience       = `jwt.parse.commaSeparatedAudience`
+	optkeyVerify                       = `jwt.parse.verify`
+	optkeyToken                        = `jwt.parse.token`
 )
 
 type VerifyParameters interface {
@@ -38,6 +57,83 @@ func WithVerify(alg jwa.SignatureAlgorithm, key interface{}) Option {
 	})
 }
 
+type decryptParams struct {
+	alg jwa.KeyEncryptionAlgorithm
+	key interface{}
+}
+
+// WithDecrypt specifies that `jwt.Parse` should decrypt the token using
+// `alg` and `key` before parsing its content, which must be a signed
+// JWT. This is how nested tokens created by `jwt.Serializer` (signed,
+// then encrypted) are parsed. Use along with `jwt.WithVerify` to verify
+// the inner token.
+func WithDecrypt(alg jwa.KeyEncryptionAlgorithm, key interface{}) Option {
+	return option.New(optkeyDecrypt, &decryptParams{
+		alg: alg,
+		key: key,
+	})
+}
+
+// WithTokenPool specifies that `jwt.Parse` should take the token to
+// parse into from `pool`, instead of allocating a new one. If parsing
+// fails, the token is returned to the pool, unless it is returned along
+// with the error (see WithReturnInvalidToken). Otherwise the caller owns
+// the token, and must release it using `pool.Put` once done with it.
+//
+// Do not keep references to a token, or to values obtained from it,
+// after releasing it.
+func WithTokenPool(pool *TokenPool) Option {
+	return option.New(optkeyTokenPool, pool)
+}
+
+type claimTransform struct {
+	name string
+	fn   func(interface{}) (interface{}, error)
+}
+
+// WithClaimTransform specifies a function that transforms the value of
+// the claim `name` when parsing a token. The transformation is applied
+// after the signature has been verified, and before the token is
+// returned. The function is not called if the claim does not exist.
+//
+// Multiple transformations may be registered by specifying this option
+// multiple times. If any of the functions return an error, parsing fails.
+func WithClaimTransform(name string, fn func(interface{}) (interface{}, error)) Option {
+	return option.New(optkeyClaimTransform, &claimTransform{
+		name: name,
+		fn:   fn,
+	})
+}
+
+// WithoutSignatureVerification specifies that `jwt.Parse` should NOT
+// verify the signature of the token, but should still validate the claims
+// using `jwt.Verify`. The options given to `jwt.Parse` that are not
+// specific to parsing (such as `jwt.WithAudience` or `jwt.WithClock`)
+// are passed to `jwt.Verify`.
+//
+// This is ONLY safe when the token is received from a trusted party that
+// has already verified the signature, for example a sidecar proxy that
+// communicates with you over mutually authenticated TLS. Anybody who can
+// send you tokens through other means can forge claims.
+//
+// This option cannot be used along with `jwt.WithVerify`.
+func WithoutSignatureVerification() Option {
+	return option.New(optkeyWithoutSignatureVerification, true)
+}
+
+// WithNumericDateMarshalPrecision specifies the precision of the date
+// claims such as "exp", "iat", and "nbf" when `jwt.Sign` serializes the
+// token. The dates are truncated to the given precision. When the
+// precision is one second or more, the dates are emitted as integers,
+// otherwise they are emitted with fractional seconds (for example
+// 1600000000.250 for `time.Millisecond`).
+//
+// By default dates are emitted as integer seconds, as some verifiers
+// reject non-integer values.
+func WithNumericDateMarshalPrecision(p time.Duration) Option {
+	return option.New(optkeyNumericDatePrecision, p)
+}
+
 // WithToken specifies the token instance that is used when parsing
 // JWT tokens.
 func WithToken(t Token) Option {
@@ -52,3 +148,61 @@ func WithToken(t Token) Option {
 func WithOpenIDClaims() Option {
 	return WithToken(openid.New())
 }
+
+// WithCommaSeparatedAudience specifies whether `jwt.Parse` should split
+// an "aud" claim that is encoded as a single string on commas, treating
+// `"a,b,c"` as the three audiences "a", "b", and "c". Whitespace around
+// each audience is removed, and empty values are dropped. Audiences that
+// are encoded as a JSON array are never split.
+//
+// This is a compatibility shim for issuers that do not follow RFC7519,
+// and is disabled by default. Do not enable it unless you have to.
+func WithCommaSeparatedAudience(b bool) Option {
+	return option.New(optkeyCommaSeparatedAudience, b)
+}
+
+// WithCompactAudience specifies whether `jwt.Sign` should serialize an
+// "aud" claim with exactly one audience as a plain string, instead of an
+// array with a single element. Both forms are valid according to RFC7519,
+// but some verifiers only accept one of them.
+//
+// By default the "aud" claim is always serialized as an array.
+func WithCompactAudience(b bool) Option {
+	return option.New(optkeyCompactAudience, b)
+}
+
+// WithValidate specifies whether `jwt.Parse` should validate the claims
+// of the token using `jwt.Verify` once it has been parsed, and its
+// signature verified. The options given to `jwt.Parse` that are not
+// specific to parsing (such as `jwt.WithAudience` or `jwt.WithClock`)
+// are passed to `jwt.Verify`.
+//
+// The claims are always validated when WithoutSignatureVerification is
+// specified.
+func WithValidate(b bool) Option {
+	return option.New(optkeyValidate, b)
+}
+
+// WithReturnInvalidToken specifies whether `jwt.Parse` should return the
+// parsed token along with the error when the claims of the token fail
+// validation (see WithValidate), for example so that the subject of a
+// rejected token can be logged. The error is still returned, and
+// jwt.IsValidationError reports true for it. Never trust the claims of a
+// token returned this way.
+//
+// Tokens that fail to be parsed, or whose signature fails to verify when
+// WithVerify or WithOIDCDiscovery is specified, are never returned.
+func WithReturnInvalidToken(b bool) Option {
+	return option.New(optkeyReturnInvalidToken, b)
+}
+
+// WithMinimumKeyStrength specifies that `jwt.Parse` should reject tokens
+// whose signature is verified by a key with a security strength of less
+// than `bits`, as computed by jwk.SecurityBits. For example, 112 accepts
+// RSA keys of 2048 bits or more, and rejects 1024 bit keys.
+//
+// This applies to the key given to jwt.WithVerify, and to the key that
+// jwt.WithOIDCDiscovery selected from the provider's keys.
+func WithMinimumKeyStrength(bits int) Option {
+	return option.New(optkeyMinimumKeyStrength, bits)
+}
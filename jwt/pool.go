@@ -0,0 +1,41 @@
+package jwt
+
+import "sync"
+
+// TokenPool is a pool of tokens that `jwt.Parse` can take tokens from
+// (see WithTokenPool), to reduce allocations in programs that parse
+// many tokens. It is safe for concurrent use.
+//
+// Tokens must be returned using Put once they are no longer used. After
+// Put, the token is reset and may be handed out again at any time, so
+// neither the token nor any value obtained from it by reference (such
+// as the map returned by PrivateClaims) may be used any more.
+type TokenPool struct {
+	pool sync.Pool
+}
+
+// NewTokenPool creates a new TokenPool that holds tokens created by
+// `jwt.New`
+func NewTokenPool() *TokenPool {
+	return &TokenPool{
+		pool: sync.Pool{
+			New: func() interface{} {
+				return New()
+			},
+		},
+	}
+}
+
+// Get returns an empty token from the pool, creating one if necessary
+func (p *TokenPool) Get() Token {
+	return p.pool.Get().(Token)
+}
+
+// Put resets the token and returns it to the pool
+func (p *TokenPool) Put(t Token) {
+	if t == nil {
+		return
+	}
+	t.Reset()
+	p.pool.Put(t)
+}
@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/pkg/errors"
+)
+
+// Serializer serializes a token by applying a series of signing and
+// encryption steps, in the order they were added. This makes it easy to
+// create nested tokens, such as signed-then-encrypted ones:
+//
+//	buf, err := jwt.NewSerializer().
+//	  Sign(jwa.RS256, signingKey).
+//	  Encrypt(jwa.RSA_OAEP, encryptionKey, jwa.A256GCM, jwa.NoCompress).
+//	  Serialize(token)
+//
+// Every step after the first one wraps a JWT, so its "cty" header is set
+// to "JWT" automatically.
+type Serializer struct {
+	steps []serializerStep
+}
+
+// serializerStep transforms the output of the previous step. The first
+// step receives the JSON serialization of the token
+type serializerStep interface {
+	serialize(payload []byte, nested bool) ([]byte, error)
+}
+
+type signStep struct {
+	alg     jwa.SignatureAlgorithm
+	key     interface{}
+	options []Option
+}
+
+type encryptStep struct {
+	keyalg      jwa.KeyEncryptionAlgorithm
+	key         interface{}
+	contentalg  jwa.ContentEncryptionAlgorithm
+	compressalg jwa.CompressionAlgorithm
+	options     []jwe.Option
+}
+
+// NewSerializer creates a new Serializer with no steps
+func NewSerializer() *Serializer {
+	return &Serializer{}
+}
+
+// Sign adds a step that signs the payload using `alg` and `key`. The
+// options that `jwt.Sign` accepts, such as WithNumericDateMarshalPrecision,
+// are applied when marshaling the token.
+func (s *Serializer) Sign(alg jwa.SignatureAlgorithm, key interface{}, options ...Option) *Serializer {
+	s.steps = append(s.steps, &signStep{
+		alg:     alg,
+		key:     key,
+		options: options,
+	})
+	return s
+}
+
+// Encrypt adds a step that encrypts the payload. The arguments are passed
+// to `jwe.Encrypt`.
+func (s *Serializer) Encrypt(keyalg jwa.KeyEncryptionAlgorithm, key interface{}, contentalg jwa.ContentEncryptionAlgorithm, compressalg jwa.CompressionAlgorithm, options ...jwe.Option) *Serializer {
+	s.steps = append(s.steps, &encryptStep{
+		keyalg:      keyalg,
+		key:         key,
+		contentalg:  contentalg,
+		compressalg: compressalg,
+		options:     options,
+	})
+	return s
+}
+
+// Serialize applies the steps to the token, and returns the result
+func (s *Serializer) Serialize(t Token) ([]byte, error) {
+	if len(s.steps) == 0 {
+		return nil, errors.New(`serializer has no steps`)
+	}
+
+	precision := time.Second
+	var compactAudience bool
+	for _, step := range s.steps {
+		sign, ok := step.(*signStep)
+		if !ok {
+			continue
+		}
+		for _, o := range sign.options {
+			switch o.Name() {
+			case optkeyNumericDatePrecision:
+				precision = o.Value().(time.Duration)
+			case optkeyCompactAudience:
+				compactAudience = o.Value().(bool)
+			}
+		}
+	}
+
+	payload, err := marshalToken(t, precision, compactAudience)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to marshal token`)
+	}
+
+	for i, step := range s.steps {
+		payload, err = step.serialize(payload, i > 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, `failed to serialize token (step #%d)`, i+1)
+		}
+	}
+	return payload, nil
+}
+
+func (s *signStep) serialize(payload []byte, nested bool) ([]byte, error) {
+	hdr := jws.NewHeaders()
+	if nested {
+		if err := hdr.Set(jws.ContentTypeKey, `JWT`); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, jws.ContentTypeKey)
+		}
+	} else {
+		if err := hdr.Set(jws.TypeKey, `JWT`); err != nil {
+			return nil, errors.Wrapf(err, `failed to set %s`, jws.TypeKey)
+		}
+	}
+
+	signed, err := jws.Sign(payload, s.alg, s.key, jws.WithHeaders(hdr))
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to sign payload`)
+	}
+	return signed, nil
+}
+
+func (s *encryptStep) serialize(payload []byte, nested bool) ([]byte, error) {
+	options := s.options
+	if nested {
+		options = append(append([]jwe.Option(nil), options...), jwe.WithContentType(`JWT`))
+	}
+
+	encrypted, err := jwe.Encrypt(payload, s.keyalg, s.key, s.contentalg, s.compressalg, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, `failed to encrypt payload`)
+	}
+	return encrypted, nil
+}
@@ -186,3 +186,130 @@ func TestToken(t *testing.T) {
 		return
 	}
 }
+
+func TestIntrospectionResponse(t *testing.T) {
+	tm := time.Unix(1600000000, 0)
+
+	tok := jwt.New()
+	for name, value := range map[string]interface{}{
+		jwt.AudienceKey:   []string{"resource-server"},
+		jwt.ExpirationKey: tm.Add(time.Hour),
+		jwt.IssuedAtKey:   tm,
+		jwt.NotBeforeKey:  tm,
+		jwt.IssuerKey:     "https://auth.example.com",
+		jwt.JwtIDKey:      "token-id",
+		jwt.SubjectKey:    "user-id",
+		"scope":           "read write",
+		"client_id":       "client-id",
+		"username":        "jdoe",
+		"active":          "bogus",
+	} {
+		if !assert.NoError(t, tok.Set(name, value), `tok.Set should succeed`) {
+			return
+		}
+	}
+
+	t.Run("Active", func(t *testing.T) {
+		res, err := tok.IntrospectionResponse(true)
+		if !assert.NoError(t, err, `tok.IntrospectionResponse should succeed`) {
+			return
+		}
+
+		expected := map[string]interface{}{
+			"active":    true,
+			"aud":       []string{"resource-server"},
+			"exp":       int64(1600003600),
+			"iat":       int64(1600000000),
+			"nbf":       int64(1600000000),
+			"iss":       "https://auth.example.com",
+			"jti":       "token-id",
+			"sub":       "user-id",
+			"scope":     "read write",
+			"client_id": "client-id",
+			"username":  "jdoe",
+		}
+		if !assert.Equal(t, expected, res, `introspection response should match`) {
+			return
+		}
+	})
+	t.Run("Inactive", func(t *testing.T) {
+		res, err := tok.IntrospectionResponse(false)
+		if !assert.NoError(t, err, `tok.IntrospectionResponse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, map[string]interface{}{"active": false}, res, `inactive response should only contain "active"`) {
+			return
+		}
+	})
+}
+
+func TestDecodeInto(t *testing.T) {
+	tm := time.Unix(1600000000, 0).UTC()
+
+	tok := jwt.New()
+	for name, value := range map[string]interface{}{
+		jwt.AudienceKey:   []string{"resource-server"},
+		jwt.ExpirationKey: tm.Add(time.Hour),
+		jwt.IssuedAtKey:   tm,
+		jwt.IssuerKey:     "https://auth.example.com",
+		jwt.SubjectKey:    "user-id",
+		"scope":           "read write",
+		"roles":           []string{"admin", "user"},
+	} {
+		if !assert.NoError(t, tok.Set(name, value), `tok.Set should succeed`) {
+			return
+		}
+	}
+
+	type Embedded struct {
+		IssuedAt time.Time `json:"iat"`
+	}
+	type Claims struct {
+		Embedded
+		Audience   []string  `json:"aud"`
+		Expiration int64     `json:"exp"`
+		NotBefore  time.Time `json:"nbf"`
+		Issuer     string    `json:"iss"`
+		Subject    string    `json:"sub"`
+		Scope      string    `json:"scope"`
+		Roles      []string  `json:"roles"`
+		Missing    string    `json:"missing"`
+	}
+
+	var claims Claims
+	if !assert.NoError(t, tok.DecodeInto(&claims), `tok.DecodeInto should succeed`) {
+		return
+	}
+
+	expected := Claims{
+		Embedded:   Embedded{IssuedAt: tm},
+		Audience:   []string{"resource-server"},
+		Expiration: tm.Add(time.Hour).Unix(),
+		Issuer:     "https://auth.example.com",
+		Subject:    "user-id",
+		Scope:      "read write",
+		Roles:      []string{"admin", "user"},
+	}
+	if !assert.True(t, claims.IssuedAt.Equal(tm), `iat should match`) {
+		return
+	}
+	claims.IssuedAt = tm
+	if !assert.Equal(t, expected, claims, `decoded claims should match`) {
+		return
+	}
+
+	t.Run("Map", func(t *testing.T) {
+		var m map[string]interface{}
+		if !assert.NoError(t, tok.DecodeInto(&m), `tok.DecodeInto should succeed`) {
+			return
+		}
+		if !assert.Equal(t, float64(tm.Unix()), m[jwt.IssuedAtKey], `iat should be numeric`) {
+			return
+		}
+	})
+	t.Run("Non-pointer", func(t *testing.T) {
+		if !assert.Error(t, tok.DecodeInto(claims), `tok.DecodeInto should fail`) {
+			return
+		}
+	})
+}
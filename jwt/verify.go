@@ -1,11 +1,13 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/lestrrat-go/jwx/internal/option"
+	"github.com/lestrrat-go/jwx/jwt/internal/types"
 )
 
 const (
@@ -17,6 +19,42 @@ const (
 	optkeyJwtid          = "jwtid"
 )
 
+// Options that Verify does not recognize are treated as claim values
+// (see WithClaimValue), so the options below are namespaced to keep them
+// from colliding with the names of claims
+const (
+	optkeyMaxAuthAge   = "jwt.verify.maxAuthAge"
+	optkeyJTIStore     = "jwt.verify.jtiStore"
+	optkeyRequireJwtID = "jwt.verify.requireJwtID"
+	optkeyContext      = "jwt.verify.context"
+
+	optkeyRequiredClaim = "jwt.verify.requiredClaim"
+
+	optkeyAnyIssuer        = "jwt.verify.anyIssuer"
+	optkeyIssuerNormalizer = "jwt.verify.issuerNormalizer"
+
+	optkeyClaimSkew = "jwt.verify.claimSkew"
+
+	optkeyFutureIssuedAtTolerance = "jwt.verify.futureIssuedAtTolerance"
+
+	optkeyCustomExpiration = "jwt.verify.customExpiration"
+	optkeyCustomNotBefore  = "jwt.verify.customNotBefore"
+)
+
+// AuthTimeKey is the name of the OpenID Connect "auth_time" claim,
+// which is checked when WithMaxAuthAge is specified
+const AuthTimeKey = "auth_time"
+
+// JTIStore keeps track of the "jti" claims of the tokens that have been
+// seen, for replay protection. See WithJTIStore
+type JTIStore interface {
+	// SeenBefore reports whether the given jti has been seen before,
+	// and records it as seen if it has not. `exp` is the expiration
+	// time of the token (which is the zero value if the token does not
+	// expire), and may be used to expire the records.
+	SeenBefore(ctx context.Context, jti string, exp time.Time) (bool, error)
+}
+
 type Clock interface {
 	Now() time.Time
 }
@@ -38,12 +76,51 @@ func WithAcceptableSkew(dur time.Duration) Option {
 	return option.New(optkeyAcceptableSkew, dur)
 }
 
+type claimSkew struct {
+	name string
+	skew time.Duration
+}
+
+// WithClaimSkew specifies the acceptable skew for the time claim `name`,
+// which is one of "exp", "iat", "nbf", and "auth_time", or a claim given
+// by WithCustomExpirationClaim or WithCustomNotBeforeClaim. It overrides the
+// skew given by WithAcceptableSkew for that claim only, regardless of the
+// order in which the options are given. For example, to tolerate issuers
+// whose clocks run ahead while still being strict about expiration:
+//
+//	jwt.Verify(t,
+//	  jwt.WithAcceptableSkew(5*time.Second),
+//	  jwt.WithClaimSkew(jwt.ExpirationKey, 0),
+//	)
+func WithClaimSkew(name string, dur time.Duration) Option {
+	return option.New(optkeyClaimSkew, &claimSkew{
+		name: name,
+		skew: dur,
+	})
+}
+
 // WithIssuer specifies that expected issuer value. If not specified,
 // the value of issuer is not verified at all.
 func WithIssuer(s string) Option {
 	return option.New(optkeyIssuer, s)
 }
 
+// WithAnyIssuer specifies the set of allowed issuers. Verification
+// passes if the "iss" claim matches any of them. Unlike WithIssuer,
+// tokens without the "iss" claim fail verification.
+//
+// Use WithIssuerNormalizer to normalize the values before comparison.
+func WithAnyIssuer(iss ...string) Option {
+	return option.New(optkeyAnyIssuer, iss)
+}
+
+// WithIssuerNormalizer specifies a function that is applied to both the
+// "iss" claim and the allowed issuers given in WithAnyIssuer before they
+// are compared, for example to strip trailing slashes or to fold case.
+func WithIssuerNormalizer(fn func(string) string) Option {
+	return option.New(optkeyIssuerNormalizer, fn)
+}
+
 // WithSubject specifies that expected subject value. If not specified,
 // the value of subject is not verified at all.
 func WithSubject(s string) Option {
@@ -64,22 +141,100 @@ func WithAudience(s string) Option {
 	return option.New(optkeyAudience, s)
 }
 
+// WithMaxAuthAge specifies the maximum amount of time that may have
+// passed since the end-user authenticated, as indicated by the
+// "auth_time" claim. The current time is taken from the `Clock`, and
+// the acceptable skew is honored. If specified, tokens without the
+// "auth_time" claim fail verification.
+func WithMaxAuthAge(d time.Duration) Option {
+	return option.New(optkeyMaxAuthAge, d)
+}
+
+// WithFutureIssuedAtTolerance loosens the check on the "iat" claim, by
+// allowing it to be up to `d` ahead of the current time in addition to
+// the acceptable skew. Tokens whose "iat" is further in the future still
+// fail verification, as they usually indicate a clock problem on the
+// issuer, or a forgery.
+//
+// Without this option, "iat" may only be ahead of the current time by
+// the acceptable skew.
+func WithFutureIssuedAtTolerance(d time.Duration) Option {
+	return option.New(optkeyFutureIssuedAtTolerance, d)
+}
+
+// WithJTIStore specifies the JTIStore that is consulted to make sure that
+// the "jti" claim has not been seen before. The store is only consulted
+// once all other checks have passed, so that tokens that fail verification
+// are not recorded.
+//
+// By default tokens without the "jti" claim are not checked against the
+// store. Use WithRequireJwtID to make them fail verification.
+func WithJTIStore(store JTIStore) Option {
+	return option.New(optkeyJTIStore, store)
+}
+
+// WithRequireJwtID specifies whether tokens without the "jti" claim
+// should fail verification when a JTIStore is specified via WithJTIStore.
+func WithRequireJwtID(b bool) Option {
+	return option.New(optkeyRequireJwtID, b)
+}
+
+// WithContext specifies the context.Context that is passed to external
+// components, such as the JTIStore, during verification.
+func WithContext(ctx context.Context) Option {
+	return option.New(optkeyContext, ctx)
+}
+
 // WithClaimValue specifies that expected any claim value.
 func WithClaimValue(name string, v interface{}) Option {
 	return option.New(name, v)
 }
 
+// WithRequiredClaim specifies that the claim `name` must be present in
+// the token, regardless of its value. Specify it multiple times to
+// require several claims. To also check the value, use WithClaimValue.
+func WithRequiredClaim(name string) Option {
+	return option.New(optkeyRequiredClaim, name)
+}
+
+// WithCustomExpirationClaim specifies that the claim `name` holds an
+// expiration time, which is checked like "exp" (including the skew) in
+// addition to "exp" itself. The value may be a numeric date, or a
+// string holding either a numeric date or a RFC3339 timestamp. Tokens
+// without the claim pass this check, as with "exp".
+func WithCustomExpirationClaim(name string) Option {
+	return option.New(optkeyCustomExpiration, name)
+}
+
+// WithCustomNotBeforeClaim specifies that the claim `name` holds a
+// not-before time, which is checked like "nbf". See
+// WithCustomExpirationClaim for the accepted values.
+func WithCustomNotBeforeClaim(name string) Option {
+	return option.New(optkeyCustomNotBefore, name)
+}
+
 // Verify makes sure that the essential claims stand.
 //
 // See the various `WithXXX` functions for optional parameters
 // that can control the behavior of this method.
 func Verify(t Token, options ...Option) error {
 	var issuer string
+	var anyIssuer []string
+	var normalizeIssuer func(string) string
 	var subject string
 	var audience string
 	var jwtid string
 	var clock Clock = ClockFunc(time.Now)
 	var skew time.Duration
+	claimSkews := make(map[string]time.Duration)
+	var maxAuthAge time.Duration
+	var futureIssuedAtTolerance time.Duration
+	var jtiStore JTIStore
+	var requireJwtID bool
+	ctx := context.Background()
+	var requiredClaims []string
+	var customExpiration []string
+	var customNotBefore []string
 	claimValues := make(map[string]interface{})
 	for _, o := range options {
 		switch o.Name() {
@@ -87,19 +242,51 @@ func Verify(t Token, options ...Option) error {
 			clock = o.Value().(Clock)
 		case optkeyAcceptableSkew:
 			skew = o.Value().(time.Duration)
+		case optkeyClaimSkew:
+			cs := o.Value().(*claimSkew)
+			claimSkews[cs.name] = cs.skew
 		case optkeyIssuer:
 			issuer = o.Value().(string)
+		case optkeyAnyIssuer:
+			anyIssuer = append(anyIssuer, o.Value().([]string)...)
+		case optkeyIssuerNormalizer:
+			normalizeIssuer = o.Value().(func(string) string)
 		case optkeySubject:
 			subject = o.Value().(string)
 		case optkeyAudience:
 			audience = o.Value().(string)
 		case optkeyJwtid:
 			jwtid = o.Value().(string)
+		case optkeyMaxAuthAge:
+			maxAuthAge = o.Value().(time.Duration)
+		case optkeyFutureIssuedAtTolerance:
+			futureIssuedAtTolerance = o.Value().(time.Duration)
+		case optkeyJTIStore:
+			jtiStore = o.Value().(JTIStore)
+		case optkeyRequireJwtID:
+			requireJwtID = o.Value().(bool)
+		case optkeyContext:
+			ctx = o.Value().(context.Context)
+		case optkeyRequiredClaim:
+			requiredClaims = append(requiredClaims, o.Value().(string))
+		case optkeyCustomExpiration:
+			customExpiration = append(customExpiration, o.Value().(string))
+		case optkeyCustomNotBefore:
+			customNotBefore = append(customNotBefore, o.Value().(string))
 		default:
 			claimValues[o.Name()] = o.Value()
 		}
 	}
 
+	// The skew for each time claim is the one given by WithClaimSkew if
+	// present, and the global one given by WithAcceptableSkew otherwise
+	skewFor := func(name string) time.Duration {
+		if v, ok := claimSkews[name]; ok {
+			return v
+		}
+		return skew
+	}
+
 	// check for iss
 	if len(issuer) > 0 {
 		if v := t.Issuer(); v != "" && v != issuer {
@@ -107,6 +294,12 @@ func Verify(t Token, options ...Option) error {
 		}
 	}
 
+	if len(anyIssuer) > 0 {
+		if !isAllowedIssuer(t.Issuer(), anyIssuer, normalizeIssuer) {
+			return errors.New(`iss not satisfied`)
+		}
+	}
+
 	// check for jti
 	if len(jwtid) > 0 {
 		if v := t.JwtID(); v != "" && v != jwtid {
@@ -139,7 +332,7 @@ func Verify(t Token, options ...Option) error {
 	if tv := t.Expiration(); !tv.IsZero() {
 		now := clock.Now().Truncate(time.Second)
 		ttv := tv.Truncate(time.Second)
-		if !now.Before(ttv.Add(skew)) {
+		if !now.Before(ttv.Add(skewFor(ExpirationKey))) {
 			return errors.New(`exp not satisfied`)
 		}
 	}
@@ -148,7 +341,7 @@ func Verify(t Token, options ...Option) error {
 	if tv := t.IssuedAt(); !tv.IsZero() {
 		now := clock.Now().Truncate(time.Second)
 		ttv := tv.Truncate(time.Second)
-		if now.Before(ttv.Add(-1 * skew)) {
+		if now.Before(ttv.Add(-1 * (skewFor(IssuedAtKey) + futureIssuedAtTolerance))) {
 			return errors.New(`iat not satisfied`)
 		}
 	}
@@ -158,16 +351,128 @@ func Verify(t Token, options ...Option) error {
 		now := clock.Now().Truncate(time.Second)
 		ttv := tv.Truncate(time.Second)
 		// now cannot be before t, so we check for now > t - skew
-		if !now.After(ttv.Add(-1 * skew)) {
+		if !now.After(ttv.Add(-1 * skewFor(NotBeforeKey))) {
 			return errors.New(`nbf not satisfied`)
 		}
 	}
 
+	// check for custom time claims, in the same way as exp and nbf
+	for _, name := range customExpiration {
+		tv, err := timeClaim(t, name)
+		if err != nil {
+			return fmt.Errorf(`%s not satisfied: %s`, name, err)
+		}
+		if !tv.IsZero() {
+			now := clock.Now().Truncate(time.Second)
+			ttv := tv.Truncate(time.Second)
+			if !now.Before(ttv.Add(skewFor(name))) {
+				return fmt.Errorf(`%s not satisfied`, name)
+			}
+		}
+	}
+	for _, name := range customNotBefore {
+		tv, err := timeClaim(t, name)
+		if err != nil {
+			return fmt.Errorf(`%s not satisfied: %s`, name, err)
+		}
+		if !tv.IsZero() {
+			now := clock.Now().Truncate(time.Second)
+			ttv := tv.Truncate(time.Second)
+			if !now.After(ttv.Add(-1 * skewFor(name))) {
+				return fmt.Errorf(`%s not satisfied`, name)
+			}
+		}
+	}
+
+	// check for auth_time
+	if maxAuthAge > 0 {
+		v, ok := t.Get(AuthTimeKey)
+		if !ok {
+			return errors.New(`auth_time not satisfied`)
+		}
+
+		var authTime types.NumericDate
+		if err := authTime.Accept(v); err != nil {
+			return fmt.Errorf(`auth_time not satisfied: %s`, err)
+		}
+
+		now := clock.Now().Truncate(time.Second)
+		ttv := authTime.Get().Truncate(time.Second)
+		if now.Sub(ttv) > maxAuthAge+skewFor(AuthTimeKey) {
+			return errors.New(`auth_time not satisfied`)
+		}
+	}
+
+	for _, name := range requiredClaims {
+		if _, ok := t.Get(name); !ok {
+			return fmt.Errorf(`%v not satisfied: claim is missing`, name)
+		}
+	}
+
 	for name, expectedValue := range claimValues {
-		if v, ok := t.Get(name); !ok || v != expectedValue {
-			return fmt.Errorf(`%v not satisfied`, name)
+		v, ok := t.Get(name)
+		if !ok {
+			return fmt.Errorf(`%v not satisfied: claim is missing`, name)
+		}
+		if v != expectedValue {
+			return fmt.Errorf(`%v not satisfied: values do not match`, name)
+		}
+	}
+
+	// check for jti reuse
+	if jtiStore != nil {
+		if v := t.JwtID(); v != "" {
+			seen, err := jtiStore.SeenBefore(ctx, v, t.Expiration())
+			if err != nil {
+				return fmt.Errorf(`failed to check jti: %s`, err)
+			}
+			if seen {
+				return errors.New(`jti has been seen before`)
+			}
+		} else if requireJwtID {
+			return errors.New(`jti not satisfied`)
 		}
 	}
 
 	return nil
 }
+
+// timeClaim returns the value of the claim `name` as a time. The zero
+// value is returned if the claim does not exist
+func timeClaim(t Token, name string) (time.Time, error) {
+	v, ok := t.Get(name)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	if s, ok := v.(string); ok {
+		if tv, err := time.Parse(time.RFC3339, s); err == nil {
+			return tv, nil
+		}
+	}
+
+	var nd types.NumericDate
+	if err := nd.Accept(v); err != nil {
+		return time.Time{}, err
+	}
+	return nd.Get(), nil
+}
+
+func isAllowedIssuer(iss string, allowed []string, normalize func(string) string) bool {
+	if iss == "" {
+		return false
+	}
+
+	if normalize != nil {
+		iss = normalize(iss)
+	}
+	for _, v := range allowed {
+		if normalize != nil {
+			v = normalize(v)
+		}
+		if v == iss {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,13 @@
 package jwt_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -150,4 +157,374 @@ func TestGHIssue10(t *testing.T) {
 			return
 		}
 	})
+	t.Run("required claim", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set("tenant_id", "")
+		t1.Set("email", "email@example.com")
+
+		// The value does not matter, as long as the claim exists
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithRequiredClaim("tenant_id")), "t1.Verify should succeed") {
+			return
+		}
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithRequiredClaim("tenant_id"), jwt.WithRequiredClaim("email")), "t1.Verify should succeed") {
+			return
+		}
+
+		err := jwt.Verify(t1, jwt.WithRequiredClaim("tenant_id"), jwt.WithRequiredClaim("role"))
+		if !assert.Error(t, err, "t1.Verify should fail") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "role", "error should mention the claim") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "missing", "error should say that the claim is missing") {
+			return
+		}
+
+		// Combined with WithClaimValue, missing and mismatched claims
+		// are reported differently
+		err = jwt.Verify(t1, jwt.WithRequiredClaim("email"), jwt.WithClaimValue("email", "other@example.com"))
+		if !assert.Error(t, err, "t1.Verify should fail") {
+			return
+		}
+		if !assert.Contains(t, err.Error(), "do not match", "error should say that the values do not match") {
+			return
+		}
+	})
+}
+
+func TestVerifyMaxAuthAge(t *testing.T) {
+	now := time.Now()
+	clock := jwt.ClockFunc(func() time.Time { return now })
+
+	t.Run("fresh auth_time", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.AuthTimeKey, now.Add(-5*time.Minute).Unix())
+
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithMaxAuthAge(10*time.Minute)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("stale auth_time", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.AuthTimeKey, now.Add(-15*time.Minute).Unix())
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithMaxAuthAge(10*time.Minute)), "token.Verify should fail") {
+			return
+		}
+
+		// With enough skew, this should succeed
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithMaxAuthAge(10*time.Minute), jwt.WithAcceptableSkew(5*time.Minute)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("missing auth_time", func(t *testing.T) {
+		t1 := jwt.New()
+
+		// This should succeed, because WithMaxAuthAge is not provided
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock)), "token.Verify should succeed") {
+			return
+		}
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithMaxAuthAge(10*time.Minute)), "token.Verify should fail") {
+			return
+		}
+	})
+	t.Run("parsed auth_time", func(t *testing.T) {
+		src := fmt.Sprintf(`{"auth_time":%d}`, now.Add(-5*time.Minute).Unix())
+		t1 := jwt.New()
+		if !assert.NoError(t, json.Unmarshal([]byte(src), t1), "json.Unmarshal should succeed") {
+			return
+		}
+
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithMaxAuthAge(10*time.Minute)), "token.Verify should succeed") {
+			return
+		}
+	})
+}
+
+type memoryJTIStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func (s *memoryJTIStore) SeenBefore(_ context.Context, jti string, exp time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[jti]; ok {
+		return true, nil
+	}
+	s.seen[jti] = exp
+	return false, nil
+}
+
+type failingJTIStore struct{}
+
+func (failingJTIStore) SeenBefore(context.Context, string, time.Time) (bool, error) {
+	return false, errors.New(`store unavailable`)
+}
+
+func TestVerifyJTIStore(t *testing.T) {
+	t.Run("Reuse is rejected", func(t *testing.T) {
+		store := &memoryJTIStore{seen: make(map[string]time.Time)}
+		exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		t1 := jwt.New()
+		t1.Set(jwt.JwtIDKey, "token-1")
+		t1.Set(jwt.ExpirationKey, exp)
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithJTIStore(store)), `first use should succeed`) {
+			return
+		}
+		if !assert.True(t, exp.Equal(store.seen["token-1"]), `exp should be passed to the store`) {
+			return
+		}
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithJTIStore(store)), `second use should fail`) {
+			return
+		}
+
+		t2 := jwt.New()
+		t2.Set(jwt.JwtIDKey, "token-2")
+		if !assert.NoError(t, jwt.Verify(t2, jwt.WithJTIStore(store)), `different jti should succeed`) {
+			return
+		}
+	})
+	t.Run("Tokens failing other checks are not recorded", func(t *testing.T) {
+		store := &memoryJTIStore{seen: make(map[string]time.Time)}
+
+		t1 := jwt.New()
+		t1.Set(jwt.JwtIDKey, "token-1")
+		t1.Set(jwt.IssuerKey, "bob")
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithJTIStore(store), jwt.WithIssuer("alice")), `jwt.Verify should fail`) {
+			return
+		}
+		if !assert.Empty(t, store.seen, `store should be empty`) {
+			return
+		}
+	})
+	t.Run("Absent jti", func(t *testing.T) {
+		store := &memoryJTIStore{seen: make(map[string]time.Time)}
+
+		t1 := jwt.New()
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithJTIStore(store)), `absent jti should pass by default`) {
+			return
+		}
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithJTIStore(store), jwt.WithRequireJwtID(true)), `absent jti should fail when required`) {
+			return
+		}
+	})
+	t.Run("Store error", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.JwtIDKey, "token-1")
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithJTIStore(failingJTIStore{})), `jwt.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestVerifyAnyIssuer(t *testing.T) {
+	allowed := []string{"https://issuer-a.example.com", "https://issuer-b.example.com"}
+
+	newToken := func(iss string) jwt.Token {
+		tok := jwt.New()
+		if iss != "" {
+			tok.Set(jwt.IssuerKey, iss)
+		}
+		return tok
+	}
+
+	t.Run("Allowed issuers", func(t *testing.T) {
+		for _, iss := range allowed {
+			if !assert.NoError(t, jwt.Verify(newToken(iss), jwt.WithAnyIssuer(allowed...)), `jwt.Verify should succeed for %s`, iss) {
+				return
+			}
+		}
+	})
+	t.Run("Disallowed issuer", func(t *testing.T) {
+		if !assert.Error(t, jwt.Verify(newToken("https://evil.example.com"), jwt.WithAnyIssuer(allowed...)), `jwt.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Missing issuer", func(t *testing.T) {
+		if !assert.Error(t, jwt.Verify(newToken(""), jwt.WithAnyIssuer(allowed...)), `jwt.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Normalization", func(t *testing.T) {
+		tok := newToken("HTTPS://Issuer-A.example.com/")
+		if !assert.Error(t, jwt.Verify(tok, jwt.WithAnyIssuer(allowed...)), `jwt.Verify without normalization should fail`) {
+			return
+		}
+
+		normalize := func(s string) string {
+			return strings.ToLower(strings.TrimSuffix(s, "/"))
+		}
+		if !assert.NoError(t, jwt.Verify(tok, jwt.WithAnyIssuer(allowed...), jwt.WithIssuerNormalizer(normalize)), `jwt.Verify with normalization should succeed`) {
+			return
+		}
+	})
+}
+
+func TestVerifyFutureIssuedAtTolerance(t *testing.T) {
+	now := time.Now()
+	clock := jwt.ClockFunc(func() time.Time { return now })
+
+	t.Run("acceptable future iat", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.IssuedAtKey, now.Add(30*time.Second))
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock)), "token.Verify should fail without tolerance") {
+			return
+		}
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithFutureIssuedAtTolerance(time.Minute)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("excessive future iat", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.IssuedAtKey, now.Add(time.Hour))
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithFutureIssuedAtTolerance(time.Minute)), "token.Verify should fail") {
+			return
+		}
+
+		// The acceptable skew is added on top of the tolerance
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithFutureIssuedAtTolerance(time.Minute), jwt.WithAcceptableSkew(time.Hour)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("past iat", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.IssuedAtKey, now.Add(-time.Hour))
+
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithFutureIssuedAtTolerance(time.Minute)), "token.Verify should succeed") {
+			return
+		}
+	})
+}
+
+func TestVerifyClaimSkew(t *testing.T) {
+	now := time.Now()
+	clock := jwt.ClockFunc(func() time.Time { return now })
+
+	t1 := jwt.New()
+	t1.Set(jwt.IssuedAtKey, now.Add(5*time.Second))
+	t1.Set(jwt.ExpirationKey, now.Add(-5*time.Second))
+
+	t.Run("global skew", func(t *testing.T) {
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithAcceptableSkew(10*time.Second)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("per-claim skew overrides global skew", func(t *testing.T) {
+		// regardless of the order of the options
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithClaimSkew(jwt.ExpirationKey, 0), jwt.WithAcceptableSkew(10*time.Second)), "token.Verify should fail") {
+			return
+		}
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithAcceptableSkew(10*time.Second), jwt.WithClaimSkew(jwt.ExpirationKey, 0)), "token.Verify should fail") {
+			return
+		}
+	})
+	t.Run("per-claim skew only", func(t *testing.T) {
+		t2 := jwt.New()
+		t2.Set(jwt.IssuedAtKey, now.Add(5*time.Second))
+		t2.Set(jwt.NotBeforeKey, now.Add(5*time.Second))
+
+		if !assert.Error(t, jwt.Verify(t2, jwt.WithClock(clock), jwt.WithClaimSkew(jwt.IssuedAtKey, 10*time.Second)), "token.Verify should fail on nbf") {
+			return
+		}
+		if !assert.NoError(t, jwt.Verify(t2, jwt.WithClock(clock), jwt.WithClaimSkew(jwt.IssuedAtKey, 10*time.Second), jwt.WithClaimSkew(jwt.NotBeforeKey, 10*time.Second)), "token.Verify should succeed") {
+			return
+		}
+	})
+}
+
+func TestVerifyCustomTimeClaims(t *testing.T) {
+	now := time.Now()
+	clock := jwt.ClockFunc(func() time.Time { return now })
+
+	t.Run("custom expiration claim", func(t *testing.T) {
+		past := now.Add(-5 * time.Second)
+		values := map[string]interface{}{
+			"numeric": past.Unix(),
+			"epoch":   strconv.FormatInt(past.Unix(), 10),
+			"RFC3339": past.Format(time.RFC3339),
+		}
+		for name, value := range values {
+			value := value
+			t.Run(name, func(t *testing.T) {
+				t1 := jwt.New()
+				t1.Set("valid_until", value)
+
+				err := jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until"))
+				if !assert.Error(t, err, "token.Verify should fail") {
+					return
+				}
+				if !assert.Contains(t, err.Error(), "valid_until", "error should mention the claim") {
+					return
+				}
+				if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until"), jwt.WithAcceptableSkew(10*time.Second)), "token.Verify should succeed") {
+					return
+				}
+				if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until"), jwt.WithClaimSkew("valid_until", 10*time.Second)), "token.Verify should succeed") {
+					return
+				}
+				// without the option the claim is just a claim
+				if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock)), "token.Verify should succeed") {
+					return
+				}
+			})
+		}
+	})
+	t.Run("custom not before claim", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set("valid_from", now.Add(5*time.Second).Unix())
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomNotBeforeClaim("valid_from")), "token.Verify should fail") {
+			return
+		}
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomNotBeforeClaim("valid_from"), jwt.WithAcceptableSkew(10*time.Second)), "token.Verify should succeed") {
+			return
+		}
+	})
+	t.Run("standard claims are still checked", func(t *testing.T) {
+		t1 := jwt.New()
+		t1.Set(jwt.ExpirationKey, now.Add(-5*time.Second))
+		t1.Set("valid_until", now.Add(time.Hour).Unix())
+
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until")), "token.Verify should fail on exp") {
+			return
+		}
+	})
+	t.Run("missing or invalid claims", func(t *testing.T) {
+		t1 := jwt.New()
+		if !assert.NoError(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until")), "token.Verify should succeed") {
+			return
+		}
+
+		t1.Set("valid_until", "tomorrow")
+		if !assert.Error(t, jwt.Verify(t1, jwt.WithClock(clock), jwt.WithCustomExpirationClaim("valid_until")), "token.Verify should fail") {
+			return
+		}
+	})
+}
+
+func TestVerifyClaimValueOptionNames(t *testing.T) {
+	// claims that happen to share their names with options must be
+	// treated as claims
+	names := []string{"context", "jtiStore", "requireJwtID", "maxAuthAge", "requiredClaim", "customExpiration", "customNotBefore", "anyIssuer", "issuerNormalizer", "claimSkew", "futureIssuedAtTolerance"}
+	for _, name := range names {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t1 := jwt.New()
+			if !assert.NoError(t, t1.Set(name, "value"), `t1.Set should succeed`) {
+				return
+			}
+			if !assert.NoError(t, jwt.Verify(t1, jwt.WithClaimValue(name, "value")), `jwt.Verify should succeed`) {
+				return
+			}
+			if !assert.Error(t, jwt.Verify(t1, jwt.WithClaimValue(name, 1)), `jwt.Verify should fail`) {
+				return
+			}
+		})
+	}
 }